@@ -76,11 +76,14 @@ func daemonAction(cmd *cobra.Command, _ []string) error {
 	} else if vSockPort != 0 {
 		vsockL, err := vsock.Listen(uint32(vSockPort), nil)
 		if err != nil {
-			return err
+			// e.g., the vsock device is missing; the host agent falls back to the socket forwarded over ssh
+			logrus.WithError(err).Warnf("failed to listen on vsock port %d, falling back to %q", vSockPort, socket)
+		} else {
+			l = vsockL
+			logrus.Infof("serving the guest agent on vsock port: %d", vSockPort)
 		}
-		l = vsockL
-		logrus.Infof("serving the guest agent on vsock port: %d", vSockPort)
-	} else {
+	}
+	if l == nil {
 		socketL, err := net.Listen("unix", socket)
 		if err != nil {
 			return err
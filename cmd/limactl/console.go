@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+
+	"github.com/lima-vm/lima/pkg/console"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newConsoleCommand() *cobra.Command {
+	consoleCommand := &cobra.Command{
+		Use:   "console INSTANCE",
+		Short: "Attach to the serial console of an instance",
+		Long: `Attach to the serial console of an instance.
+Useful for debugging early-boot failures.
+
+Type "` + console.EscapeSequence + `" at the beginning of a line to detach.`,
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              consoleAction,
+		ValidArgsFunction: consoleBashComplete,
+		GroupID:           advancedCommand,
+	}
+	return consoleCommand
+}
+
+func consoleAction(cmd *cobra.Command, args []string) error {
+	instName := DefaultInstanceName
+	if len(args) > 0 {
+		instName = args[0]
+	}
+
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	if err := console.Attach(cmd.Context(), inst, os.Stdin, cmd.OutOrStdout()); err != nil {
+		return err
+	}
+	logrus.Infof("Detached from the console of %q", instName)
+	return nil
+}
+
+func consoleBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
@@ -5,10 +5,11 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 
-	"github.com/coreos/go-semver/semver"
-	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/alessio/shellescape"
+	"github.com/lima-vm/lima/pkg/copyutil"
 	"github.com/lima-vm/lima/pkg/sshutil"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/sirupsen/logrus"
@@ -19,116 +20,405 @@ const copyHelp = `Copy files between host and guest
 
 Prefix guest filenames with the instance name and a colon.
 
-Example: limactl copy default:/etc/os-release .
+Directories require --recursive. As with rsync, a trailing slash on a source directory
+copies the contents of the directory, instead of the directory itself.
+
+Symlinks are copied as symlinks, unless --follow-symlinks is specified.
+
+The files are copied with rsync when it is installed on both the host and the guest,
+so that only the differences are transferred on repeated copies.
+Otherwise the files are copied with SFTP; files copied between two instances are
+streamed through the host, without temporary files.
 `
 
+const (
+	copyMethodAuto  = "auto"
+	copyMethodRsync = "rsync"
+	copyMethodSFTP  = "sftp"
+)
+
+// execCommand and lookPath are replaced in the tests.
+var (
+	execCommand = exec.Command
+	lookPath    = exec.LookPath
+)
+
 func newCopyCommand() *cobra.Command {
 	copyCommand := &cobra.Command{
 		Use:     "copy SOURCE ... TARGET",
 		Aliases: []string{"cp"},
 		Short:   "Copy files between host and guest",
 		Long:    copyHelp,
+		Example: `  To copy a file from the guest:
+  $ limactl copy default:/etc/os-release .
+
+  To copy a directory to the guest, as "/tmp/dir":
+  $ limactl copy -r ./dir default:/tmp/
+
+  To copy the contents of a directory to the guest, into "/tmp/dir":
+  $ limactl copy -r ./dir/ default:/tmp/dir
+
+  To synchronize a build tree into the guest, transferring only the differences:
+  $ limactl copy -r --method=rsync --delete --exclude=.git ./src/ default:/tmp/src
+
+  To copy a directory from an instance to another:
+  $ limactl copy -r --progress foo:/home/foo.linux/src bar:/tmp/`,
 		Args:    WrapArgsError(cobra.MinimumNArgs(2)),
 		RunE:    copyAction,
 		GroupID: advancedCommand,
 	}
 
-	copyCommand.Flags().BoolP("recursive", "r", false, "copy directories recursively")
+	flags := copyCommand.Flags()
+	flags.BoolP("recursive", "r", false, "copy directories recursively")
+	flags.Bool("follow-symlinks", false, "copy the targets of symlinks, instead of the symlinks themselves")
+	flags.Bool("progress", false, "show the progress of each file, and the total")
+	flags.String("method", copyMethodAuto, "copy method (auto, rsync, sftp); auto uses rsync when it is installed on both the host and the guest")
+	_ = copyCommand.RegisterFlagCompletionFunc("method", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return []string{copyMethodAuto, copyMethodRsync, copyMethodSFTP}, cobra.ShellCompDirectiveNoFileComp
+	})
+	flags.Bool("delete", false, "delete the files in the target that do not exist in the source (rsync only)")
+	flags.StringArray("exclude", nil, "exclude the files matching the `PATTERN` (rsync only, can be specified multiple times)")
 
 	return copyCommand
 }
 
+// copyPath is a path on the host, or on the instance when inst is not nil.
+type copyPath struct {
+	inst *store.Instance
+	path string
+}
+
+func (p copyPath) String() string {
+	if p.inst == nil {
+		return p.path
+	}
+	return p.inst.Name + ":" + p.path
+}
+
+// rsyncOptions is the set of the flags of `limactl copy` that are translated to the flags of rsync.
+type rsyncOptions struct {
+	recursive      bool
+	followSymlinks bool
+	progress       bool
+	verbose        bool
+	delete         bool
+	excludes       []string
+}
+
 func copyAction(cmd *cobra.Command, args []string) error {
-	recursive, err := cmd.Flags().GetBool("recursive")
-	if err != nil {
+	flags := cmd.Flags()
+	var ropts rsyncOptions
+	var err error
+	if ropts.recursive, err = flags.GetBool("recursive"); err != nil {
 		return err
 	}
-
-	arg0, err := exec.LookPath("scp")
-	if err != nil {
+	if ropts.followSymlinks, err = flags.GetBool("follow-symlinks"); err != nil {
 		return err
 	}
-	u, err := osutil.LimaUser(false)
-	if err != nil {
+	if ropts.progress, err = flags.GetBool("progress"); err != nil {
 		return err
 	}
-	instDirs := make(map[string]string)
-	scpFlags := []string{}
-	scpArgs := []string{}
-	debug, err := cmd.Flags().GetBool("debug")
-	if err != nil {
+	if ropts.verbose, err = flags.GetBool("debug"); err != nil {
 		return err
 	}
-	if debug {
-		scpFlags = append(scpFlags, "-v")
+	if ropts.delete, err = flags.GetBool("delete"); err != nil {
+		return err
+	}
+	if ropts.excludes, err = flags.GetStringArray("exclude"); err != nil {
+		return err
 	}
-	if recursive {
-		scpFlags = append(scpFlags, "-r")
+	method, err := flags.GetString("method")
+	if err != nil {
+		return err
+	}
+	rsyncOnly := ropts.delete || len(ropts.excludes) > 0
+	switch method {
+	case copyMethodAuto, copyMethodRsync:
+	case copyMethodSFTP:
+		if rsyncOnly {
+			return errors.New("`--delete` and `--exclude` require `--method=rsync`")
+		}
+	default:
+		return fmt.Errorf("unknown copy method %q (expected %q, %q, or %q)", method, copyMethodAuto, copyMethodRsync, copyMethodSFTP)
 	}
-	legacySSH := false
-	if sshutil.DetectOpenSSHVersion().LessThan(*semver.New("8.0.0")) {
-		legacySSH = true
+
+	sshExe, err := exec.LookPath("ssh")
+	if err != nil {
+		return err
 	}
+	instances := make(map[string]*store.Instance)
+	var paths []copyPath
 	for _, arg := range args {
 		path := strings.Split(arg, ":")
 		switch len(path) {
 		case 1:
-			scpArgs = append(scpArgs, arg)
+			paths = append(paths, copyPath{path: arg})
 		case 2:
 			instName := path[0]
-			inst, err := store.Inspect(instName)
-			if err != nil {
-				if errors.Is(err, os.ErrNotExist) {
-					return fmt.Errorf("instance %q does not exist, run `limactl create %s` to create a new instance", instName, instName)
+			inst, ok := instances[instName]
+			if !ok {
+				inst, err = inspectCopyInstance(instName)
+				if err != nil {
+					return err
 				}
-				return err
+				instances[instName] = inst
 			}
-			if inst.Status == store.StatusStopped {
-				return fmt.Errorf("instance %q is stopped, run `limactl start %s` to start the instance", instName, instName)
-			}
-			if legacySSH {
-				scpFlags = append(scpFlags, "-P", fmt.Sprintf("%d", inst.SSHLocalPort))
-				scpArgs = append(scpArgs, fmt.Sprintf("%s@127.0.0.1:%s", u.Username, path[1]))
-			} else {
-				scpArgs = append(scpArgs, fmt.Sprintf("scp://%s@127.0.0.1:%d/%s", u.Username, inst.SSHLocalPort, path[1]))
-			}
-			instDirs[instName] = inst.Dir
+			paths = append(paths, copyPath{inst: inst, path: path[1]})
 		default:
 			return fmt.Errorf("path %q contains multiple colons", arg)
 		}
 	}
-	if legacySSH && len(instDirs) > 1 {
-		return fmt.Errorf("More than one (instance) host is involved in this command, this is only supported for openSSH v8.0 or higher")
+
+	if method == copyMethodAuto {
+		method = copyMethodSFTP
+		if err := checkRsync(sshExe, instances, ropts.verbose); err == nil {
+			method = copyMethodRsync
+		} else if rsyncOnly {
+			return fmt.Errorf("`--delete` and `--exclude` require rsync: %w", err)
+		} else {
+			logrus.WithError(err).Debug("copying with SFTP, as rsync is not available")
+		}
+	} else if method == copyMethodRsync {
+		if err := checkRsync(sshExe, instances, ropts.verbose); err != nil {
+			return err
+		}
 	}
-	scpFlags = append(scpFlags, "-3", "--")
-	scpArgs = append(scpFlags, scpArgs...)
 
-	var sshOpts []string
-	if len(instDirs) == 1 {
-		// Only one (instance) host is involved; we can use the instance-specific
-		// arguments such as ControlPath.  This is preferred as we can multiplex
-		// sessions without re-authenticating (MaxSessions permitting).
-		for _, instDir := range instDirs {
-			sshOpts, err = sshutil.SSHOpts(instDir, false, false, false, false)
-			if err != nil {
+	if method == copyMethodRsync {
+		if !ropts.recursive {
+			if err := checkNoDirectorySources(sshExe, paths[:len(paths)-1], ropts); err != nil {
 				return err
 			}
 		}
-	} else {
-		// Copying among multiple hosts; we can't pass in host-specific options.
-		sshOpts, err = sshutil.CommonOpts(false)
+		rsyncCmd, err := rsyncCommand(sshExe, paths, ropts)
+		if err != nil {
+			return err
+		}
+		rsyncCmd.Stdin = cmd.InOrStdin()
+		rsyncCmd.Stdout = cmd.OutOrStdout()
+		rsyncCmd.Stderr = cmd.ErrOrStderr()
+		logrus.Debugf("executing rsync (may take a long time): %+v", rsyncCmd.Args)
+		return rsyncCmd.Run()
+	}
+	return copyWithSFTP(cmd, sshExe, paths, ropts)
+}
+
+func copyWithSFTP(cmd *cobra.Command, sshExe string, paths []copyPath, ropts rsyncOptions) error {
+	opts := copyutil.Options{
+		Recursive:      ropts.recursive,
+		FollowSymlinks: ropts.followSymlinks,
+	}
+	if ropts.progress {
+		opts.Progress = cmd.ErrOrStderr()
+	}
+	sessions := make(sftpSessions)
+	defer sessions.close()
+	var locations []copyutil.Location
+	for i, p := range paths {
+		// The target is never expanded.
+		locs, err := sessions.locations(sshExe, p, ropts.verbose, i < len(paths)-1)
+		if err != nil {
+			return err
+		}
+		locations = append(locations, locs...)
+	}
+
+	srcs, dst := locations[:len(locations)-1], locations[len(locations)-1]
+	stats, err := copyutil.Copy(cmd.Context(), srcs, dst, opts)
+	if err != nil {
+		return err
+	}
+	if ropts.progress {
+		fmt.Fprintln(cmd.ErrOrStderr(), stats.String())
+	}
+	return nil
+}
+
+// checkNoDirectorySources returns an error if a source is a directory, as the SFTP method does without --recursive.
+// Otherwise rsync would just skip the directory and exit with status 0.
+func checkNoDirectorySources(sshExe string, srcs []copyPath, ropts rsyncOptions) error {
+	sessions := make(sftpSessions)
+	defer sessions.close()
+	for _, p := range srcs {
+		locs, err := sessions.locations(sshExe, p, ropts.verbose, true)
 		if err != nil {
 			return err
 		}
+		for _, loc := range locs {
+			stat := loc.FS.Lstat
+			if ropts.followSymlinks {
+				stat = loc.FS.Stat
+			}
+			// the other errors are reported by rsync
+			if st, err := stat(loc.Path); err == nil && st.IsDir() {
+				return fmt.Errorf("%s is a directory (specify --recursive)", loc)
+			}
+		}
+	}
+	return nil
+}
+
+// sftpSessions is the set of the SFTP sessions, keyed by the instance names.
+type sftpSessions map[string]*copyutil.SFTPFS
+
+// locations returns the locations of p, opening the SFTP session of the instance if needed.
+// Globs in the guest filenames are expanded when expandGlobs is true, as no shell is involved.
+func (s sftpSessions) locations(sshExe string, p copyPath, verbose, expandGlobs bool) ([]copyutil.Location, error) {
+	if p.inst == nil {
+		return []copyutil.Location{{FS: copyutil.LocalFS{}, Path: p.path}}, nil
+	}
+	sftpFS, ok := s[p.inst.Name]
+	if !ok {
+		sshArgs, err := instanceSSHArgs(p.inst, verbose)
+		if err != nil {
+			return nil, err
+		}
+		sftpFS, err = copyutil.DialSFTP(sshExe, append(sshArgs, p.inst.SSHAddress))
+		if err != nil {
+			return nil, err
+		}
+		s[p.inst.Name] = sftpFS
+	}
+	prefix := p.inst.Name + ":"
+	if !expandGlobs || !strings.ContainsAny(p.path, "*?[") {
+		return []copyutil.Location{{FS: sftpFS, Path: p.path, Prefix: prefix}}, nil
+	}
+	matches, err := sftpFS.Glob(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand %q: %w", p, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no such file: %q", p)
+	}
+	var res []copyutil.Location
+	for _, m := range matches {
+		res = append(res, copyutil.Location{FS: sftpFS, Path: m, Prefix: prefix})
+	}
+	return res, nil
+}
+
+func (s sftpSessions) close() {
+	for instName, sftpFS := range s {
+		if err := sftpFS.Close(); err != nil {
+			logrus.WithError(err).Debugf("failed to close the SFTP session of %q", instName)
+		}
+	}
+}
+
+func inspectCopyInstance(instName string) (*store.Instance, error) {
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("instance %q does not exist, run `limactl create %s` to create a new instance", instName, instName)
+		}
+		return nil, err
+	}
+	if inst.Status == store.StatusStopped {
+		return nil, fmt.Errorf("instance %q is stopped, run `limactl start %s` to start the instance", instName, instName)
+	}
+	if inst.Status == store.StatusPaused {
+		return nil, fmt.Errorf("instance %q is paused, run `limactl resume %s` to resume the instance", instName, instName)
+	}
+	if inst.Config == nil {
+		return nil, fmt.Errorf("instance %q is broken: %w", instName, errors.Join(inst.Errors...))
+	}
+	return inst, nil
+}
+
+// instanceSSHArgs returns the arguments of ssh for the instance, except the destination host.
+// The arguments use the ControlPath of the instance, as `limactl show-ssh` does.
+func instanceSSHArgs(inst *store.Instance, verbose bool) ([]string, error) {
+	sshOpts, err := sshutil.SSHOpts(inst.Dir, *inst.Config.SSH.GenerateDedicatedKey, false, false, false, false, sshutil.ConnectionOpts{
+		ControlPersist:      *inst.Config.SSH.ControlPersist,
+		ServerAliveInterval: *inst.Config.SSH.ServerAliveInterval,
+		ServerAliveCountMax: *inst.Config.SSH.ServerAliveCountMax,
+	})
+	if err != nil {
+		return nil, err
 	}
 	sshArgs := sshutil.SSHArgsFromOpts(sshOpts)
+	if verbose {
+		sshArgs = append(sshArgs, "-v")
+	}
+	return append(sshArgs, "-p", strconv.Itoa(inst.SSHLocalPort)), nil
+}
 
-	sshCmd := exec.Command(arg0, append(sshArgs, scpArgs...)...)
-	sshCmd.Stdin = cmd.InOrStdin()
-	sshCmd.Stdout = cmd.OutOrStdout()
-	sshCmd.Stderr = cmd.ErrOrStderr()
-	logrus.Debugf("executing scp (may take a long time)): %+v", sshCmd.Args)
+// checkRsync returns an error if rsync cannot be used for copying files with the instances.
+func checkRsync(sshExe string, instances map[string]*store.Instance, verbose bool) error {
+	if len(instances) > 1 {
+		return errors.New("rsync cannot copy files between two instances")
+	}
+	if _, err := lookPath("rsync"); err != nil {
+		return fmt.Errorf("rsync is not installed on the host: %w", err)
+	}
+	for _, inst := range instances {
+		sshArgs, err := instanceSSHArgs(inst, verbose)
+		if err != nil {
+			return err
+		}
+		sshArgs = append(sshArgs, "-q", inst.SSHAddress, "--", "command -v rsync")
+		sshCmd := execCommand(sshExe, sshArgs...)
+		logrus.Debugf("executing ssh for detecting rsync in the guest: %+v", sshCmd.Args)
+		if err := sshCmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			// ssh exits with 255 on its own errors
+			if errors.As(err, &exitErr) && exitErr.ExitCode() != 255 {
+				return fmt.Errorf("rsync is not installed in instance %q, install the \"rsync\" package in the guest "+
+					"(e.g., `limactl shell %s sudo apt-get install -y rsync`)", inst.Name, inst.Name)
+			}
+			return fmt.Errorf("failed to detect rsync in instance %q: %w", inst.Name, err)
+		}
+	}
+	return nil
+}
 
-	// TODO: use syscall.Exec directly (results in losing tty?)
-	return sshCmd.Run()
+// rsyncCommand returns the rsync command for copying the files.
+// At most one instance can be involved.
+func rsyncCommand(sshExe string, paths []copyPath, opts rsyncOptions) (*exec.Cmd, error) {
+	// -l: copy symlinks as symlinks, -p: preserve permissions, -t: preserve times for the quick check of the delta transfer
+	args := []string{"-lpt"}
+	if opts.recursive {
+		args = append(args, "--recursive")
+	}
+	if opts.followSymlinks {
+		args = append(args, "--copy-links")
+	}
+	if opts.progress {
+		args = append(args, "--progress", "--stats")
+	}
+	if opts.verbose {
+		args = append(args, "--verbose")
+	}
+	if opts.delete {
+		args = append(args, "--delete")
+	}
+	for _, pattern := range opts.excludes {
+		args = append(args, "--exclude="+pattern)
+	}
+	var inst *store.Instance
+	for _, p := range paths {
+		if p.inst == nil {
+			continue
+		}
+		if inst != nil && inst.Name != p.inst.Name {
+			return nil, errors.New("rsync cannot copy files between two instances")
+		}
+		inst = p.inst
+	}
+	if inst != nil {
+		sshArgs, err := instanceSSHArgs(inst, opts.verbose)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-e", shellescape.QuoteCommand(append([]string{sshExe}, sshArgs...)))
+	}
+	args = append(args, "--")
+	for _, p := range paths {
+		if p.inst == nil {
+			args = append(args, p.path)
+		} else {
+			args = append(args, p.inst.SSHAddress+":"+p.path)
+		}
+	}
+	return execCommand("rsync", args...), nil
 }
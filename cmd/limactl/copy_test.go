@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/ptr"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func testCopyInstance(t *testing.T, name string) *store.Instance {
+	t.Helper()
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, filenames.SSHPrivateKey), nil, 0o600))
+	return &store.Instance{
+		Name:         name,
+		Dir:          dir,
+		SSHAddress:   "127.0.0.1",
+		SSHLocalPort: 60022,
+		Config: &limayaml.LimaYAML{
+			SSH: limayaml.SSH{
+				GenerateDedicatedKey: ptr.Of(true),
+				ControlPersist:       ptr.Of("yes"),
+				ServerAliveInterval:  ptr.Of(0),
+				ServerAliveCountMax:  ptr.Of(3),
+			},
+		},
+	}
+}
+
+func TestRsyncCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("rsync is not supported on Windows")
+	}
+	inst := testCopyInstance(t, "default")
+	paths := []copyPath{{path: "./src/"}, {inst: inst, path: "/tmp/src"}}
+	cmd, err := rsyncCommand("/usr/bin/ssh", paths, rsyncOptions{
+		recursive: true,
+		delete:    true,
+		excludes:  []string{".git", "*.o"},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"rsync", "-lpt", "--recursive", "--delete", "--exclude=.git", "--exclude=*.o", "-e"}, cmd.Args[:7])
+	sshCmdline := cmd.Args[7]
+	assert.Assert(t, strings.HasPrefix(sshCmdline, "/usr/bin/ssh -F /dev/null "), sshCmdline)
+	assert.Assert(t, strings.Contains(sshCmdline, "ControlPath="), sshCmdline)
+	assert.Assert(t, strings.HasSuffix(sshCmdline, " -p 60022"), sshCmdline)
+	assert.DeepEqual(t, []string{"--", "./src/", "127.0.0.1:/tmp/src"}, cmd.Args[8:])
+
+	cmd, err = rsyncCommand("/usr/bin/ssh", []copyPath{{inst: inst, path: "/etc/os-release"}, {path: "."}}, rsyncOptions{followSymlinks: true, progress: true})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"rsync", "-lpt", "--copy-links", "--progress", "--stats", "-e"}, cmd.Args[:6])
+	assert.DeepEqual(t, []string{"--", "127.0.0.1:/etc/os-release", "."}, cmd.Args[7:])
+
+	_, err = rsyncCommand("/usr/bin/ssh", []copyPath{{inst: inst, path: "/tmp/a"}, {inst: testCopyInstance(t, "other"), path: "/tmp/b"}}, rsyncOptions{})
+	assert.ErrorContains(t, err, "between two instances")
+}
+
+func TestCheckRsync(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("rsync is not supported on Windows")
+	}
+	lookPath = func(file string) (string, error) { return "/usr/bin/" + file, nil }
+	t.Cleanup(func() { lookPath = exec.LookPath })
+	inst := testCopyInstance(t, "default")
+	instances := map[string]*store.Instance{inst.Name: inst}
+	for _, tc := range []struct {
+		name     string
+		exitCode string
+		expected string
+	}{
+		{"installed", "0", ""},
+		{"missing", "1", `install the "rsync" package`},
+		{"ssh failure", "255", "failed to detect rsync"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var executed []string
+			execCommand = func(name string, args ...string) *exec.Cmd {
+				executed = append([]string{name}, args...)
+				return exec.Command("sh", "-c", "exit "+tc.exitCode)
+			}
+			t.Cleanup(func() { execCommand = exec.Command })
+			err := checkRsync("/usr/bin/ssh", instances, false)
+			if tc.expected == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expected)
+			}
+			assert.DeepEqual(t, []string{"127.0.0.1", "--", "command -v rsync"}, executed[len(executed)-3:])
+		})
+	}
+
+	other := testCopyInstance(t, "other")
+	instances[other.Name] = other
+	assert.ErrorContains(t, checkRsync("/usr/bin/ssh", instances, false), "between two instances")
+}
+
+func TestCheckNoDirectorySources(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, os.Mkdir(filepath.Join(dir, "src"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "file"), nil, 0o644))
+	srcs := func(names ...string) []copyPath {
+		var res []copyPath
+		for _, name := range names {
+			res = append(res, copyPath{path: filepath.Join(dir, name)})
+		}
+		return res
+	}
+	assert.NilError(t, checkNoDirectorySources("ssh", srcs("file"), rsyncOptions{}))
+	assert.NilError(t, checkNoDirectorySources("ssh", srcs("missing"), rsyncOptions{}), "rsync reports the missing files")
+	assert.ErrorContains(t, checkNoDirectorySources("ssh", srcs("file", "src"), rsyncOptions{}), "is a directory (specify --recursive)")
+	assert.ErrorContains(t, checkNoDirectorySources("ssh", srcs("src"+string(filepath.Separator)), rsyncOptions{}), "is a directory")
+
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+	assert.NilError(t, os.Symlink("src", filepath.Join(dir, "link")))
+	assert.NilError(t, checkNoDirectorySources("ssh", srcs("link"), rsyncOptions{}), "the symlink itself is copied")
+	assert.ErrorContains(t, checkNoDirectorySources("ssh", srcs("link"), rsyncOptions{followSymlinks: true}), "is a directory")
+}
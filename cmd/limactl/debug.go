@@ -1,10 +1,15 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/lima-vm/lima/pkg/hostagent/dns"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/qemu"
+	"github.com/lima-vm/lima/pkg/store"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -17,6 +22,7 @@ func newDebugCommand() *cobra.Command {
 		Hidden: true,
 	}
 	cmd.AddCommand(newDebugDNSCommand())
+	cmd.AddCommand(newDebugQMPCommand())
 	return cmd
 }
 
@@ -66,3 +72,61 @@ func debugDNSAction(cmd *cobra.Command, args []string) error {
 		time.Sleep(time.Hour)
 	}
 }
+
+func newDebugQMPCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "qmp INSTANCE COMMAND",
+		Short: "Execute a QMP command and print the raw JSON response",
+		Long: `Execute a QMP command and print the raw JSON response.
+Destructive commands such as "quit" are refused unless --force is specified.
+
+DO NOT USE! THE COMMAND SYNTAX IS SUBJECT TO CHANGE!`,
+		Example: `  $ limactl debug qmp default query-block
+  $ limactl debug qmp default screendump --args '{"filename": "/tmp/screen.ppm"}'`,
+		Args:              WrapArgsError(cobra.ExactArgs(2)),
+		RunE:              debugQMPAction,
+		ValidArgsFunction: debugQMPBashComplete,
+	}
+	cmd.Flags().String("args", "", "arguments of the command, as a JSON object")
+	cmd.Flags().Duration("timeout", 10*time.Second, "timeout for connecting and waiting for the response")
+	cmd.Flags().Bool("force", false, "allow destructive commands such as \"quit\"")
+	return cmd
+}
+
+func debugQMPAction(cmd *cobra.Command, args []string) error {
+	arguments, err := cmd.Flags().GetString("args")
+	if err != nil {
+		return err
+	}
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	inst, err := store.Inspect(args[0])
+	if err != nil {
+		return err
+	}
+	if inst.VMType != limayaml.QEMU {
+		return fmt.Errorf("QMP is not supported by vmType %q", inst.VMType)
+	}
+	if inst.Status != store.StatusRunning && inst.Status != store.StatusPaused {
+		return fmt.Errorf("expected status %q, got %q", store.StatusRunning, inst.Status)
+	}
+	resp, err := qemu.RunQMPCommand(inst.Dir, args[1], json.RawMessage(arguments), timeout, force)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(resp))
+	return err
+}
+
+func debugQMPBashComplete(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return bashCompleteInstanceNames(cmd)
+}
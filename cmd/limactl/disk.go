@@ -6,11 +6,18 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"slices"
 	"text/tabwriter"
 
 	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/driverutil"
+	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/qemu"
 	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/yqutil"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -29,7 +36,14 @@ func newDiskCommand() *cobra.Command {
   $ limactl disk delete DISK
   
   Resize a disk:
-  $ limactl disk resize DISK --size SIZE`,
+  $ limactl disk resize DISK --size SIZE
+
+  Compact the main disk of a stopped instance:
+  $ limactl disk compact INSTANCE [--check]
+
+  Attach a disk to an instance, and detach it:
+  $ limactl disk attach DISK --to INSTANCE
+  $ limactl disk detach DISK --from INSTANCE`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		GroupID:       advancedCommand,
@@ -40,6 +54,9 @@ func newDiskCommand() *cobra.Command {
 		newDiskDeleteCommand(),
 		newDiskUnlockCommand(),
 		newDiskResizeCommand(),
+		newDiskCompactCommand("compact"),
+		newDiskAttachCommand(),
+		newDiskDetachCommand(),
 	)
 	return diskCommand
 }
@@ -330,7 +347,7 @@ func diskUnlockAction(_ *cobra.Command, args []string) error {
 					diskName, disk.Instance, inst.Errors)
 				continue
 			}
-			if inst.Status == store.StatusRunning {
+			if inst.Status == store.StatusRunning || inst.Status == store.StatusPaused {
 				logrus.Warnf("Cannot unlock disk %q used by running instance %q", diskName, disk.Instance)
 				continue
 			}
@@ -348,7 +365,10 @@ func newDiskResizeCommand() *cobra.Command {
 		Use: "resize DISK",
 		Example: `
 Resize a disk:
-$ limactl disk resize DISK --size SIZE`,
+$ limactl disk resize DISK --size SIZE
+
+Shrink a disk (the data beyond the new size is lost):
+$ limactl disk resize DISK --size SIZE --allow-shrink`,
 		Short:             "Resize existing Lima disk",
 		Args:              WrapArgsError(cobra.ExactArgs(1)),
 		RunE:              diskResizeAction,
@@ -356,6 +376,7 @@ $ limactl disk resize DISK --size SIZE`,
 	}
 	diskResizeCommand.Flags().String("size", "", "Disk size")
 	_ = diskResizeCommand.MarkFlagRequired("size")
+	diskResizeCommand.Flags().Bool("allow-shrink", false, "allow shrinking the disk, which loses the data beyond the new size")
 	return diskResizeCommand
 }
 
@@ -370,6 +391,11 @@ func diskResizeAction(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	allowShrink, err := cmd.Flags().GetBool("allow-shrink")
+	if err != nil {
+		return err
+	}
+
 	diskName := args[0]
 	disk, err := store.InspectDisk(diskName)
 	if err != nil {
@@ -380,25 +406,255 @@ func diskResizeAction(cmd *cobra.Command, args []string) error {
 	}
 
 	// Shrinking can cause a disk failure
-	if diskSize < disk.Size {
-		return fmt.Errorf("specified size %q is less than the current disk size %q. Disk shrinking is currently unavailable", units.BytesSize(float64(diskSize)), units.BytesSize(float64(disk.Size)))
+	shrink := diskSize < disk.Size
+	if shrink && !allowShrink {
+		return fmt.Errorf("specified size %q is less than the current disk size %q. Disk shrinking requires --allow-shrink", units.BytesSize(float64(diskSize)), units.BytesSize(float64(disk.Size)))
 	}
 
 	if disk.Instance != "" {
 		inst, err := store.Inspect(disk.Instance)
 		if err == nil {
-			if inst.Status == store.StatusRunning {
+			if inst.Status == store.StatusRunning || inst.Status == store.StatusPaused {
 				return fmt.Errorf("cannot resize disk %q used by running instance %q. Please stop the VM instance", diskName, disk.Instance)
 			}
 		}
 	}
-	if err := qemu.ResizeDataDisk(disk.Dir, disk.Format, int(diskSize)); err != nil {
+	if shrink {
+		logrus.Warnf("Shrinking disk %q from %s to %s. The data beyond the new size is lost, "+
+			"so the filesystem and the partition inside must have been shrunk in the guest beforehand",
+			diskName, units.BytesSize(float64(disk.Size)), units.BytesSize(float64(diskSize)))
+	}
+	if err := qemu.ResizeDataDisk(disk.Dir, disk.Format, int(diskSize), shrink); err != nil {
 		return fmt.Errorf("failed to resize disk %q: %w", diskName, err)
 	}
 	logrus.Infof("Resized disk %q (%q)", diskName, disk.Dir)
+	if !shrink {
+		logrus.Info("To use the new space, the partition and the filesystem still need to be grown inside the guest. " +
+			"This is done automatically on the next start of the instance, when growpart is installed in the guest")
+	}
+	return nil
+}
+
+// newDiskCompactCommand returns `limactl disk compact`, or its `limactl compact-disk` alias.
+func newDiskCompactCommand(use string) *cobra.Command {
+	diskCompactCommand := &cobra.Command{
+		Use: use + " INSTANCE",
+		Example: `
+Compact the main disk of a stopped instance:
+$ limactl disk compact INSTANCE
+
+Report the reclaimable space without modifying the disk:
+$ limactl disk compact INSTANCE --check`,
+		Short: "Reclaim the unused space of the main disk of a stopped instance",
+		Long: `Reclaim the unused space of the main disk (diffdisk) of a stopped instance.
+The qcow2 disk is converted to a new image that replaces the disk, preserving the backing file.
+Running "sudo fstrim -av" in the guest before stopping the instance makes more space reclaimable.
+Disks with snapshots are not compacted, as the snapshots would be lost.`,
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              diskCompactAction,
+		ValidArgsFunction: diskCompactBashComplete,
+	}
+	diskCompactCommand.Flags().Bool("check", false, "report the reclaimable space without modifying the disk")
+	return diskCompactCommand
+}
+
+// newCompactDiskCommand returns `limactl compact-disk`, an alias of `limactl disk compact`.
+func newCompactDiskCommand() *cobra.Command {
+	compactDiskCommand := newDiskCompactCommand("compact-disk")
+	compactDiskCommand.GroupID = advancedCommand
+	return compactDiskCommand
+}
+
+func diskCompactAction(cmd *cobra.Command, args []string) error {
+	check, err := cmd.Flags().GetBool("check")
+	if err != nil {
+		return err
+	}
+	instName := DefaultInstanceName
+	if len(args) > 0 {
+		instName = args[0]
+	}
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	if inst.Status != store.StatusStopped {
+		return fmt.Errorf("expected status %q, got %q (hint: run `limactl stop %s`)", store.StatusStopped, inst.Status, instName)
+	}
+	limaDriver, err := newInstanceDriver(inst)
+	if err != nil {
+		return err
+	}
+	return limaDriver.CompactDisk(cmd.Context(), check)
+}
+
+func diskCompactBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
+
+func newDiskAttachCommand() *cobra.Command {
+	diskAttachCommand := &cobra.Command{
+		Use: "attach DISK",
+		Example: `
+Attach a disk to an instance:
+$ limactl disk attach DISK --to INSTANCE
+`,
+		Short: "Attach a Lima disk to an instance",
+		Long: `Attach a Lima disk to an instance, by adding the disk to the "additionalDisks" field.
+A running QEMU instance gets the disk hot-plugged, as a block device that is mounted on the next start.`,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              diskAttachAction,
+		ValidArgsFunction: diskBashComplete,
+	}
+	diskAttachCommand.Flags().String("to", "", "instance to attach the disk to")
+	_ = diskAttachCommand.MarkFlagRequired("to")
+	_ = diskAttachCommand.RegisterFlagCompletionFunc("to", func(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return bashCompleteInstanceNames(cmd)
+	})
+	return diskAttachCommand
+}
+
+func diskAttachAction(cmd *cobra.Command, args []string) error {
+	instName, err := cmd.Flags().GetString("to")
+	if err != nil {
+		return err
+	}
+	diskName := args[0]
+	disk, err := store.InspectDisk(diskName)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("disk %q does not exist", diskName)
+		}
+		return err
+	}
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(inst.AdditionalDisks, func(d limayaml.Disk) bool { return d.Name == diskName }) {
+		return fmt.Errorf("disk %q is already attached to instance %q", diskName, instName)
+	}
+	if disk.Instance != "" && disk.InstanceDir != inst.Dir {
+		return fmt.Errorf("disk %q is in use by instance %q (hint: detach it with `limactl disk detach %s --from %s`)",
+			diskName, disk.Instance, diskName, disk.Instance)
+	}
+	switch inst.Status {
+	case store.StatusStopped:
+	case store.StatusRunning:
+		limaDriver, err := newInstanceDriver(inst)
+		if err != nil {
+			return err
+		}
+		if err := limaDriver.AttachDisk(cmd.Context(), disk); err != nil {
+			return fmt.Errorf("failed to attach disk %q to instance %q: %w", diskName, instName, err)
+		}
+		if disk.Instance == "" {
+			if err := disk.Lock(inst.Dir); err != nil {
+				return err
+			}
+		}
+		logrus.Infof("Hot-plugged disk %q; it will be mounted on %q on the next start", diskName, disk.MountPoint)
+	default:
+		return fmt.Errorf("expected status %q or %q, got %q", store.StatusStopped, store.StatusRunning, inst.Status)
+	}
+	if err := editAdditionalDisks(inst, fmt.Sprintf(".additionalDisks += [{\"name\": %q}]", diskName)); err != nil {
+		return err
+	}
+	logrus.Infof("Attached disk %q to instance %q", diskName, instName)
+	return nil
+}
+
+func newDiskDetachCommand() *cobra.Command {
+	diskDetachCommand := &cobra.Command{
+		Use: "detach DISK",
+		Example: `
+Detach a disk from an instance:
+$ limactl disk detach DISK --from INSTANCE
+`,
+		Short: "Detach a Lima disk from an instance",
+		Long: `Detach a Lima disk from an instance, by removing the disk from the "additionalDisks" field.
+A running QEMU instance gets the disk hot-unplugged. Unmount the disk in the guest beforehand.`,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              diskDetachAction,
+		ValidArgsFunction: diskBashComplete,
+	}
+	diskDetachCommand.Flags().String("from", "", "instance to detach the disk from")
+	_ = diskDetachCommand.MarkFlagRequired("from")
+	_ = diskDetachCommand.RegisterFlagCompletionFunc("from", func(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return bashCompleteInstanceNames(cmd)
+	})
+	return diskDetachCommand
+}
+
+func diskDetachAction(cmd *cobra.Command, args []string) error {
+	instName, err := cmd.Flags().GetString("from")
+	if err != nil {
+		return err
+	}
+	diskName := args[0]
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(inst.AdditionalDisks, func(d limayaml.Disk) bool { return d.Name == diskName }) {
+		return fmt.Errorf("disk %q is not attached to instance %q", diskName, instName)
+	}
+	switch inst.Status {
+	case store.StatusStopped:
+	case store.StatusRunning:
+		limaDriver, err := newInstanceDriver(inst)
+		if err != nil {
+			return err
+		}
+		if err := limaDriver.DetachDisk(cmd.Context(), diskName); err != nil {
+			return fmt.Errorf("failed to detach disk %q from instance %q: %w", diskName, instName, err)
+		}
+		disk, err := store.InspectDisk(diskName)
+		if err != nil {
+			return err
+		}
+		if disk.InstanceDir == inst.Dir {
+			if err := disk.Unlock(); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("expected status %q or %q, got %q", store.StatusStopped, store.StatusRunning, inst.Status)
+	}
+	// the disk may be specified either as a string or as a map
+	expr := fmt.Sprintf(`del(.additionalDisks[] | select((tag == "!!str" and . == %q) or (tag == "!!map" and .name == %q)))`, diskName, diskName)
+	if err := editAdditionalDisks(inst, expr); err != nil {
+		return err
+	}
+	logrus.Infof("Detached disk %q from instance %q", diskName, instName)
 	return nil
 }
 
+func newInstanceDriver(inst *store.Instance) (driver.Driver, error) {
+	y, err := inst.LoadYAML()
+	if err != nil {
+		return nil, err
+	}
+	return driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
+		Instance: inst,
+		Yaml:     y,
+	}), nil
+}
+
+// editAdditionalDisks applies the yq expression that modifies the "additionalDisks" field to lima.yaml of the instance.
+func editAdditionalDisks(inst *store.Instance, expr string) error {
+	filePath := filepath.Join(inst.Dir, filenames.LimaYAML)
+	yContent, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	yBytes, err := yqutil.EvaluateExpression(expr, yContent)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, yBytes, 0o644)
+}
+
 func diskBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
 	return bashCompleteDiskNames(cmd)
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/doctor"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func newDoctorCommand() *cobra.Command {
+	doctorCommand := &cobra.Command{
+		Use:   "doctor [NAME|FILE.yaml|URL]",
+		Short: "Check the host environment",
+		Long: `Check whether the host environment can run an instance, e.g., whether QEMU and socket_vmnet are installed.
+
+The checks depend on the instance or the template, e.g., virtiofsd is only checked for ` + "`mountType: virtiofs`" + `.
+When no argument is given, the "default" instance is checked if it exists, otherwise the default template.
+
+The command fails if any of the checks has failed.`,
+		Example: `  $ limactl doctor
+  $ limactl doctor default
+  $ limactl doctor template://docker
+  $ limactl doctor --format json ./lima.yaml`,
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              doctorAction,
+		ValidArgsFunction: doctorBashComplete,
+		GroupID:           advancedCommand,
+	}
+	doctorCommand.Flags().String("format", "text", "output format, one of: json, text")
+	return doctorCommand
+}
+
+func doctorAction(cmd *cobra.Command, args []string) error {
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json", "text":
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	y, err := doctorTarget(cmd, args)
+	if err != nil {
+		return err
+	}
+	results := doctor.Run(y)
+	if err := printDoctorResults(cmd.OutOrStdout(), results, format); err != nil {
+		return err
+	}
+	if failed := doctor.Failed(results); failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+// doctorTarget returns the YAML of the instance or the template to be checked.
+func doctorTarget(cmd *cobra.Command, args []string) (*limayaml.LimaYAML, error) {
+	arg := DefaultInstanceName
+	if len(args) > 0 {
+		arg = args[0]
+	}
+	if seemsTemplateArg(arg) {
+		return validateTemplate(cmd, arg)
+	}
+	inst, err := store.Inspect(arg)
+	if err != nil {
+		if len(args) == 0 && errors.Is(err, os.ErrNotExist) {
+			return validateTemplate(cmd, "template://default")
+		}
+		return nil, err
+	}
+	if inst.Config == nil {
+		return nil, fmt.Errorf("failed to load the YAML of instance %q: %w", inst.Name, errors.Join(inst.Errors...))
+	}
+	return inst.Config, nil
+}
+
+func printDoctorResults(out io.Writer, results []doctor.Result, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		for _, r := range results {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, r := range results {
+		fmt.Fprintf(out, "%s %s: %s\n", r.Status, r.Name, r.Message)
+		if r.Hint != "" && r.Status != doctor.Pass {
+			fmt.Fprintf(out, "     hint: %s\n", r.Hint)
+		}
+	}
+	return nil
+}
+
+func doctorBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
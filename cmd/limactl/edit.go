@@ -2,15 +2,26 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/docker/go-units"
 	"github.com/lima-vm/lima/cmd/limactl/editflags"
+	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/driverutil"
 	"github.com/lima-vm/lima/pkg/editutil"
+	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	networks "github.com/lima-vm/lima/pkg/networks/reconcile"
+	"github.com/lima-vm/lima/pkg/qemu/imgutil"
+	"github.com/lima-vm/lima/pkg/snapshot"
 	"github.com/lima-vm/lima/pkg/start"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
@@ -18,18 +29,34 @@ import (
 	"github.com/lima-vm/lima/pkg/yqutil"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 func newEditCommand() *cobra.Command {
 	editCommand := &cobra.Command{
-		Use:               "edit INSTANCE",
-		Short:             "Edit an instance of Lima",
+		Use:   "edit INSTANCE",
+		Short: "Edit an instance of Lima",
+		Example: `  Edit the configuration interactively:
+  $ limactl edit default
+
+  Edit the configuration non-interactively:
+  $ limactl edit default --set '.cpus = 8' --memory 8
+
+  Grow the disk (a running instance is grown immediately, a stopped instance is grown on the next start):
+  $ limactl edit default --disk 200
+
+  Change the port forwards without reloading them on the running instance:
+  $ limactl edit default --no-reload
+`,
 		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
 		RunE:              editAction,
 		ValidArgsFunction: editBashComplete,
 		GroupID:           basicCommand,
 	}
 	editflags.RegisterEdit(editCommand)
+	editCommand.Flags().Bool("snapshot", false, "create a snapshot before persisting the changes (same as `autoSnapshot.beforeEdit: true`)")
+	registerRejectedYAMLPathFlag(editCommand, "")
+	editCommand.Flags().Bool("no-reload", false, "do not reload the port forwards of a running instance (applied on the next start)")
 	return editCommand
 }
 
@@ -47,10 +74,6 @@ func editAction(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	if inst.Status == store.StatusRunning {
-		return errors.New("Cannot edit a running instance")
-	}
-
 	filePath := filepath.Join(inst.Dir, filenames.LimaYAML)
 	yContent, err := os.ReadFile(filePath)
 	if err != nil {
@@ -95,18 +118,69 @@ func editAction(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	if err := limayaml.Validate(y, true); err != nil {
-		rejectedYAML := "lima.REJECTED.yaml"
-		if writeErr := os.WriteFile(rejectedYAML, yBytes, 0o644); writeErr != nil {
-			return fmt.Errorf("the YAML is invalid, attempted to save the buffer as %q but failed: %w: %w", rejectedYAML, writeErr, err)
+		rejectedYAMLPath, pathErr := rejectedYAMLPathFromFlags(flags, true)
+		if pathErr != nil {
+			return pathErr
 		}
 		// TODO: may need to support editing the rejected YAML
-		return fmt.Errorf("the YAML is invalid, saved the buffer as %q: %w", rejectedYAML, err)
+		return saveRejectedYAML(rejectedYAMLPath, yBytes, err)
+	}
+	if err := validateDriver(y); err != nil {
+		return err
+	}
+	changed, err := changedFields(yContent, yBytes)
+	if err != nil {
+		return err
+	}
+	if err := validateChangedHostResources(y, changed); err != nil {
+		return err
+	}
+	takeSnapshot, err := flags.GetBool("snapshot")
+	if err != nil {
+		return err
+	}
+	if takeSnapshot || *inst.Config.AutoSnapshot.BeforeEdit {
+		if err := createPreEditSnapshot(cmd.Context(), inst); err != nil {
+			return fmt.Errorf("failed to create a snapshot before editing (the configuration was not modified): %w", err)
+		}
+	}
+	if slices.Contains(changed, "disk") {
+		if err := resizeDisk(cmd.Context(), inst, y); err != nil {
+			return err
+		}
 	}
 	if err := os.WriteFile(filePath, yBytes, 0o644); err != nil {
 		return err
 	}
 	logrus.Infof("Instance %q configuration edited", instName)
 
+	if inst.Status == store.StatusRunning || inst.Status == store.StatusPaused {
+		noReload, err := flags.GetBool("no-reload")
+		if err != nil {
+			return err
+		}
+		reloaded := false
+		if !noReload && inst.Status == store.StatusRunning && slices.ContainsFunc(changed, func(f string) bool { return reloadableFields[f] }) {
+			reloaded = reloadHostAgent(cmd.Context(), inst)
+		}
+		var live, restart []string
+		for _, f := range changed {
+			if liveEditableFields[f] || (reloaded && reloadableFields[f] && f != "mounts") {
+				live = append(live, f)
+			} else {
+				restart = append(restart, f)
+			}
+		}
+		if len(live) > 0 {
+			logrus.Infof("Changes to %v took effect on the running instance", live)
+		}
+		if len(restart) > 0 {
+			logrus.Warnf("Changes to %v require restarting the instance (Hint: run `limactl stop %s && limactl start %s`)",
+				restart, instName, instName)
+		}
+		return nil
+	}
+
 	if !tty {
 		// use "start" to start it
 		return nil
@@ -126,6 +200,142 @@ func editAction(cmd *cobra.Command, args []string) error {
 	return start.Start(ctx, inst, false)
 }
 
+// liveEditableFields are the top-level fields that can be changed without restarting a running instance.
+var liveEditableFields = map[string]bool{
+	"disk": true,
+}
+
+// reloadableFields are the top-level fields that are reloaded by the host agent of a running instance.
+// The changes of "mounts" are only reported by the host agent, as the mounts cannot be hot-plugged yet.
+// Likewise, the changes of "diskOptions" other than the throttle are reported by the host agent.
+var reloadableFields = map[string]bool{
+	"diskOptions":        true,
+	"mounts":             true,
+	"portForwardOptions": true,
+	"portForwards":       true,
+}
+
+// reloadHostAgent asks the host agent of the running instance to reload lima.yaml.
+// It returns false when the host agent could not reload it.
+func reloadHostAgent(ctx context.Context, inst *store.Instance) bool {
+	haClient, err := hostagentclient.NewHostAgentClient(filepath.Join(inst.Dir, filenames.HostAgentSock))
+	if err != nil {
+		logrus.WithError(err).Warn("failed to connect to the host agent")
+		return false
+	}
+	res, err := haClient.Reload(ctx)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to reload the configuration of the running instance")
+		return false
+	}
+	logrus.Infof("Reloaded the configuration of the running instance (%d port forwards changed)", res.PortForwardsChanged)
+	if res.DiskThrottleChanged {
+		logrus.Info("Changed the disk throttle of the running instance")
+	}
+	for _, s := range res.RestartRequired {
+		logrus.Warnf("The change requires restarting the instance: %s", s)
+	}
+	return true
+}
+
+// changedFields returns the sorted names of the top-level fields that differ between the two YAMLs.
+func changedFields(before, after []byte) ([]string, error) {
+	var b, a map[string]any
+	if err := yaml.Unmarshal(before, &b); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(after, &a); err != nil {
+		return nil, err
+	}
+	var res []string
+	for k, v := range a {
+		if !reflect.DeepEqual(v, b[k]) {
+			res = append(res, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			res = append(res, k)
+		}
+	}
+	slices.Sort(res)
+	return res, nil
+}
+
+// preEditSnapshotPrefix is the tag prefix of the snapshots created by createPreEditSnapshot.
+const preEditSnapshotPrefix = "pre-edit-"
+
+// createPreEditSnapshot creates a snapshot of the instance, and deletes the older pre-edit snapshots
+// exceeding `autoSnapshot.keep`.
+func createPreEditSnapshot(ctx context.Context, inst *store.Instance) error {
+	if _, err := os.Stat(filepath.Join(inst.Dir, filenames.DiffDisk)); errors.Is(err, os.ErrNotExist) {
+		logrus.Infof("Skipping the snapshot, as instance %q has never been started", inst.Name)
+		return nil
+	}
+	tag := preEditSnapshotPrefix + time.Now().Format("20060102T150405")
+	logrus.Infof("Creating snapshot %q", tag)
+	if err := snapshot.Save(ctx, inst, tag); err != nil {
+		return err
+	}
+	list, err := snapshot.List(ctx, inst)
+	if err != nil {
+		return err
+	}
+	var tags []string
+	for _, s := range list.Snapshots {
+		if strings.HasPrefix(s.Tag, preEditSnapshotPrefix) {
+			tags = append(tags, s.Tag)
+		}
+	}
+	// the tags are sorted by the timestamp
+	slices.Sort(tags)
+	keep := *inst.Config.AutoSnapshot.Keep
+	for len(tags) > keep {
+		logrus.Infof("Deleting old snapshot %q", tags[0])
+		if err := snapshot.Del(ctx, inst, tags[0]); err != nil {
+			return err
+		}
+		tags = tags[1:]
+	}
+	return nil
+}
+
+// resizeDisk grows the main disk of an existing instance to the size specified in y.
+// The disk is left untouched when it has not been created yet, as it is created with the new size on start.
+// The disk of a stopped QEMU instance is grown on the next start.
+func resizeDisk(ctx context.Context, inst *store.Instance, y *limayaml.LimaYAML) error {
+	diffDisk := filepath.Join(inst.Dir, filenames.DiffDisk)
+	if _, err := os.Stat(diffDisk); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	size, err := units.RAMInBytes(*y.Disk)
+	if err != nil {
+		return err
+	}
+	if inst.VMType == limayaml.QEMU && inst.Status == store.StatusStopped {
+		info, err := imgutil.GetInfo(diffDisk)
+		if err != nil {
+			return fmt.Errorf("failed to get the information of %q: %w", diffDisk, err)
+		}
+		grow, err := imgutil.NeedsGrow(info, size)
+		if err != nil {
+			return fmt.Errorf("failed to resize the disk of instance %q: %w", inst.Name, err)
+		}
+		if grow {
+			logrus.Infof("The disk will be grown to %s on the next start", units.BytesSize(float64(size)))
+		}
+		return nil
+	}
+	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
+		Instance: inst,
+		Yaml:     y,
+	})
+	if err := limaDriver.ResizeDisk(ctx, size); err != nil {
+		return fmt.Errorf("failed to resize the disk of instance %q: %w", inst.Name, err)
+	}
+	return nil
+}
+
 func askWhetherToStart() (bool, error) {
 	message := "Do you want to start the instance now? "
 	return uiutil.Confirm(message, true)
@@ -1,12 +1,22 @@
 package editflags
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"maps"
 	"math/bits"
+	"net"
+	"os"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/yqutil"
 	"github.com/pbnjay/memory"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -30,9 +40,17 @@ func registerEdit(cmd *cobra.Command, commentPrefix string) {
 		return res, cobra.ShellCompDirectiveNoFileComp
 	})
 
+	flags.String("disk", "", commentPrefix+"disk size in GiB, or with a unit, e.g., \"100GiB\"") // colima-compatible
+	_ = cmd.RegisterFlagCompletionFunc("disk", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return []string{"10", "30", "50", "100", "200"}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	flags.StringArray("env-file", nil, commentPrefix+"file of KEY=VALUE lines to add to `env`, e.g., for provisioning scripts (can be specified multiple times)")
+	flags.Bool("env-file-override", false, commentPrefix+"let the values of --env-file override the values of `env` in the template")
+
 	flags.IPSlice("dns", nil, commentPrefix+"specify custom DNS (disable host resolver)") // colima-compatible
 
-	flags.Float32("memory", 0, commentPrefix+"memory in GiB") // colima-compatible
+	flags.String("memory", "", commentPrefix+"memory in GiB, or with a unit, e.g., \"512MiB\"") // colima-compatible
 	_ = cmd.RegisterFlagCompletionFunc("memory", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
 		var res []string
 		for _, f := range completeMemoryGiB(memory.TotalMemory()) {
@@ -49,20 +67,38 @@ func registerEdit(cmd *cobra.Command, commentPrefix string) {
 	})
 
 	flags.Bool("mount-writable", false, commentPrefix+"make all mounts writable")
+	flags.Bool("mount-writable-default", false, commentPrefix+"make the mounts writable unless they explicitly set `writable`. "+
+		"CAUTION: the guest will be able to modify the host files, including the home directory when it is mounted")
 	flags.Bool("mount-inotify", false, commentPrefix+"enable inotify for mounts")
 
-	flags.StringSlice("network", nil, commentPrefix+"additional networks, e.g., \"vzNAT\" or \"lima:shared\" to assign vmnet IP")
+	flags.StringSlice("network", nil, commentPrefix+"additional networks, e.g., \"vzNAT\" or \"lima:shared\" to assign vmnet IP (\"lima:\" prefix can be omitted)")
 	_ = cmd.RegisterFlagCompletionFunc("network", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
-		// TODO: retrieve the lima:* network list from networks.yaml
-		return []string{"lima:shared", "lima:bridged", "lima:host", "lima:user-v2", "vzNAT"}, cobra.ShellCompDirectiveNoFileComp
+		res := []string{"vzNAT"}
+		config, err := networks.Config()
+		if err != nil {
+			return res, cobra.ShellCompDirectiveNoFileComp
+		}
+		for name := range config.Networks {
+			res = append(res, "lima:"+name)
+		}
+		slices.Sort(res)
+		return res, cobra.ShellCompDirectiveNoFileComp
 	})
 
+	flags.StringArray("mac-address", nil, commentPrefix+"MAC address of the NIC of networks[INDEX], overriding the computed one, e.g., \"0=52:55:55:12:34:56\" (can be specified multiple times)")
+
 	flags.Bool("rosetta", false, commentPrefix+"enable Rosetta (for vz instances)")
 
-	flags.String("set", "", commentPrefix+"modify the template inplace, using yq syntax")
+	flags.StringArray("set", nil, commentPrefix+"modify the template inplace, using yq syntax (can be specified multiple times)")
+
+	flags.Int("ssh-port", 0, commentPrefix+"SSH port of the host, for a stable ~/.ssh/config entry (0: auto-assigned)")
+
+	flags.StringArray("ssh-pubkey", nil, commentPrefix+"`FILE` of SSH public keys to add to ssh.authorizedKeys, for letting other users connect to the instance (can be specified multiple times)")
 
 	// negative performance impact: https://gitlab.com/qemu-project/qemu/-/issues/334
 	flags.Bool("video", false, commentPrefix+"enable video output (has negative performance impact for QEMU)")
+
+	flags.Bool("vnc", false, commentPrefix+"enable the VNC display, and print the connection string of the started or running instance (QEMU only)")
 }
 
 // RegisterCreate registers flags related to in-place YAML modification, for `limactl create`.
@@ -80,11 +116,6 @@ func RegisterCreate(cmd *cobra.Command, commentPrefix string) {
 		return []string{"user", "system", "user+system", "none"}, cobra.ShellCompDirectiveNoFileComp
 	})
 
-	flags.Float32("disk", 0, commentPrefix+"disk size in GiB") // colima-compatible
-	_ = cmd.RegisterFlagCompletionFunc("memory", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
-		return []string{"10", "30", "50", "100", "200"}, cobra.ShellCompDirectiveNoFileComp
-	})
-
 	flags.String("vm-type", "", commentPrefix+"virtual machine type (qemu, vz)") // colima-compatible
 	_ = cmd.RegisterFlagCompletionFunc("vm-type", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
 		return []string{"qemu", "vz"}, cobra.ShellCompDirectiveNoFileComp
@@ -99,6 +130,25 @@ func defaultExprFunc(expr string) func(v *flag.Flag) (string, error) {
 	}
 }
 
+// sizeExprFunc returns the expression for a size flag.
+// A number without a unit is interpreted in GiB, for the compatibility with colima.
+func sizeExprFunc(field string) func(v *flag.Flag) (string, error) {
+	return func(v *flag.Flag) (string, error) {
+		s := strings.TrimSpace(v.Value.String())
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			s += "GiB"
+		}
+		size, err := units.RAMInBytes(s)
+		if err != nil {
+			return "", fmt.Errorf("flag `--%s` has an invalid value %q (expected GiB, or a size with a unit, e.g., \"512MiB\"): %w", v.Name, v.Value, err)
+		}
+		if size <= 0 {
+			return "", fmt.Errorf("flag `--%s` must be positive, got %q", v.Name, v.Value)
+		}
+		return fmt.Sprintf("%s = %q", field, s), nil
+	}
+}
+
 // YQExpressions returns YQ expressions.
 func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 	type def struct {
@@ -110,6 +160,7 @@ func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 	d := defaultExprFunc
 	defs := []def{
 		{"cpus", d(".cpus = %s"), false, false},
+		{"disk", sizeExprFunc(".disk"), false, false},
 		{
 			"dns",
 			func(_ *flag.Flag) (string, error) {
@@ -131,7 +182,35 @@ func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 			false,
 			false,
 		},
-		{"memory", d(".memory = \"%sGiB\""), false, false},
+		{
+			"env-file",
+			func(_ *flag.Flag) (string, error) {
+				files, err := flags.GetStringArray("env-file")
+				if err != nil {
+					return "", err
+				}
+				override, err := flags.GetBool("env-file-override")
+				if err != nil {
+					return "", err
+				}
+				env := make(map[string]string)
+				for _, f := range files {
+					b, err := os.ReadFile(f)
+					if err != nil {
+						return "", err
+					}
+					fileEnv, err := parseEnvFile(b)
+					if err != nil {
+						return "", fmt.Errorf("failed to parse %q: %w", f, err)
+					}
+					maps.Copy(env, fileEnv)
+				}
+				return envFileExpression(env, override), nil
+			},
+			false,
+			false,
+		},
+		{"memory", sizeExprFunc(".memory"), false, false},
 		{
 			"mount",
 			func(_ *flag.Flag) (string, error) {
@@ -157,6 +236,21 @@ func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 		{"mount-type", d(".mountType = %q"), false, false},
 		{"mount-inotify", d(".mountInotify = %s"), false, true},
 		{"mount-writable", d(".mounts[].writable = %s"), false, false},
+		{
+			"mount-writable-default",
+			func(_ *flag.Flag) (string, error) {
+				b, err := flags.GetBool("mount-writable-default")
+				if err != nil {
+					return "", err
+				}
+				if !b {
+					return ".", nil
+				}
+				return `with(.mounts[] | select(has("writable") | not); .writable = true)`, nil
+			},
+			false,
+			false,
+		},
 		{
 			"network",
 			func(_ *flag.Flag) (string, error) {
@@ -167,14 +261,14 @@ func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 				expr := `.networks += [`
 				for i, s := range ss {
 					// CLI syntax is still experimental (YAML syntax is out of experimental)
-					switch {
-					case s == "vzNAT":
+					if s == "vzNAT" {
 						expr += `{"vzNAT": true}`
-					case strings.HasPrefix(s, "lima:"):
+					} else {
 						network := strings.TrimPrefix(s, "lima:")
+						if err := checkNetwork(network); err != nil {
+							return "", err
+						}
 						expr += fmt.Sprintf(`{"lima": %q}`, network)
-					default:
-						return "", fmt.Errorf("network name must be \"vzNAT\" or \"lima:*\", got %q", s)
 					}
 					if i < len(ss)-1 {
 						expr += ","
@@ -186,6 +280,28 @@ func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 			false,
 			false,
 		},
+		{
+			// Must be after "network", so that the index can refer to the networks added by `--network`
+			"mac-address",
+			func(_ *flag.Flag) (string, error) {
+				ss, err := flags.GetStringArray("mac-address")
+				if err != nil {
+					return "", err
+				}
+				macs, err := parseMACAddressFlags(ss)
+				if err != nil {
+					return "", err
+				}
+				var exprs []string
+				for _, m := range macs {
+					exprs = append(exprs, fmt.Sprintf(`with(select((.networks // [] | length) <= %d); error("networks[%d] is not defined")) | .networks[%d].macAddress = %q`,
+						m.index, m.index, m.index, m.mac))
+				}
+				return yqutil.Join(exprs), nil
+			},
+			false,
+			false,
+		},
 		{
 			"rosetta",
 			func(_ *flag.Flag) (string, error) {
@@ -198,7 +314,51 @@ func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 			false,
 			true,
 		},
-		{"set", d("%s"), false, false},
+		{
+			"set",
+			func(_ *flag.Flag) (string, error) {
+				ss, err := flags.GetStringArray("set")
+				if err != nil {
+					return "", err
+				}
+				return yqutil.Join(ss), nil
+			},
+			false,
+			false,
+		},
+		{"ssh-port", d(".ssh.localPort = %s"), false, false},
+		{
+			"ssh-pubkey",
+			func(_ *flag.Flag) (string, error) {
+				files, err := flags.GetStringArray("ssh-pubkey")
+				if err != nil {
+					return "", err
+				}
+				var keys []string
+				for _, f := range files {
+					b, err := os.ReadFile(f)
+					if err != nil {
+						return "", err
+					}
+					fileKeys, err := parseSSHPubKeyFile(b)
+					if err != nil {
+						return "", fmt.Errorf("failed to parse %q: %w", f, err)
+					}
+					keys = append(keys, fileKeys...)
+				}
+				expr := `.ssh.authorizedKeys += [`
+				for i, key := range keys {
+					expr += fmt.Sprintf("%q", key)
+					if i < len(keys)-1 {
+						expr += ","
+					}
+				}
+				expr += `] | .ssh.authorizedKeys |= unique`
+				return expr, nil
+			},
+			false,
+			false,
+		},
 		{
 			"video",
 			func(_ *flag.Flag) (string, error) {
@@ -214,6 +374,21 @@ func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 			false,
 			false,
 		},
+		{
+			"vnc",
+			func(_ *flag.Flag) (string, error) {
+				b, err := flags.GetBool("vnc")
+				if err != nil {
+					return "", err
+				}
+				if b {
+					return ".video.display = \"vnc\"", nil
+				}
+				return "with(select(.video.display == \"vnc\"); .video.display = \"none\")", nil
+			},
+			false,
+			true,
+		},
 		{"arch", d(".arch = %q"), true, false},
 		{
 			"containerd",
@@ -238,7 +413,6 @@ func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 			true,
 			false,
 		},
-		{"disk", d(".disk= \"%sGiB\""), true, false},
 		{"vm-type", d(".vmType = %q"), true, false},
 		{"plain", d(".plain = %s"), true, false},
 	}
@@ -264,6 +438,137 @@ func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 	return exprs, nil
 }
 
+type macAddressFlag struct {
+	index int
+	mac   string
+}
+
+// parseMACAddressFlags parses the values of `--mac-address` in the "INDEX=MAC" format.
+// The MAC addresses are normalized, and must be unique.
+func parseMACAddressFlags(ss []string) ([]macAddressFlag, error) {
+	res := make([]macAddressFlag, 0, len(ss))
+	indices := make(map[int]string)
+	macs := make(map[string]int)
+	for _, s := range ss {
+		k, v, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected the \"INDEX=MAC\" format, got %q", s)
+		}
+		index, err := strconv.Atoi(k)
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("expected a non-negative network index, got %q", k)
+		}
+		hw, err := net.ParseMAC(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(hw) != 6 {
+			return nil, fmt.Errorf("expected a 48 bit (6 bytes) MAC address, got %q", v)
+		}
+		mac := hw.String()
+		if prev, ok := indices[index]; ok {
+			return nil, fmt.Errorf("network index %d is specified twice (%q and %q)", index, prev, mac)
+		}
+		if prev, ok := macs[mac]; ok {
+			return nil, fmt.Errorf("MAC address %q is specified for both networks[%d] and networks[%d]", mac, prev, index)
+		}
+		indices[index] = mac
+		macs[mac] = index
+		res = append(res, macAddressFlag{index: index, mac: mac})
+	}
+	return res, nil
+}
+
+// checkNetwork returns an error if the network is not defined in networks.yaml.
+func checkNetwork(name string) error {
+	if name == "" {
+		return errors.New("network name must be \"vzNAT\" or \"lima:*\", got an empty name")
+	}
+	config, err := networks.Config()
+	if err != nil {
+		return err
+	}
+	if err := config.Check(name); err != nil {
+		configFile, _ := networks.ConfigFile()
+		names := make([]string, 0, len(config.Networks))
+		for nw := range config.Networks {
+			names = append(names, nw)
+		}
+		slices.Sort(names)
+		return fmt.Errorf("%w in %q (defined networks: %v)", err, configFile, names)
+	}
+	return nil
+}
+
+// parseEnvFile parses the KEY=VALUE lines of an env file.
+// Empty lines and the lines starting with "#" are ignored, and the value may be quoted.
+func parseEnvFile(b []byte) (map[string]string, error) {
+	env := make(map[string]string)
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE, got %q", i+1, line)
+		}
+		if err := limayaml.ValidateEnvKey(k); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		env[k] = v
+	}
+	return env, nil
+}
+
+// parseSSHPubKeyFile parses b in the authorized_keys format, e.g., the content of ~/.ssh/id_ed25519.pub.
+// Empty lines and comments are skipped.
+func parseSSHPubKeyFile(b []byte) ([]string, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("-----BEGIN")) {
+		return nil, errors.New("seems to be a private key, specify the public key (e.g., ~/.ssh/id_ed25519.pub) instead")
+	}
+	var keys []string
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := limayaml.ValidateAuthorizedKey(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		keys = append(keys, line)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no SSH public key was found")
+	}
+	return keys, nil
+}
+
+// envFileExpression returns the expression for adding env to `env`.
+// The values in the template take precedence, unless override is true.
+func envFileExpression(env map[string]string, override bool) string {
+	if len(env) == 0 {
+		return "."
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	exprs := make([]string, len(keys))
+	for i, k := range keys {
+		if override {
+			exprs[i] = fmt.Sprintf(".env.%s = %q", k, env[k])
+		} else {
+			exprs[i] = fmt.Sprintf(".env.%s = (.env.%s // %q)", k, k, env[k])
+		}
+	}
+	return yqutil.Join(exprs)
+}
+
 func isPowerOfTwo(x int) bool {
 	return bits.OnesCount(uint(x)) == 1
 }
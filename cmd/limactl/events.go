@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/spf13/cobra"
+)
+
+func newEventsCommand() *cobra.Command {
+	eventsCommand := &cobra.Command{
+		Use:   "events INSTANCE",
+		Short: "Show the events of the host agent of a running instance",
+		Long: `Show the events of the host agent of a running instance, as JSON lines.
+
+The host agent retains the latest events only.`,
+		Example: `  $ limactl events default
+  $ limactl events --follow default`,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              eventsAction,
+		ValidArgsFunction: eventsBashComplete,
+		GroupID:           advancedCommand,
+	}
+	eventsCommand.Flags().BoolP("follow", "f", false, "follow the new events")
+	return eventsCommand
+}
+
+func eventsAction(cmd *cobra.Command, args []string) error {
+	follow, err := cmd.Flags().GetBool("follow")
+	if err != nil {
+		return err
+	}
+	inst, err := store.Inspect(args[0])
+	if err != nil {
+		return err
+	}
+	if inst.Status != store.StatusRunning && inst.Status != store.StatusPaused {
+		return fmt.Errorf("instance %q is not running", inst.Name)
+	}
+	haClient, err := hostagentclient.NewHostAgentClient(filepath.Join(inst.Dir, filenames.HostAgentSock))
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	var encErr error
+	err = haClient.Events(cmd.Context(), follow, func(ev events.Event) {
+		if encErr == nil {
+			encErr = enc.Encode(ev)
+		}
+	})
+	if errors.Is(err, cmd.Context().Err()) {
+		// interrupted while following
+		err = nil
+	}
+	return errors.Join(err, encErr)
+}
+
+func eventsBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
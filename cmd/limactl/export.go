@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/lima-vm/lima/pkg/bundle"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newExportCommand() *cobra.Command {
+	exportCommand := &cobra.Command{
+		Use:   "export INSTANCE",
+		Short: "Export an instance to a bundle, for migrating it to another host",
+		Long: `Export an instance to a bundle, for migrating it to another host.
+
+The bundle is a zstd-compressed tar archive of lima.yaml, the disk, and the additional disks of the instance.
+The disk is converted to a standalone image when it has a backing file. The snapshots are not exported.
+The bundle can be imported with 'limactl import'.
+
+Requires the zstd command.`,
+		Example:           `  $ limactl export default -o default.limabundle`,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              exportAction,
+		ValidArgsFunction: exportBashComplete,
+		GroupID:           advancedCommand,
+	}
+	exportCommand.Flags().StringP("output", "o", "", "output file (default: INSTANCE"+bundle.FileExtension+")")
+	exportCommand.Flags().Bool("force", false, "export the instance even when it is running, at the risk of inconsistent disks")
+	return exportCommand
+}
+
+func exportAction(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	inst, err := store.Inspect(args[0])
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		output = inst.Name + bundle.FileExtension
+	}
+	if err := bundle.Export(cmd.Context(), inst, output, force); err != nil {
+		return err
+	}
+	logrus.Infof("Exported instance %q to %q", inst.Name, output)
+	return nil
+}
+
+func exportBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
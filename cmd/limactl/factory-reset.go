@@ -2,33 +2,76 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/uiutil"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 func newFactoryResetCommand() *cobra.Command {
 	resetCommand := &cobra.Command{
-		Use:               "factory-reset INSTANCE",
-		Short:             "Factory reset an instance of Lima",
+		Use:   "factory-reset INSTANCE",
+		Short: "Factory reset an instance of Lima",
+		Long: `Factory reset an instance of Lima.
+
+The disks, the cloud-init data, the logs, and the other state of the instance are removed,
+so that the next 'limactl start' provisions the instance from scratch.
+The configuration (lima.yaml) and the unknown files in the instance directory are preserved.`,
+		Example: `  $ limactl factory-reset default
+  $ limactl factory-reset --force default`,
 		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
 		RunE:              factoryResetAction,
 		ValidArgsFunction: factoryResetBashComplete,
 		GroupID:           advancedCommand,
 	}
+	resetCommand.Flags().BoolP("force", "f", false, "reset the instance without asking for confirmation")
 	return resetCommand
 }
 
-func factoryResetAction(_ *cobra.Command, args []string) error {
+// factoryResetFiles are the files and the directories removed by `limactl factory-reset`.
+// The sockets and the pid files are removed on stopping the instance.
+var factoryResetFiles = []string{
+	filenames.CIDataISO,
+	filenames.CIDataISODir,
+	filenames.BaseDisk,
+	filenames.DiffDisk,
+	filenames.Kernel,
+	filenames.KernelCmdline,
+	filenames.Initrd,
+	filenames.SerialLog,
+	filenames.SerialPCILog,
+	filenames.SerialVirtioLog,
+	filenames.SSHConfig,
+	filenames.VNCDisplayFile,
+	filenames.VNCPasswordFile,
+	filenames.SwtpmStateDir,
+	filenames.HostAgentStdoutLog,
+	filenames.HostAgentStderrLog,
+	filenames.HostAgentEventsLog,
+	filenames.VzEfi,
+	filenames.QemuEfiCodeFD,
+	filenames.ConsoleLock,
+	filenames.ShutdownTimeout,
+}
+
+func factoryResetAction(cmd *cobra.Command, args []string) error {
 	instName := DefaultInstanceName
 	if len(args) > 0 {
 		instName = args[0]
 	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	tty, err := cmd.Flags().GetBool("tty")
+	if err != nil {
+		return err
+	}
 
 	inst, err := store.Inspect(instName)
 	if err != nil {
@@ -38,20 +81,33 @@ func factoryResetAction(_ *cobra.Command, args []string) error {
 		}
 		return err
 	}
+	if inst.Protected {
+		return fmt.Errorf("instance %q is protected to prohibit accidental reset (Hint: use `limactl unprotect`)", instName)
+	}
+	if !force {
+		if !tty {
+			return fmt.Errorf("factory-resetting instance %q requires --force when the terminal is not available", instName)
+		}
+		message := fmt.Sprintf("Do you want to factory reset instance %q? The disks of the instance will be removed", instName)
+		ans, err := uiutil.Confirm(message, false)
+		if err != nil {
+			return err
+		}
+		if !ans {
+			return fmt.Errorf("instance %q was not reset", instName)
+		}
+	}
 
 	stopInstanceForcibly(inst)
 
-	fi, err := os.ReadDir(inst.Dir)
-	if err != nil {
-		return err
-	}
-	for _, f := range fi {
-		path := filepath.Join(inst.Dir, f.Name())
-		if !strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml") && f.Name() != filenames.VzIdentifier {
-			logrus.Infof("Removing %q", path)
-			if err := os.Remove(path); err != nil {
-				logrus.Error(err)
-			}
+	for _, f := range factoryResetFiles {
+		path := filepath.Join(inst.Dir, f)
+		if _, err := os.Lstat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		logrus.Infof("Removing %q", path)
+		if err := os.RemoveAll(path); err != nil {
+			logrus.Error(err)
 		}
 	}
 	logrus.Infof("Instance %q has been factory reset", instName)
@@ -5,9 +5,11 @@ import (
 	"net/url"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/containerd/containerd/identifiers"
+	"github.com/sirupsen/logrus"
 )
 
 func SeemsTemplateURL(arg string) (bool, *url.URL) {
@@ -29,6 +31,20 @@ func SeemsHTTPURL(arg string) bool {
 	return true
 }
 
+// GitHubRawURL returns the "raw.githubusercontent.com" URL for a "github.com/OWNER/REPO/blob/REF/PATH" URL.
+func GitHubRawURL(arg string) (string, bool) {
+	u, err := url.Parse(arg)
+	if err != nil || u.Host != "github.com" {
+		return "", false
+	}
+	// "/OWNER/REPO/blob/REF/PATH" -> ["", "OWNER", "REPO", "blob", "REF/PATH"]
+	elems := strings.SplitN(u.Path, "/", 5)
+	if len(elems) != 5 || elems[3] != "blob" {
+		return "", false
+	}
+	return "https://raw.githubusercontent.com/" + path.Join(elems[1], elems[2], elems[4]), true
+}
+
 func SeemsFileURL(arg string) bool {
 	u, err := url.Parse(arg)
 	if err != nil {
@@ -50,15 +66,45 @@ func InstNameFromURL(urlStr string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return InstNameFromYAMLPath(path.Base(u.Path))
+	// e.g., "foo.yaml.gz" -> "foo"
+	return InstNameFromYAMLPath(strings.TrimSuffix(path.Base(u.Path), ".gz"))
 }
 
+// InstNameFromYAMLPath returns the instance name for yamlPath, e.g., "foo-bar" for "/path/to/Foo.Bar.yaml".
+//
+// When the name is not a valid identifier, e.g., for "_foo.yaml" or "foo bar.yaml",
+// the name is sanitized with a warning; see [SanitizeInstName].
+// The name can be specified explicitly with `--name` instead.
 func InstNameFromYAMLPath(yamlPath string) (string, error) {
 	s := strings.ToLower(filepath.Base(yamlPath))
 	s = strings.TrimSuffix(strings.TrimSuffix(s, ".yml"), ".yaml")
 	s = strings.ReplaceAll(s, ".", "-")
-	if err := identifiers.Validate(s); err != nil {
-		return "", fmt.Errorf("filename %q is invalid: %w", yamlPath, err)
+	if err := identifiers.Validate(s); err == nil {
+		return s, nil
+	}
+	sanitized := SanitizeInstName(s)
+	if err := identifiers.Validate(sanitized); err != nil {
+		return "", fmt.Errorf("filename %q is invalid, specify the instance name with `--name`: %w", yamlPath, err)
+	}
+	logrus.Warnf("Using instance name %q for filename %q, as %q is not a valid instance name; specify `--name` to choose another name",
+		sanitized, yamlPath, s)
+	return sanitized, nil
+}
+
+// instNameMaxLength is the maximum length accepted by identifiers.Validate.
+const instNameMaxLength = 76
+
+var instNameSeparatorsRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+
+// SanitizeInstName converts s into a valid instance name:
+// the runs of characters other than [a-z0-9] are replaced with a single "-",
+// the leading and trailing "-" are removed, and the name is truncated to 76 characters.
+// The result is empty when s contains no [a-z0-9] characters.
+func SanitizeInstName(s string) string {
+	s = instNameSeparatorsRegexp.ReplaceAllString(strings.ToLower(s), "-")
+	s = strings.Trim(s, "-")
+	if len(s) > instNameMaxLength {
+		s = strings.TrimRight(s[:instNameMaxLength], "-")
 	}
-	return s, nil
+	return s
 }
@@ -0,0 +1,37 @@
+package guessarg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/identifiers"
+	"gotest.tools/v3/assert"
+)
+
+func TestSanitizeInstName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"valid", "foo", "foo"},
+		{"leading digits", "1234-foo", "1234-foo"},
+		{"dots", "foo.bar.baz", "foo-bar-baz"},
+		{"uppercase", "Foo-BAR", "foo-bar"},
+		{"leading and trailing separators", "_foo_", "foo"},
+		{"runs of separators", "foo  @@ bar", "foo-bar"},
+		{"non-ASCII", "fooÄbar", "foo-bar"},
+		{"empty result", "_.-", ""},
+		{"empty", "", ""},
+		{"truncated", strings.Repeat("a", 75) + "-b", strings.Repeat("a", 75)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := SanitizeInstName(tc.input)
+			assert.Equal(t, actual, tc.expected)
+			if actual != "" {
+				assert.NilError(t, identifiers.Validate(actual))
+			}
+		})
+	}
+}
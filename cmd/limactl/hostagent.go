@@ -30,6 +30,9 @@ func newHostagentCommand() *cobra.Command {
 	hostagentCommand.Flags().String("socket", "", "hostagent socket")
 	hostagentCommand.Flags().Bool("run-gui", false, "run gui synchronously within hostagent")
 	hostagentCommand.Flags().String("nerdctl-archive", "", "local file path (not URL) of nerdctl-full-VERSION-GOOS-GOARCH.tar.gz")
+	hostagentCommand.Flags().Bool("paused", false, "start the VM with its vCPUs paused")
+	hostagentCommand.Flags().String("cloud-init-user-data", "", "local file path of the cloud-init user-data to merge into the generated one")
+	hostagentCommand.Flags().String("cloud-init-network-config", "", "local file path of the cloud-init network-config to merge into the generated one")
 	return hostagentCommand
 }
 
@@ -82,6 +85,27 @@ func hostagentAction(cmd *cobra.Command, args []string) error {
 	if nerdctlArchive != "" {
 		opts = append(opts, hostagent.WithNerdctlArchive(nerdctlArchive))
 	}
+	paused, err := cmd.Flags().GetBool("paused")
+	if err != nil {
+		return err
+	}
+	if paused {
+		opts = append(opts, hostagent.WithStartPaused())
+	}
+	userData, err := cmd.Flags().GetString("cloud-init-user-data")
+	if err != nil {
+		return err
+	}
+	if userData != "" {
+		opts = append(opts, hostagent.WithCloudInitUserData(userData))
+	}
+	networkConfig, err := cmd.Flags().GetString("cloud-init-network-config")
+	if err != nil {
+		return err
+	}
+	if networkConfig != "" {
+		opts = append(opts, hostagent.WithCloudInitNetworkConfig(networkConfig))
+	}
 	ha, err := hostagent.New(instName, stdout, signalCh, opts...)
 	if err != nil {
 		return err
@@ -98,14 +122,20 @@ func hostagentAction(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	l, err := net.Listen("unix", socket)
-	logrus.Infof("hostagent socket created at %s", socket)
 	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(socket)
+	defer srv.Close()
+	// The API exposes the state of the instance, e.g., the forwarded ports.
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(socket, 0o600); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("hostagent socket created at %s", socket)
 	go func() {
-		defer os.RemoveAll(socket)
-		defer srv.Close()
-		if serveErr := srv.Serve(l); serveErr != nil {
+		if serveErr := srv.Serve(l); serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
 			logrus.WithError(serveErr).Warn("hostagent API server exited with an error")
 		}
 	}()
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/lima-vm/lima/pkg/bundle"
+	"github.com/lima-vm/lima/pkg/start"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newImportCommand() *cobra.Command {
+	importCommand := &cobra.Command{
+		Use:   "import FILE" + bundle.FileExtension,
+		Short: "Import an instance from a bundle created by 'limactl export'",
+		Long: `Import an instance from a bundle created by 'limactl export'.
+
+The instance is created with the name of the exported instance, unless --name is specified.
+The MAC addresses and the SSH port are assigned for the new host, unless lima.yaml specifies them explicitly.
+
+Requires the zstd command.`,
+		Example: `  $ limactl import default.limabundle
+  $ limactl import --name=default2 default.limabundle`,
+		Args:    WrapArgsError(cobra.ExactArgs(1)),
+		RunE:    importAction,
+		GroupID: advancedCommand,
+	}
+	importCommand.Flags().String("name", "", "name of the new instance (default: the name of the exported instance)")
+	return importCommand
+}
+
+func importAction(cmd *cobra.Command, args []string) error {
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+	inst, err := bundle.Import(ctx, args[0], name)
+	if err != nil {
+		return err
+	}
+	if len(inst.Errors) > 0 {
+		logrus.WithField("errors", inst.Errors).Warnf("instance %q has errors", inst.Name)
+	}
+	if err := start.Register(ctx, inst); err != nil {
+		return err
+	}
+	logrus.Infof("Imported instance %q. Run `limactl start %s` to start the instance.", inst.Name, inst.Name)
+	return nil
+}
@@ -2,25 +2,57 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path/filepath"
 
+	hostagentapi "github.com/lima-vm/lima/pkg/hostagent/api"
+	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
 	"github.com/lima-vm/lima/pkg/infoutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
 	"github.com/spf13/cobra"
 )
 
 func newInfoCommand() *cobra.Command {
 	infoCommand := &cobra.Command{
-		Use:     "info",
-		Short:   "Show diagnostic information",
-		Args:    WrapArgsError(cobra.NoArgs),
-		RunE:    infoAction,
-		GroupID: advancedCommand,
+		Use:   "info [INSTANCE --running]",
+		Short: "Show diagnostic information",
+		Example: `  Show the diagnostic information of Lima:
+  $ limactl info
+
+  Show the state of the host agent of a running instance:
+  $ limactl info default --running
+`,
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              infoAction,
+		ValidArgsFunction: infoBashComplete,
+		GroupID:           advancedCommand,
 	}
+	infoCommand.Flags().Bool("running", false, "show the state of the host agent of the running instance, e.g., the forwarded ports")
 	return infoCommand
 }
 
-func infoAction(cmd *cobra.Command, _ []string) error {
-	info, err := infoutil.GetInfo()
+// runningInfo is the state of the host agent of a running instance.
+type runningInfo struct {
+	*hostagentapi.Info
+	PortForwards []hostagentapi.PortForward `json:"portForwards"`
+}
+
+func infoAction(cmd *cobra.Command, args []string) error {
+	running, err := cmd.Flags().GetBool("running")
+	if err != nil {
+		return err
+	}
+	if running != (len(args) == 1) {
+		return errors.New("an instance name and --running must be specified together")
+	}
+	var info any
+	if running {
+		info, err = getRunningInfo(cmd, args[0])
+	} else {
+		info, err = infoutil.GetInfo()
+	}
 	if err != nil {
 		return err
 	}
@@ -31,3 +63,31 @@ func infoAction(cmd *cobra.Command, _ []string) error {
 	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(j))
 	return err
 }
+
+func getRunningInfo(cmd *cobra.Command, instName string) (*runningInfo, error) {
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return nil, err
+	}
+	if inst.Status != store.StatusRunning {
+		return nil, fmt.Errorf("instance %q is not running", instName)
+	}
+	haClient, err := hostagentclient.NewHostAgentClient(filepath.Join(inst.Dir, filenames.HostAgentSock))
+	if err != nil {
+		return nil, err
+	}
+	ctx := cmd.Context()
+	haInfo, err := haClient.Info(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	forwards, err := haClient.PortForwards(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &runningInfo{Info: haInfo, PortForwards: forwards}, nil
+}
+
+func infoBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
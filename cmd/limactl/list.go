@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/cheggaaa/pb/v3/termutil"
+	"github.com/lima-vm/lima/pkg/stats"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/mattn/go-isatty"
 	"github.com/sirupsen/logrus"
@@ -59,6 +60,7 @@ The following legacy flags continue to function:
 	listCommand.Flags().Bool("json", false, "JSONify output")
 	listCommand.Flags().BoolP("quiet", "q", false, "Only show names")
 	listCommand.Flags().Bool("all-fields", false, "Show all fields")
+	listCommand.Flags().Bool("stats", false, "Show the resource usage of the running instances (see `limactl stats`)")
 
 	return listCommand
 }
@@ -106,6 +108,13 @@ func listAction(cmd *cobra.Command, args []string) error {
 	if quiet && format != "table" {
 		return errors.New("option --quiet can only be used with '--format table'")
 	}
+	showStats, err := cmd.Flags().GetBool("stats")
+	if err != nil {
+		return err
+	}
+	if showStats && (quiet || format != "table") {
+		return errors.New("option --stats can only be used with '--format table'")
+	}
 
 	if listFields {
 		names := fieldNames()
@@ -175,6 +184,17 @@ func listAction(cmd *cobra.Command, args []string) error {
 	}
 
 	options := store.PrintOptions{AllFields: allFields}
+	if showStats {
+		options.ExtraColumns = stats.TableHeader
+		all := stats.GetAll(cmd.Context(), instances, stats.NewCPUSampler())
+		rows := make(map[string][]string, len(all))
+		for _, s := range all {
+			rows[s.Name] = s.TableRow()
+		}
+		options.ExtraValues = func(inst *store.Instance) []string {
+			return rows[inst.Name]
+		}
+	}
 	out := cmd.OutOrStdout()
 	if out == os.Stdout {
 		if isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()) {
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/sshutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/nxadm/tail"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+func newLogsCommand() *cobra.Command {
+	logsCommand := &cobra.Command{
+		Use:   "logs INSTANCE",
+		Short: "Show the logs of an instance",
+		Long: `Show the logs of an instance.
+
+The sources are:
+- ha:         the host agent log (` + filenames.HostAgentStderrLog + `)
+- serial:     the serial console logs (` + filenames.SerialLog + `, ` + filenames.SerialPCILog + `, ` + filenames.SerialVirtioLog + `)
+- cloud-init: /var/log/cloud-init-output.log in the guest (only available while the instance is running)
+
+The lines are prefixed with the source name.
+--since only applies to the host agent log, as the lines of the other sources have no timestamps.
+The lines of the other sources are shown regardless of --since.`,
+		Example: `  $ limactl logs default
+  $ limactl logs --follow --source ha default
+  $ limactl logs --since 10m default`,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              logsAction,
+		ValidArgsFunction: logsBashComplete,
+		GroupID:           advancedCommand,
+	}
+	logsCommand.Flags().BoolP("follow", "f", false, "follow the logs, waiting for the log files that do not exist yet")
+	logsCommand.Flags().String("source", "all", "log source, one of: ha, serial, cloud-init, all")
+	logsCommand.Flags().Duration("since", 0, "show the lines of the host agent log newer than the duration, e.g., 10m (the other sources are not filtered)")
+	return logsCommand
+}
+
+const (
+	logSourceHostAgent = "ha"
+	logSourceSerial    = "serial"
+	logSourceCloudInit = "cloud-init"
+	logSourceAll       = "all"
+)
+
+// logFile is a log file under the instance directory.
+type logFile struct {
+	prefix string
+	path   string
+}
+
+func logsAction(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	follow, err := flags.GetBool("follow")
+	if err != nil {
+		return err
+	}
+	source, err := flags.GetString("source")
+	if err != nil {
+		return err
+	}
+	since, err := flags.GetDuration("since")
+	if err != nil {
+		return err
+	}
+	var sources []string
+	switch source {
+	case logSourceHostAgent, logSourceSerial, logSourceCloudInit:
+		sources = []string{source}
+	case logSourceAll:
+		sources = []string{logSourceHostAgent, logSourceSerial, logSourceCloudInit}
+	default:
+		return fmt.Errorf("unknown source %q (must be %q, %q, %q, or %q)", source, logSourceHostAgent, logSourceSerial, logSourceCloudInit, logSourceAll)
+	}
+	inst, err := store.Inspect(args[0])
+	if err != nil {
+		return err
+	}
+
+	var files []logFile
+	if slices.Contains(sources, logSourceHostAgent) {
+		files = append(files, logFile{prefix: logSourceHostAgent, path: filepath.Join(inst.Dir, filenames.HostAgentStderrLog)})
+	}
+	if slices.Contains(sources, logSourceSerial) {
+		for _, f := range []string{filenames.SerialLog, filenames.SerialPCILog, filenames.SerialVirtioLog} {
+			files = append(files, logFile{prefix: strings.TrimSuffix(f, ".log"), path: filepath.Join(inst.Dir, f)})
+		}
+	}
+	cloudInit := slices.Contains(sources, logSourceCloudInit)
+	if cloudInit && inst.Status != store.StatusRunning {
+		if source == logSourceCloudInit {
+			return fmt.Errorf("the cloud-init log is only available while the instance is running (status %q)", inst.Status)
+		}
+		logrus.Infof("Skipping the cloud-init log, as instance %q is not running", inst.Name)
+		cloudInit = false
+	}
+
+	lw := &logWriter{w: cmd.OutOrStdout()}
+	if since > 0 {
+		lw.since = time.Now().Add(-since)
+	}
+	ctx := cmd.Context()
+	if !follow {
+		for _, f := range files {
+			if err := readLogFile(lw, f); err != nil {
+				return err
+			}
+		}
+		if cloudInit {
+			return readCloudInitLog(ctx, lw, inst, false)
+		}
+		return nil
+	}
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, f := range files {
+		f := f
+		eg.Go(func() error {
+			return followLogFile(ctx, lw, f)
+		})
+	}
+	if cloudInit {
+		eg.Go(func() error {
+			return readCloudInitLog(ctx, lw, inst, true)
+		})
+	}
+	err = eg.Wait()
+	if errors.Is(err, context.Canceled) {
+		// interrupted
+		return nil
+	}
+	return err
+}
+
+// logWriter writes the lines of the log sources, prefixed with the source name.
+type logWriter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	since time.Time
+}
+
+func (lw *logWriter) writeLine(prefix, line string) error {
+	if !lw.since.IsZero() {
+		if t, ok := logLineTime(line); ok && t.Before(lw.since) {
+			return nil
+		}
+	}
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	_, err := fmt.Fprintf(lw.w, "[%s] %s\n", prefix, strings.TrimRight(line, "\r"))
+	return err
+}
+
+// logLineTime returns the timestamp of the JSON log line, such as the lines of the host agent log.
+func logLineTime(line string) (time.Time, bool) {
+	var j struct {
+		Time time.Time `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(line), &j); err != nil || j.Time.IsZero() {
+		return time.Time{}, false
+	}
+	return j.Time, true
+}
+
+func scanLines(r io.Reader, fn func(string) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if err := fn(sc.Text()); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func readLogFile(lw *logWriter, f logFile) error {
+	r, err := os.Open(f.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			logrus.Debugf("Skipping %q, as it does not exist", f.path)
+			return nil
+		}
+		return err
+	}
+	defer r.Close()
+	return scanLines(r, func(line string) error {
+		return lw.writeLine(f.prefix, line)
+	})
+}
+
+// followLogFile is similar to `tail -F`, so the file does not need to exist yet.
+func followLogFile(ctx context.Context, lw *logWriter, f logFile) error {
+	t, err := tail.TailFile(f.path, tail.Config{
+		Follow: true,
+		ReOpen: true,
+		Logger: tail.DiscardingLogger,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = t.Stop()
+		t.Cleanup()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-t.Lines:
+			if !ok {
+				return t.Err()
+			}
+			if line.Err != nil {
+				logrus.WithError(line.Err).Warnf("failed to read %q", f.path)
+				continue
+			}
+			if err := lw.writeLine(f.prefix, line.Text); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readCloudInitLog reads /var/log/cloud-init-output.log in the guest, over SSH.
+func readCloudInitLog(ctx context.Context, lw *logWriter, inst *store.Instance, follow bool) error {
+	arg0, err := exec.LookPath("ssh")
+	if err != nil {
+		return err
+	}
+	sshOpts, err := sshutil.SSHOpts(inst.Dir, *inst.Config.SSH.GenerateDedicatedKey, *inst.Config.SSH.LoadDotSSHPubKeys, false, false, false, sshutil.ConnectionOpts{
+		ControlPersist:      *inst.Config.SSH.ControlPersist,
+		ServerAliveInterval: *inst.Config.SSH.ServerAliveInterval,
+		ServerAliveCountMax: *inst.Config.SSH.ServerAliveCountMax,
+	})
+	if err != nil {
+		return err
+	}
+	script := "sudo tail -n +1 /var/log/cloud-init-output.log"
+	if follow {
+		script = "sudo tail -n +1 -F /var/log/cloud-init-output.log"
+	}
+	sshArgs := sshutil.SSHArgsFromOpts(sshOpts)
+	sshArgs = append(sshArgs, "-q", "-p", strconv.Itoa(inst.SSHLocalPort), inst.SSHAddress, "--", script)
+	sshCmd := exec.CommandContext(ctx, arg0, sshArgs...)
+	sshCmd.Stderr = os.Stderr
+	stdout, err := sshCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("executing ssh: %+v", sshCmd.Args)
+	if err := sshCmd.Start(); err != nil {
+		return err
+	}
+	scanErr := scanLines(stdout, func(line string) error {
+		return lw.writeLine(logSourceCloudInit, line)
+	})
+	if err := sshCmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("failed to read the cloud-init log: %w", err)
+	}
+	return scanErr
+}
+
+func logsBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
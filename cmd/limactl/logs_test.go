@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLogLineTime(t *testing.T) {
+	testCases := []struct {
+		name     string
+		line     string
+		expected time.Time
+		ok       bool
+	}{
+		{
+			name:     "host agent log",
+			line:     `{"level":"info","msg":"SSH Local Port: 60022","time":"2024-05-01T12:34:56+09:00"}`,
+			expected: time.Date(2024, 5, 1, 3, 34, 56, 0, time.UTC),
+			ok:       true,
+		},
+		{
+			name:     "fractional seconds",
+			line:     `{"msg":"foo","time":"2024-05-01T03:34:56.789Z"}`,
+			expected: time.Date(2024, 5, 1, 3, 34, 56, 789000000, time.UTC),
+			ok:       true,
+		},
+		{name: "serial console", line: "[    0.000000] Linux version 6.8.0-31-generic"},
+		{name: "JSON without time", line: `{"level":"info","msg":"foo"}`},
+		{name: "invalid time", line: `{"msg":"foo","time":"yesterday"}`},
+		{name: "empty", line: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, ok := logLineTime(tc.line)
+			assert.Equal(t, tc.ok, ok)
+			assert.Assert(t, actual.Equal(tc.expected), "expected %v, got %v", tc.expected, actual)
+		})
+	}
+}
+
+func TestLogWriterSince(t *testing.T) {
+	var b bytes.Buffer
+	lw := &logWriter{w: &b, since: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+	assert.NilError(t, lw.writeLine("ha", `{"msg":"old","time":"2024-04-30T23:59:59Z"}`))
+	assert.NilError(t, lw.writeLine("ha", `{"msg":"new","time":"2024-05-01T00:00:00Z"}`))
+	// the lines without timestamps are not filtered
+	assert.NilError(t, lw.writeLine("serial", "login:\r"))
+	assert.Equal(t, "[ha] {\"msg\":\"new\",\"time\":\"2024-05-01T00:00:00Z\"}\n[serial] login:\n", b.String())
+}
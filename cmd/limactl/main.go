@@ -61,6 +61,8 @@ func newApp() *cobra.Command {
 	}
 	rootCmd.PersistentFlags().String("log-level", "", "Set the logging level [trace, debug, info, warn, error]")
 	rootCmd.PersistentFlags().Bool("debug", false, "debug mode")
+	rootCmd.PersistentFlags().String("log-format", "", "Set the logging format [text, json] (default: $LIMA_LOG_FORMAT, or text). "+
+		"The json format also emits the structured progress events of `limactl start`")
 	// TODO: "survey" does not support using cygwin terminal on windows yet
 	rootCmd.PersistentFlags().Bool("tty", isatty.IsTerminal(os.Stdout.Fd()), "Enable TUI interactions such as opening an editor. Defaults to true when stdout is a terminal. Set to false for automation.")
 	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, _ []string) error {
@@ -88,6 +90,19 @@ func newApp() *cobra.Command {
 			formatter.ForceColors = true
 			logrus.StandardLogger().SetFormatter(formatter)
 		}
+		if logFormat, _ := cmd.Flags().GetString("log-format"); logFormat != "" {
+			// propagated to the host agent, and to the other subprocesses
+			if err := os.Setenv("LIMA_LOG_FORMAT", logFormat); err != nil {
+				return err
+			}
+		}
+		switch logFormat := os.Getenv("LIMA_LOG_FORMAT"); logFormat {
+		case "", "text":
+		case "json":
+			logrus.StandardLogger().SetFormatter(new(logrus.JSONFormatter))
+		default:
+			return fmt.Errorf("unknown $LIMA_LOG_FORMAT %q (must be \"text\" or \"json\")", logFormat)
+		}
 		if os.Geteuid() == 0 && cmd.Name() != "generate-doc" {
 			return errors.New("must not run as the root user")
 		}
@@ -123,20 +138,37 @@ func newApp() *cobra.Command {
 		newListCommand(),
 		newDeleteCommand(),
 		newValidateCommand(),
+		newDoctorCommand(),
 		newSudoersCommand(),
 		newPruneCommand(),
 		newHostagentCommand(),
 		newInfoCommand(),
+		newEventsCommand(),
+		newLogsCommand(),
 		newShowSSHCommand(),
+		newSSHConfigCommand(),
 		newDebugCommand(),
 		newEditCommand(),
 		newFactoryResetCommand(),
+		newExportCommand(),
+		newImportCommand(),
 		newDiskCommand(),
 		newUsernetCommand(),
 		newGenDocCommand(),
 		newSnapshotCommand(),
 		newProtectCommand(),
 		newUnprotectCommand(),
+		newPauseCommand(),
+		newResumeCommand(),
+		newResizeCommand(),
+		newUSBCommand(),
+		newNICCommand(),
+		newTunnelCommand(),
+		newConsoleCommand(),
+		newScreenshotCommand(),
+		newCompactDiskCommand(),
+		newStatsCommand(),
+		newTopCommand(),
 	)
 	if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
 		rootCmd.AddCommand(startAtLoginCommand())
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newNICCommand() *cobra.Command {
+	nicCommand := &cobra.Command{
+		Use:   "nic",
+		Short: "Manage NICs of a running instance",
+		Long: `Add and remove NICs of a running instance, without restarting it (QEMU only).
+The NICs are not persisted, i.e., they are gone on the next start.
+The "q35" and "virt" machines need ports reserved by the "qemu.hotplugPorts" field.`,
+		PersistentPreRun: func(*cobra.Command, []string) {
+			logrus.Warn("`limactl nic` is experimental")
+		},
+		GroupID: advancedCommand,
+	}
+	nicCommand.AddCommand(newNICAddCommand())
+	nicCommand.AddCommand(newNICRemoveCommand())
+	return nicCommand
+}
+
+func newNICAddCommand() *cobra.Command {
+	addCommand := &cobra.Command{
+		Use:   "add INSTANCE",
+		Short: "Add a NIC to a running instance",
+		Example: `  To add a NIC connected to the "user-v2" network of networks.yaml:
+  $ limactl nic add --network=user-v2 default
+
+  To add a NIC connected to a QEMU-compatible socket:
+  $ limactl nic add --socket=/var/run/socket_vmnet default`,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              nicAddAction,
+		ValidArgsFunction: nicBashComplete,
+	}
+	addCommand.Flags().String("network", "", "network name in networks.yaml")
+	addCommand.Flags().String("socket", "", "QEMU-compatible socket")
+	addCommand.Flags().String("mac", "", "MAC address (default: derived from the instance and the NIC ID)")
+	return addCommand
+}
+
+func nicAddAction(cmd *cobra.Command, args []string) error {
+	inst, err := runningInstance(args[0])
+	if err != nil {
+		return err
+	}
+	flags := cmd.Flags()
+	var nw limayaml.Network
+	if nw.Lima, err = flags.GetString("network"); err != nil {
+		return err
+	}
+	if nw.Socket, err = flags.GetString("socket"); err != nil {
+		return err
+	}
+	if nw.MACAddress, err = flags.GetString("mac"); err != nil {
+		return err
+	}
+	limaDriver, err := newInstanceDriver(inst)
+	if err != nil {
+		return err
+	}
+	id, err := limaDriver.AddNIC(cmd.Context(), nw)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Added NIC %q to %q", id, inst.Name)
+	fmt.Fprintln(cmd.OutOrStdout(), id)
+	return nil
+}
+
+func newNICRemoveCommand() *cobra.Command {
+	removeCommand := &cobra.Command{
+		Use:               "remove INSTANCE ID",
+		Aliases:           []string{"rm"},
+		Short:             "Remove a NIC added by 'limactl nic add' from a running instance",
+		Args:              WrapArgsError(cobra.ExactArgs(2)),
+		RunE:              nicRemoveAction,
+		ValidArgsFunction: nicBashComplete,
+	}
+	return removeCommand
+}
+
+func nicRemoveAction(cmd *cobra.Command, args []string) error {
+	inst, err := runningInstance(args[0])
+	if err != nil {
+		return err
+	}
+	limaDriver, err := newInstanceDriver(inst)
+	if err != nil {
+		return err
+	}
+	if err := limaDriver.RemoveNIC(cmd.Context(), args[1]); err != nil {
+		return err
+	}
+	logrus.Infof("Removed NIC %q from %q", args[1], inst.Name)
+	return nil
+}
+
+func runningInstance(instName string) (*store.Instance, error) {
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return nil, err
+	}
+	if inst.Status != store.StatusRunning {
+		return nil, fmt.Errorf("expected status %q, got %q", store.StatusRunning, inst.Status)
+	}
+	return inst, nil
+}
+
+func nicBashComplete(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return bashCompleteInstanceNames(cmd)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/lima-vm/lima/pkg/pause"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newPauseCommand() *cobra.Command {
+	pauseCommand := &cobra.Command{
+		Use:   "pause INSTANCE",
+		Short: "Pause an instance",
+		Long: `Pause an instance by stopping its vCPUs, without shutting down the guest.
+Use 'limactl resume' to continue. Only supported for QEMU instances.`,
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              pauseAction,
+		ValidArgsFunction: pauseBashComplete,
+		GroupID:           advancedCommand,
+	}
+	return pauseCommand
+}
+
+func pauseAction(cmd *cobra.Command, args []string) error {
+	instName := DefaultInstanceName
+	if len(args) > 0 {
+		instName = args[0]
+	}
+
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	if err := pause.Pause(cmd.Context(), inst); err != nil {
+		return err
+	}
+	logrus.Infof("Paused %q", instName)
+	return nil
+}
+
+func pauseBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
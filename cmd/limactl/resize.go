@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/resize"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func newResizeCommand() *cobra.Command {
+	resizeCommand := &cobra.Command{
+		Use:   "resize INSTANCE --memory SIZE",
+		Short: "Resize the memory of a running instance",
+		Long: `Resize the memory of a running instance, using the memory balloon.
+The instance must have been started with 'memoryBalloon.enabled: true'.
+The memory cannot grow beyond the 'memory' size in the configuration.`,
+		Example: `  $ limactl resize default --memory 2GiB
+`,
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              resizeAction,
+		ValidArgsFunction: resizeBashComplete,
+		GroupID:           advancedCommand,
+	}
+	resizeCommand.Flags().String("memory", "", "memory size, e.g., \"4GiB\"")
+	return resizeCommand
+}
+
+func resizeAction(cmd *cobra.Command, args []string) error {
+	instName := DefaultInstanceName
+	if len(args) > 0 {
+		instName = args[0]
+	}
+	memory, err := cmd.Flags().GetString("memory")
+	if err != nil {
+		return err
+	}
+	if memory == "" {
+		return errors.New("requires --memory")
+	}
+	size, err := units.RAMInBytes(memory)
+	if err != nil {
+		return fmt.Errorf("failed to parse the memory size %q: %w", memory, err)
+	}
+
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	return resize.Memory(cmd.Context(), inst, size)
+}
+
+func resizeBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
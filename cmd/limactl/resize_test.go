@@ -0,0 +1,27 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestResizeFlags(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"no memory", []string{"default"}, "requires --memory"},
+		{"invalid memory", []string{"default", "--memory", "lots"}, `failed to parse the memory size "lots"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := newResizeCommand()
+			cmd.SetArgs(tc.args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+			assert.ErrorContains(t, cmd.Execute(), tc.expected)
+		})
+	}
+}
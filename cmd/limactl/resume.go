@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/lima-vm/lima/pkg/pause"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newResumeCommand() *cobra.Command {
+	resumeCommand := &cobra.Command{
+		Use:               "resume INSTANCE",
+		Short:             "Resume a paused instance",
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              resumeAction,
+		ValidArgsFunction: resumeBashComplete,
+		GroupID:           advancedCommand,
+	}
+	return resumeCommand
+}
+
+func resumeAction(cmd *cobra.Command, args []string) error {
+	instName := DefaultInstanceName
+	if len(args) > 0 {
+		instName = args[0]
+	}
+
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	if err := pause.Resume(cmd.Context(), inst); err != nil {
+		return err
+	}
+	logrus.Infof("Resumed %q", instName)
+	return nil
+}
+
+func resumeBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
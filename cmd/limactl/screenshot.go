@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/screenshot"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newScreenshotCommand() *cobra.Command {
+	screenshotCommand := &cobra.Command{
+		Use:   "screenshot INSTANCE",
+		Short: "Save a screenshot of the display of an instance as PNG",
+		Long: `Save a screenshot of the display of an instance as PNG.
+Useful for seeing a kernel panic when SSH is not available.
+Works whether or not VNC is configured.`,
+		Example:           "  $ limactl screenshot default -o screen.png",
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              screenshotAction,
+		ValidArgsFunction: screenshotBashComplete,
+		GroupID:           advancedCommand,
+	}
+	screenshotCommand.Flags().StringP("output", "o", "", "output PNG file, or \"-\" for stdout")
+	_ = screenshotCommand.MarkFlagRequired("output")
+	return screenshotCommand
+}
+
+func screenshotAction(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	instName := DefaultInstanceName
+	if len(args) > 0 {
+		instName = args[0]
+	}
+
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	img, err := screenshot.Take(cmd.Context(), inst)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return err
+	}
+	if output == "-" {
+		_, err = cmd.OutOrStdout().Write(b.Bytes())
+		return err
+	}
+	if err := os.WriteFile(output, b.Bytes(), 0o644); err != nil {
+		return err
+	}
+	logrus.Infof("Saved the screenshot of %q to %q", instName, output)
+	return nil
+}
+
+func screenshotBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
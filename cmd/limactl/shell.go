@@ -3,12 +3,17 @@ package main
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"os/exec"
+	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/alessio/shellescape"
+	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/sshutil"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/mattn/go-isatty"
@@ -28,6 +33,9 @@ lima command is provided as an alias for limactl shell $LIMA_INSTANCE. $LIMA_INS
 By default, the first 'ssh' executable found in the host's PATH is used to connect to the Lima instance.
 A custom ssh alias can be used instead by setting the $` + envShellSSH + ` environment variable.
 
+Environment variables are set from the "shell.env" map of lima.yaml, the host variables named with --preserve-env,
+and --env, in the ascending order of precedence.
+
 Hint: try --debug to show the detailed logs, if it seems hanging (mostly due to some SSH issue).
 `
 
@@ -46,7 +54,9 @@ func newShellCommand() *cobra.Command {
 	shellCmd.Flags().SetInterspersed(false)
 
 	shellCmd.Flags().String("shell", "", "shell interpreter, e.g. /bin/bash")
-	shellCmd.Flags().String("workdir", "", "working directory")
+	shellCmd.Flags().String("workdir", "", "working directory in the guest (default: shell.workdir in lima.yaml, or the current directory if it exists in the guest)")
+	shellCmd.Flags().StringArray("env", nil, "environment variable for the shell, as KEY=VALUE (can be specified multiple times)")
+	shellCmd.Flags().StringSlice("preserve-env", nil, "names of the environment variables to pass from the host, e.g., https_proxy,LANG")
 	return shellCmd
 }
 
@@ -78,44 +88,35 @@ func shellAction(cmd *cobra.Command, args []string) error {
 	if inst.Status == store.StatusStopped {
 		return fmt.Errorf("instance %q is stopped, run `limactl start %s` to start the instance", instName, instName)
 	}
+	if inst.Status == store.StatusPaused {
+		return fmt.Errorf("instance %q is paused, run `limactl resume %s` to resume the instance", instName, instName)
+	}
 	y, err := inst.LoadYAML()
 	if err != nil {
 		return err
 	}
 
-	// When workDir is explicitly set, the shell MUST have workDir as the cwd, or exit with an error.
-	//
-	// changeDirCmd := "cd workDir || exit 1"                  if workDir != ""
-	//              := "cd hostCurrentDir || cd hostHomeDir"   if workDir == ""
-	var changeDirCmd string
 	workDir, err := cmd.Flags().GetString("workdir")
 	if err != nil {
 		return err
 	}
-	if workDir != "" {
-		changeDirCmd = fmt.Sprintf("cd %s || exit 1", shellescape.Quote(workDir))
-		// FIXME: check whether y.Mounts contains the home, not just len > 0
-	} else if len(y.Mounts) > 0 {
-		hostCurrentDir, err := os.Getwd()
-		if err == nil {
-			changeDirCmd = fmt.Sprintf("cd %s", shellescape.Quote(hostCurrentDir))
-		} else {
-			changeDirCmd = "false"
+	if workDir == "" {
+		workDir = *y.Shell.WorkDir
+	}
+	// FIXME: check whether y.Mounts contains the home, not just len > 0
+	mounted := len(y.Mounts) > 0
+	var hostCurrentDir, hostHomeDir string
+	if workDir == "" && mounted {
+		if hostCurrentDir, err = os.Getwd(); err != nil {
 			logrus.WithError(err).Warn("failed to get the current directory")
 		}
-		hostHomeDir, err := os.UserHomeDir()
-		if err == nil {
-			changeDirCmd = fmt.Sprintf("%s || cd %s", changeDirCmd, shellescape.Quote(hostHomeDir))
-		} else {
+		if hostHomeDir, err = os.UserHomeDir(); err != nil {
 			logrus.WithError(err).Warn("failed to get the home directory")
 		}
-	} else {
+	} else if workDir == "" {
 		logrus.Debug("the host home does not seem mounted, so the guest shell will have a different cwd")
 	}
-
-	if changeDirCmd == "" {
-		changeDirCmd = "false"
-	}
+	changeDirCmd := changeDirCommand(workDir, mounted, hostCurrentDir, hostHomeDir)
 	logrus.Debugf("changeDirCmd=%q", changeDirCmd)
 
 	shell, err := cmd.Flags().GetString("shell")
@@ -127,7 +128,12 @@ func shellAction(cmd *cobra.Command, args []string) error {
 	} else {
 		shell = shellescape.Quote(shell)
 	}
-	script := fmt.Sprintf("%s ; exec %s --login", changeDirCmd, shell)
+	env, err := shellEnv(cmd, y.Shell.Env)
+	if err != nil {
+		return err
+	}
+	// The variables are set with env(1), as SendEnv and SetEnv are ignored unless AcceptEnv is configured in sshd_config
+	script := fmt.Sprintf("%s ; exec %s%s --login", changeDirCmd, envCommandPrefix(env), shell)
 	if len(args) > 1 {
 		quotedArgs := make([]string, len(args[1:]))
 		parsingEnv := true
@@ -169,7 +175,11 @@ func shellAction(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	sshOpts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent, *y.SSH.ForwardX11, *y.SSH.ForwardX11Trusted)
+	sshOpts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.GenerateDedicatedKey, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent, *y.SSH.ForwardX11, *y.SSH.ForwardX11Trusted, sshutil.ConnectionOpts{
+		ControlPersist:      *y.SSH.ControlPersist,
+		ServerAliveInterval: *y.SSH.ServerAliveInterval,
+		ServerAliveCountMax: *y.SSH.ServerAliveCountMax,
+	})
 	if err != nil {
 		return err
 	}
@@ -195,8 +205,124 @@ func shellAction(cmd *cobra.Command, args []string) error {
 	sshCmd.Stderr = os.Stderr
 	logrus.Debugf("executing ssh (may take a long)): %+v", sshCmd.Args)
 
+	// The interrupt is handled by ssh and the remote command, so that the exit code of the remote command is propagated
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	defer signal.Stop(sigCh)
+
 	// TODO: use syscall.Exec directly (results in losing tty?)
-	return sshCmd.Run()
+	return sshExitError(sshCmd.Run())
+}
+
+// changeDirCommand returns the shell command for changing the working directory of the shell in the guest.
+// When workDir is explicitly set with --workdir or `shell.workdir`, the shell MUST have workDir as the cwd,
+// or exit with an error.
+// hostCurrentDir and hostHomeDir are empty when they could not be detected.
+//
+//	changeDirCmd := "cd workDir || exit 1"                  if workDir != ""
+//	             := "cd hostCurrentDir || cd hostHomeDir"   if workDir == "" and the host directories are mounted
+//	             := "false"                                 otherwise
+func changeDirCommand(workDir string, mounted bool, hostCurrentDir, hostHomeDir string) string {
+	if workDir != "" {
+		return fmt.Sprintf("cd %s || { echo %s >&2; exit 1; }", shellescape.Quote(workDir),
+			shellescape.Quote(fmt.Sprintf("limactl shell: failed to change the working directory to %q in the guest", workDir)))
+	}
+	if !mounted {
+		return "false"
+	}
+	changeDirCmd := "false"
+	if hostCurrentDir != "" {
+		changeDirCmd = fmt.Sprintf("cd %s 2>/dev/null", shellescape.Quote(hostCurrentDir))
+	}
+	if hostHomeDir != "" {
+		warning := fmt.Sprintf("limactl shell: warning: the current directory %q does not exist in the guest, using %q", hostCurrentDir, hostHomeDir)
+		changeDirCmd = fmt.Sprintf("%s || { echo %s >&2; cd %s; }", changeDirCmd, shellescape.Quote(warning), shellescape.Quote(hostHomeDir))
+	}
+	return changeDirCmd
+}
+
+// signaledError is an ExitCoder for ssh killed by a signal, e.g., by Ctrl-C without a tty.
+type signaledError struct {
+	signal syscall.Signal
+}
+
+func (e *signaledError) Error() string {
+	return fmt.Sprintf("ssh was killed by signal %q", e.signal)
+}
+
+// ExitCode returns 128+signal, like shells do, e.g., 130 for SIGINT.
+func (e *signaledError) ExitCode() int {
+	return 128 + int(e.signal)
+}
+
+// sshExitError converts err of ssh killed by a signal into signaledError.
+// The other errors, including *exec.ExitError, are returned as is, so that the exit code is propagated unchanged.
+func sshExitError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return &signaledError{signal: ws.Signal()}
+		}
+	}
+	return err
+}
+
+// shellEnv returns the environment variables for the shell: `shell.env` of lima.yaml (instEnv),
+// overridden by the host variables named in --preserve-env, and by --env.
+func shellEnv(cmd *cobra.Command, instEnv map[string]string) (map[string]string, error) {
+	flags := cmd.Flags()
+	env := maps.Clone(instEnv)
+	if env == nil {
+		env = make(map[string]string)
+	}
+	preserveEnv, err := flags.GetStringSlice("preserve-env")
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range preserveEnv {
+		if err := limayaml.ValidateEnvKey(k); err != nil {
+			return nil, fmt.Errorf("--preserve-env: %w", err)
+		}
+		if v, ok := os.LookupEnv(k); ok {
+			env[k] = v
+		} else {
+			logrus.Debugf("--preserve-env: %q is not set on the host", k)
+		}
+	}
+	envFlags, err := flags.GetStringArray("env")
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range envFlags {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("--env: expected KEY=VALUE, got %q", kv)
+		}
+		if err := limayaml.ValidateEnvKey(k); err != nil {
+			return nil, fmt.Errorf("--env: %w", err)
+		}
+		env[k] = v
+	}
+	return env, nil
+}
+
+// envCommandPrefix returns "env KEY1=VALUE1 KEY2=VALUE2 " with the values quoted for the shell,
+// or an empty string when env is empty.
+func envCommandPrefix(env map[string]string) string {
+	if len(env) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var sb strings.Builder
+	sb.WriteString("env ")
+	for _, k := range keys {
+		sb.WriteString(k + "=" + shellescape.Quote(env[k]) + " ")
+	}
+	return sb.String()
 }
 
 func shellBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestEnvCommandPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		env      map[string]string
+		expected string
+	}{
+		{"empty", nil, ""},
+		{"plain", map[string]string{"FOO": "foo"}, "env FOO=foo "},
+		{"sorted", map[string]string{"B": "b", "A": "a"}, "env A=a B=b "},
+		{"empty value", map[string]string{"FOO": ""}, "env FOO='' "},
+		{"space", map[string]string{"FOO": "foo bar"}, "env FOO='foo bar' "},
+		{"double quote", map[string]string{"FOO": `say "hi"`}, `env FOO='say "hi"' `},
+		{"single quote", map[string]string{"FOO": "it's"}, `env FOO='it'"'"'s' `},
+		{"expansion", map[string]string{"FOO": "$HOME `id`"}, "env FOO='$HOME `id`' "},
+		{"url", map[string]string{"https_proxy": "http://user:p@ss@proxy:3128"}, "env https_proxy=http://user:p@ss@proxy:3128 "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, envCommandPrefix(tc.env))
+		})
+	}
+}
+
+func TestShellEnv(t *testing.T) {
+	t.Setenv("LIMA_TEST_PRESERVED", "from-host")
+	cmd := newShellCommand()
+	assert.NilError(t, cmd.Flags().Parse([]string{
+		"--preserve-env", "LIMA_TEST_PRESERVED,LIMA_TEST_UNSET",
+		"--env", "FOO=from-flag",
+		"--env", "BAR=a=b",
+	}))
+	env, err := shellEnv(cmd, map[string]string{"FOO": "from-yaml", "BAZ": "from-yaml"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, map[string]string{
+		"FOO":                 "from-flag",
+		"BAR":                 "a=b",
+		"BAZ":                 "from-yaml",
+		"LIMA_TEST_PRESERVED": "from-host",
+	}, env)
+
+	for _, args := range [][]string{
+		{"--env", "FOO"},
+		{"--env", "1FOO=foo"},
+		{"--preserve-env", "FOO BAR"},
+	} {
+		cmd := newShellCommand()
+		assert.NilError(t, cmd.Flags().Parse(args))
+		_, err := shellEnv(cmd, nil)
+		assert.ErrorContains(t, err, "--")
+	}
+}
+
+func TestChangeDirCommand(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		workDir        string
+		mounted        bool
+		hostCurrentDir string
+		hostHomeDir    string
+		expected       string
+	}{
+		{
+			name:     "workdir",
+			workDir:  "/work dir",
+			mounted:  true,
+			expected: `cd '/work dir' || { echo 'limactl shell: failed to change the working directory to "/work dir" in the guest' >&2; exit 1; }`,
+		},
+		{
+			name:           "current directory",
+			mounted:        true,
+			hostCurrentDir: "/home/user/src",
+			hostHomeDir:    "/home/user",
+			expected:       `cd /home/user/src 2>/dev/null || { echo 'limactl shell: warning: the current directory "/home/user/src" does not exist in the guest, using "/home/user"' >&2; cd /home/user; }`,
+		},
+		{
+			name:           "unknown home directory",
+			mounted:        true,
+			hostCurrentDir: "/home/user/src",
+			expected:       "cd /home/user/src 2>/dev/null",
+		},
+		{
+			name:        "unknown current directory",
+			mounted:     true,
+			hostHomeDir: "/home/user",
+			expected:    `false || { echo 'limactl shell: warning: the current directory "" does not exist in the guest, using "/home/user"' >&2; cd /home/user; }`,
+		},
+		{
+			name:           "not mounted",
+			hostCurrentDir: "/home/user/src",
+			hostHomeDir:    "/home/user",
+			expected:       "false",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, changeDirCommand(tc.workDir, tc.mounted, tc.hostCurrentDir, tc.hostHomeDir))
+		})
+	}
+}
+
+func TestSSHExitError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on windows")
+	}
+	assert.NilError(t, sshExitError(nil))
+
+	// the exit code of the remote command is propagated unchanged
+	err := sshExitError(exec.Command("sh", "-c", "exit 3").Run())
+	var exitErr *exec.ExitError
+	assert.Assert(t, errors.As(err, &exitErr))
+	assert.Equal(t, 3, exitErr.ExitCode())
+
+	// ssh killed by Ctrl-C without a tty
+	cmd := exec.Command("sleep", "10")
+	assert.NilError(t, cmd.Start())
+	assert.NilError(t, cmd.Process.Signal(os.Interrupt))
+	err = sshExitError(cmd.Wait())
+	var sigErr *signaledError
+	assert.Assert(t, errors.As(err, &sigErr), "expected signaledError, got %v", err)
+	assert.Equal(t, syscall.SIGINT, sigErr.signal)
+	assert.Equal(t, 130, sigErr.ExitCode())
+}
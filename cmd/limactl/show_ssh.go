@@ -92,7 +92,11 @@ func showSSHAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	opts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent, *y.SSH.ForwardX11, *y.SSH.ForwardX11Trusted)
+	opts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.GenerateDedicatedKey, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent, *y.SSH.ForwardX11, *y.SSH.ForwardX11Trusted, sshutil.ConnectionOpts{
+		ControlPersist:      *y.SSH.ControlPersist,
+		ServerAliveInterval: *y.SSH.ServerAliveInterval,
+		ServerAliveCountMax: *y.SSH.ServerAliveCountMax,
+	})
 	if err != nil {
 		return err
 	}
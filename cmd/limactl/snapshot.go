@@ -1,8 +1,9 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/lima-vm/lima/pkg/snapshot"
 	"github.com/lima-vm/lima/pkg/store"
@@ -24,6 +25,8 @@ func newSnapshotCommand() *cobra.Command {
 	snapshotCmd.AddCommand(newSnapshotCreateCommand())
 	snapshotCmd.AddCommand(newSnapshotDeleteCommand())
 	snapshotCmd.AddCommand(newSnapshotListCommand())
+	snapshotCmd.AddCommand(newSnapshotExportCommand())
+	snapshotCmd.AddCommand(newSnapshotImportCommand())
 
 	return snapshotCmd
 }
@@ -143,6 +146,7 @@ func newSnapshotListCommand() *cobra.Command {
 		ValidArgsFunction: snapshotBashComplete,
 	}
 	listCmd.Flags().BoolP("quiet", "q", false, "Only show tags")
+	listCmd.Flags().StringP("format", "f", "", "output format, one of: json, table (default: the plain output of the driver)")
 
 	return listCmd
 }
@@ -159,32 +163,132 @@ func snapshotListAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	if quiet && format == "json" {
+		return errors.New("option --quiet cannot be used with '--format json'")
+	}
 	ctx := cmd.Context()
-	out, err := snapshot.List(ctx, inst)
+	list, err := snapshot.List(ctx, inst)
 	if err != nil {
 		return err
 	}
 	if quiet {
-		for i, line := range strings.Split(out, "\n") {
-			// "ID", "TAG", "VM SIZE", "DATE", "VM CLOCK", "ICOUNT"
-			fields := strings.Fields(line)
-			if i == 0 && len(fields) > 1 && fields[1] != "TAG" {
-				// make sure that output matches the expected
-				return fmt.Errorf("unknown header: %s", line)
-			}
-			if i == 0 || line == "" {
-				// skip header and empty line after using split
-				continue
-			}
-			tag := fields[1]
-			fmt.Printf("%s\n", tag)
+		for _, s := range list.Snapshots {
+			fmt.Fprintln(cmd.OutOrStdout(), s.Tag)
 		}
 		return nil
 	}
-	fmt.Print(out)
+	switch format {
+	case "":
+		fmt.Fprint(cmd.OutOrStdout(), list.Text)
+	case "json":
+		for _, s := range list.Snapshots {
+			j, err := json.Marshal(s)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(j))
+		}
+	case "table":
+		fmt.Fprint(cmd.OutOrStdout(), snapshot.Format(list.Snapshots))
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
 	return nil
 }
 
+func newSnapshotExportCommand() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:               "export INSTANCE",
+		Short:             "Export a snapshot to a standalone image file",
+		Example:           "  $ limactl snapshot export default --tag t1 -o snap.qcow2\n",
+		Args:              cobra.MinimumNArgs(1),
+		RunE:              snapshotExportAction,
+		ValidArgsFunction: snapshotBashComplete,
+	}
+	exportCmd.Flags().String("tag", "", "name of the snapshot")
+	exportCmd.Flags().StringP("output", "o", "", "path of the image file to create")
+	exportCmd.Flags().Bool("force", false, "export the snapshot even when the instance is running")
+
+	return exportCmd
+}
+
+func snapshotExportAction(cmd *cobra.Command, args []string) error {
+	instName := args[0]
+
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+
+	tag, err := cmd.Flags().GetString("tag")
+	if err != nil {
+		return err
+	}
+	if tag == "" {
+		return fmt.Errorf("expected tag")
+	}
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		return fmt.Errorf("expected output")
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	return snapshot.Export(ctx, inst, tag, output, force)
+}
+
+func newSnapshotImportCommand() *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:               "import INSTANCE",
+		Short:             "Import a snapshot from an image file created by 'limactl snapshot export'",
+		Example:           "  $ limactl snapshot import default -i snap.qcow2 --tag t1\n",
+		Args:              cobra.MinimumNArgs(1),
+		RunE:              snapshotImportAction,
+		ValidArgsFunction: snapshotBashComplete,
+	}
+	importCmd.Flags().String("tag", "", "name of the snapshot")
+	importCmd.Flags().StringP("input", "i", "", "path of the image file")
+
+	return importCmd
+}
+
+func snapshotImportAction(cmd *cobra.Command, args []string) error {
+	instName := args[0]
+
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+
+	tag, err := cmd.Flags().GetString("tag")
+	if err != nil {
+		return err
+	}
+	if tag == "" {
+		return fmt.Errorf("expected tag")
+	}
+	input, err := cmd.Flags().GetString("input")
+	if err != nil {
+		return err
+	}
+	if input == "" {
+		return fmt.Errorf("expected input")
+	}
+
+	ctx := cmd.Context()
+	return snapshot.Import(ctx, inst, tag, input)
+}
+
 func snapshotBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
 	return bashCompleteInstanceNames(cmd)
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lima-vm/lima/pkg/sshutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newSSHConfigCommand() *cobra.Command {
+	sshConfigCmd := &cobra.Command{
+		Use:   "ssh-config",
+		Short: "Manage the Include directive for the instances in ~/.ssh/config",
+		Long: `Manage the Include directive for the instances in ~/.ssh/config.
+
+Each instance has an SSH config file ($LIMA_HOME/<INSTANCE>/ssh.config) with the "lima-<INSTANCE>" host alias.
+The file is regenerated on every start, so the changes of the port are picked up,
+and removed by 'limactl delete'.
+'limactl ssh-config install' includes these files from ~/.ssh/config, so that 'ssh lima-<INSTANCE>' works without '-F'.`,
+		GroupID: advancedCommand,
+	}
+	sshConfigCmd.AddCommand(newSSHConfigInstallCommand())
+	sshConfigCmd.AddCommand(newSSHConfigUninstallCommand())
+	return sshConfigCmd
+}
+
+func newSSHConfigInstallCommand() *cobra.Command {
+	installCmd := &cobra.Command{
+		Use:   "install [INSTANCE]",
+		Short: "Include the SSH config files of the instances from ~/.ssh/config",
+		Long: `Include the SSH config files of the instances from ~/.ssh/config.
+
+An "Include" directive guarded by marker comments is added to the beginning of ~/.ssh/config.
+The directive covers all the instances, including the ones created later.
+The command is idempotent.`,
+		Example: `  $ limactl ssh-config install default
+  $ ssh lima-default`,
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              sshConfigInstallAction,
+		ValidArgsFunction: sshConfigBashComplete,
+	}
+	return installCmd
+}
+
+func sshConfigInstallAction(_ *cobra.Command, args []string) error {
+	instName := DefaultInstanceName
+	if len(args) > 0 {
+		instName = args[0]
+	}
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist, run `limactl create %s` to create a new instance", instName, instName)
+		}
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(inst.Dir, filenames.SSHConfig)); errors.Is(err, os.ErrNotExist) {
+		logrus.Warnf("The SSH config file of instance %q will be created on starting the instance", instName)
+	}
+	configPath, err := sshutil.UserSSHConfigPath()
+	if err != nil {
+		return err
+	}
+	pattern, err := sshutil.IncludePattern()
+	if err != nil {
+		return err
+	}
+	changed, err := sshutil.InstallInclude(configPath, pattern)
+	if err != nil {
+		return fmt.Errorf("failed to update %q: %w", configPath, err)
+	}
+	if changed {
+		logrus.Infof("Added \"Include %s\" to %q", pattern, configPath)
+	} else {
+		logrus.Infof("%q already includes %s", configPath, pattern)
+	}
+	logrus.Infof("Run `ssh lima-%s` to connect to the instance", instName)
+	return nil
+}
+
+func newSSHConfigUninstallCommand() *cobra.Command {
+	uninstallCmd := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove the Include directive added by 'limactl ssh-config install' from ~/.ssh/config",
+		Args:  WrapArgsError(cobra.NoArgs),
+		RunE:  sshConfigUninstallAction,
+	}
+	return uninstallCmd
+}
+
+func sshConfigUninstallAction(_ *cobra.Command, _ []string) error {
+	configPath, err := sshutil.UserSSHConfigPath()
+	if err != nil {
+		return err
+	}
+	changed, err := sshutil.UninstallInclude(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to update %q: %w", configPath, err)
+	}
+	if changed {
+		logrus.Infof("Removed the Include directive from %q", configPath)
+	} else {
+		logrus.Infof("%q does not contain the Include directive added by Lima", configPath)
+	}
+	return nil
+}
+
+func sshConfigBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
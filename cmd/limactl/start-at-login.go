@@ -13,8 +13,18 @@ import (
 
 func startAtLoginCommand() *cobra.Command {
 	startAtLoginCommand := &cobra.Command{
-		Use:               "start-at-login INSTANCE",
-		Short:             "Register/Unregister an autostart file for the instance",
+		Use:   "start-at-login INSTANCE",
+		Short: "Register/Unregister an autostart file for the instance",
+		Long: `Register/Unregister an autostart file for the instance.
+
+The autostart file is a launchd plist (~/Library/LaunchAgents) on macOS, or a systemd user unit
+($XDG_CONFIG_HOME/systemd/user) on Linux, which runs 'limactl start --foreground INSTANCE'.
+The file is removed by 'limactl delete' too.`,
+		Example: `  To start the instance "docker" when the user logs in:
+  $ limactl start-at-login docker
+
+  To stop starting the instance "docker" when the user logs in:
+  $ limactl start-at-login --disable docker`,
 		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
 		RunE:              startAtLoginAction,
 		ValidArgsFunction: startAtLoginComplete,
@@ -25,6 +35,7 @@ func startAtLoginCommand() *cobra.Command {
 		"enabled", true,
 		"Automatically start the instance when the user logs in",
 	)
+	startAtLoginCommand.Flags().Bool("disable", false, "Unregister the autostart file; equivalent to --enabled=false")
 
 	return startAtLoginCommand
 }
@@ -49,6 +60,16 @@ func startAtLoginAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	disable, err := flags.GetBool("disable")
+	if err != nil {
+		return err
+	}
+	if disable {
+		if flags.Changed("enabled") && startAtLogin {
+			return errors.New("flags --enabled and --disable cannot be specified together")
+		}
+		startAtLogin = false
+	}
 	if startAtLogin {
 		if err := autostart.CreateStartAtLoginEntry(runtime.GOOS, inst.Name, inst.Dir); err != nil {
 			logrus.WithError(err).Warnf("Can't create an autostart file for instance %q", inst.Name)
@@ -57,14 +78,15 @@ func startAtLoginAction(cmd *cobra.Command, args []string) error {
 		}
 	} else {
 		deleted, err := autostart.DeleteStartAtLoginEntry(runtime.GOOS, instName)
-		if err != nil {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			logrus.WithError(err).Warnf("The autostart file %q could not be deleted", instName)
 		} else if deleted {
 			logrus.Infof("The autostart file %q has been deleted", autostart.GetFilePath(runtime.GOOS, instName))
 		}
 	}
-
-	return nil
+	// Record the state even when the unit file could not be loaded, so that `limactl list` reflects the file
+	_, statErr := os.Stat(autostart.GetFilePath(runtime.GOOS, inst.Name))
+	return inst.SetAutoStart(statErr == nil)
 }
 
 func startAtLoginComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
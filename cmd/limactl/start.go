@@ -1,24 +1,37 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/containerd/containerd/identifiers"
 	"github.com/lima-vm/lima/cmd/limactl/editflags"
 	"github.com/lima-vm/lima/cmd/limactl/guessarg"
+	"github.com/lima-vm/lima/pkg/cidata"
+	"github.com/lima-vm/lima/pkg/driverutil"
 	"github.com/lima-vm/lima/pkg/editutil"
 	"github.com/lima-vm/lima/pkg/ioutilx"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	networks "github.com/lima-vm/lima/pkg/networks/reconcile"
 	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/snapshot"
+	"github.com/lima-vm/lima/pkg/sshutil"
 	"github.com/lima-vm/lima/pkg/start"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
@@ -28,12 +41,18 @@ import (
 	"github.com/lima-vm/lima/pkg/yqutil"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 )
 
 func registerCreateFlags(cmd *cobra.Command, commentPrefix string) {
 	flags := cmd.Flags()
 	flags.String("name", "", commentPrefix+"override the instance name")
 	flags.Bool("list-templates", false, commentPrefix+"list available templates and exit")
+	flags.Bool("json", false, commentPrefix+"print the list of --list-templates as JSON, with the names, locations, and descriptions")
+	flags.BoolP("yes", "y", false, commentPrefix+"proceed with the current configuration without showing the TUI menu, even when --tty is true")
+	registerRejectedYAMLPathFlag(cmd, commentPrefix)
+	registerTemplateAuthFlags(cmd, commentPrefix)
 	editflags.RegisterCreate(cmd, commentPrefix)
 }
 
@@ -50,17 +69,41 @@ $ limactl create --name=default template://docker
 To create an instance "default" with modified parameters:
 $ limactl create --cpus=2 --memory=2
 
+To create an instance "default" with the sizes with units:
+$ limactl create --memory=512MiB --disk=20GiB
+
 To create an instance "default" with yq expressions:
 $ limactl create --set='.cpus = 2 | .memory = "2GiB"'
 
 To see the template list:
 $ limactl create --list-templates
 
+To create an instance "default" without showing the TUI menu:
+$ limactl create --yes
+
+To create an instance "default" with the VNC display enabled:
+$ limactl create --vnc
+
+To create an instance "default" that also trusts the SSH public key of a CI agent:
+$ limactl create --ssh-pubkey=ci.pub
+
+To create an instance "default" with the MAC address of the "shared" network pinned for a DHCP reservation:
+$ limactl create --network=lima:shared --mac-address=0=52:55:55:12:34:56
+
+To list the templates as JSON, with their locations and descriptions:
+$ limactl create --list-templates --json
+
 To create an instance "default" from a local file:
 $ limactl create --name=default /usr/local/share/lima/templates/fedora.yaml
 
 To create an instance "default" from a remote URL (use carefully, with a trustable source):
 $ limactl create --name=default https://raw.githubusercontent.com/lima-vm/lima/master/examples/alpine.yaml
+Without --name, the name is taken from the "X-Lima-Template-Name" response header if present, otherwise from the URL path.
+The template may be gzip-compressed ("Content-Encoding: gzip", or a ".yaml.gz" URL).
+
+To create an instance "default" from a remote URL that requires the bearer authentication:
+$ LIMA_TEMPLATE_AUTH_BEARER=$(cat ~/.template-token) limactl create --name=default https://templates.example.com/default.yaml
+Prefer the environment variables to the flags, as the flags are visible to the other users of the host (e.g., in ps(1)).
 
 To create an instance "local" from a template passed to stdin (--name parameter is required):
 $ cat template.yaml | limactl create --name=local -
@@ -85,6 +128,25 @@ $ limactl start
 To create an instance "default" from a template "docker", and start it:
 $ limactl start --name=default template://docker
 
+To start an instance "default" with the vCPUs paused, and resume it later:
+$ limactl start --paused
+$ limactl resume
+
+To start an instance "default" with extra cloud-init user-data (e.g., packages and runcmd):
+$ limactl start --cloud-init-user-data=./user-data.yaml
+
+To apply the snapshot "clean" to the stopped instance "default", and start it:
+$ limactl start --resume-from-snapshot=clean default
+
+To start an existing instance "default" with another mount type (e.g., for comparing the performance):
+$ limactl start --mount-type=virtiofs default
+
+To delete the instance "default" if it exists, and create it again from a template "docker" (e.g., in CI):
+$ limactl start --replace --force --name=default template://docker
+
+To create an instance "dev" from a template passed to stdin, and start it (--name parameter is required):
+$ cat my.yaml | limactl start --name=dev -
+
 'limactl start' also accepts the 'limactl create' flags such as '--set'.
 See the examples in 'limactl create --help'.
 `,
@@ -96,9 +158,20 @@ See the examples in 'limactl create --help'.
 	}
 	registerCreateFlags(startCommand, "[limactl create] ")
 	if runtime.GOOS != "windows" {
-		startCommand.Flags().Bool("foreground", false, "run the hostagent in the foreground")
+		startCommand.Flags().Bool("foreground", false, "run the hostagent in the foreground, until the instance stops. "+
+			"SIGINT and SIGTERM stop the instance gracefully, and the exit status is non-zero when the VM did not exit cleanly")
 	}
-	startCommand.Flags().Duration("timeout", start.DefaultWatchHostAgentEventsTimeout, "duration to wait for the instance to be running before timing out")
+	startCommand.Flags().Duration("timeout", start.DefaultWatchHostAgentEventsTimeout, "duration to wait for the instance to be running before timing out. "+
+		"When specified, it bounds the whole startup including the disk preparation, and the partially started instance is stopped on timeout")
+	startCommand.Flags().Bool("start-only-if-template-changed", false, "when the instance already exists, fail if its configuration has drifted from the template")
+	startCommand.Flags().String("cloud-init-user-data", "", "YAML file to merge into the cloud-init user-data generated by Lima")
+	startCommand.Flags().String("cloud-init-network-config", "", "YAML file to merge into the cloud-init network-config generated by Lima")
+	startCommand.Flags().Bool("replace", false, "when the instance already exists, stop and delete it, and create it again")
+	startCommand.Flags().Bool("force", false, "with --replace, replace the instance without asking for confirmation")
+	startCommand.Flags().Bool("paused", false, "start the VM with its vCPUs paused, for debugging the early boot (QEMU only; continue with 'limactl resume')")
+	startCommand.Flags().String("resume-from-snapshot", "", "apply the snapshot with the tag to the stopped instance before starting it")
+	startCommand.Flags().Bool("wait", true, "wait for the instance to be ready. "+
+		"With --wait=false, return as soon as the VM is launched, leaving the host agent running in the background (the Ansible provisioning is skipped)")
 	return startCommand
 }
 
@@ -126,72 +199,23 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string, createOnly bool) (*
 		return nil, err
 	}
 
-	const yBytesLimit = 4 * 1024 * 1024 // 4MiB
-
-	if ok, u := guessarg.SeemsTemplateURL(arg); ok {
-		// No need to use SecureJoin here. https://github.com/lima-vm/lima/pull/805#discussion_r853411702
-		templateName := filepath.Join(u.Host, u.Path)
-		logrus.Debugf("interpreting argument %q as a template name %q", arg, templateName)
-		if st.instName == "" {
-			// e.g., templateName = "deprecated/centos-7" , st.instName = "centos-7"
-			st.instName = filepath.Base(templateName)
-		}
-		st.yBytes, err = templatestore.Read(templateName)
-		if err != nil {
-			return nil, err
-		}
-	} else if guessarg.SeemsHTTPURL(arg) {
-		if st.instName == "" {
-			st.instName, err = guessarg.InstNameFromURL(arg)
-			if err != nil {
-				return nil, err
-			}
-		}
-		logrus.Debugf("interpreting argument %q as a http url for instance %q", arg, st.instName)
-		req, err := http.NewRequestWithContext(cmd.Context(), http.MethodGet, arg, http.NoBody)
-		if err != nil {
-			return nil, err
-		}
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-		st.yBytes, err = ioutilx.ReadAtMaximum(resp.Body, yBytesLimit)
-		if err != nil {
-			return nil, err
-		}
-	} else if guessarg.SeemsFileURL(arg) {
-		if st.instName == "" {
-			st.instName, err = guessarg.InstNameFromURL(arg)
-			if err != nil {
-				return nil, err
-			}
-		}
-		logrus.Debugf("interpreting argument %q as a file url for instance %q", arg, st.instName)
-		r, err := os.Open(strings.TrimPrefix(arg, "file://"))
-		if err != nil {
-			return nil, err
+	// "replace" is only registered for `limactl start`
+	replace, _ := flags.GetBool("replace")
+	if replace {
+		if checkDrift, _ := flags.GetBool("start-only-if-template-changed"); checkDrift {
+			return nil, errors.New("flags --replace and --start-only-if-template-changed cannot be specified together")
 		}
-		defer r.Close()
-		st.yBytes, err = ioutilx.ReadAtMaximum(r, yBytesLimit)
-		if err != nil {
-			return nil, err
-		}
-	} else if guessarg.SeemsYAMLPath(arg) {
-		if st.instName == "" {
-			st.instName, err = guessarg.InstNameFromYAMLPath(arg)
-			if err != nil {
-				return nil, err
-			}
+		if tag, _ := flags.GetString("resume-from-snapshot"); tag != "" {
+			return nil, errors.New("flags --replace and --resume-from-snapshot cannot be specified together")
 		}
-		logrus.Debugf("interpreting argument %q as a file path for instance %q", arg, st.instName)
-		r, err := os.Open(arg)
+	}
+
+	if seemsTemplateArg(arg) {
+		auth, err := templateAuthFromFlags(flags)
 		if err != nil {
 			return nil, err
 		}
-		defer r.Close()
-		st.yBytes, err = ioutilx.ReadAtMaximum(r, yBytesLimit)
+		st.instName, st.yBytes, err = readTemplate(cmd.Context(), arg, st.instName, auth)
 		if err != nil {
 			return nil, err
 		}
@@ -199,7 +223,7 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string, createOnly bool) (*
 		if st.instName == "" {
 			return nil, errors.New("must pass instance name with --name when reading template from stdin")
 		}
-		st.yBytes, err = io.ReadAll(os.Stdin)
+		st.yBytes, err = ioutilx.ReadAtMaximum(os.Stdin, templateBytesLimit)
 		if err != nil {
 			return nil, fmt.Errorf("unexpected error reading stdin: %w", err)
 		}
@@ -225,7 +249,7 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string, createOnly bool) (*
 			return nil, fmt.Errorf("argument must be either an instance name, a YAML file path, or a URL, got %q: %w", st.instName, err)
 		}
 		inst, err := store.Inspect(st.instName)
-		if err == nil {
+		if err == nil && !replace {
 			if createOnly {
 				return nil, fmt.Errorf("Instance %q already exists", st.instName)
 			}
@@ -243,7 +267,7 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string, createOnly bool) (*
 			}
 			return inst, nil
 		}
-		if !errors.Is(err, os.ErrNotExist) {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return nil, err
 		}
 		if arg != "" && arg != DefaultInstanceName {
@@ -262,20 +286,437 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string, createOnly bool) (*
 		return nil, err
 	}
 	yq := yqutil.Join(yqExprs)
-	if tty {
+	// "start-only-if-template-changed" is only registered for `limactl start`
+	if checkDrift, _ := flags.GetBool("start-only-if-template-changed"); checkDrift {
+		inst, err := store.Inspect(st.instName)
+		if err == nil {
+			if err := modifyInPlace(st, yq); err != nil {
+				return nil, err
+			}
+			if err := checkTemplateDrift(inst, st.yBytes); err != nil {
+				return nil, err
+			}
+			logrus.Infof("Using the existing instance %q, as its configuration matches the template", st.instName)
+			return inst, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	yes, err := flags.GetBool("yes")
+	if err != nil {
+		return nil, err
+	}
+	if tty && !yes {
 		var err error
 		st, err = chooseNextCreatorState(st, yq)
 		if err != nil {
 			return nil, err
 		}
+	} else if tty {
+		logrus.Info("Proceeding with the current configuration, as --yes is specified")
+		if err := modifyInPlace(st, yq); err != nil {
+			return nil, err
+		}
 	} else {
 		logrus.Info("Terminal is not available, proceeding without opening an editor")
 		if err := modifyInPlace(st, yq); err != nil {
 			return nil, err
 		}
 	}
-	saveBrokenEditorBuffer := tty
-	return createInstance(cmd.Context(), st, saveBrokenEditorBuffer)
+	if replace {
+		if err := replaceInstance(cmd, st.instName, tty); err != nil {
+			return nil, err
+		}
+	}
+	rejectedYAMLPath, err := rejectedYAMLPathFromFlags(flags, tty)
+	if err != nil {
+		return nil, err
+	}
+	return createInstance(cmd.Context(), st, rejectedYAMLPath)
+}
+
+const defaultRejectedYAMLPath = "lima.REJECTED.yaml"
+
+func registerRejectedYAMLPathFlag(cmd *cobra.Command, commentPrefix string) {
+	cmd.Flags().String("rejected-yaml-path", "", commentPrefix+"save the invalid YAML to the path (empty to suppress). "+
+		"Defaults to $LIMA_REJECTED_YAML, or \""+defaultRejectedYAMLPath+"\" when the YAML was edited interactively")
+}
+
+// rejectedYAMLPathFromFlags returns the path to save the invalid YAML to, or an empty string to suppress saving it.
+func rejectedYAMLPathFromFlags(flags *pflag.FlagSet, edited bool) (string, error) {
+	if flags.Changed("rejected-yaml-path") {
+		return flags.GetString("rejected-yaml-path")
+	}
+	if v, ok := os.LookupEnv("LIMA_REJECTED_YAML"); ok {
+		return v, nil
+	}
+	if !edited {
+		return "", nil
+	}
+	return defaultRejectedYAMLPath, nil
+}
+
+func registerTemplateAuthFlags(cmd *cobra.Command, commentPrefix string) {
+	cmd.Flags().String("template-auth-basic", "", commentPrefix+"credentials for fetching the template from an HTTP URL with the basic authentication, as \"USER:PASSWORD\". "+
+		"Defaults to $LIMA_TEMPLATE_AUTH_BASIC")
+	cmd.Flags().String("template-auth-bearer", "", commentPrefix+"token for fetching the template from an HTTP URL with the bearer authentication. "+
+		"Defaults to $LIMA_TEMPLATE_AUTH_BEARER")
+}
+
+// templateAuth is the credentials for fetching templates from HTTP URLs.
+// The credentials must never be logged.
+type templateAuth struct {
+	basicUser     string
+	basicPassword string
+	bearerToken   string
+}
+
+// templateAuthFromFlags returns the credentials specified with --template-auth-basic and --template-auth-bearer,
+// or with $LIMA_TEMPLATE_AUTH_BASIC and $LIMA_TEMPLATE_AUTH_BEARER.
+func templateAuthFromFlags(flags *pflag.FlagSet) (templateAuth, error) {
+	var a templateAuth
+	flagOrEnv := func(flag, env string) (string, error) {
+		if flags.Changed(flag) {
+			return flags.GetString(flag)
+		}
+		return os.Getenv(env), nil
+	}
+	basic, err := flagOrEnv("template-auth-basic", "LIMA_TEMPLATE_AUTH_BASIC")
+	if err != nil {
+		return a, err
+	}
+	bearer, err := flagOrEnv("template-auth-bearer", "LIMA_TEMPLATE_AUTH_BEARER")
+	if err != nil {
+		return a, err
+	}
+	if basic != "" && bearer != "" {
+		return a, errors.New("the basic authentication and the bearer authentication of the template cannot be specified together")
+	}
+	if basic != "" {
+		var ok bool
+		a.basicUser, a.basicPassword, ok = strings.Cut(basic, ":")
+		if !ok || a.basicUser == "" {
+			// Do not include the value in the error, as it may contain the password
+			return a, errors.New("the basic authentication of the template must be specified as \"USER:PASSWORD\"")
+		}
+	}
+	a.bearerToken = bearer
+	return a, nil
+}
+
+// apply sets the Authorization header of req.
+// net/http does not forward the header when the request is redirected to another domain,
+// and checkTemplateRedirect refuses the redirects from HTTPS to plain HTTP.
+func (a templateAuth) apply(req *http.Request) {
+	if a == (templateAuth{}) {
+		return
+	}
+	if req.URL.Scheme == "http" {
+		logrus.Warnf("The credentials of the template are sent in cleartext to %q, as it is not an HTTPS URL", req.URL.Host)
+	}
+	switch {
+	case a.basicUser != "":
+		req.SetBasicAuth(a.basicUser, a.basicPassword)
+	case a.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+a.bearerToken)
+	}
+}
+
+// checkTemplateRedirect is the CheckRedirect function of the HTTP client for fetching templates.
+// It refuses the redirects from HTTPS to plain HTTP, which would expose the credentials and the template
+// on the same host, in addition to the default limit of 10 redirects.
+func checkTemplateRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if prev := via[len(via)-1]; prev.URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("refusing the redirect from %q to %q, as it downgrades HTTPS to plain HTTP", prev.URL.Redacted(), req.URL.Redacted())
+	}
+	return nil
+}
+
+// fetchTemplate sends the GET request for the template at urlStr with auth.
+// The caller must close the body of the response.
+func fetchTemplate(ctx context.Context, client *http.Client, urlStr string, auth templateAuth) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	auth.apply(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %q: %s (hint: specify the credentials with --template-auth-basic or --template-auth-bearer)", urlStr, resp.Status)
+	}
+	return resp, nil
+}
+
+// saveRejectedYAML saves the invalid YAML b to rejectedYAMLPath unless it is empty,
+// and returns validateErr annotated with the path.
+func saveRejectedYAML(rejectedYAMLPath string, b []byte, validateErr error) error {
+	if rejectedYAMLPath == "" {
+		return validateErr
+	}
+	if writeErr := os.WriteFile(rejectedYAMLPath, b, 0o644); writeErr != nil {
+		return fmt.Errorf("the YAML is invalid, attempted to save the buffer as %q but failed: %w: %w", rejectedYAMLPath, writeErr, validateErr)
+	}
+	return fmt.Errorf("the YAML is invalid, saved the buffer as %q: %w", rejectedYAMLPath, validateErr)
+}
+
+// cloudInitOverridesFromFlags returns the absolute paths of the files specified with
+// --cloud-init-user-data and --cloud-init-network-config, after validating them as YAML.
+func cloudInitOverridesFromFlags(cmd *cobra.Command) (start.CloudInitOverrides, error) {
+	var o start.CloudInitOverrides
+	for flag, dst := range map[string]*string{
+		"cloud-init-user-data":      &o.UserData,
+		"cloud-init-network-config": &o.NetworkConfig,
+	} {
+		f, err := cmd.Flags().GetString(flag)
+		if err != nil {
+			return o, err
+		}
+		if f == "" {
+			continue
+		}
+		f, err = filepath.Abs(f)
+		if err != nil {
+			return o, err
+		}
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return o, err
+		}
+		if err := cidata.ValidateOverride(b); err != nil {
+			return o, fmt.Errorf("invalid --%s %q: %w", flag, f, err)
+		}
+		*dst = f
+	}
+	return o, nil
+}
+
+// replaceInstance deletes the existing instance, so that it can be created again.
+// The confirmation is asked on TTY, unless --force is specified.
+func replaceInstance(cmd *cobra.Command, instName string, tty bool) error {
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	if !force && tty {
+		message := fmt.Sprintf("Instance %q already exists. Do you want to delete it, and create it again?", instName)
+		ans, err := uiutil.Confirm(message, false)
+		if err != nil {
+			return err
+		}
+		if !ans {
+			return fmt.Errorf("instance %q was not replaced", instName)
+		}
+	}
+	logrus.Infof("Deleting the existing instance %q, to replace it", instName)
+	if err := deleteInstance(cmd.Context(), inst, true); err != nil {
+		return fmt.Errorf("failed to delete instance %q: %w", instName, err)
+	}
+	return nil
+}
+
+// templateNameHeader is the HTTP response header for suggesting the instance name of a template.
+const templateNameHeader = "X-Lima-Template-Name"
+
+// instNameFromHTTPResponse returns the instance name suggested by the templateNameHeader of the response,
+// or the name derived from the URL when the header is missing.
+func instNameFromHTTPResponse(urlStr string, resp *http.Response) (string, error) {
+	if name := resp.Header.Get(templateNameHeader); name != "" {
+		if err := identifiers.Validate(name); err != nil {
+			return "", fmt.Errorf("header %q of %q is invalid: %w", templateNameHeader, urlStr, err)
+		}
+		return name, nil
+	}
+	return guessarg.InstNameFromURL(urlStr)
+}
+
+// templateBytesLimit is the maximum size of a template.
+const templateBytesLimit = 4 * 1024 * 1024 // 4MiB
+
+// compressedTemplateBytesLimit is the maximum size of a gzip-compressed template, before decompression.
+const compressedTemplateBytesLimit = 1 * 1024 * 1024 // 1MiB
+
+// seemsTemplateArg returns true if arg refers to a template, not an instance name.
+func seemsTemplateArg(arg string) bool {
+	if ok, _ := guessarg.SeemsTemplateURL(arg); ok {
+		return true
+	}
+	return guessarg.SeemsHTTPURL(arg) || guessarg.SeemsFileURL(arg) || guessarg.SeemsYAMLPath(arg)
+}
+
+// readTemplate reads the template referred by arg, which is either a template URL, an HTTP URL, a file URL, or a file path.
+// The instance name is derived from arg when instName is empty.
+// auth is used only for HTTP URLs.
+func readTemplate(ctx context.Context, arg, instName string, auth templateAuth) (string, []byte, error) {
+	var (
+		yBytes []byte
+		err    error
+	)
+	if ok, u := guessarg.SeemsTemplateURL(arg); ok {
+		// No need to use SecureJoin here. https://github.com/lima-vm/lima/pull/805#discussion_r853411702
+		templateName := filepath.Join(u.Host, u.Path)
+		logrus.Debugf("interpreting argument %q as a template name %q", arg, templateName)
+		if instName == "" {
+			// e.g., templateName = "deprecated/centos-7" , instName = "centos-7"
+			instName = filepath.Base(templateName)
+		}
+		yBytes, err = templatestore.Read(templateName)
+		if err != nil {
+			return "", nil, err
+		}
+	} else if guessarg.SeemsHTTPURL(arg) {
+		resp, err := fetchTemplate(ctx, &http.Client{CheckRedirect: checkTemplateRedirect}, arg, auth)
+		if err != nil {
+			return "", nil, err
+		}
+		defer resp.Body.Close()
+		if instName == "" {
+			instName, err = instNameFromHTTPResponse(arg, resp)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+		logrus.Debugf("interpreting argument %q as a http url for instance %q", arg, instName)
+		yBytes, err = readHTTPTemplate(arg, resp, compressedTemplateBytesLimit, templateBytesLimit)
+		if htmlErr := checkNotHTML(arg, yBytes); htmlErr != nil {
+			return "", nil, htmlErr
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	} else if guessarg.SeemsFileURL(arg) {
+		if instName == "" {
+			instName, err = guessarg.InstNameFromURL(arg)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+		logrus.Debugf("interpreting argument %q as a file url for instance %q", arg, instName)
+		r, err := os.Open(strings.TrimPrefix(arg, "file://"))
+		if err != nil {
+			return "", nil, err
+		}
+		defer r.Close()
+		yBytes, err = ioutilx.ReadAtMaximum(r, templateBytesLimit)
+		if err != nil {
+			return "", nil, err
+		}
+	} else {
+		if instName == "" {
+			instName, err = guessarg.InstNameFromYAMLPath(arg)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+		logrus.Debugf("interpreting argument %q as a file path for instance %q", arg, instName)
+		r, err := os.Open(arg)
+		if err != nil {
+			return "", nil, err
+		}
+		defer r.Close()
+		yBytes, err = ioutilx.ReadAtMaximum(r, templateBytesLimit)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return instName, yBytes, nil
+}
+
+// readHTTPTemplate reads the template from resp at maximum n bytes, decompressing it when it is gzip-compressed,
+// i.e., when the response has "Content-Encoding: gzip" or the URL has the ".gz" suffix.
+// The compressed content is read at maximum compressedN bytes, and n is applied to the decompressed size.
+func readHTTPTemplate(urlStr string, resp *http.Response, compressedN, n int64) ([]byte, error) {
+	br := bufio.NewReader(resp.Body)
+	// http.Transport removes "Content-Encoding: gzip" when it decompresses the body by itself
+	gz := strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip")
+	if u, err := url.Parse(urlStr); err == nil && strings.HasSuffix(strings.ToLower(u.Path), ".gz") {
+		gz = true
+	}
+	if gz {
+		// the body may have been decompressed already, e.g. when a ".yaml.gz" file is served with "Content-Encoding: gzip"
+		if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+			logrus.Debugf("decompressing the gzip-compressed content of %q", urlStr)
+			return ioutilx.ReadGzipAtMaximum(br, compressedN, n)
+		}
+	}
+	return ioutilx.ReadAtMaximum(br, n)
+}
+
+// checkNotHTML returns an error if the content downloaded from urlStr looks like HTML, not YAML.
+func checkNotHTML(urlStr string, b []byte) error {
+	if !strings.HasPrefix(http.DetectContentType(b), "text/html") {
+		return nil
+	}
+	// HTML may still be parsed as a YAML scalar
+	var m map[string]any
+	if err := yaml.Unmarshal(b, &m); err == nil && len(m) > 0 {
+		return nil
+	}
+	err := fmt.Errorf("the content of %q looks like HTML, not YAML (maybe the URL is wrong?)", urlStr)
+	if rawURL, ok := guessarg.GitHubRawURL(urlStr); ok {
+		err = fmt.Errorf("%w (Hint: %q is a GitHub web page, try %q)", err, urlStr, rawURL)
+	}
+	return err
+}
+
+// checkTemplateDrift returns an error if the configuration of the existing instance differs from the template.
+func checkTemplateDrift(inst *store.Instance, templateBytes []byte) error {
+	filePath := filepath.Join(inst.Dir, filenames.LimaYAML)
+	instBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	changed, err := templateDrift(instBytes, templateBytes, filePath)
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("the configuration of instance %q has drifted from the template (fields: %v)", inst.Name, changed)
+	}
+	return nil
+}
+
+// templateDrift returns the top-level fields that differ between the configuration of the instance and the template.
+// Both are compared after filling the defaults, excluding computed values such as MAC addresses.
+// filePath is the path of lima.yaml of the instance.
+func templateDrift(instBytes, templateBytes []byte, filePath string) ([]string, error) {
+	if len(bytes.TrimSpace(templateBytes)) == 0 {
+		return nil, errors.New("the template is empty")
+	}
+	normalize := func(b []byte) ([]byte, error) {
+		// use the same file path for both, as some defaults are derived from it
+		y, err := limayaml.Load(b, filePath)
+		if err != nil {
+			return nil, err
+		}
+		for i := range y.Networks {
+			y.Networks[i].MACAddress = ""
+		}
+		return limayaml.Save(y)
+	}
+	instNormalized, err := normalize(instBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the configuration of the instance: %w", err)
+	}
+	templateNormalized, err := normalize(templateBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the template: %w", err)
+	}
+	return changedFields(instNormalized, templateNormalized)
 }
 
 func applyYQExpressionToExistingInstance(inst *store.Instance, yq string) (*store.Instance, error) {
@@ -292,6 +733,23 @@ func applyYQExpressionToExistingInstance(inst *store.Instance, yq string) (*stor
 	if err != nil {
 		return nil, err
 	}
+	y, err := limayaml.Load(yBytes, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := limayaml.Validate(y, false); err != nil {
+		return nil, err
+	}
+	changed, err := changedFields(yContent, yBytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateChangedHostResources(y, changed); err != nil {
+		return nil, err
+	}
+	if err := validateDriver(y); err != nil {
+		return nil, err
+	}
 	if err := os.WriteFile(filePath, yBytes, 0o644); err != nil {
 		return nil, err
 	}
@@ -299,7 +757,25 @@ func applyYQExpressionToExistingInstance(inst *store.Instance, yq string) (*stor
 	return store.Inspect(inst.Name)
 }
 
-func createInstance(ctx context.Context, st *creatorState, saveBrokenEditorBuffer bool) (*store.Instance, error) {
+// validateChangedHostResources runs [limayaml.ValidateHostResources] only when `memory` is changed,
+// so that an existing instance created on a larger host can still be edited.
+func validateChangedHostResources(y *limayaml.LimaYAML, changed []string) error {
+	if !slices.Contains(changed, "memory") {
+		return nil
+	}
+	return limayaml.ValidateHostResources(y)
+}
+
+// validateDriver checks that the driver supports the mount type, e.g., the QEMU driver rejects `mountType: virtiofs` on non-Linux hosts.
+// This is also checked on starting the instance, but checking it earlier prevents saving a configuration that cannot start.
+// The other checks of the driver depend on the current state of the host, so they are left to the start.
+func validateDriver(y *limayaml.LimaYAML) error {
+	return driverutil.ValidateMountType(y)
+}
+
+// createInstance creates the instance.
+// When the YAML is invalid, it is saved to rejectedYAMLPath unless rejectedYAMLPath is empty.
+func createInstance(ctx context.Context, st *creatorState, rejectedYAMLPath string) (*store.Instance, error) {
 	if st.instName == "" {
 		return nil, errors.New("got empty st.instName")
 	}
@@ -328,14 +804,13 @@ func createInstance(ctx context.Context, st *creatorState, saveBrokenEditorBuffe
 		return nil, err
 	}
 	if err := limayaml.Validate(y, true); err != nil {
-		if !saveBrokenEditorBuffer {
-			return nil, err
-		}
-		rejectedYAML := "lima.REJECTED.yaml"
-		if writeErr := os.WriteFile(rejectedYAML, st.yBytes, 0o644); writeErr != nil {
-			return nil, fmt.Errorf("the YAML is invalid, attempted to save the buffer as %q but failed: %w: %w", rejectedYAML, writeErr, err)
-		}
-		return nil, fmt.Errorf("the YAML is invalid, saved the buffer as %q: %w", rejectedYAML, err)
+		return nil, saveRejectedYAML(rejectedYAMLPath, st.yBytes, err)
+	}
+	if err := limayaml.ValidateHostResources(y); err != nil {
+		return nil, err
+	}
+	if err := validateDriver(y); err != nil {
+		return nil, err
 	}
 	if err := os.MkdirAll(instDir, 0o700); err != nil {
 		return nil, err
@@ -346,6 +821,17 @@ func createInstance(ctx context.Context, st *creatorState, saveBrokenEditorBuffe
 	if err := os.WriteFile(filepath.Join(instDir, filenames.LimaVersion), []byte(version.Version), 0o444); err != nil {
 		return nil, err
 	}
+	if *y.SSH.GenerateDedicatedKey {
+		if err := sshutil.GenerateInstanceKey(instDir); err != nil {
+			return nil, err
+		}
+	}
+	if err := runCreateHook(ctx, st.instName, filePath); err != nil {
+		if rmErr := os.RemoveAll(instDir); rmErr != nil {
+			logrus.WithError(rmErr).Warnf("Failed to remove the instance directory %q", instDir)
+		}
+		return nil, err
+	}
 
 	inst, err := store.Inspect(st.instName)
 	if err != nil {
@@ -359,6 +845,42 @@ func createInstance(ctx context.Context, st *creatorState, saveBrokenEditorBuffe
 	return inst, nil
 }
 
+// createHookTimeout is the maximum duration of the $LIMA_CREATE_HOOK execution.
+const createHookTimeout = 5 * time.Minute
+
+// runCreateHook executes $LIMA_CREATE_HOOK, if set, with the instance name and the path of lima.yaml.
+// The hook may modify lima.yaml; the modified file is validated again.
+func runCreateHook(ctx context.Context, instName, filePath string) error {
+	hook := os.Getenv("LIMA_CREATE_HOOK")
+	if hook == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, createHookTimeout)
+	defer cancel()
+	logrus.Infof("Running the creation hook %q", hook)
+	cmd := exec.CommandContext(ctx, hook, instName, filePath)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("the creation hook %q did not finish in %v", hook, createHookTimeout)
+		}
+		return fmt.Errorf("the creation hook %q failed: %w", hook, err)
+	}
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	y, err := limayaml.Load(b, filePath)
+	if err != nil {
+		return fmt.Errorf("the creation hook %q produced an invalid YAML: %w", hook, err)
+	}
+	if err := limayaml.Validate(y, true); err != nil {
+		return fmt.Errorf("the creation hook %q produced an invalid YAML: %w", hook, err)
+	}
+	return nil
+}
+
 type creatorState struct {
 	instName string // instance name
 	yBytes   []byte // yaml bytes
@@ -459,13 +981,32 @@ func createStartActionCommon(cmd *cobra.Command, _ []string) (exit bool, err err
 	if listTemplates, err := cmd.Flags().GetBool("list-templates"); err != nil {
 		return true, err
 	} else if listTemplates {
+		jsonFormat, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			return true, err
+		}
 		if templates, err := templatestore.Templates(); err == nil {
 			w := cmd.OutOrStdout()
+			if jsonFormat {
+				if templates == nil {
+					templates = []templatestore.Template{}
+				}
+				b, err := json.Marshal(templates)
+				if err != nil {
+					return true, err
+				}
+				fmt.Fprintln(w, string(b))
+				return true, nil
+			}
 			for _, f := range templates {
 				fmt.Fprintln(w, f.Name)
 			}
 			return true, nil
 		}
+	} else if jsonFormat, err := cmd.Flags().GetBool("json"); err != nil {
+		return true, err
+	} else if jsonFormat {
+		return true, errors.New("flag `--json` requires `--list-templates`")
 	}
 	return false, nil
 }
@@ -503,12 +1044,27 @@ func startAction(cmd *cobra.Command, args []string) error {
 	if len(inst.Errors) > 0 {
 		return fmt.Errorf("errors inspecting instance: %+v", inst.Errors)
 	}
+	snapshotTag, err := cmd.Flags().GetString("resume-from-snapshot")
+	if err != nil {
+		return err
+	}
+	if snapshotTag != "" && inst.Status != store.StatusStopped {
+		return fmt.Errorf("expected status %q, got %q (Hint: stop the instance before applying the snapshot %q)", store.StatusStopped, inst.Status, snapshotTag)
+	}
 	switch inst.Status {
 	case store.StatusRunning:
 		logrus.Infof("The instance %q is already running. Run `%s` to open the shell.",
 			inst.Name, start.LimactlShellCmd(inst.Name))
+		if vnc, err := cmd.Flags().GetBool("vnc"); err != nil {
+			return err
+		} else if vnc {
+			return printVNCConnection(cmd.OutOrStdout(), inst)
+		}
 		// Not an error
 		return nil
+	case store.StatusPaused:
+		logrus.Infof("The instance %q is paused. Run `limactl resume %s` to resume it.", inst.Name, inst.Name)
+		return nil
 	case store.StatusStopped:
 		// NOP
 	default:
@@ -534,9 +1090,80 @@ func startAction(cmd *cobra.Command, args []string) error {
 	}
 	if timeout > 0 {
 		ctx = start.WithWatchHostAgentTimeout(ctx, timeout)
+		if cmd.Flags().Changed("timeout") {
+			ctx = start.WithStartTimeout(ctx, timeout)
+		}
+	}
+	paused, err := cmd.Flags().GetBool("paused")
+	if err != nil {
+		return err
+	}
+	if paused {
+		ctx = start.WithStartPaused(ctx)
+	}
+	wait, err := cmd.Flags().GetBool("wait")
+	if err != nil {
+		return err
+	}
+	if !wait {
+		ctx = start.WithNoWait(ctx)
+	}
+	cloudInit, err := cloudInitOverridesFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if cloudInit != (start.CloudInitOverrides{}) {
+		ctx = start.WithCloudInitOverrides(ctx, cloudInit)
+	}
+	if snapshotTag != "" {
+		if err := snapshot.LoadStopped(ctx, inst, snapshotTag); err != nil {
+			return err
+		}
 	}
 
-	return start.Start(ctx, inst, launchHostAgentForeground)
+	if err := start.Start(ctx, inst, launchHostAgentForeground); err != nil {
+		return err
+	}
+	if vnc, err := cmd.Flags().GetBool("vnc"); err != nil {
+		return err
+	} else if vnc && !launchHostAgentForeground {
+		return printVNCConnection(cmd.OutOrStdout(), inst)
+	}
+	return nil
+}
+
+// printVNCConnection prints the VNC address of the running instance, and the location of the password file.
+// The address is read from the display file written by the host agent, as the QMP socket of a running
+// instance is held by the host agent.
+func printVNCConnection(w io.Writer, inst *store.Instance) error {
+	b, err := os.ReadFile(filepath.Join(inst.Dir, filenames.VNCDisplayFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("the VNC display of instance %q is not running (Hint: run `limactl stop %s` and `limactl start --vnc %s`)",
+				inst.Name, inst.Name, inst.Name)
+		}
+		return err
+	}
+	addr, err := vncAddress(strings.TrimSpace(string(b)))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "VNC: vnc://%s\n", addr)
+	fmt.Fprintf(w, "VNC password file: %s\n", filepath.Join(inst.Dir, filenames.VNCPasswordFile))
+	return nil
+}
+
+// vncAddress converts the VNC display "HOST:DISPLAY" into the "HOST:PORT" address, the port being 5900+DISPLAY.
+func vncAddress(display string) (string, error) {
+	host, num, err := net.SplitHostPort(display)
+	if err != nil {
+		return "", fmt.Errorf("invalid VNC display %q: %w", display, err)
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("invalid VNC display %q: the display number must be a non-negative integer", display)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(5900+n)), nil
 }
 
 func createBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
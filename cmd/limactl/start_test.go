@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/ptr"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/cobra"
+	"gotest.tools/v3/assert"
+)
+
+func TestReadHTTPTemplate(t *testing.T) {
+	yaml := "cpus: 2\n" + strings.Repeat("# padding\n", 1000)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(yaml))
+	assert.NilError(t, err)
+	assert.NilError(t, zw.Close())
+	compressed := buf.Bytes()
+	resp := func(b []byte) *http.Response {
+		return &http.Response{Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(b))}
+	}
+
+	b, err := readHTTPTemplate("https://example.com/foo.yaml.gz", resp(compressed), int64(len(compressed)), int64(len(yaml)))
+	assert.NilError(t, err)
+	assert.Equal(t, yaml, string(b))
+
+	// the compressed size exceeds compressedN
+	_, err = readHTTPTemplate("https://example.com/foo.yaml.gz", resp(compressed), int64(len(compressed))-1, int64(len(yaml)))
+	assert.ErrorContains(t, err, "exceeded the limit of the compressed stream")
+
+	// the decompressed size exceeds n
+	_, err = readHTTPTemplate("https://example.com/foo.yaml.gz", resp(compressed), int64(len(compressed)), int64(len(yaml))-1)
+	assert.ErrorContains(t, err, "exceeded the limit of the decompressed stream")
+
+	// not compressed
+	b, err = readHTTPTemplate("https://example.com/foo.yaml", resp([]byte(yaml)), 16, int64(len(yaml)))
+	assert.NilError(t, err)
+	assert.Equal(t, yaml, string(b))
+}
+
+func TestTemplateDrift(t *testing.T) {
+	t.Setenv("LIMA_HOME", t.TempDir())
+	instDir := filepath.Join(t.TempDir(), "foo")
+	assert.NilError(t, os.MkdirAll(instDir, 0o700))
+	filePath := filepath.Join(instDir, filenames.LimaYAML)
+	const template = `images:
+- location: https://example.com/image.qcow2
+cpus: 2
+networks:
+- lima: shared
+`
+
+	// the MAC address is computed on creating the instance
+	instBytes := []byte(template + "  macAddress: 52:55:55:12:34:56\n")
+	changed, err := templateDrift(instBytes, []byte(template), filePath)
+	assert.NilError(t, err)
+	assert.Equal(t, len(changed), 0)
+
+	instBytes = []byte(strings.Replace(template, "cpus: 2", "cpus: 4", 1))
+	changed, err = templateDrift(instBytes, []byte(template), filePath)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changed, []string{"cpus"})
+
+	_, err = templateDrift(instBytes, nil, filePath)
+	assert.ErrorContains(t, err, "the template is empty")
+
+	// the instance is missing lima.yaml
+	err = checkTemplateDrift(&store.Instance{Name: "foo", Dir: instDir}, []byte(template))
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+
+	assert.NilError(t, os.WriteFile(filePath, instBytes, 0o644))
+	err = checkTemplateDrift(&store.Instance{Name: "foo", Dir: instDir}, []byte(template))
+	assert.ErrorContains(t, err, `the configuration of instance "foo" has drifted from the template (fields: [cpus])`)
+}
+
+func TestCheckNotHTML(t *testing.T) {
+	const urlStr = "https://example.com/foo.yaml"
+	for _, tc := range []struct {
+		name    string
+		content string
+		isHTML  bool
+	}{
+		{"doctype", "<!DOCTYPE html>\n<html><body>Not Found</body></html>\n", true},
+		{"leading whitespace", "\n\n  <html>\n<head><title>404</title></head>\n</html>\n", true},
+		{"lowercase doctype", "<!doctype html><title>x</title>", true},
+		{"yaml", "images:\n- location: https://example.com/image.qcow2\n", false},
+		{"yaml mentioning html", "# see <html> docs at https://example.com/index.html\nmessage: |\n  <html> is served on port 80\n", false},
+		{"empty", "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkNotHTML(urlStr, []byte(tc.content))
+			if tc.isHTML {
+				assert.ErrorContains(t, err, "looks like HTML, not YAML")
+			} else {
+				assert.NilError(t, err)
+			}
+		})
+	}
+
+	err := checkNotHTML("https://github.com/lima-vm/lima/blob/master/templates/default.yaml", []byte("<!DOCTYPE html>"))
+	assert.ErrorContains(t, err, `try "https://raw.githubusercontent.com/lima-vm/lima/master/templates/default.yaml"`)
+}
+
+func TestValidateDriver(t *testing.T) {
+	t.Setenv("LIMA_HOME", t.TempDir())
+	load := func(s string) *limayaml.LimaYAML {
+		y, err := limayaml.Load([]byte(s), filepath.Join(t.TempDir(), filenames.LimaYAML))
+		assert.NilError(t, err)
+		return y
+	}
+	assert.NilError(t, validateDriver(load("vmType: qemu\n")))
+
+	// the checks of the host are left to the start
+	assert.NilError(t, validateDriver(load("vmType: qemu\nqemu:\n  minimumVersion: 999.0.0\n")))
+
+	err := validateDriver(load("vmType: qemu\nmountType: virtiofs\n"))
+	if runtime.GOOS == "linux" {
+		assert.NilError(t, err)
+	} else {
+		assert.ErrorContains(t, err, "field `mountType` must be")
+	}
+}
+
+func TestValidateChangedHostResources(t *testing.T) {
+	y := &limayaml.LimaYAML{Memory: ptr.Of("1PiB")}
+	// an existing instance created on a larger host can still be edited
+	assert.NilError(t, validateChangedHostResources(y, []string{"cpus"}))
+	assert.ErrorContains(t, validateChangedHostResources(y, []string{"cpus", "memory"}), "must not exceed the host memory")
+}
+
+func TestVNCAddress(t *testing.T) {
+	testCases := []struct {
+		display  string
+		expected string
+		err      string
+	}{
+		{display: "127.0.0.1:0", expected: "127.0.0.1:5900"},
+		{display: "127.0.0.1:1", expected: "127.0.0.1:5901"},
+		{display: "[::1]:2", expected: "[::1]:5902"},
+		{display: "127.0.0.1", err: "invalid VNC display"},
+		{display: "127.0.0.1:foo", err: "must be a non-negative integer"},
+		{display: "127.0.0.1:-1", err: "must be a non-negative integer"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.display, func(t *testing.T) {
+			addr, err := vncAddress(tc.display)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, tc.expected, addr)
+		})
+	}
+}
+
+func TestPrintVNCConnection(t *testing.T) {
+	inst := &store.Instance{Name: "vnc", Dir: t.TempDir()}
+	var b bytes.Buffer
+	assert.ErrorContains(t, printVNCConnection(&b, inst), "is not running")
+
+	// the display file is written by the host agent
+	assert.NilError(t, os.WriteFile(filepath.Join(inst.Dir, filenames.VNCDisplayFile), []byte("127.0.0.1:1"), 0o600))
+	assert.NilError(t, printVNCConnection(&b, inst))
+	expected := "VNC: vnc://127.0.0.1:5901\n" +
+		"VNC password file: " + filepath.Join(inst.Dir, filenames.VNCPasswordFile) + "\n"
+	assert.Equal(t, expected, b.String())
+}
+
+func TestTemplateAuthFromFlags(t *testing.T) {
+	parse := func(args ...string) (templateAuth, error) {
+		cmd := &cobra.Command{}
+		registerTemplateAuthFlags(cmd, "")
+		assert.NilError(t, cmd.Flags().Parse(args))
+		return templateAuthFromFlags(cmd.Flags())
+	}
+	t.Setenv("LIMA_TEMPLATE_AUTH_BASIC", "")
+	t.Setenv("LIMA_TEMPLATE_AUTH_BEARER", "env-token")
+
+	a, err := parse()
+	assert.NilError(t, err)
+	assert.Equal(t, templateAuth{bearerToken: "env-token"}, a)
+
+	a, err = parse("--template-auth-basic", "user:pass:word", "--template-auth-bearer", "")
+	assert.NilError(t, err)
+	assert.Equal(t, templateAuth{basicUser: "user", basicPassword: "pass:word"}, a)
+
+	_, err = parse("--template-auth-basic", "user:password")
+	assert.ErrorContains(t, err, "cannot be specified together")
+
+	_, err = parse("--template-auth-basic", "secret", "--template-auth-bearer", "")
+	assert.ErrorContains(t, err, `must be specified as "USER:PASSWORD"`)
+	assert.Assert(t, !strings.Contains(err.Error(), "secret"))
+}
+
+func TestFetchTemplate(t *testing.T) {
+	const template = "cpus: 2\n"
+	ctx := context.Background()
+	auth := templateAuth{basicUser: "user", basicPassword: "password"}
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, template)
+	}
+	var plainRequests atomic.Int32
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plainRequests.Add(1)
+		serve(w, r)
+	}))
+	t.Cleanup(plain.Close)
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved.yaml":
+			http.Redirect(w, r, "/template.yaml", http.StatusFound)
+		case "/downgraded.yaml":
+			http.Redirect(w, r, plain.URL+"/template.yaml", http.StatusFound)
+		default:
+			serve(w, r)
+		}
+	}))
+	t.Cleanup(tlsSrv.Close)
+	client := tlsSrv.Client()
+	client.CheckRedirect = checkTemplateRedirect
+	fetch := func(urlStr string, auth templateAuth) (string, error) {
+		resp, err := fetchTemplate(ctx, client, urlStr, auth)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err
+	}
+	hook := logrustest.NewGlobal()
+	t.Cleanup(hook.Reset)
+
+	b, err := fetch(tlsSrv.URL+"/template.yaml", auth)
+	assert.NilError(t, err)
+	assert.Equal(t, template, b)
+	assert.Equal(t, 0, len(hook.AllEntries()))
+
+	// the credentials are forwarded on the redirect to the same host
+	b, err = fetch(tlsSrv.URL+"/moved.yaml", auth)
+	assert.NilError(t, err)
+	assert.Equal(t, template, b)
+
+	_, err = fetch(tlsSrv.URL+"/template.yaml", templateAuth{})
+	assert.ErrorContains(t, err, "401 Unauthorized (hint: specify the credentials")
+
+	// the redirect from HTTPS to plain HTTP is refused before sending the request
+	_, err = fetch(tlsSrv.URL+"/downgraded.yaml", auth)
+	assert.ErrorContains(t, err, "downgrades HTTPS to plain HTTP")
+	assert.Equal(t, int32(0), plainRequests.Load())
+
+	// plain HTTP is allowed with a warning
+	b, err = fetch(plain.URL+"/template.yaml", auth)
+	assert.NilError(t, err)
+	assert.Equal(t, template, b)
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.Assert(t, strings.Contains(hook.LastEntry().Message, "sent in cleartext"))
+	assert.Assert(t, !strings.Contains(hook.LastEntry().Message, "password"))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/stats"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func newStatsCommand() *cobra.Command {
+	statsCommand := &cobra.Command{
+		Use:   "stats [INSTANCE]...",
+		Short: "Show the resource usage of instances",
+		Long: `Show the resource usage of instances.
+
+CPU% and RSS are the usage of the VM process on the host.
+CPU% is the CPU time consumed during a second, or since the previous refresh with --watch.
+LOAD (the load averages over 1, 5, and 15 minutes) and MEMPRESSURE (the "some avg10" value of /proc/pressure/memory)
+are reported by the guest agent. BALLOON is the actual memory size when field ` + "`memoryBalloon.enabled`" + ` is set.
+ROOTFS is the usage of the root filesystem of the guest. The usage of the mounts is included in the JSON output.
+The values are shown as "-" when they are not available, e.g., when the instance is stopped,
+or MEMPRESSURE when the guest kernel does not support PSI.`,
+		Example: `  $ limactl stats
+  $ limactl stats --watch default
+  $ limactl stats --format json`,
+		Args:              WrapArgsError(cobra.ArbitraryArgs),
+		RunE:              statsAction,
+		ValidArgsFunction: statsBashComplete,
+		GroupID:           advancedCommand,
+	}
+	statsCommand.Flags().StringP("format", "f", "table", "output format, one of: json, table")
+	statsCommand.Flags().BoolP("watch", "w", false, "refresh the stats every 2 seconds")
+	return statsCommand
+}
+
+func statsAction(cmd *cobra.Command, args []string) error {
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json", "table":
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	watch, err := cmd.Flags().GetBool("watch")
+	if err != nil {
+		return err
+	}
+	instNames := args
+	if len(instNames) == 0 {
+		instNames, err = store.Instances()
+		if err != nil {
+			return err
+		}
+	}
+	out := cmd.OutOrStdout()
+	sampler := stats.NewCPUSampler()
+	for {
+		var insts []*store.Instance
+		for _, instName := range instNames {
+			inst, err := store.Inspect(instName)
+			if err != nil {
+				return err
+			}
+			insts = append(insts, inst)
+		}
+		all := stats.GetAll(cmd.Context(), insts, sampler)
+		if watch && format == "table" {
+			// clear the screen
+			fmt.Fprint(out, "\033[H\033[2J")
+		}
+		if err := printStats(out, all, format); err != nil {
+			return err
+		}
+		if !watch {
+			return nil
+		}
+		select {
+		case <-cmd.Context().Done():
+			return nil
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func printStats(out io.Writer, all []*stats.Stats, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		for _, s := range all {
+			if err := enc.Encode(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 4, 8, 4, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\t"+strings.Join(stats.TableHeader, "\t"))
+	for _, s := range all {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, s.Status, strings.Join(s.TableRow(), "\t"))
+	}
+	return w.Flush()
+}
+
+func statsBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
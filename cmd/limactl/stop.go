@@ -10,6 +10,7 @@ import (
 	"time"
 
 	hostagentevents "github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
 	networks "github.com/lima-vm/lima/pkg/networks/reconcile"
 	"github.com/lima-vm/lima/pkg/osutil"
 	"github.com/lima-vm/lima/pkg/store"
@@ -29,6 +30,7 @@ func newStopCommand() *cobra.Command {
 	}
 
 	stopCmd.Flags().BoolP("force", "f", false, "force stop the instance")
+	stopCmd.Flags().Duration("timeout", 0, "duration to wait for the guest to shut down before killing it, overriding `shutdown.timeout` (0 kills immediately)")
 	return stopCmd
 }
 
@@ -47,10 +49,21 @@ func stopAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	var timeout *time.Duration
+	if cmd.Flags().Changed("timeout") {
+		t, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			return err
+		}
+		if t < 0 {
+			return fmt.Errorf("--timeout must not be negative, got %v", t)
+		}
+		timeout = &t
+	}
 	if force {
 		stopInstanceForcibly(inst)
 	} else {
-		err = stopInstanceGracefully(inst)
+		err = stopInstanceGracefully(inst, timeout)
 	}
 	// TODO: should we also reconcile networks if graceful stop returned an error?
 	if err == nil {
@@ -59,11 +72,29 @@ func stopAction(cmd *cobra.Command, args []string) error {
 	return err
 }
 
-func stopInstanceGracefully(inst *store.Instance) error {
-	if inst.Status != store.StatusRunning {
+// stopInstanceGracefully stops the instance via the host agent.
+// timeout overrides `shutdown.timeout` when it is not nil.
+func stopInstanceGracefully(inst *store.Instance, timeout *time.Duration) error {
+	if inst.Status != store.StatusRunning && inst.Status != store.StatusPaused {
 		return fmt.Errorf("expected status %q, got %q (maybe use `limactl stop -f`?)", store.StatusRunning, inst.Status)
 	}
 
+	shutdownTimeout := 3 * time.Minute
+	if inst.Config != nil && inst.Config.Shutdown.Timeout != nil {
+		t, err := limayaml.ParseShutdownTimeout(*inst.Config.Shutdown.Timeout)
+		if err != nil {
+			return err
+		}
+		shutdownTimeout = t
+	}
+	if timeout != nil {
+		shutdownTimeout = *timeout
+		overridePath := filepath.Join(inst.Dir, filenames.ShutdownTimeout)
+		if err := os.WriteFile(overridePath, []byte(shutdownTimeout.String()), 0o644); err != nil {
+			return err
+		}
+	}
+
 	begin := time.Now() // used for logrus propagation
 	logrus.Infof("Sending SIGINT to hostagent process %d", inst.HostAgentPID)
 	if err := osutil.SysKill(inst.HostAgentPID, osutil.SigInt); err != nil {
@@ -71,11 +102,12 @@ func stopInstanceGracefully(inst *store.Instance) error {
 	}
 
 	logrus.Info("Waiting for the host agent and the driver processes to shut down")
-	return waitForHostAgentTermination(context.TODO(), inst, begin)
+	// leave a margin for killing the driver after the shutdown timeout
+	return waitForHostAgentTermination(context.TODO(), inst, begin, max(3*time.Minute, shutdownTimeout+time.Minute))
 }
 
-func waitForHostAgentTermination(ctx context.Context, inst *store.Instance, begin time.Time) error {
-	ctx2, cancel := context.WithTimeout(ctx, 3*time.Minute)
+func waitForHostAgentTermination(ctx context.Context, inst *store.Instance, begin time.Time, timeout time.Duration) error {
+	ctx2, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	var receivedExitingEvent bool
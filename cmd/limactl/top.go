@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+
+	"github.com/lima-vm/lima/pkg/top"
+	"github.com/spf13/cobra"
+)
+
+func newTopCommand() *cobra.Command {
+	topCommand := &cobra.Command{
+		Use:   "top",
+		Short: "Show the resource usage of the running instances, refreshing every 2 seconds",
+		Long: `Show the resource usage of the running instances, refreshing every 2 seconds.
+
+CPU% and RSS are the usage of the VM process on the host.
+CPU% is the CPU time consumed since the previous refresh, not the average over the lifetime of the process.
+MEMORY is the memory size of the guest, ROOTFS is the usage of the root filesystem of the guest,
+and PORTS is the number of the TCP ports forwarded from the guest.
+
+Keys:
+  <, >, or the arrow keys: change the sort column
+  1-6: select the sort column
+  r: reverse the sort order
+  q: quit
+
+When the output is not a terminal, the usage is printed once. See also ` + "`limactl stats`" + `.`,
+		Args:    WrapArgsError(cobra.NoArgs),
+		RunE:    topAction,
+		GroupID: advancedCommand,
+	}
+	return topCommand
+}
+
+func topAction(cmd *cobra.Command, _ []string) error {
+	return top.Run(cmd.Context(), os.Stdin, os.Stdout)
+}
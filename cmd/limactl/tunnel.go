@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/lima-vm/lima/pkg/sshutil"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newTunnelCommand() *cobra.Command {
+	tunnelCommand := &cobra.Command{
+		Use:   "tunnel INSTANCE",
+		Short: "Forward ports of a running instance, without editing the YAML",
+		Long: `Forward ports of a running instance over a dedicated SSH connection, without editing the YAML.
+The forwards are kept until the command is interrupted, e.g., with Ctrl-C.`,
+		Example: `  To forward the guest port 5432 to the host port 15432:
+  $ limactl tunnel --local 15432:5432 default
+
+  To start a SOCKS proxy on the host port 1080, for accessing the guest network from a browser:
+  $ limactl tunnel --socks 1080 default`,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              tunnelAction,
+		ValidArgsFunction: tunnelBashComplete,
+		GroupID:           advancedCommand,
+	}
+	tunnelCommand.Flags().StringArray("local", nil, "forward `[HOSTIP:]HOSTPORT:GUESTPORT` (can be specified multiple times; HOSTIP defaults to 127.0.0.1)")
+	tunnelCommand.Flags().String("socks", "", "start a SOCKS proxy on `[HOSTIP:]HOSTPORT` (HOSTIP defaults to 127.0.0.1)")
+	return tunnelCommand
+}
+
+// tunnelForward is a local forward of `limactl tunnel --local`.
+type tunnelForward struct {
+	hostAddr  string
+	guestPort int
+}
+
+// parseTunnelLocal parses the value of `--local` in the "[HOSTIP:]HOSTPORT:GUESTPORT" format.
+func parseTunnelLocal(s string) (tunnelForward, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return tunnelForward{}, fmt.Errorf("expected the \"[HOSTIP:]HOSTPORT:GUESTPORT\" format, got %q", s)
+	}
+	hostAddr, err := parseTunnelHostAddr(s[:i])
+	if err != nil {
+		return tunnelForward{}, err
+	}
+	guestPort, err := parseTunnelPort(s[i+1:])
+	if err != nil {
+		return tunnelForward{}, err
+	}
+	return tunnelForward{hostAddr: hostAddr, guestPort: guestPort}, nil
+}
+
+// parseTunnelHostAddr parses "[HOSTIP:]HOSTPORT" into "HOSTIP:HOSTPORT".
+func parseTunnelHostAddr(s string) (string, error) {
+	hostIP, portStr := "127.0.0.1", s
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		hostIP, portStr = strings.Trim(s[:i], "[]"), s[i+1:]
+		if net.ParseIP(hostIP) == nil {
+			return "", fmt.Errorf("invalid host IP %q", hostIP)
+		}
+	}
+	port, err := parseTunnelPort(portStr)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(hostIP, strconv.Itoa(port)), nil
+}
+
+func parseTunnelPort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+// checkTunnelHostAddr returns an error if the address is already bound on the host.
+func checkTunnelHostAddr(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("%s is not available on the host: %w", addr, err)
+	}
+	return l.Close()
+}
+
+// dedicatedSSHOpts removes the options for multiplexing the sessions over the ControlPath of the instance,
+// so that the forwards are removed when the ssh process exits.
+func dedicatedSSHOpts(opts []string) []string {
+	var res []string
+	for _, o := range opts {
+		if strings.HasPrefix(o, "ControlMaster=") || strings.HasPrefix(o, "ControlPath=") || strings.HasPrefix(o, "ControlPersist=") {
+			continue
+		}
+		res = append(res, o)
+	}
+	return append(res, "ControlMaster=no", "ControlPath=none", "ExitOnForwardFailure=yes")
+}
+
+func tunnelAction(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	locals, err := flags.GetStringArray("local")
+	if err != nil {
+		return err
+	}
+	socks, err := flags.GetString("socks")
+	if err != nil {
+		return err
+	}
+	if len(locals) == 0 && socks == "" {
+		return errors.New("specify --local or --socks")
+	}
+
+	var forwardArgs []string
+	var hostAddrs []string
+	for _, s := range locals {
+		fwd, err := parseTunnelLocal(s)
+		if err != nil {
+			return fmt.Errorf("invalid --local: %w", err)
+		}
+		hostAddrs = append(hostAddrs, fwd.hostAddr)
+		forwardArgs = append(forwardArgs, "-L", fmt.Sprintf("%s:127.0.0.1:%d", fwd.hostAddr, fwd.guestPort))
+		logrus.Infof("Forwarding %s to the guest port %d", fwd.hostAddr, fwd.guestPort)
+	}
+	if socks != "" {
+		socksAddr, err := parseTunnelHostAddr(socks)
+		if err != nil {
+			return fmt.Errorf("invalid --socks: %w", err)
+		}
+		hostAddrs = append(hostAddrs, socksAddr)
+		forwardArgs = append(forwardArgs, "-D", socksAddr)
+		logrus.Infof("Starting a SOCKS proxy on %s", socksAddr)
+	}
+	seen := make(map[string]bool)
+	for _, addr := range hostAddrs {
+		if seen[addr] {
+			return fmt.Errorf("%s is specified multiple times", addr)
+		}
+		seen[addr] = true
+		if err := checkTunnelHostAddr(addr); err != nil {
+			return err
+		}
+	}
+
+	inst, err := runningInstance(args[0])
+	if err != nil {
+		return err
+	}
+	arg0, err := exec.LookPath("ssh")
+	if err != nil {
+		return err
+	}
+	sshOpts, err := sshutil.SSHOpts(inst.Dir, *inst.Config.SSH.GenerateDedicatedKey, *inst.Config.SSH.LoadDotSSHPubKeys, false, false, false, sshutil.ConnectionOpts{
+		ControlPersist:      *inst.Config.SSH.ControlPersist,
+		ServerAliveInterval: *inst.Config.SSH.ServerAliveInterval,
+		ServerAliveCountMax: *inst.Config.SSH.ServerAliveCountMax,
+	})
+	if err != nil {
+		return err
+	}
+	sshArgs := sshutil.SSHArgsFromOpts(dedicatedSSHOpts(sshOpts))
+	if debug, err := flags.GetBool("debug"); err != nil {
+		return err
+	} else if debug {
+		sshArgs = append(sshArgs, "-v")
+	}
+	sshArgs = append(sshArgs, "-N", "-p", strconv.Itoa(inst.SSHLocalPort))
+	sshArgs = append(sshArgs, forwardArgs...)
+	sshArgs = append(sshArgs, inst.SSHAddress)
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	sshCmd := exec.CommandContext(ctx, arg0, sshArgs...)
+	sshCmd.Stdout = cmd.OutOrStdout()
+	sshCmd.Stderr = cmd.ErrOrStderr()
+	logrus.Debugf("executing ssh: %+v", sshCmd.Args)
+	logrus.Info("Press Ctrl-C to stop the tunnel")
+	if err := sshCmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			logrus.Info("Stopped the tunnel")
+			return nil
+		}
+		return fmt.Errorf("ssh exited (hint: run with --debug for the details): %w", err)
+	}
+	return nil
+}
+
+func tunnelBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
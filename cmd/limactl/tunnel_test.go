@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseTunnelLocal(t *testing.T) {
+	fwd, err := parseTunnelLocal("15432:5432")
+	assert.NilError(t, err)
+	assert.Equal(t, tunnelForward{hostAddr: "127.0.0.1:15432", guestPort: 5432}, fwd)
+
+	fwd, err = parseTunnelLocal("0.0.0.0:8080:80")
+	assert.NilError(t, err)
+	assert.Equal(t, tunnelForward{hostAddr: "0.0.0.0:8080", guestPort: 80}, fwd)
+
+	fwd, err = parseTunnelLocal("[::1]:8080:80")
+	assert.NilError(t, err)
+	assert.Equal(t, tunnelForward{hostAddr: "[::1]:8080", guestPort: 80}, fwd)
+
+	_, err = parseTunnelLocal("5432")
+	assert.ErrorContains(t, err, "HOSTPORT:GUESTPORT")
+	_, err = parseTunnelLocal("15432:65536")
+	assert.ErrorContains(t, err, "invalid port")
+	_, err = parseTunnelLocal("localhost:15432:5432")
+	assert.ErrorContains(t, err, "invalid host IP")
+}
+
+func TestCheckTunnelHostAddr(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer l.Close()
+	assert.ErrorContains(t, checkTunnelHostAddr(l.Addr().String()), "is not available on the host")
+}
+
+func TestDedicatedSSHOpts(t *testing.T) {
+	opts := []string{"User=foo", "ControlMaster=auto", `ControlPath="/tmp/ssh.sock"`, "ControlPersist=yes", "ServerAliveInterval=30"}
+	assert.DeepEqual(t, []string{"User=foo", "ServerAliveInterval=30", "ControlMaster=no", "ControlPath=none", "ExitOnForwardFailure=yes"}, dedicatedSSHOpts(opts))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/usb"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newUSBCommand() *cobra.Command {
+	usbCommand := &cobra.Command{
+		Use:   "usb",
+		Short: "Manage USB devices of a running instance",
+		Long: `Detach and attach the USB devices configured in the "usbDevices" field, while the instance is running.
+INDEX is the index of the device in the "usbDevices" list, starting from 0.`,
+		PersistentPreRun: func(*cobra.Command, []string) {
+			logrus.Warn("`limactl usb` is experimental")
+		},
+		GroupID: advancedCommand,
+	}
+	usbCommand.AddCommand(newUSBAttachCommand())
+	usbCommand.AddCommand(newUSBDetachCommand())
+	return usbCommand
+}
+
+func newUSBAttachCommand() *cobra.Command {
+	attachCommand := &cobra.Command{
+		Use:               "attach INSTANCE INDEX",
+		Short:             "Attach a configured USB device to a running instance",
+		Args:              WrapArgsError(cobra.ExactArgs(2)),
+		RunE:              usbAttachAction,
+		ValidArgsFunction: usbBashComplete,
+	}
+	return attachCommand
+}
+
+func usbAttachAction(cmd *cobra.Command, args []string) error {
+	inst, index, err := usbArgs(args)
+	if err != nil {
+		return err
+	}
+	if err := usb.Attach(cmd.Context(), inst, index); err != nil {
+		return err
+	}
+	logrus.Infof("Attached USB device %d to %q", index, inst.Name)
+	return nil
+}
+
+func newUSBDetachCommand() *cobra.Command {
+	detachCommand := &cobra.Command{
+		Use:               "detach INSTANCE INDEX",
+		Short:             "Detach a configured USB device from a running instance",
+		Args:              WrapArgsError(cobra.ExactArgs(2)),
+		RunE:              usbDetachAction,
+		ValidArgsFunction: usbBashComplete,
+	}
+	return detachCommand
+}
+
+func usbDetachAction(cmd *cobra.Command, args []string) error {
+	inst, index, err := usbArgs(args)
+	if err != nil {
+		return err
+	}
+	if err := usb.Detach(cmd.Context(), inst, index); err != nil {
+		return err
+	}
+	logrus.Infof("Detached USB device %d from %q", index, inst.Name)
+	return nil
+}
+
+func usbArgs(args []string) (*store.Instance, int, error) {
+	inst, err := store.Inspect(args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	index, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid USB device index %q: %w", args[1], err)
+	}
+	return inst, index, nil
+}
+
+func usbBashComplete(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return bashCompleteInstanceNames(cmd)
+}
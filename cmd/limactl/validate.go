@@ -1,10 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/lima-vm/lima/cmd/limactl/guessarg"
+	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
 	"github.com/spf13/cobra"
 
 	"github.com/sirupsen/logrus"
@@ -12,13 +17,23 @@ import (
 
 func newValidateCommand() *cobra.Command {
 	validateCommand := &cobra.Command{
-		Use:     "validate FILE.yaml [FILE.yaml, ...]",
-		Short:   "Validate YAML files",
+		Use:   "validate FILE.yaml|URL [FILE.yaml|URL, ...]",
+		Short: "Validate YAML files",
+		Long: `Validate YAML files, without creating an instance.
+
+All the arguments are validated, and the command fails if any of them is invalid.`,
+		Example: `  Validate a local file:
+  $ limactl validate ./lima.yaml
+
+  Validate templates in batch:
+  $ limactl validate template://default template://docker https://example.com/lima.yaml
+`,
 		Args:    WrapArgsError(cobra.MinimumNArgs(1)),
 		RunE:    validateAction,
 		GroupID: advancedCommand,
 	}
 	validateCommand.Flags().Bool("fill", false, "fill defaults")
+	registerTemplateAuthFlags(validateCommand, "")
 	return validateCommand
 }
 
@@ -28,15 +43,15 @@ func validateAction(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	for _, f := range args {
-		y, err := store.LoadYAMLByFilePath(f)
+	var failed int
+	for _, arg := range args {
+		y, err := validateTemplate(cmd, arg)
 		if err != nil {
-			return fmt.Errorf("failed to load YAML file %q: %w", f, err)
-		}
-		if _, err := guessarg.InstNameFromYAMLPath(f); err != nil {
-			return err
+			logrus.WithError(err).Errorf("%q: invalid", arg)
+			failed++
+			continue
 		}
-		logrus.Infof("%q: OK", f)
+		logrus.Infof("%q: OK", arg)
 		if fill {
 			b, err := store.SaveYAML(y, len(args) > 1)
 			if err != nil {
@@ -45,6 +60,47 @@ func validateAction(cmd *cobra.Command, args []string) error {
 			fmt.Fprint(cmd.OutOrStdout(), string(b))
 		}
 	}
-
+	if failed > 0 {
+		return fmt.Errorf("%d of %d templates are invalid", failed, len(args))
+	}
 	return nil
 }
+
+// validateTemplate loads and validates the template referred by arg.
+// The instance store is never modified.
+func validateTemplate(cmd *cobra.Command, arg string) (*limayaml.LimaYAML, error) {
+	if !seemsTemplateArg(arg) {
+		return nil, errors.New("argument must be either a YAML file path or a URL")
+	}
+	auth, err := templateAuthFromFlags(cmd.Flags())
+	if err != nil {
+		return nil, err
+	}
+	instName, yBytes, err := readTemplate(cmd.Context(), arg, "", auth)
+	if err != nil {
+		return nil, err
+	}
+	// The file path is used for filling the instance-local defaults, e.g., the host sockets.
+	var filePath string
+	if ok, _ := guessarg.SeemsTemplateURL(arg); ok || guessarg.SeemsHTTPURL(arg) {
+		instDir, err := store.InstanceDir(instName)
+		if err != nil {
+			return nil, err
+		}
+		filePath = filepath.Join(instDir, filenames.LimaYAML)
+	} else {
+		// We need to use the absolute path for local files, like store.LoadYAMLByFilePath.
+		filePath, err = filepath.Abs(strings.TrimPrefix(arg, "file://"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	y, err := limayaml.Load(yBytes, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := limayaml.Validate(y, true); err != nil {
+		return nil, err
+	}
+	return y, nil
+}
@@ -78,26 +78,40 @@ func enableDisableService(action, hostOS, serviceWithPath string) error {
 	// Get filename without extension
 	filename := strings.TrimSuffix(path.Base(serviceWithPath), filepath.Ext(path.Base(serviceWithPath)))
 
-	var args []string
+	var cmds [][]string
 	if hostOS == "darwin" {
 		// man launchctl
-		args = append(args, []string{
-			"launchctl",
-			action,
-			fmt.Sprintf("gui/%s/%s", strconv.Itoa(os.Getuid()), filename),
-		}...)
+		domain := "gui/" + strconv.Itoa(os.Getuid())
+		switch action {
+		case "enable":
+			// "enable" does not load the plist, so it has to be bootstrapped too
+			cmds = append(cmds, []string{"launchctl", "enable", domain + "/" + filename})
+			// "bootstrap" fails when the plist is already loaded, e.g., when start-at-login is enabled twice.
+			// The loaded job is not booted out, as it may be running the instance in the foreground.
+			if err := exec.Command("launchctl", "print", domain+"/"+filename).Run(); err != nil {
+				cmds = append(cmds, []string{"launchctl", "bootstrap", domain, serviceWithPath})
+			}
+		case "disable":
+			// "bootout" fails when the plist is not loaded, e.g., after "launchctl bootout" by the user
+			_ = exec.Command("launchctl", "bootout", domain+"/"+filename).Run()
+			cmds = append(cmds, []string{"launchctl", "disable", domain + "/" + filename})
+		}
 	} else {
-		args = append(args, []string{
-			"systemctl",
-			"--user",
-			action,
-			filename,
-		}...)
+		if action == "enable" {
+			// Make systemd aware of the unit file that has been just written
+			cmds = append(cmds, []string{"systemctl", "--user", "daemon-reload"})
+		}
+		cmds = append(cmds, []string{"systemctl", "--user", action, filename})
+	}
+	for _, args := range cmds {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to run %v: %w", args, err)
+		}
 	}
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return nil
 }
 
 func renderTemplate(hostOS, instName, workDir string, getExecutable func() (string, error)) ([]byte, error) {
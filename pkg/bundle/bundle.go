@@ -0,0 +1,389 @@
+// Package bundle implements the instance bundles of `limactl export` and `limactl import`.
+//
+// A bundle is a zstd-compressed tar archive. The first entry is manifest.json,
+// followed by the files of the instance directory, and the data disks as "disks/NAME/datadisk".
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/iso9660util"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/qemu/imgutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/version"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FileExtension is the conventional file extension of the bundles.
+	FileExtension = ".limabundle"
+
+	manifestFile = "manifest.json"
+	disksPrefix  = "disks/"
+)
+
+// Manifest describes the instance in a bundle.
+type Manifest struct {
+	// Name is the name of the exported instance, used as the default name on importing.
+	Name string `json:"name"`
+	// LimaVersion is the version of Lima that exported the instance.
+	LimaVersion string          `json:"limaVersion"`
+	VMType      limayaml.VMType `json:"vmType"`
+	Arch        limayaml.Arch   `json:"arch"`
+	// Disks are the names of the additional disks in the bundle.
+	Disks []string `json:"disks,omitempty"`
+}
+
+// instanceFiles are the files of the instance directory that are exported as they are, in addition to the disks.
+// The other files, such as cidata.iso, are regenerated on starting the instance.
+var instanceFiles = []string{
+	filenames.LimaYAML,
+	filenames.LimaVersion,
+	filenames.Kernel,
+	filenames.KernelCmdline,
+	filenames.Initrd,
+	filenames.SSHPrivateKey,
+	filenames.SSHPublicKey,
+}
+
+// entry is a file to be written to a bundle.
+type entry struct {
+	name string // the path in the bundle
+	path string // the path on the host
+}
+
+// Export exports the instance to the bundle dst.
+// A running instance is refused unless force is true, as its disks may be inconsistent.
+func Export(ctx context.Context, inst *store.Instance, dst string, force bool) error {
+	running := inst.Status == store.StatusRunning || inst.Status == store.StatusPaused
+	if running {
+		if !force {
+			return fmt.Errorf("instance %q is %s, stop it first (or use --force, at the risk of exporting inconsistent disks)", inst.Name, strings.ToLower(string(inst.Status)))
+		}
+		logrus.Warnf("Exporting instance %q while it is %s, the disks may be inconsistent", inst.Name, strings.ToLower(string(inst.Status)))
+	}
+	if _, err := os.Stat(dst); !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("file %q already exists", dst)
+	}
+	zstd, err := exec.LookPath("zstd")
+	if err != nil {
+		return fmt.Errorf("zstd is required for exporting an instance: %w", err)
+	}
+
+	m := Manifest{
+		Name:        inst.Name,
+		LimaVersion: version.Version,
+		VMType:      inst.VMType,
+		Arch:        inst.Arch,
+	}
+	var entries []entry
+	for _, f := range instanceFiles {
+		p := filepath.Join(inst.Dir, f)
+		if _, err := os.Stat(p); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		entries = append(entries, entry{name: f, path: p})
+	}
+	diskEntries, cleanup, err := exportDisk(inst, dst, running)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	entries = append(entries, diskEntries...)
+	for _, d := range inst.Config.AdditionalDisks {
+		disk, err := store.InspectDisk(d.Name)
+		if err != nil {
+			return fmt.Errorf("failed to inspect disk %q: %w", d.Name, err)
+		}
+		entries = append(entries, entry{name: disksPrefix + d.Name + "/" + filenames.DataDisk, path: filepath.Join(disk.Dir, filenames.DataDisk)})
+		m.Disks = append(m.Disks, d.Name)
+	}
+
+	tmp := dst + ".tmp"
+	cmd := exec.CommandContext(ctx, zstd, "-q", "-T0", "-f", "-o", tmp)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Exporting instance %q to %q", inst.Name, dst)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	writeErr := write(stdin, &m, entries)
+	_ = stdin.Close()
+	if err := errors.Join(writeErr, cmd.Wait()); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to export instance %q: %w", inst.Name, err)
+	}
+	return os.Rename(tmp, dst)
+}
+
+// exportDisk returns the entries of the disk of the instance.
+// A diff disk with a backing file is converted to a temporary standalone image next to dst, and removed by cleanup.
+// The base disk is only exported when it is an ISO image, as it is attached as a CD-ROM.
+func exportDisk(inst *store.Instance, dst string, running bool) (_ []entry, cleanup func(), _ error) {
+	cleanup = func() {}
+	var entries []entry
+	baseDisk := filepath.Join(inst.Dir, filenames.BaseDisk)
+	if isISO, err := iso9660util.IsISO9660(baseDisk); err == nil && isISO {
+		entries = append(entries, entry{name: filenames.BaseDisk, path: baseDisk})
+	}
+	diffDisk := filepath.Join(inst.Dir, filenames.DiffDisk)
+	if _, err := os.Stat(diffDisk); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			logrus.Infof("The disk of instance %q has not been created yet, so the image will be downloaded on starting the imported instance", inst.Name)
+			return entries, cleanup, nil
+		}
+		return nil, cleanup, err
+	}
+	// The diff disk of VZ is always a raw image, and qemu-img may not be installed
+	if inst.VMType == limayaml.VZ {
+		return append(entries, entry{name: filenames.DiffDisk, path: diffDisk}), cleanup, nil
+	}
+	info, err := imgutil.GetInfo(diffDisk)
+	if err != nil {
+		return nil, cleanup, fmt.Errorf("failed to get the information of %q: %w", diffDisk, err)
+	}
+	if info.BackingFilename == "" {
+		return append(entries, entry{name: filenames.DiffDisk, path: diffDisk}), cleanup, nil
+	}
+	standalone := dst + ".diffdisk.tmp"
+	cleanup = func() {
+		_ = os.Remove(standalone)
+	}
+	logrus.Infof("Converting %q to a standalone image (the snapshots are not exported)", diffDisk)
+	if err := imgutil.ConvertToStandaloneQcow2(diffDisk, standalone, running); err != nil {
+		return nil, cleanup, err
+	}
+	entries = append(entries, entry{name: filenames.DiffDisk, path: standalone})
+	return entries, cleanup, nil
+}
+
+// write writes the tar archive of the manifest and the entries to w.
+func write(w io.Writer, m *Manifest, entries []entry) error {
+	tw := tar.NewWriter(w)
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: manifestFile, Mode: 0o644, Size: int64(len(b))}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(b); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := writeEntry(tw, e); err != nil {
+			return fmt.Errorf("failed to write %q: %w", e.path, err)
+		}
+	}
+	return tw.Close()
+}
+
+func writeEntry(tw *tar.Writer, e entry) error {
+	f, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Name:    e.name,
+		Mode:    int64(st.Mode().Perm()),
+		Size:    st.Size(),
+		ModTime: st.ModTime(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Import imports the bundle src as a new instance.
+// When instName is empty, the name of the exported instance is used.
+func Import(ctx context.Context, src, instName string) (*store.Instance, error) {
+	if _, err := os.Stat(src); err != nil {
+		return nil, err
+	}
+	zstd, err := exec.LookPath("zstd")
+	if err != nil {
+		return nil, fmt.Errorf("zstd is required for importing an instance: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, zstd, "-q", "-d", "-c", src)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	m, instName, err := extract(stdout, instName)
+	if err != nil {
+		// zstd may be still writing
+		cancel()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("failed to import %q: %w", src, err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("failed to decompress %q: %w", src, err)
+	}
+	if goarch := limayaml.NewArch(runtime.GOARCH); m.Arch != goarch {
+		logrus.Warnf("Instance %q was exported on a %s host, so it will be emulated on this %s host, and will be slow", instName, m.Arch, goarch)
+	}
+	return store.Inspect(instName)
+}
+
+// extract extracts the tar archive r to the directory of the instance instName, and to the disk directories.
+// Nothing is left behind on an error.
+func extract(r io.Reader, instName string) (_ *Manifest, _ string, retErr error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read the manifest: %w", err)
+	}
+	if hdr.Name != manifestFile {
+		return nil, "", fmt.Errorf("expected %q as the first entry, got %q (not a Lima bundle?)", manifestFile, hdr.Name)
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, "", fmt.Errorf("failed to decode the manifest: %w", err)
+	}
+	if instName == "" {
+		instName = m.Name
+	}
+	instDir, err := store.InstanceDir(instName)
+	if err != nil {
+		return nil, "", err
+	}
+	// the full path of the socket name must be less than UNIX_PATH_MAX chars.
+	if maxSockName := filepath.Join(instDir, filenames.LongestSock); len(maxSockName) >= osutil.UnixPathMax {
+		return nil, "", fmt.Errorf("instance name %q too long: %q must be less than UNIX_PATH_MAX=%d characters, but is %d",
+			instName, maxSockName, osutil.UnixPathMax, len(maxSockName))
+	}
+	if _, err := os.Stat(instDir); !errors.Is(err, os.ErrNotExist) {
+		return nil, "", fmt.Errorf("instance %q already exists (%q)", instName, instDir)
+	}
+	diskDirs := make(map[string]string, len(m.Disks))
+	for _, d := range m.Disks {
+		diskDir, err := store.DiskDir(d)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := os.Stat(diskDir); !errors.Is(err, os.ErrNotExist) {
+			return nil, "", fmt.Errorf("disk %q already exists (%q)", d, diskDir)
+		}
+		diskDirs[d] = diskDir
+	}
+	created := []string{instDir}
+	defer func() {
+		if retErr != nil {
+			for _, dir := range created {
+				if err := os.RemoveAll(dir); err != nil {
+					logrus.WithError(err).Warnf("Failed to remove %q", dir)
+				}
+			}
+		}
+	}()
+	if err := os.MkdirAll(instDir, 0o700); err != nil {
+		return nil, "", err
+	}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, "", fmt.Errorf("unexpected entry %q of type %q", hdr.Name, hdr.Typeflag)
+		}
+		var dst string
+		if diskName, f, ok := strings.Cut(strings.TrimPrefix(hdr.Name, disksPrefix), "/"); ok && strings.HasPrefix(hdr.Name, disksPrefix) {
+			diskDir, ok := diskDirs[diskName]
+			if !ok || f != filenames.DataDisk {
+				return nil, "", fmt.Errorf("unexpected entry %q", hdr.Name)
+			}
+			if err := os.MkdirAll(diskDir, 0o755); err != nil {
+				return nil, "", err
+			}
+			created = append(created, diskDir)
+			dst = filepath.Join(diskDir, f)
+		} else {
+			if !slices.Contains(instanceFiles, hdr.Name) && hdr.Name != filenames.BaseDisk && hdr.Name != filenames.DiffDisk {
+				return nil, "", fmt.Errorf("unexpected entry %q", hdr.Name)
+			}
+			dst = filepath.Join(instDir, hdr.Name)
+		}
+		if err := extractFile(dst, tr, hdr); err != nil {
+			return nil, "", fmt.Errorf("failed to extract %q: %w", hdr.Name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(instDir, filenames.LimaYAML)); err != nil {
+		return nil, "", fmt.Errorf("the bundle does not contain %q: %w", filenames.LimaYAML, err)
+	}
+	return &m, instName, nil
+}
+
+// sparseBlockSize is the size of the blocks that are skipped when they are filled with zeros.
+const sparseBlockSize = 64 * 1024
+
+// extractFile writes the file as a sparse file, as the disks are usually sparse.
+func extractFile(dst string, r io.Reader, hdr *tar.Header) error {
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.FileMode(hdr.Mode).Perm())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buf := make([]byte, sparseBlockSize)
+	zeros := make([]byte, sparseBlockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if bytes.Equal(buf[:n], zeros[:n]) {
+				if _, err := f.Seek(int64(n), io.SeekCurrent); err != nil {
+					return err
+				}
+			} else if _, err := f.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// Extend the file when it ends with zeros
+	if err := f.Truncate(hdr.Size); err != nil {
+		return err
+	}
+	return f.Close()
+}
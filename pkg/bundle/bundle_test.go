@@ -0,0 +1,75 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func TestWriteExtract(t *testing.T) {
+	src := t.TempDir()
+	limaYAML := filepath.Join(src, filenames.LimaYAML)
+	assert.NilError(t, os.WriteFile(limaYAML, []byte("cpus: 2\n"), 0o644))
+	diffDisk := filepath.Join(src, filenames.DiffDisk)
+	// non-zero data followed by a hole
+	assert.NilError(t, os.WriteFile(diffDisk, []byte("data"), 0o644))
+	assert.NilError(t, os.Truncate(diffDisk, 3*sparseBlockSize))
+	dataDisk := filepath.Join(src, filenames.DataDisk)
+	assert.NilError(t, os.WriteFile(dataDisk, []byte("datadisk"), 0o644))
+
+	var buf bytes.Buffer
+	m := &Manifest{Name: "foo", Arch: "x86_64", VMType: "qemu", Disks: []string{"data"}}
+	assert.NilError(t, write(&buf, m, []entry{
+		{name: filenames.LimaYAML, path: limaYAML},
+		{name: filenames.DiffDisk, path: diffDisk},
+		{name: disksPrefix + "data/" + filenames.DataDisk, path: dataDisk},
+	}))
+
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+	extracted, instName, err := extract(bytes.NewReader(buf.Bytes()), "bar")
+	assert.NilError(t, err)
+	assert.Equal(t, instName, "bar")
+	assert.DeepEqual(t, extracted, m)
+
+	b, err := os.ReadFile(filepath.Join(limaHome, "bar", filenames.LimaYAML))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "cpus: 2\n")
+	b, err = os.ReadFile(filepath.Join(limaHome, "bar", filenames.DiffDisk))
+	assert.NilError(t, err)
+	assert.Equal(t, len(b), 3*sparseBlockSize)
+	assert.Equal(t, string(b[:4]), "data")
+	b, err = os.ReadFile(filepath.Join(limaHome, filenames.DisksDir, "data", filenames.DataDisk))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "datadisk")
+
+	// The instance already exists
+	_, _, err = extract(bytes.NewReader(buf.Bytes()), "bar")
+	assert.ErrorContains(t, err, `instance "bar" already exists`)
+}
+
+func TestExtractUnexpectedEntry(t *testing.T) {
+	for _, name := range []string{"../evil", "cidata.iso", disksPrefix + "other/" + filenames.DataDisk} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		manifest := []byte(`{"name":"foo"}`)
+		assert.NilError(t, tw.WriteHeader(&tar.Header{Name: manifestFile, Mode: 0o644, Size: int64(len(manifest))}))
+		_, err := tw.Write(manifest)
+		assert.NilError(t, err)
+		assert.NilError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644}))
+		assert.NilError(t, tw.Close())
+
+		limaHome := t.TempDir()
+		t.Setenv("LIMA_HOME", limaHome)
+		_, _, err = extract(&buf, "")
+		assert.ErrorContains(t, err, "unexpected entry")
+		// Nothing is left behind
+		_, err = os.Stat(filepath.Join(limaHome, "foo"))
+		assert.Assert(t, os.IsNotExist(err))
+	}
+}
@@ -17,33 +17,8 @@ fi
 # Install or update the guestagent binary
 install -m 755 "${LIMA_CIDATA_MNT}"/lima-guestagent "${LIMA_CIDATA_GUEST_INSTALL_PREFIX}"/bin/lima-guestagent
 
-# Launch the guestagent service
-if [ -f /sbin/openrc-run ]; then
-	# Install the openrc lima-guestagent service script
-	cat >/etc/init.d/lima-guestagent <<'EOF'
-#!/sbin/openrc-run
-supervisor=supervise-daemon
-
-log_file="${log_file:-/var/log/${RC_SVCNAME}.log}"
-err_file="${err_file:-${log_file}}"
-log_mode="${log_mode:-0644}"
-log_owner="${log_owner:-root:root}"
-
-supervise_daemon_args="${supervise_daemon_opts:---stderr \"${err_file}\" --stdout \"${log_file}\"}"
-
-name="lima-guestagent"
-description="Forward ports to the lima-hostagent"
-
-command=${LIMA_CIDATA_GUEST_INSTALL_PREFIX}/bin/lima-guestagent
-command_args="daemon --vsock-port \"${LIMA_CIDATA_VSOCK_PORT}\" --virtio-port \"${LIMA_CIDATA_VIRTIO_PORT}\""
-command_background=true
-pidfile="/run/lima-guestagent.pid"
-EOF
-	chmod 755 /etc/init.d/lima-guestagent
-
-	rc-update add lima-guestagent default
-	rc-service lima-guestagent start
-else
+# Launch the guestagent service, depending on the init system
+if [ -d /run/systemd/system ]; then
 	# Remove legacy systemd service
 	rm -f "${LIMA_CIDATA_HOME}/.config/systemd/user/lima-guestagent.service"
 
@@ -54,4 +29,27 @@ else
 	else
 		sudo "${LIMA_CIDATA_GUEST_INSTALL_PREFIX}"/bin/lima-guestagent install-systemd
 	fi
+elif [ -f /sbin/openrc-run ]; then
+	# Install the openrc lima-guestagent service script
+	install -m 755 "${LIMA_CIDATA_MNT}"/guestagent/openrc/lima-guestagent /etc/init.d/lima-guestagent
+	rc-update add lima-guestagent default
+	rc-service lima-guestagent restart
+elif command -v runsvdir >/dev/null 2>&1; then
+	# Install the runit lima-guestagent service directory, e.g., for Void Linux
+	mkdir -p /etc/sv/lima-guestagent
+	install -m 755 "${LIMA_CIDATA_MNT}"/guestagent/runit/lima-guestagent/run /etc/sv/lima-guestagent/run
+	# Void Linux links /var/service to the current runsvdir
+	servicedir=/var/service
+	if [ ! -d "${servicedir}" ]; then
+		servicedir=/etc/runit/runsvdir/default
+		mkdir -p "${servicedir}"
+	fi
+	if [ ! -e "${servicedir}/lima-guestagent" ]; then
+		# runsvdir starts the service within 5 seconds
+		ln -s /etc/sv/lima-guestagent "${servicedir}/lima-guestagent"
+	else
+		sv restart "${servicedir}/lima-guestagent" || true
+	fi
+else
+	echo >&2 "WARNING: the guest agent is not started, as the init system is not supported"
 fi
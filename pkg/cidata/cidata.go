@@ -110,7 +110,7 @@ func setupEnv(y *limayaml.LimaYAML, args TemplateArgs) (map[string]string, error
 	return env, nil
 }
 
-func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort, tcpDNSLocalPort int, nerdctlArchive string, vsockPort int, virtioPort string) error {
+func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort, tcpDNSLocalPort int, nerdctlArchive string, vsockPort int, virtioPort string, overrides Overrides) error {
 	if err := limayaml.Validate(y, false); err != nil {
 		return err
 	}
@@ -169,7 +169,12 @@ func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort
 	// change instance id on every boot so network config will be processed again
 	args.IID = fmt.Sprintf("iid-%d", time.Now().Unix())
 
-	pubKeys, err := sshutil.DefaultPubKeys(*y.SSH.LoadDotSSHPubKeys)
+	var pubKeys []sshutil.PubKey
+	if *y.SSH.GenerateDedicatedKey {
+		pubKeys, err = sshutil.InstancePubKeys(instDir, *y.SSH.LoadDotSSHPubKeys)
+	} else {
+		pubKeys, err = sshutil.DefaultPubKeys(*y.SSH.LoadDotSSHPubKeys)
+	}
 	if err != nil {
 		return err
 	}
@@ -179,6 +184,7 @@ func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort
 	for _, f := range pubKeys {
 		args.SSHPubKeys = append(args.SSHPubKeys, f.Content)
 	}
+	args.SSHPubKeys = append(args.SSHPubKeys, y.SSH.AuthorizedKeys...)
 
 	var fstype string
 	switch *y.MountType {
@@ -193,8 +199,8 @@ func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort
 	if err != nil {
 		return err
 	}
-	for i, f := range y.Mounts {
-		tag := fmt.Sprintf("mount%d", i)
+	for _, f := range y.Mounts {
+		tag := f.Tag
 		location, err := localpathutil.Expand(f.Location)
 		if err != nil {
 			return err
@@ -324,6 +330,9 @@ func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort
 	if err != nil {
 		return err
 	}
+	if err := applyOverrides(layout, overrides); err != nil {
+		return err
+	}
 
 	for i, f := range y.Provision {
 		switch f.Mode {
@@ -0,0 +1,120 @@
+package cidata
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/iso9660util"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Overrides are the user-provided NoCloud data, merged into the generated data.
+// Set with `limactl start --cloud-init-user-data FILE --cloud-init-network-config FILE`.
+type Overrides struct {
+	UserData      []byte
+	NetworkConfig []byte
+}
+
+const cloudConfigHeader = "#cloud-config\n"
+
+// ValidateOverride returns an error if b is not a YAML mapping.
+func ValidateOverride(b []byte) error {
+	_, err := parseOverride(b)
+	return err
+}
+
+func parseOverride(b []byte) (map[string]any, error) {
+	var m map[string]any
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse as a YAML mapping: %w", err)
+	}
+	if len(m) == 0 {
+		return nil, errors.New("got an empty YAML mapping")
+	}
+	return m, nil
+}
+
+// applyOverrides merges the overrides into the "user-data" and "network-config" entries of the layout.
+func applyOverrides(layout []iso9660util.Entry, overrides Overrides) error {
+	for i, e := range layout {
+		var (
+			override []byte
+			header   string
+		)
+		switch e.Path {
+		case "user-data":
+			override, header = overrides.UserData, cloudConfigHeader
+		case "network-config":
+			override = overrides.NetworkConfig
+		}
+		if len(override) == 0 {
+			continue
+		}
+		generated, err := io.ReadAll(e.Reader)
+		if err != nil {
+			return err
+		}
+		merged, err := mergeOverride(e.Path, generated, override)
+		if err != nil {
+			return fmt.Errorf("failed to merge the overrides into %q: %w", e.Path, err)
+		}
+		layout[i].Reader = strings.NewReader(header + string(merged))
+	}
+	return nil
+}
+
+// mergeOverride merges override into generated.
+// Mappings are merged recursively, and sequences are appended.
+// Other values of generated are replaced with a warning, as they are managed by Lima.
+func mergeOverride(name string, generated, override []byte) ([]byte, error) {
+	var g map[string]any
+	if err := yaml.Unmarshal(generated, &g); err != nil {
+		return nil, err
+	}
+	if g == nil {
+		g = make(map[string]any)
+	}
+	o, err := parseOverride(override)
+	if err != nil {
+		return nil, err
+	}
+	mergeMaps(name, "", g, o)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(g); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func mergeMaps(name, prefix string, dst, src map[string]any) {
+	for k, sv := range src {
+		dv, ok := dst[k]
+		if !ok {
+			dst[k] = sv
+			continue
+		}
+		switch d := dv.(type) {
+		case map[string]any:
+			if s, ok := sv.(map[string]any); ok {
+				mergeMaps(name, prefix+k+".", d, s)
+				continue
+			}
+		case []any:
+			if s, ok := sv.([]any); ok {
+				dst[k] = append(d, s...)
+				continue
+			}
+		}
+		logrus.Warnf("%s: overriding the key %q managed by Lima", name, prefix+k)
+		dst[k] = sv
+	}
+}
@@ -0,0 +1,64 @@
+package cidata
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/iso9660util"
+	"gotest.tools/v3/assert"
+)
+
+func TestMergeOverride(t *testing.T) {
+	generated := `#cloud-config
+growpart:
+  mode: auto
+  devices: ['/']
+users:
+  - name: lima
+bootcmd:
+  - echo lima
+`
+	override := `
+growpart:
+  mode: "off"
+users:
+  - name: extra
+packages:
+  - htop
+`
+	merged, err := mergeOverride("user-data", []byte(generated), []byte(override))
+	assert.NilError(t, err)
+	assert.Equal(t, `bootcmd:
+  - echo lima
+growpart:
+  devices:
+    - /
+  mode: "off"
+packages:
+  - htop
+users:
+  - name: lima
+  - name: extra
+`, string(merged))
+}
+
+func TestValidateOverride(t *testing.T) {
+	assert.NilError(t, ValidateOverride([]byte("packages: [htop]\n")))
+	assert.ErrorContains(t, ValidateOverride([]byte("- htop\n")), "failed to parse")
+	assert.ErrorContains(t, ValidateOverride([]byte("# empty\n")), "empty")
+}
+
+func TestApplyOverrides(t *testing.T) {
+	layout := []iso9660util.Entry{
+		{Path: "user-data", Reader: strings.NewReader("#cloud-config\nusers:\n  - name: lima\n")},
+		{Path: "network-config", Reader: strings.NewReader("version: 2\n")},
+	}
+	assert.NilError(t, applyOverrides(layout, Overrides{UserData: []byte("packages: [htop]\n")}))
+	b, err := io.ReadAll(layout[0].Reader)
+	assert.NilError(t, err)
+	assert.Equal(t, "#cloud-config\npackages:\n  - htop\nusers:\n  - name: lima\n", string(b))
+	b, err = io.ReadAll(layout[1].Reader)
+	assert.NilError(t, err)
+	assert.Equal(t, "version: 2\n", string(b))
+}
@@ -76,3 +76,30 @@ func TestTemplate9p(t *testing.T) {
 		}
 	}
 }
+
+func TestTemplateGuestAgentServices(t *testing.T) {
+	args := TemplateArgs{
+		Name:               "default",
+		User:               "foo",
+		UID:                501,
+		Home:               "/home/foo.linux",
+		SSHPubKeys:         []string{"ssh-rsa dummy foo@example.com"},
+		GuestInstallPrefix: "/usr/local",
+		VSockPort:          2222,
+		CACerts: CACerts{
+			RemoveDefaults: &defaultRemoveDefaults,
+		},
+	}
+	layout, err := ExecuteTemplate(args)
+	assert.NilError(t, err)
+	files := make(map[string]string)
+	for _, f := range layout {
+		b, err := io.ReadAll(f.Reader)
+		assert.NilError(t, err)
+		files[f.Path] = string(b)
+	}
+	assert.Assert(t, strings.Contains(files["guestagent/openrc/lima-guestagent"],
+		`command="/usr/local/bin/lima-guestagent"`+"\n"+`command_args="daemon --vsock-port 2222"`))
+	assert.Assert(t, strings.Contains(files["guestagent/runit/lima-guestagent/run"],
+		`exec "/usr/local/bin/lima-guestagent" daemon --vsock-port 2222`))
+}
@@ -0,0 +1,125 @@
+// Package console attaches a terminal to the serial console of an instance.
+package console
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/lockutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"golang.org/x/term"
+)
+
+// EscapeSequence detaches from the console when typed at the beginning of a line.
+const EscapeSequence = "~."
+
+// Attach bridges stdin and stdout to the serial console of the instance,
+// until the escape sequence is typed or the console is closed.
+// Only one session can be attached to an instance at a time.
+func Attach(ctx context.Context, inst *store.Instance, stdin *os.File, stdout io.Writer) error {
+	if inst.VMType != limayaml.QEMU {
+		return fmt.Errorf("console is not supported by vmType %q", inst.VMType)
+	}
+	if inst.Status != store.StatusRunning && inst.Status != store.StatusPaused {
+		return fmt.Errorf("expected status %q, got %q", store.StatusRunning, inst.Status)
+	}
+	unlock, err := lockutil.TryLockFile(filepath.Join(inst.Dir, filenames.ConsoleLock))
+	if err != nil {
+		return fmt.Errorf("the console of instance %q is already attached by another session: %w", inst.Name, err)
+	}
+	defer unlock()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", filepath.Join(inst.Dir, filenames.SerialSock))
+	if err != nil {
+		return fmt.Errorf("failed to connect to the serial console of instance %q: %w", inst.Name, err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(stdout, "Connected to the serial console of %q. Type %q at the beginning of a line to detach.\n", inst.Name, EscapeSequence)
+	if fd := int(stdin.Fd()); term.IsTerminal(fd) {
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = term.Restore(fd, oldState) }()
+	}
+
+	errCh := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(stdout, conn)
+		errCh <- err
+	}()
+	go func() {
+		var f escapeFilter
+		buf := make([]byte, 1024)
+		for {
+			n, err := stdin.Read(buf)
+			if n > 0 {
+				b, detach := f.filter(buf[:n])
+				if _, err := conn.Write(b); err != nil {
+					errCh <- err
+					return
+				}
+				if detach {
+					errCh <- nil
+					return
+				}
+			}
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				errCh <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return err
+}
+
+// escapeFilter detects the escape sequence at the beginning of a line, like ssh(1).
+type escapeFilter struct {
+	midLine bool // the last byte was not a newline
+	tilde   bool // "~" at the beginning of a line is pending
+}
+
+// filter returns the bytes to be sent to the console, and whether the escape sequence was typed.
+// "~~" at the beginning of a line sends a single "~".
+func (f *escapeFilter) filter(p []byte) ([]byte, bool) {
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		if f.tilde {
+			f.tilde = false
+			switch b {
+			case '.':
+				return out, true
+			case '~':
+				out = append(out, '~')
+				f.midLine = true
+				continue
+			default:
+				out = append(out, '~')
+			}
+		} else if !f.midLine && b == '~' {
+			f.tilde = true
+			continue
+		}
+		out = append(out, b)
+		f.midLine = b != '\r' && b != '\n'
+	}
+	return out, false
+}
@@ -0,0 +1,27 @@
+package console
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestEscapeFilter(t *testing.T) {
+	var f escapeFilter
+	out, detach := f.filter([]byte("ls ~.\r"))
+	assert.Equal(t, "ls ~.\r", string(out))
+	assert.Assert(t, !detach)
+
+	out, detach = f.filter([]byte("~~foo\r~"))
+	assert.Equal(t, "~foo\r", string(out))
+	assert.Assert(t, !detach)
+
+	out, detach = f.filter([]byte(".bar"))
+	assert.Equal(t, "", string(out))
+	assert.Assert(t, detach)
+
+	f = escapeFilter{}
+	out, detach = f.filter([]byte("~x"))
+	assert.Equal(t, "~x", string(out))
+	assert.Assert(t, !detach)
+}
@@ -0,0 +1,240 @@
+// Package copyutil implements `limactl copy`.
+package copyutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+)
+
+// Location is a path on the host or on an instance.
+type Location struct {
+	FS   FS
+	Path string
+	// Prefix is prepended to Path for display, e.g., "default:".
+	Prefix string
+}
+
+func (l Location) String() string {
+	return l.Prefix + l.Path
+}
+
+func (l Location) join(name string) Location {
+	return Location{FS: l.FS, Path: l.FS.Join(l.Path, name), Prefix: l.Prefix}
+}
+
+// hasTrailingSlash returns whether the path ends with a slash, e.g., "dir/".
+// Following rsync, the contents of a source directory with a trailing slash are copied,
+// instead of the directory itself.
+func (l Location) hasTrailingSlash() bool {
+	if _, ok := l.FS.(LocalFS); ok && strings.HasSuffix(l.Path, string(filepath.Separator)) {
+		return true
+	}
+	return strings.HasSuffix(l.Path, "/")
+}
+
+type Options struct {
+	// Recursive copies directories.
+	Recursive bool
+	// FollowSymlinks copies the targets of the symlinks, instead of the symlinks themselves.
+	FollowSymlinks bool
+	// Progress receives a line for each copied file, when not nil.
+	Progress io.Writer
+}
+
+// Stats is the summary of Copy.
+type Stats struct {
+	Files       int
+	Directories int
+	Symlinks    int
+	Bytes       int64
+	Duration    time.Duration
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf("%d files (%s), %d directories, and %d symlinks copied in %s",
+		s.Files, units.HumanSize(float64(s.Bytes)), s.Directories, s.Symlinks, s.Duration.Round(time.Millisecond))
+}
+
+// Copy copies srcs to dst, following the conventions of rsync:
+//
+//   - A source directory is copied into dst, e.g., "dir" to "dst/dir".
+//     The contents of a source directory with a trailing slash are copied into dst, e.g., "dir/" to "dst".
+//     Directories require opts.Recursive.
+//   - A source file is copied as dst, unless dst is an existing directory, dst has a trailing slash,
+//     or multiple sources are specified. The file is copied into dst in these cases.
+//   - The directory dst is created when missing, but its parent directory is not.
+//   - Symlinks are copied as symlinks, unless opts.FollowSymlinks is set.
+//
+// The files copied between two instances are streamed through the host, without temporary files.
+func Copy(ctx context.Context, srcs []Location, dst Location, opts Options) (*Stats, error) {
+	c := &copier{ctx: ctx, opts: opts, stats: &Stats{}}
+	begin := time.Now()
+	defer func() {
+		c.stats.Duration = time.Since(begin)
+	}()
+	intoDir := len(srcs) > 1 || dst.hasTrailingSlash()
+	if st, err := dst.FS.Stat(dst.Path); err == nil {
+		intoDir = intoDir || st.IsDir()
+	}
+	for _, src := range srcs {
+		st, err := c.stat(src)
+		if err != nil {
+			return c.stats, err
+		}
+		if st.IsDir() && !opts.Recursive {
+			return c.stats, fmt.Errorf("%s is a directory (specify --recursive)", src)
+		}
+		if st.IsDir() || intoDir {
+			if err := c.mkdir(dst, 0o755); err != nil {
+				return c.stats, err
+			}
+		}
+		if st.IsDir() && src.hasTrailingSlash() {
+			if err := c.copyDirContents(src, dst); err != nil {
+				return c.stats, err
+			}
+			continue
+		}
+		target := dst
+		if st.IsDir() || intoDir {
+			target = dst.join(src.FS.Base(src.Path))
+		}
+		if err := c.copy(src, st, target); err != nil {
+			return c.stats, err
+		}
+	}
+	return c.stats, nil
+}
+
+type copier struct {
+	ctx   context.Context
+	opts  Options
+	stats *Stats
+}
+
+func (c *copier) stat(l Location) (fs.FileInfo, error) {
+	if c.opts.FollowSymlinks {
+		return l.FS.Stat(l.Path)
+	}
+	return l.FS.Lstat(l.Path)
+}
+
+// mkdir creates the directory l unless it already exists.
+func (c *copier) mkdir(l Location, perm fs.FileMode) error {
+	if st, err := l.FS.Stat(l.Path); err == nil {
+		if !st.IsDir() {
+			return fmt.Errorf("%s is not a directory", l)
+		}
+		return nil
+	}
+	if err := l.FS.Mkdir(l.Path, perm); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", l, err)
+	}
+	return nil
+}
+
+func (c *copier) copy(src Location, st fs.FileInfo, dst Location) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	switch mode := st.Mode(); {
+	case mode&fs.ModeSymlink != 0:
+		return c.copySymlink(src, dst)
+	case mode.IsDir():
+		if !c.opts.Recursive {
+			return fmt.Errorf("%s is a directory (specify --recursive)", src)
+		}
+		if err := c.mkdir(dst, mode.Perm()); err != nil {
+			return err
+		}
+		c.stats.Directories++
+		return c.copyDirContents(src, dst)
+	case mode.IsRegular():
+		return c.copyFile(src, st, dst)
+	default:
+		logrus.Warnf("Skipping %s, as it is not a regular file, a directory, or a symlink (mode %s)", src, mode)
+		return nil
+	}
+}
+
+func (c *copier) copyDirContents(src, dst Location) error {
+	entries, err := src.FS.ReadDir(src.Path)
+	if err != nil {
+		return err
+	}
+	for _, st := range entries {
+		child := src.join(st.Name())
+		if c.opts.FollowSymlinks && st.Mode()&fs.ModeSymlink != 0 {
+			if st, err = child.FS.Stat(child.Path); err != nil {
+				return err
+			}
+		}
+		if err := c.copy(child, st, dst.join(st.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *copier) copySymlink(src, dst Location) error {
+	target, err := src.FS.ReadLink(src.Path)
+	if err != nil {
+		return err
+	}
+	// An existing file is replaced, as rsync does
+	if st, err := dst.FS.Lstat(dst.Path); err == nil && !st.IsDir() {
+		if err := dst.FS.Remove(dst.Path); err != nil {
+			return err
+		}
+	}
+	if err := dst.FS.Symlink(target, dst.Path); err != nil {
+		return fmt.Errorf("failed to create symlink %s: %w", dst, err)
+	}
+	c.stats.Symlinks++
+	if c.opts.Progress != nil {
+		fmt.Fprintf(c.opts.Progress, "%s -> %s (symlink to %q)\n", src, dst, target)
+	}
+	return nil
+}
+
+func (c *copier) copyFile(src Location, st fs.FileInfo, dst Location) (retErr error) {
+	r, err := src.FS.Open(src.Path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// A symlink at dst is replaced, instead of overwriting its target
+	if dstSt, err := dst.FS.Lstat(dst.Path); err == nil && dstSt.Mode()&fs.ModeSymlink != 0 {
+		if err := dst.FS.Remove(dst.Path); err != nil {
+			return err
+		}
+	}
+	w, err := dst.FS.Create(dst.Path, st.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	defer func() {
+		if err := w.Close(); err != nil && retErr == nil {
+			retErr = fmt.Errorf("failed to close %s: %w", dst, err)
+		}
+	}()
+	begin := time.Now()
+	n, err := io.Copy(w, r)
+	c.stats.Bytes += n
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dst, err)
+	}
+	c.stats.Files++
+	if c.opts.Progress != nil {
+		fmt.Fprintf(c.opts.Progress, "%s -> %s (%s in %s)\n", src, dst, units.HumanSize(float64(n)), time.Since(begin).Round(time.Millisecond))
+	}
+	return nil
+}
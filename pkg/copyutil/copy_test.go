@@ -0,0 +1,118 @@
+package copyutil
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func writeTree(t *testing.T, dir string) {
+	t.Helper()
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, "src", "sub"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "src", "a"), []byte("a"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "src", "sub", "b"), []byte("bb"), 0o600))
+}
+
+func local(path string) Location {
+	return Location{FS: LocalFS{}, Path: path}
+}
+
+func assertFile(t *testing.T, path, content string) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), content)
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir)
+	src := filepath.Join(dir, "src", "a")
+
+	// Copied as dst
+	_, err := Copy(context.Background(), []Location{local(src)}, local(filepath.Join(dir, "x")), Options{})
+	assert.NilError(t, err)
+	assertFile(t, filepath.Join(dir, "x"), "a")
+
+	// Copied into dst, as dst has a trailing slash
+	_, err = Copy(context.Background(), []Location{local(src)}, local(filepath.Join(dir, "y")+string(filepath.Separator)), Options{})
+	assert.NilError(t, err)
+	assertFile(t, filepath.Join(dir, "y", "a"), "a")
+
+	// Copied into dst, as multiple sources are specified
+	srcs := []Location{local(src), local(filepath.Join(dir, "src", "sub", "b"))}
+	stats, err := Copy(context.Background(), srcs, local(filepath.Join(dir, "z")), Options{})
+	assert.NilError(t, err)
+	assertFile(t, filepath.Join(dir, "z", "a"), "a")
+	assertFile(t, filepath.Join(dir, "z", "b"), "bb")
+	assert.Equal(t, stats.Files, 2)
+	assert.Equal(t, stats.Bytes, int64(3))
+}
+
+func TestCopyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir)
+	src := filepath.Join(dir, "src")
+
+	_, err := Copy(context.Background(), []Location{local(src)}, local(filepath.Join(dir, "dst")), Options{})
+	assert.ErrorContains(t, err, "specify --recursive")
+
+	var progress bytes.Buffer
+	stats, err := Copy(context.Background(), []Location{local(src)}, local(filepath.Join(dir, "dst")), Options{Recursive: true, Progress: &progress})
+	assert.NilError(t, err)
+	assertFile(t, filepath.Join(dir, "dst", "src", "a"), "a")
+	assertFile(t, filepath.Join(dir, "dst", "src", "sub", "b"), "bb")
+	assert.Equal(t, stats.Files, 2)
+	assert.Equal(t, stats.Directories, 2)
+	assert.Equal(t, strings.Count(progress.String(), "\n"), 2)
+	if runtime.GOOS != "windows" {
+		st, err := os.Stat(filepath.Join(dir, "dst", "src", "sub", "b"))
+		assert.NilError(t, err)
+		assert.Equal(t, st.Mode().Perm(), os.FileMode(0o600))
+	}
+
+	// The contents are copied, as the source has a trailing slash
+	_, err = Copy(context.Background(), []Location{local(src + string(filepath.Separator))}, local(filepath.Join(dir, "contents")), Options{Recursive: true})
+	assert.NilError(t, err)
+	assertFile(t, filepath.Join(dir, "contents", "a"), "a")
+	assertFile(t, filepath.Join(dir, "contents", "sub", "b"), "bb")
+}
+
+func TestCopySymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+	dir := t.TempDir()
+	writeTree(t, dir)
+	assert.NilError(t, os.Symlink("a", filepath.Join(dir, "src", "link")))
+
+	stats, err := Copy(context.Background(), []Location{local(filepath.Join(dir, "src") + "/")}, local(filepath.Join(dir, "preserved")), Options{Recursive: true})
+	assert.NilError(t, err)
+	target, err := os.Readlink(filepath.Join(dir, "preserved", "link"))
+	assert.NilError(t, err)
+	assert.Equal(t, target, "a")
+	assert.Equal(t, stats.Symlinks, 1)
+
+	stats, err = Copy(context.Background(), []Location{local(filepath.Join(dir, "src") + "/")}, local(filepath.Join(dir, "followed")), Options{Recursive: true, FollowSymlinks: true})
+	assert.NilError(t, err)
+	st, err := os.Lstat(filepath.Join(dir, "followed", "link"))
+	assert.NilError(t, err)
+	assert.Assert(t, st.Mode().IsRegular())
+	assertFile(t, filepath.Join(dir, "followed", "link"), "a")
+	assert.Equal(t, stats.Symlinks, 0)
+}
+
+func TestExpandHome(t *testing.T) {
+	assert.Equal(t, expandHome("~", "/home/foo.linux"), "/home/foo.linux")
+	assert.Equal(t, expandHome("~/bar", "/home/foo.linux"), "/home/foo.linux/bar")
+	assert.Equal(t, expandHome("~/*.txt", "/home/foo.linux"), "/home/foo.linux/*.txt")
+	assert.Equal(t, expandHome("/tmp/~/bar", "/home/foo.linux"), "/tmp/~/bar")
+	assert.Equal(t, expandHome("~bar", "/home/foo.linux"), "~bar", "the home of other users is not supported")
+	assert.Equal(t, expandHome("bar", "/home/foo.linux"), "bar")
+}
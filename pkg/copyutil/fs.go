@@ -0,0 +1,204 @@
+package copyutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"github.com/sirupsen/logrus"
+)
+
+// FS is the filesystem of the host or an instance.
+type FS interface {
+	Lstat(name string) (fs.FileInfo, error)
+	Stat(name string) (fs.FileInfo, error)
+	// ReadDir returns the entries of the directory name, as Lstat would return, sorted by the name.
+	ReadDir(name string) ([]fs.FileInfo, error)
+	ReadLink(name string) (string, error)
+	Symlink(oldname, newname string) error
+	Mkdir(name string, perm fs.FileMode) error
+	Remove(name string) error
+	Open(name string) (io.ReadCloser, error)
+	// Create creates or truncates the regular file name.
+	Create(name string, perm fs.FileMode) (io.WriteCloser, error)
+	Glob(pattern string) ([]string, error)
+	Join(elem ...string) string
+	Base(name string) string
+}
+
+// LocalFS is the filesystem of the host.
+type LocalFS struct{}
+
+var _ FS = LocalFS{}
+
+func (LocalFS) Lstat(name string) (fs.FileInfo, error) { return os.Lstat(name) }
+
+func (LocalFS) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+func (LocalFS) ReadDir(name string) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]fs.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, info)
+	}
+	return res, nil
+}
+
+func (LocalFS) ReadLink(name string) (string, error) { return os.Readlink(name) }
+
+func (LocalFS) Symlink(oldname, newname string) error { return os.Symlink(oldname, newname) }
+
+func (LocalFS) Mkdir(name string, perm fs.FileMode) error { return os.Mkdir(name, perm) }
+
+func (LocalFS) Remove(name string) error { return os.Remove(name) }
+
+func (LocalFS) Open(name string) (io.ReadCloser, error) { return os.Open(name) }
+
+func (LocalFS) Create(name string, perm fs.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+func (LocalFS) Glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
+
+func (LocalFS) Join(elem ...string) string { return filepath.Join(elem...) }
+
+func (LocalFS) Base(name string) string { return filepath.Base(name) }
+
+// SFTPFS is the filesystem of an instance, accessed with the SFTP subsystem of the ssh server of the guest.
+// A leading "~/" of the names is resolved against the working directory of the SFTP session, i.e., the home directory,
+// as scp and rsync do.
+type SFTPFS struct {
+	client *sftp.Client
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	home   string
+}
+
+var _ FS = (*SFTPFS)(nil)
+
+// DialSFTP starts `sshExe sshArgs... -s sftp` and returns the filesystem served by it.
+// sshArgs must end with the destination host.
+func DialSFTP(sshExe string, sshArgs []string) (*SFTPFS, error) {
+	args := append([]string{"-s"}, sshArgs...)
+	args = append(args, "sftp")
+	cmd := exec.Command(sshExe, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	logrus.Debugf("executing ssh for the SFTP subsystem: %+v", cmd.Args)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClientPipe(stdout, stdin)
+	if err != nil {
+		_ = stdin.Close()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("failed to start the SFTP session (%v): %w", cmd.Args, err)
+	}
+	home, err := client.Getwd()
+	if err != nil {
+		_ = client.Close()
+		_ = stdin.Close()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("failed to get the working directory of the SFTP session: %w", err)
+	}
+	return &SFTPFS{client: client, cmd: cmd, stdin: stdin, home: home}, nil
+}
+
+// expandHome resolves a leading "~" of name against home.
+func expandHome(name, home string) string {
+	if name == "~" {
+		return home
+	}
+	if rest, ok := strings.CutPrefix(name, "~/"); ok {
+		return path.Join(home, rest)
+	}
+	return name
+}
+
+// Close closes the SFTP session and waits for ssh to exit.
+func (s *SFTPFS) Close() error {
+	err := s.client.Close()
+	_ = s.stdin.Close()
+	return errors.Join(err, s.cmd.Wait())
+}
+
+func (s *SFTPFS) Lstat(name string) (fs.FileInfo, error) {
+	return s.client.Lstat(expandHome(name, s.home))
+}
+
+func (s *SFTPFS) Stat(name string) (fs.FileInfo, error) {
+	return s.client.Stat(expandHome(name, s.home))
+}
+
+func (s *SFTPFS) ReadDir(name string) ([]fs.FileInfo, error) {
+	res, err := s.client.ReadDir(expandHome(name, s.home))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name() < res[j].Name() })
+	return res, nil
+}
+
+func (s *SFTPFS) ReadLink(name string) (string, error) {
+	return s.client.ReadLink(expandHome(name, s.home))
+}
+
+func (s *SFTPFS) Symlink(oldname, newname string) error {
+	return s.client.Symlink(oldname, expandHome(newname, s.home))
+}
+
+func (s *SFTPFS) Mkdir(name string, perm fs.FileMode) error {
+	name = expandHome(name, s.home)
+	if err := s.client.Mkdir(name); err != nil {
+		return err
+	}
+	return s.client.Chmod(name, perm)
+}
+
+func (s *SFTPFS) Remove(name string) error { return s.client.Remove(expandHome(name, s.home)) }
+
+func (s *SFTPFS) Open(name string) (io.ReadCloser, error) {
+	return s.client.Open(expandHome(name, s.home))
+}
+
+func (s *SFTPFS) Create(name string, perm fs.FileMode) (io.WriteCloser, error) {
+	f, err := s.client.OpenFile(expandHome(name, s.home), os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(perm); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *SFTPFS) Glob(pattern string) ([]string, error) {
+	return s.client.Glob(expandHome(pattern, s.home))
+}
+
+func (s *SFTPFS) Join(elem ...string) string { return path.Join(elem...) }
+
+func (s *SFTPFS) Base(name string) string { return path.Base(name) }
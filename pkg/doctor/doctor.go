@@ -0,0 +1,266 @@
+// Package doctor checks whether the host environment can run an instance.
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/driverutil"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/qemu"
+	"github.com/lima-vm/lima/pkg/qemu/entitlementutil"
+	"github.com/lima-vm/lima/pkg/sshutil"
+)
+
+type Status string
+
+const (
+	Pass Status = "PASS"
+	Warn Status = "WARN"
+	Fail Status = "FAIL"
+)
+
+// Result is the result of a check.
+type Result struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	// Hint is the remediation hint for WARN and FAIL
+	Hint string `json:"hint,omitempty"`
+}
+
+func pass(name, format string, a ...any) Result {
+	return Result{Name: name, Status: Pass, Message: fmt.Sprintf(format, a...)}
+}
+
+func warn(name, hint, format string, a ...any) Result {
+	return Result{Name: name, Status: Warn, Message: fmt.Sprintf(format, a...), Hint: hint}
+}
+
+func fail(name, hint, format string, a ...any) Result {
+	return Result{Name: name, Status: Fail, Message: fmt.Sprintf(format, a...), Hint: hint}
+}
+
+// Run runs the checks relevant to y, e.g., the checks of the QEMU binary are skipped for the VZ driver.
+// The defaults of y must be already filled.
+func Run(y *limayaml.LimaYAML) []Result {
+	results := []Result{checkDriver(y), checkSSH()}
+	if *y.VMType == limayaml.QEMU {
+		results = append(results, checkQEMU(y)...)
+	}
+	results = append(results, checkNetworks(y.Networks)...)
+	return results
+}
+
+// Failed returns the number of the FAIL results.
+func Failed(results []Result) int {
+	var n int
+	for _, r := range results {
+		if r.Status == Fail {
+			n++
+		}
+	}
+	return n
+}
+
+// checkDriver runs the validation of the driver, e.g., the macOS version check of the VZ driver.
+func checkDriver(y *limayaml.LimaYAML) Result {
+	const name = "driver"
+	drivers := driverutil.Drivers()
+	if !slices.Contains(drivers, *y.VMType) {
+		return fail(name, fmt.Sprintf("use one of the available drivers: %s", strings.Join(drivers, ", ")),
+			"vmType %q is not supported by this build of Lima on %s", *y.VMType, runtime.GOOS)
+	}
+	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{Yaml: y})
+	if err := limaDriver.Validate(); err != nil {
+		return fail(name, "", "vmType %q: %v", *y.VMType, err)
+	}
+	return pass(name, "vmType %q is available", *y.VMType)
+}
+
+// checkSSH checks the ssh binary, which has to support ControlMaster and ControlPersist.
+func checkSSH() Result {
+	const name = "ssh"
+	exe, err := exec.LookPath("ssh")
+	if err != nil {
+		return fail(name, "install OpenSSH", "ssh is not installed: %v", err)
+	}
+	return checkOpenSSHVersion(exe, sshutil.DetectOpenSSHVersion())
+}
+
+// minimumOpenSSHVersion is the first version that supports ControlPersist.
+const minimumOpenSSHVersion = "5.6.0"
+
+func checkOpenSSHVersion(exe string, v semver.Version) Result {
+	const name = "ssh"
+	if v.Equal(semver.Version{}) {
+		return warn(name, "make sure that "+exe+" is OpenSSH "+minimumOpenSSHVersion+" or later",
+			"failed to detect the OpenSSH version of %s", exe)
+	}
+	if v.LessThan(*semver.New(minimumOpenSSHVersion)) {
+		return fail(name, "upgrade OpenSSH to "+minimumOpenSSHVersion+" or later",
+			"OpenSSH %s (%s) does not support ControlPersist", v.String(), exe)
+	}
+	return pass(name, "OpenSSH %s (%s)", v.String(), exe)
+}
+
+// checkQEMU checks the QEMU binary and the helpers required by y.
+// swtpm is already checked by the driver validation.
+func checkQEMU(y *limayaml.LimaYAML) []Result {
+	exe, _, err := qemu.ExeFromYAML(y)
+	if err != nil {
+		return []Result{fail("qemu", qemuInstallHint(), "QEMU is not installed for the architecture %q: %v", *y.Arch, err)}
+	}
+	results := []Result{checkQEMUVersion(exe)}
+	accelResult, accel := checkAccel(y)
+	results = append(results, accelResult)
+	if accel == limayaml.HVF {
+		results = append(results, checkEntitlement(exe))
+	}
+	if accel == limayaml.KVM {
+		if r, ok := checkKVMNested(); ok {
+			results = append(results, r)
+		}
+	}
+	if *y.MountType == limayaml.VIRTIOFS && len(y.Mounts) > 0 && runtime.GOOS == "linux" {
+		if virtiofsd, err := qemu.FindVirtiofsd(exe); err != nil {
+			results = append(results, fail("virtiofsd", "install the Rust implementation of virtiofsd, or use another `mountType`",
+				"%v", err))
+		} else {
+			results = append(results, pass("virtiofsd", "%s", virtiofsd))
+		}
+	}
+	return results
+}
+
+func qemuInstallHint() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "`brew install qemu`"
+	case "linux":
+		return "`sudo apt-get install qemu-system` or `sudo dnf install qemu`, or set field `qemu.binary`"
+	}
+	return "install QEMU, or set field `qemu.binary`"
+}
+
+func checkQEMUVersion(exe string) Result {
+	const name = "qemu"
+	v, err := qemu.DetectVersion(exe)
+	if err != nil {
+		return warn(name, "", "failed to detect the QEMU version of %s: %v", exe, err)
+	}
+	if v.LessThan(*semver.New(qemu.MinimumQemuVersion)) {
+		return fail(name, "upgrade QEMU to "+qemu.MinimumQemuVersion+" or later",
+			"QEMU %s (%s) is too old", v.String(), exe)
+	}
+	return pass(name, "QEMU %s (%s)", v.String(), exe)
+}
+
+// checkAccel checks the accelerator, and returns the accelerator name when it is available.
+func checkAccel(y *limayaml.LimaYAML) (Result, string) {
+	const name = "accel"
+	accel, err := qemu.SelectAccel(*y.Arch, y.Accel)
+	if err != nil {
+		return fail(name, "", "%v", err), ""
+	}
+	if accel == limayaml.TCG {
+		return warn(name, "use the native architecture "+limayaml.NewArch(runtime.GOARCH)+" for hardware acceleration",
+			"no hardware acceleration is available for the architecture %q, the VM will be slow", *y.Arch), accel
+	}
+	if err := qemu.CheckAccel(*y.Arch, accel); err != nil {
+		var hint string
+		if accel == limayaml.KVM {
+			hint = "make sure that the kvm kernel module is loaded and the user has the permission to open /dev/kvm (`sudo usermod -aG kvm $USER`)"
+		}
+		return fail(name, hint, "accelerator %q is not available: %v", accel, err), ""
+	}
+	return pass(name, "accelerator %q is available", accel), accel
+}
+
+// checkEntitlement checks the "com.apple.security.hypervisor" entitlement of the QEMU binary.
+// Workaround for https://github.com/lima-vm/lima/issues/1742
+func checkEntitlement(exe string) Result {
+	const name = "entitlement"
+	macOSProductVersion, err := osutil.ProductVersion()
+	if err != nil {
+		return warn(name, "", "failed to detect the macOS version: %v", err)
+	}
+	// The codesign --xml option is only available on macOS Monterey and later
+	if macOSProductVersion.LessThan(*semver.New("12.0.0")) {
+		return pass(name, "skipped on macOS %s", macOSProductVersion.String())
+	}
+	if err := entitlementutil.IsSigned(exe); err != nil {
+		return warn(name, "`limactl start` asks to sign the binary; see https://github.com/lima-vm/lima/issues/1742",
+			"%v", err)
+	}
+	return pass(name, "%s is signed with the \"com.apple.security.hypervisor\" entitlement", exe)
+}
+
+// checkKVMNested checks whether the kvm module allows nested virtualization.
+// ok is false when the kvm_intel and kvm_amd modules are not loaded.
+func checkKVMNested() (r Result, ok bool) {
+	for _, mod := range []string{"kvm_intel", "kvm_amd"} {
+		b, err := os.ReadFile("/sys/module/" + mod + "/parameters/nested")
+		if err != nil {
+			continue
+		}
+		return kvmNestedResult(mod, b), true
+	}
+	return Result{}, false
+}
+
+func kvmNestedResult(mod string, param []byte) Result {
+	const name = "nested"
+	switch strings.TrimSpace(string(param)) {
+	case "Y", "1":
+		return pass(name, "nested virtualization is enabled in %s", mod)
+	}
+	return warn(name, fmt.Sprintf("add `options %s nested=1` to /etc/modprobe.d/kvm.conf and reload %s", mod, mod),
+		"nested virtualization is disabled in %s, so the guest cannot run VMs", mod)
+}
+
+// checkNetworks checks the networks defined in networks.yaml and the sockets.
+func checkNetworks(nws []limayaml.Network) []Result {
+	const name = "networks"
+	var results []Result
+	var needsVMNet bool
+	for _, nw := range nws {
+		switch {
+		case nw.Socket != "":
+			if _, err := os.Stat(nw.Socket); err != nil {
+				results = append(results, fail(name, "start the daemon of the socket before starting the instance", "socket %q: %v", nw.Socket, err))
+			} else {
+				results = append(results, pass(name, "socket %q exists", nw.Socket))
+			}
+		case nw.Lima != "" && !networks.IsUsernet(nw.Lima):
+			needsVMNet = true
+		}
+	}
+	if !needsVMNet {
+		return results
+	}
+	if runtime.GOOS != "darwin" {
+		return append(results, fail(name, "use the user-mode network \"user-v2\" instead", "the networks defined in networks.yaml are only supported on macOS"))
+	}
+	config, err := networks.Config()
+	if err == nil {
+		err = config.Validate()
+	}
+	if err != nil {
+		hint := "install socket_vmnet as root, see https://lima-vm.io/docs/config/network/vmnet/"
+		if errors.Is(err, os.ErrNotExist) {
+			hint = "install socket_vmnet, see https://lima-vm.io/docs/config/network/vmnet/"
+		}
+		return append(results, fail(name, hint, "%v", err))
+	}
+	return append(results, pass(name, "socket_vmnet %q is installed securely", config.Paths.SocketVMNet))
+}
@@ -0,0 +1,35 @@
+package doctor
+
+import (
+	"testing"
+
+	"github.com/coreos/go-semver/semver"
+	"gotest.tools/v3/assert"
+)
+
+func TestCheckOpenSSHVersion(t *testing.T) {
+	assert.Equal(t, Warn, checkOpenSSHVersion("/usr/bin/ssh", semver.Version{}).Status)
+	assert.Equal(t, Fail, checkOpenSSHVersion("/usr/bin/ssh", *semver.New("5.5.0")).Status)
+	r := checkOpenSSHVersion("/usr/bin/ssh", *semver.New("9.6.0"))
+	assert.Equal(t, Pass, r.Status)
+	assert.Equal(t, "OpenSSH 9.6.0 (/usr/bin/ssh)", r.Message)
+}
+
+func TestKVMNestedResult(t *testing.T) {
+	assert.Equal(t, Pass, kvmNestedResult("kvm_intel", []byte("Y\n")).Status)
+	assert.Equal(t, Pass, kvmNestedResult("kvm_amd", []byte("1\n")).Status)
+	r := kvmNestedResult("kvm_intel", []byte("N\n"))
+	assert.Equal(t, Warn, r.Status)
+	assert.Assert(t, r.Hint != "")
+}
+
+func TestFailed(t *testing.T) {
+	results := []Result{
+		pass("a", "ok"),
+		warn("b", "", "slow"),
+		fail("c", "", "missing"),
+		fail("d", "", "missing"),
+	}
+	assert.Equal(t, 2, Failed(results))
+	assert.Equal(t, 0, Failed(nil))
+}
@@ -13,6 +13,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/cheggaaa/pb/v3"
 	"github.com/containerd/continuity/fs"
@@ -52,6 +53,7 @@ type options struct {
 	decompress     bool   // default: false (keep compression)
 	description    string // default: url
 	expectedDigest digest.Digest
+	onProgress     func(current, total int64)
 }
 
 type Opt func(*options) error
@@ -93,6 +95,15 @@ func WithDecompress(decompress bool) Opt {
 	}
 }
 
+// WithProgress calls onProgress with the number of bytes downloaded so far, and the total size (-1 if unknown).
+// onProgress is called once per second at most, and also on the completion.
+func WithProgress(onProgress func(current, total int64)) Opt {
+	return func(o *options) error {
+		o.onProgress = onProgress
+		return nil
+	}
+}
+
 // WithExpectedDigest is used to validate the downloaded file against the expected digest.
 //
 // The digest is not verified in the following cases:
@@ -175,7 +186,7 @@ func Download(ctx context.Context, local, remote string, opts ...Opt) (*Result,
 	}
 
 	if o.cacheDir == "" {
-		if err := downloadHTTP(ctx, localPath, remote, o.description, o.expectedDigest); err != nil {
+		if err := downloadHTTP(ctx, localPath, remote, o.description, o.expectedDigest, o.onProgress); err != nil {
 			return nil, err
 		}
 		res := &Result{
@@ -224,7 +235,7 @@ func Download(ctx context.Context, local, remote string, opts ...Opt) (*Result,
 	if err := os.WriteFile(shadURL, []byte(remote), 0o644); err != nil {
 		return nil, err
 	}
-	if err := downloadHTTP(ctx, shadData, remote, o.description, o.expectedDigest); err != nil {
+	if err := downloadHTTP(ctx, shadData, remote, o.description, o.expectedDigest, o.onProgress); err != nil {
 		return nil, err
 	}
 	// no need to pass the digest to copyLocal(), as we already verified the digest
@@ -470,7 +481,7 @@ func validateLocalFileDigest(localPath string, expectedDigest digest.Digest) err
 	return nil
 }
 
-func downloadHTTP(ctx context.Context, localPath, url, description string, expectedDigest digest.Digest) error {
+func downloadHTTP(ctx context.Context, localPath, url, description string, expectedDigest digest.Digest, onProgress func(current, total int64)) error {
 	if localPath == "" {
 		return fmt.Errorf("downloadHTTP: got empty localPath")
 	}
@@ -518,8 +529,12 @@ func downloadHTTP(ctx context.Context, localPath, url, description string, expec
 		// stderr corresponds to the progress bar output
 		fmt.Fprintf(os.Stderr, "Downloading %s\n", description)
 	}
+	var body io.Reader = resp.Body
+	if onProgress != nil {
+		body = &progressReader{r: body, total: resp.ContentLength, onProgress: onProgress}
+	}
 	bar.Start()
-	if _, err := io.Copy(multiWriter, bar.NewProxyReader(resp.Body)); err != nil {
+	if _, err := io.Copy(multiWriter, bar.NewProxyReader(body)); err != nil {
 		return err
 	}
 	bar.Finish()
@@ -542,3 +557,22 @@ func downloadHTTP(ctx context.Context, localPath, url, description string, expec
 	}
 	return os.Rename(localPathTmp, localPath)
 }
+
+// progressReader calls onProgress while reading r.
+type progressReader struct {
+	r          io.Reader
+	total      int64
+	current    int64
+	lastReport time.Time
+	onProgress func(current, total int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.current += int64(n)
+	if errors.Is(err, io.EOF) || time.Since(pr.lastReport) >= time.Second {
+		pr.lastReport = time.Now()
+		pr.onProgress(pr.current, pr.total)
+	}
+	return n, err
+}
@@ -52,6 +52,19 @@ func TestDownloadRemote(t *testing.T) {
 			assert.NilError(t, err)
 			assert.Equal(t, StatusSkipped, r.Status)
 		})
+		t.Run("with progress", func(t *testing.T) {
+			localPath := filepath.Join(t.TempDir(), t.Name())
+			var current, total int64
+			r, err := Download(context.Background(), localPath, dummyRemoteFileURL, WithProgress(func(c, t int64) {
+				current, total = c, t
+			}))
+			assert.NilError(t, err)
+			assert.Equal(t, StatusDownloaded, r.Status)
+			st, err := os.Stat(localPath)
+			assert.NilError(t, err)
+			assert.Equal(t, st.Size(), current)
+			assert.Equal(t, st.Size(), total)
+		})
 	})
 	t.Run("with cache", func(t *testing.T) {
 		cacheDir := filepath.Join(t.TempDir(), "cache")
@@ -3,10 +3,18 @@ package driver
 import (
 	"context"
 	"fmt"
+	"image"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
 
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
 )
 
 // Driver interface is used by hostagent for managing vm.
@@ -44,6 +52,45 @@ type Driver interface {
 	// It returns error if there are any errors during Stop
 	Stop(_ context.Context) error
 
+	// Pause stops the vCPUs of the running vm instance, without shutting it down.
+	Pause(_ context.Context) error
+
+	// Resume restarts the vCPUs of the vm instance paused by Pause.
+	Resume(_ context.Context) error
+
+	// SetMemoryTarget sets the target memory size of the running vm instance in bytes, using the memory balloon.
+	SetMemoryTarget(_ context.Context, size int64) error
+
+	// MemoryActual returns the actual memory size of the running vm instance in bytes, as reported by the memory balloon.
+	MemoryActual(_ context.Context) (int64, error)
+
+	// SetDiskThrottle sets the I/O throttling of the main disk of the running vm instance.
+	SetDiskThrottle(_ context.Context, throttle limayaml.DiskThrottle) error
+
+	// AttachUSBDevice attaches `usbDevices[index]` of the config to the running vm instance.
+	AttachUSBDevice(_ context.Context, index int) error
+
+	// DetachUSBDevice detaches `usbDevices[index]` of the config from the running vm instance.
+	DetachUSBDevice(_ context.Context, index int) error
+
+	// AttachDisk hot-plugs the additional disk to the running vm instance.
+	AttachDisk(_ context.Context, disk *store.Disk) error
+
+	// DetachDisk hot-unplugs the additional disk from the running vm instance.
+	DetachDisk(_ context.Context, diskName string) error
+
+	// AddNIC hot-plugs a NIC connected to the network to the running vm instance, and returns the ID of the NIC.
+	AddNIC(_ context.Context, nw limayaml.Network) (string, error)
+
+	// RemoveNIC hot-unplugs the NIC added by AddNIC from the running vm instance.
+	RemoveNIC(_ context.Context, id string) error
+
+	// GuestIPs returns the IP addresses of the running vm instance, grouped by the interface name.
+	GuestIPs(_ context.Context) (map[string][]net.IP, error)
+
+	// Screenshot returns the current framebuffer of the running vm instance.
+	Screenshot(_ context.Context) (image.Image, error)
+
 	// Register will add an instance to a registry.
 	// It returns error if there are any errors during Register
 	Register(_ context.Context) error
@@ -62,13 +109,48 @@ type Driver interface {
 
 	DeleteSnapshot(_ context.Context, tag string) error
 
-	ListSnapshots(_ context.Context) (string, error)
+	ListSnapshots(_ context.Context) (*SnapshotList, error)
+
+	// ExportSnapshot writes the disk of the snapshot to a standalone image file.
+	ExportSnapshot(_ context.Context, tag, path string) error
+
+	// ImportSnapshot creates a snapshot from a standalone image file created by ExportSnapshot.
+	ImportSnapshot(_ context.Context, tag, path string) error
+
+	// ResizeDisk grows the main disk to the given size in bytes, and persists the new size in lima.yaml.
+	// It returns error if the disk cannot be resized, or if the new size is smaller than the current size.
+	ResizeDisk(_ context.Context, size int64) error
+
+	// CompactDisk reclaims the unused space of the main disk of the stopped vm instance.
+	// When check is true, the reclaimable space is only reported, without modifying the disk.
+	CompactDisk(_ context.Context, check bool) error
 
 	// ForwardGuestAgent returns if the guest agent sock needs forwarding by host agent.
 	ForwardGuestAgent() bool
 
 	// GuestAgentConn returns the guest agent connection, or nil (if forwarded by ssh).
 	GuestAgentConn(_ context.Context) (net.Conn, error)
+
+	// SupportsVSock returns if the guest agent can be connected over vsock.
+	// The host agent prefers vsock over the socket forwarded by ssh when this returns true.
+	SupportsVSock() bool
+}
+
+// SnapshotList is the list of the snapshots of the vm instance.
+type SnapshotList struct {
+	Snapshots []Snapshot
+	// Text is the list in the plain format of the driver, e.g., the output of `qemu-img snapshot -l`.
+	Text string
+}
+
+// Snapshot is a snapshot of the vm instance.
+type Snapshot struct {
+	Tag string `json:"tag"`
+	// VMStateSize is the size of the saved vm state in bytes (0 for disk-only snapshots).
+	VMStateSize int64     `json:"vmStateSize"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// VMClock is the guest uptime at the time of the snapshot. Encoded in nanoseconds in JSON.
+	VMClock time.Duration `json:"vmClock"`
 }
 
 type BaseDriver struct {
@@ -78,6 +160,9 @@ type BaseDriver struct {
 	SSHLocalPort int
 	VSockPort    int
 	VirtioPort   string
+
+	// StartPaused is set when the vm instance should be started with its vCPUs paused.
+	StartPaused bool
 }
 
 var _ Driver = (*BaseDriver)(nil)
@@ -110,6 +195,58 @@ func (d *BaseDriver) Stop(_ context.Context) error {
 	return nil
 }
 
+func (d *BaseDriver) Pause(_ context.Context) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) Resume(_ context.Context) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) SetMemoryTarget(_ context.Context, _ int64) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) MemoryActual(_ context.Context) (int64, error) {
+	return 0, fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) SetDiskThrottle(_ context.Context, _ limayaml.DiskThrottle) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) AttachUSBDevice(_ context.Context, _ int) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) DetachUSBDevice(_ context.Context, _ int) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) AttachDisk(_ context.Context, _ *store.Disk) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) DetachDisk(_ context.Context, _ string) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) AddNIC(_ context.Context, _ limayaml.Network) (string, error) {
+	return "", fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) RemoveNIC(_ context.Context, _ string) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) GuestIPs(_ context.Context) (map[string][]net.IP, error) {
+	return nil, fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) Screenshot(_ context.Context) (image.Image, error) {
+	return nil, fmt.Errorf("unimplemented")
+}
+
 func (d *BaseDriver) Register(_ context.Context) error {
 	return nil
 }
@@ -138,8 +275,24 @@ func (d *BaseDriver) DeleteSnapshot(_ context.Context, _ string) error {
 	return fmt.Errorf("unimplemented")
 }
 
-func (d *BaseDriver) ListSnapshots(_ context.Context) (string, error) {
-	return "", fmt.Errorf("unimplemented")
+func (d *BaseDriver) ListSnapshots(_ context.Context) (*SnapshotList, error) {
+	return nil, fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) ExportSnapshot(_ context.Context, _, _ string) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) ImportSnapshot(_ context.Context, _, _ string) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) CompactDisk(_ context.Context, _ bool) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) ResizeDisk(_ context.Context, _ int64) error {
+	return fmt.Errorf("unimplemented")
 }
 
 func (d *BaseDriver) ForwardGuestAgent() bool {
@@ -151,3 +304,27 @@ func (d *BaseDriver) GuestAgentConn(_ context.Context) (net.Conn, error) {
 	// use the unix socket forwarded by host agent
 	return nil, nil
 }
+
+func (d *BaseDriver) SupportsVSock() bool {
+	return false
+}
+
+// ShutdownTimeout returns the override written by `limactl stop --timeout` if present, otherwise `shutdown.timeout`.
+// The override is removed, as it only applies to a single stop.
+func (d *BaseDriver) ShutdownTimeout() time.Duration {
+	s := *d.Yaml.Shutdown.Timeout
+	overridePath := filepath.Join(d.Instance.Dir, filenames.ShutdownTimeout)
+	if b, err := os.ReadFile(overridePath); err == nil {
+		s = strings.TrimSpace(string(b))
+		_ = os.RemoveAll(overridePath)
+	}
+	timeout, err := limayaml.ParseShutdownTimeout(s)
+	if err != nil {
+		logrus.WithError(err).Warnf("invalid shutdown timeout %q, using %v", s, DefaultShutdownTimeout)
+		return DefaultShutdownTimeout
+	}
+	return timeout
+}
+
+// DefaultShutdownTimeout is the builtin default of `shutdown.timeout`.
+const DefaultShutdownTimeout = 3 * time.Minute
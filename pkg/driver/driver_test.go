@@ -0,0 +1,34 @@
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/ptr"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+)
+
+func TestShutdownTimeout(t *testing.T) {
+	dir := t.TempDir()
+	d := &BaseDriver{
+		Instance: &store.Instance{Dir: dir},
+		Yaml:     &limayaml.LimaYAML{Shutdown: limayaml.Shutdown{Timeout: ptr.Of("90s")}},
+	}
+	assert.Equal(t, d.ShutdownTimeout(), 90*time.Second)
+
+	overridePath := filepath.Join(dir, filenames.ShutdownTimeout)
+	assert.NilError(t, os.WriteFile(overridePath, []byte("10s\n"), 0o644))
+	assert.Equal(t, d.ShutdownTimeout(), 10*time.Second)
+	_, err := os.Stat(overridePath)
+	assert.Assert(t, os.IsNotExist(err), "the override must only apply to a single stop")
+	assert.Equal(t, d.ShutdownTimeout(), 90*time.Second)
+
+	d.Yaml.Shutdown.Timeout = ptr.Of("invalid")
+	assert.Equal(t, d.ShutdownTimeout(), DefaultShutdownTimeout)
+}
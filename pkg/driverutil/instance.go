@@ -18,3 +18,15 @@ func CreateTargetDriverInstance(base *driver.BaseDriver) driver.Driver {
 	}
 	return qemu.New(base)
 }
+
+// ValidateMountType returns an error if `mountType` is not supported by the driver of vmType.
+// Unlike the Validate method of the driver, it does not check the host, e.g., the QEMU version.
+func ValidateMountType(y *limayaml.LimaYAML) error {
+	switch *y.VMType {
+	case limayaml.VZ:
+		return vz.ValidateMountType(y)
+	case limayaml.WSL2:
+		return wsl2.ValidateMountType(y)
+	}
+	return qemu.ValidateMountType(y)
+}
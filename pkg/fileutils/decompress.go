@@ -0,0 +1,94 @@
+package fileutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/sirupsen/logrus"
+)
+
+// zstdMagic is the magic number of a zstd frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// IsZstd returns whether the file starts with the magic number of zstd.
+func IsZstd(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	b := make([]byte, len(zstdMagic))
+	if _, err := io.ReadFull(f, b); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return bytes.Equal(b, zstdMagic), nil
+}
+
+// DecompressZstd decompresses the zstd-compressed file path in place, with the zstd command.
+//
+// The decompression is aborted when the decompressed file exceeds maxSize bytes,
+// so that a corrupted or a malicious image cannot fill up the host disk.
+func DecompressZstd(ctx context.Context, path string, maxSize int64) error {
+	zstd, err := exec.LookPath("zstd")
+	if err != nil {
+		return fmt.Errorf("zstd is required for decompressing %q: %w", path, err)
+	}
+	tmp := path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	defer out.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, zstd, "-q", "-d", "-c", path)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Decompressing %q with zstd", path)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// copy one more byte to detect exceeding the limit
+	n, err := io.Copy(out, io.LimitReader(stdout, maxSize+1))
+	if err == nil && n > maxSize {
+		err = fmt.Errorf("the decompressed size of %q exceeded the limit (%d bytes)", path, maxSize)
+	}
+	if err != nil {
+		// zstd may be still writing
+		cancel()
+		_ = cmd.Wait()
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to decompress %q: %q: %w", path, stderr.String(), err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// EnsureDecompressedBaseDisk decompresses the base disk in place, if it is compressed with zstd
+// without the ".zst" extension that is handled by the downloader.
+// maxSize is usually the size of the instance disk, as the base disk cannot be larger than it.
+func EnsureDecompressedBaseDisk(ctx context.Context, baseDisk string, maxSize int64) error {
+	isZstd, err := IsZstd(baseDisk)
+	if err != nil || !isZstd {
+		return err
+	}
+	return DecompressZstd(ctx, baseDisk, maxSize)
+}
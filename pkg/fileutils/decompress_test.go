@@ -0,0 +1,53 @@
+package fileutils
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestIsZstd(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, b []byte) string {
+		p := filepath.Join(dir, name)
+		assert.NilError(t, os.WriteFile(p, b, 0o644))
+		return p
+	}
+	isZstd, err := IsZstd(write("zstd", append(zstdMagic, 0x00, 0x01)))
+	assert.NilError(t, err)
+	assert.Assert(t, isZstd)
+
+	isZstd, err = IsZstd(write("qcow2", []byte("QFI\xfb\x00\x00\x00\x03")))
+	assert.NilError(t, err)
+	assert.Assert(t, !isZstd)
+
+	isZstd, err = IsZstd(write("short", []byte{0x28}))
+	assert.NilError(t, err)
+	assert.Assert(t, !isZstd)
+}
+
+func TestDecompressZstd(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd is not installed")
+	}
+	dir := t.TempDir()
+	img := filepath.Join(dir, "basedisk")
+	data := bytes.Repeat([]byte("lima"), 4096)
+	assert.NilError(t, os.WriteFile(img+".raw", data, 0o644))
+	assert.NilError(t, exec.Command("zstd", "-q", "-o", img, img+".raw").Run())
+
+	err := EnsureDecompressedBaseDisk(context.Background(), img, int64(len(data))-1)
+	assert.ErrorContains(t, err, "exceeded the limit")
+
+	assert.NilError(t, EnsureDecompressedBaseDisk(context.Background(), img, int64(len(data))))
+	b, err := os.ReadFile(img)
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(b, data))
+	_, err = os.Stat(img + ".tmp")
+	assert.Assert(t, os.IsNotExist(err))
+}
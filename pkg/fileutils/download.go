@@ -8,6 +8,7 @@ import (
 
 	"github.com/lima-vm/lima/pkg/downloader"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/progress"
 	"github.com/sirupsen/logrus"
 )
 
@@ -26,6 +27,9 @@ func DownloadFile(ctx context.Context, dest string, f limayaml.File, decompress
 		downloader.WithDecompress(decompress),
 		downloader.WithDescription(fmt.Sprintf("%s (%s)", description, path.Base(f.Location))),
 		downloader.WithExpectedDigest(f.Digest),
+		downloader.WithProgress(func(current, total int64) {
+			progress.Emit(ctx, progress.Event{Phase: progress.DownloadingImage, Message: description, Current: current, Total: total})
+		}),
 	)
 	if err != nil {
 		return "", fmt.Errorf("failed to download %q: %w", f.Location, err)
@@ -37,6 +37,10 @@ func (c *GuestAgentClient) Info(ctx context.Context) (*api.Info, error) {
 	return c.cli.GetInfo(ctx, &emptypb.Empty{})
 }
 
+func (c *GuestAgentClient) Stats(ctx context.Context) (*api.Stats, error) {
+	return c.cli.GetStats(ctx, &emptypb.Empty{})
+}
+
 func (c *GuestAgentClient) Events(ctx context.Context, eventCb func(response *api.Event)) error {
 	events, err := c.cli.GetEvents(ctx, &emptypb.Empty{})
 	if err != nil {
@@ -59,3 +63,7 @@ func (c *GuestAgentClient) Inotify(ctx context.Context) (api.GuestService_PostIn
 	}
 	return inotify, nil
 }
+
+func (c *GuestAgentClient) Tunnel(ctx context.Context) (api.GuestService_TunnelClient, error) {
+	return c.cli.Tunnel(ctx)
+}
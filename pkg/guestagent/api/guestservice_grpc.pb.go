@@ -26,6 +26,8 @@ type GuestServiceClient interface {
 	GetInfo(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Info, error)
 	GetEvents(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (GuestService_GetEventsClient, error)
 	PostInotify(ctx context.Context, opts ...grpc.CallOption) (GuestService_PostInotifyClient, error)
+	GetStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Stats, error)
+	Tunnel(ctx context.Context, opts ...grpc.CallOption) (GuestService_TunnelClient, error)
 }
 
 type guestServiceClient struct {
@@ -111,6 +113,46 @@ func (x *guestServicePostInotifyClient) CloseAndRecv() (*emptypb.Empty, error) {
 	return m, nil
 }
 
+func (c *guestServiceClient) GetStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Stats, error) {
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, "/GuestService/GetStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestServiceClient) Tunnel(ctx context.Context, opts ...grpc.CallOption) (GuestService_TunnelClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GuestService_ServiceDesc.Streams[2], "/GuestService/Tunnel", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &guestServiceTunnelClient{stream}
+	return x, nil
+}
+
+type GuestService_TunnelClient interface {
+	Send(*TunnelMessage) error
+	Recv() (*TunnelMessage, error)
+	grpc.ClientStream
+}
+
+type guestServiceTunnelClient struct {
+	grpc.ClientStream
+}
+
+func (x *guestServiceTunnelClient) Send(m *TunnelMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *guestServiceTunnelClient) Recv() (*TunnelMessage, error) {
+	m := new(TunnelMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // GuestServiceServer is the server API for GuestService service.
 // All implementations must embed UnimplementedGuestServiceServer
 // for forward compatibility
@@ -118,6 +160,8 @@ type GuestServiceServer interface {
 	GetInfo(context.Context, *emptypb.Empty) (*Info, error)
 	GetEvents(*emptypb.Empty, GuestService_GetEventsServer) error
 	PostInotify(GuestService_PostInotifyServer) error
+	GetStats(context.Context, *emptypb.Empty) (*Stats, error)
+	Tunnel(GuestService_TunnelServer) error
 	mustEmbedUnimplementedGuestServiceServer()
 }
 
@@ -134,6 +178,12 @@ func (UnimplementedGuestServiceServer) GetEvents(*emptypb.Empty, GuestService_Ge
 func (UnimplementedGuestServiceServer) PostInotify(GuestService_PostInotifyServer) error {
 	return status.Errorf(codes.Unimplemented, "method PostInotify not implemented")
 }
+func (UnimplementedGuestServiceServer) GetStats(context.Context, *emptypb.Empty) (*Stats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedGuestServiceServer) Tunnel(GuestService_TunnelServer) error {
+	return status.Errorf(codes.Unimplemented, "method Tunnel not implemented")
+}
 func (UnimplementedGuestServiceServer) mustEmbedUnimplementedGuestServiceServer() {}
 
 // UnsafeGuestServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -212,6 +262,50 @@ func (x *guestServicePostInotifyServer) Recv() (*Inotify, error) {
 	return m, nil
 }
 
+func _GuestService_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestServiceServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/GuestService/GetStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestServiceServer).GetStats(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestService_Tunnel_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GuestServiceServer).Tunnel(&guestServiceTunnelServer{stream})
+}
+
+type GuestService_TunnelServer interface {
+	Send(*TunnelMessage) error
+	Recv() (*TunnelMessage, error)
+	grpc.ServerStream
+}
+
+type guestServiceTunnelServer struct {
+	grpc.ServerStream
+}
+
+func (x *guestServiceTunnelServer) Send(m *TunnelMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *guestServiceTunnelServer) Recv() (*TunnelMessage, error) {
+	m := new(TunnelMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // GuestService_ServiceDesc is the grpc.ServiceDesc for GuestService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -223,6 +317,10 @@ var GuestService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetInfo",
 			Handler:    _GuestService_GetInfo_Handler,
 		},
+		{
+			MethodName: "GetStats",
+			Handler:    _GuestService_GetStats_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -235,6 +333,12 @@ var GuestService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _GuestService_PostInotify_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Tunnel",
+			Handler:       _GuestService_Tunnel_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "guestservice.proto",
 }
@@ -8,3 +8,12 @@ import (
 func (x *IPPort) HostString() string {
 	return net.JoinHostPort(x.Ip, strconv.Itoa(int(x.Port)))
 }
+
+// Proto returns the protocol of the port, "tcp" or "udp".
+// An empty Protocol, as sent by older guest agents, means "tcp".
+func (x *IPPort) Proto() string {
+	if x.Protocol == "" {
+		return "tcp"
+	}
+	return x.Protocol
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/lima-vm/lima/pkg/guestagent"
 	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/portfwd"
 	"google.golang.org/grpc"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
@@ -25,6 +26,10 @@ func (s GuestServer) GetInfo(ctx context.Context, _ *emptypb.Empty) (*api.Info,
 	return s.Agent.Info(ctx)
 }
 
+func (s GuestServer) GetStats(ctx context.Context, _ *emptypb.Empty) (*api.Stats, error) {
+	return s.Agent.Stats(ctx)
+}
+
 func (s GuestServer) GetEvents(_ *emptypb.Empty, stream api.GuestService_GetEventsServer) error {
 	responses := make(chan *api.Event)
 	go s.Agent.Events(stream.Context(), responses)
@@ -46,3 +51,7 @@ func (s GuestServer) PostInotify(server api.GuestService_PostInotifyServer) erro
 		s.Agent.HandleInotify(recv)
 	}
 }
+
+func (s GuestServer) Tunnel(stream api.GuestService_TunnelServer) error {
+	return portfwd.ServeTunnel(stream)
+}
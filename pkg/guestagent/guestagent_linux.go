@@ -6,6 +6,7 @@ import (
 	"os"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -14,7 +15,9 @@ import (
 	"github.com/lima-vm/lima/pkg/guestagent/api"
 	"github.com/lima-vm/lima/pkg/guestagent/iptables"
 	"github.com/lima-vm/lima/pkg/guestagent/kubernetesservice"
+	"github.com/lima-vm/lima/pkg/guestagent/procevents"
 	"github.com/lima-vm/lima/pkg/guestagent/procnettcp"
+	"github.com/lima-vm/lima/pkg/guestagent/procstat"
 	"github.com/lima-vm/lima/pkg/guestagent/timesync"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/cpu"
@@ -80,6 +83,11 @@ func startGuestAgentRoutines(a *agent, supportsAuditing bool) (*agent, error) {
 	}
 	go a.kubernetesServiceWatcher.Start()
 	go a.fixSystemTimeSkew()
+	if procEvents, err := procevents.Listen(); err != nil {
+		logrus.WithError(err).Info("process events are not available, so the sockets are only scanned on every tick")
+	} else {
+		a.procEvents = procEvents
+	}
 
 	return a, nil
 }
@@ -89,6 +97,12 @@ type agent struct {
 	// We can't use inotify for /proc/net/tcp, so we need this ticker to
 	// reload /proc/net/tcp.
 	newTicker func() (<-chan time.Time, func())
+	// procEvents receives a value on exec(2) and exit(2) of the processes, for rescanning the sockets
+	// before the next tick. nil if the process connector is not available.
+	procEvents <-chan struct{}
+	// sockDiagUnsupported is set when the inet_diag netlink interface is not available.
+	// It is not set on the transient errors, e.g., EINTR, so that inet_diag is retried on the next call.
+	sockDiagUnsupported atomic.Bool
 
 	worthCheckingIPTables    bool
 	worthCheckingIPTablesMu  sync.RWMutex
@@ -188,35 +202,118 @@ func isEventEmpty(ev *api.Event) bool {
 	return reflect.DeepEqual(empty, copied)
 }
 
+// rescanBackoff is the adaptive interval of rescanning the sockets after a process event or a change of the ports,
+// as a process may bind the sockets a while after exec(2).
+// The interval is doubled on each rescan without changes, until it exceeds max. Then the sockets are scanned on every tick.
+type rescanBackoff struct {
+	min, max time.Duration
+	cur      time.Duration
+}
+
+// next returns the interval until the next rescan, or 0 when no rescan is needed before the next tick.
+func (b *rescanBackoff) next(active bool) time.Duration {
+	switch {
+	case active:
+		b.cur = b.min
+	case b.cur != 0:
+		b.cur *= 2
+		if b.cur > b.max {
+			b.cur = 0
+		}
+	}
+	return b.cur
+}
+
 func (a *agent) Events(ctx context.Context, ch chan *api.Event) {
 	defer close(ch)
 	tickerCh, tickerClose := a.newTicker()
 	defer tickerClose()
+	backoff := &rescanBackoff{min: 100 * time.Millisecond, max: 2 * time.Second}
 	var st eventState
-	for {
+	scanLoop(ctx, tickerCh, a.procEvents, backoff, func() bool {
 		var ev *api.Event
 		ev, st = a.collectEvent(ctx, st)
-		if !isEventEmpty(ev) {
-			ch <- ev
+		if isEventEmpty(ev) {
+			return false
+		}
+		ch <- ev
+		return true
+	})
+}
+
+// scanLoop calls scan on every tick, and on the rescans scheduled by backoff after a change or a process event.
+// scan returns whether the ports have changed.
+func scanLoop(ctx context.Context, tickerCh <-chan time.Time, procEvents <-chan struct{}, backoff *rescanBackoff, scan func() bool) {
+	rescanTimer := time.NewTimer(time.Hour)
+	defer rescanTimer.Stop()
+	// armRescan (re)schedules the rescan after d, or cancels the rescan when d is 0
+	armed := true
+	armRescan := func(d time.Duration) {
+		if armed && !rescanTimer.Stop() {
+			select {
+			case <-rescanTimer.C:
+			default:
+			}
+		}
+		armed = d != 0
+		if armed {
+			rescanTimer.Reset(d)
 		}
-		select {
-		case <-ctx.Done():
-			return
-		case _, ok := <-tickerCh:
-			if !ok {
+	}
+	armRescan(0)
+	for {
+		armRescan(backoff.next(scan()))
+		for rescan := false; !rescan; {
+			select {
+			case <-ctx.Done():
 				return
+			case _, ok := <-tickerCh:
+				if !ok {
+					return
+				}
+				logrus.Debug("tick!")
+				rescan = true
+			case <-rescanTimer.C:
+				armed = false
+				rescan = true
+			case _, ok := <-procEvents:
+				if !ok {
+					procEvents = nil
+					continue
+				}
+				// a pending rescan already covers the event, and resetting it would defeat the backoff
+				if !armed {
+					armRescan(backoff.next(true))
+				}
 			}
-			logrus.Debug("tick!")
 		}
 	}
 }
 
-func (a *agent) LocalPorts(_ context.Context) ([]*api.IPPort, error) {
+// localSockets lists the listening TCP sockets and the unconnected UDP sockets,
+// using inet_diag, or parsing /proc/net/{tcp,tcp6,udp,udp6} on the kernels without inet_diag.
+func (a *agent) localSockets() ([]procnettcp.Entry, error) {
+	if !a.sockDiagUnsupported.Load() {
+		entries, err := procnettcp.SockDiag()
+		if err == nil {
+			return entries, nil
+		}
+		if procnettcp.IsSockDiagUnsupported(err) {
+			logrus.WithError(err).Warn("inet_diag is not supported, falling back to parsing /proc/net")
+			a.sockDiagUnsupported.Store(true)
+		} else {
+			logrus.WithError(err).Debug("failed to list the sockets with inet_diag, falling back to parsing /proc/net this time")
+		}
+	}
 	if cpu.IsBigEndian {
 		return nil, errors.New("big endian architecture is unsupported, because I don't know how /proc/net/tcp looks like on big endian hosts")
 	}
+	return procnettcp.ParseFiles()
+}
+
+func (a *agent) LocalPorts(_ context.Context) ([]*api.IPPort, error) {
 	var res []*api.IPPort
-	tcpParsed, err := procnettcp.ParseFiles()
+	tcpParsed, err := a.localSockets()
 	if err != nil {
 		return res, err
 	}
@@ -224,15 +321,23 @@ func (a *agent) LocalPorts(_ context.Context) ([]*api.IPPort, error) {
 	for _, f := range tcpParsed {
 		switch f.Kind {
 		case procnettcp.TCP, procnettcp.TCP6:
-		default:
-			continue
-		}
-		if f.State == procnettcp.TCPListen {
-			res = append(res,
-				&api.IPPort{
-					Ip:   f.IP.String(),
-					Port: int32(f.Port),
-				})
+			if f.State == procnettcp.TCPListen {
+				res = append(res,
+					&api.IPPort{
+						Ip:       f.IP.String(),
+						Port:     int32(f.Port),
+						Protocol: "tcp",
+					})
+			}
+		case procnettcp.UDP, procnettcp.UDP6:
+			if f.State == procnettcp.UDPUnconnected {
+				res = append(res,
+					&api.IPPort{
+						Ip:       f.IP.String(),
+						Port:     int32(f.Port),
+						Protocol: "udp",
+					})
+			}
 		}
 	}
 
@@ -257,18 +362,23 @@ func (a *agent) LocalPorts(_ context.Context) ([]*api.IPPort, error) {
 	}
 
 	for _, ipt := range ipts {
+		protocol := "tcp"
+		if !ipt.TCP {
+			protocol = "udp"
+		}
 		// Make sure the port isn't already listed from procnettcp
 		found := false
 		for _, re := range res {
-			if re.Port == int32(ipt.Port) {
+			if re.Port == int32(ipt.Port) && re.Protocol == protocol {
 				found = true
 			}
 		}
 		if !found {
 			res = append(res,
 				&api.IPPort{
-					Ip:   ipt.IP.String(),
-					Port: int32(ipt.Port),
+					Ip:       ipt.IP.String(),
+					Port:     int32(ipt.Port),
+					Protocol: protocol,
 				})
 		}
 	}
@@ -277,7 +387,7 @@ func (a *agent) LocalPorts(_ context.Context) ([]*api.IPPort, error) {
 	for _, entry := range kubernetesEntries {
 		found := false
 		for _, re := range res {
-			if re.Port == int32(entry.Port) {
+			if re.Port == int32(entry.Port) && re.Protocol == "tcp" {
 				found = true
 			}
 		}
@@ -285,8 +395,9 @@ func (a *agent) LocalPorts(_ context.Context) ([]*api.IPPort, error) {
 		if !found {
 			res = append(res,
 				&api.IPPort{
-					Ip:   entry.IP.String(),
-					Port: int32(entry.Port),
+					Ip:       entry.IP.String(),
+					Port:     int32(entry.Port),
+					Protocol: "tcp",
 				})
 		}
 	}
@@ -306,6 +417,35 @@ func (a *agent) Info(ctx context.Context) (*api.Info, error) {
 	return &info, nil
 }
 
+func (a *agent) Stats(_ context.Context) (*api.Stats, error) {
+	var (
+		stats api.Stats
+		err   error
+	)
+	stats.LoadAverage, err = procstat.LoadAverage()
+	if err != nil {
+		return nil, err
+	}
+	// left unset when CONFIG_PSI is disabled, to be distinguished from no pressure
+	if pressure, err := procstat.MemoryPressure(); err != nil {
+		logrus.WithError(err).Debug("failed to get the memory pressure")
+	} else {
+		stats.MemoryPressureAvg10 = &pressure
+	}
+	usages, err := procstat.FilesystemUsage()
+	if err != nil {
+		logrus.WithError(err).Warn("failed to get the filesystem usage")
+	}
+	for _, u := range usages {
+		stats.Filesystems = append(stats.Filesystems, &api.FilesystemUsage{
+			MountPoint: u.MountPoint,
+			Total:      u.Total,
+			Used:       u.Used,
+		})
+	}
+	return &stats, nil
+}
+
 const deltaLimit = 2 * time.Second
 
 func (a *agent) fixSystemTimeSkew() {
@@ -0,0 +1,61 @@
+package guestagent
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRescanBackoff(t *testing.T) {
+	b := &rescanBackoff{min: 100 * time.Millisecond, max: time.Second}
+	assert.Equal(t, b.next(false), time.Duration(0), "no rescan before any change")
+	assert.Equal(t, b.next(true), 100*time.Millisecond)
+	assert.Equal(t, b.next(false), 200*time.Millisecond)
+	assert.Equal(t, b.next(false), 400*time.Millisecond)
+	assert.Equal(t, b.next(true), 100*time.Millisecond, "reset on a change")
+	assert.Equal(t, b.next(false), 200*time.Millisecond)
+	assert.Equal(t, b.next(false), 400*time.Millisecond)
+	assert.Equal(t, b.next(false), 800*time.Millisecond)
+	assert.Equal(t, b.next(false), time.Duration(0), "falls back to the ticker after exceeding max")
+	assert.Equal(t, b.next(false), time.Duration(0))
+}
+
+func TestScanLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tickerCh := make(chan time.Time)
+	procEvents := make(chan struct{})
+	backoff := &rescanBackoff{min: 10 * time.Millisecond, max: 40 * time.Millisecond}
+	var scans atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanLoop(ctx, tickerCh, procEvents, backoff, func() bool {
+			scans.Add(1)
+			return false
+		})
+	}()
+	waitScans := func(want int32) {
+		t.Helper()
+		// long enough for the backoff to run out
+		time.Sleep(300 * time.Millisecond)
+		assert.Equal(t, scans.Load(), want)
+	}
+	waitScans(1)
+
+	// a burst of the process events, e.g., the processes executed by a shell script,
+	// is rescanned after 10ms, 20ms, and 40ms, without resetting the backoff on every event
+	for i := 0; i < 50; i++ {
+		procEvents <- struct{}{}
+	}
+	waitScans(4)
+
+	tickerCh <- time.Now()
+	waitScans(5)
+
+	cancel()
+	<-done
+}
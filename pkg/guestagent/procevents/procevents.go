@@ -0,0 +1,119 @@
+// Package procevents notifies the process events reported by the netlink process connector.
+package procevents
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The values of <linux/netlink.h>, <linux/connector.h>, and <linux/cn_proc.h>.
+const (
+	cnIdxProc = 0x1
+	cnValProc = 0x1
+
+	procCnMcastListen = 1
+
+	procEventExec = 0x00000002
+	procEventExit = 0x80000000
+
+	nlmsgDone      = 0x3
+	sizeofNlMsghdr = 16
+	sizeofCnMsg    = 20
+)
+
+// listenRequest returns the netlink message for subscribing to the process events.
+func listenRequest(pid uint32) []byte {
+	b := make([]byte, sizeofNlMsghdr+sizeofCnMsg+4)
+	ne := binary.NativeEndian
+	// struct nlmsghdr, with NLMSG_DONE as the type, as the connector expects
+	ne.PutUint32(b[0:4], uint32(len(b)))
+	ne.PutUint16(b[4:6], nlmsgDone)
+	ne.PutUint32(b[12:16], pid)
+	// struct cn_msg
+	msg := b[sizeofNlMsghdr:]
+	ne.PutUint32(msg[0:4], cnIdxProc)
+	ne.PutUint32(msg[4:8], cnValProc)
+	ne.PutUint16(msg[16:18], 4)
+	// enum proc_cn_mcast_op
+	ne.PutUint32(msg[20:24], procCnMcastListen)
+	return b
+}
+
+// event is an exec or an exit event of a process.
+type event struct {
+	exit bool
+	tgid uint32
+	// parentTgid is the parent of the exited process.
+	// 0 for the exec events, and for the exit events on the old kernels that do not report the parent.
+	parentTgid uint32
+}
+
+// parseEvent parses the netlink message b, and returns false when b is not an exec or an exit event,
+// i.e., an event that may change the listening sockets.
+func parseEvent(b []byte) (event, bool) {
+	if len(b) < sizeofNlMsghdr+sizeofCnMsg {
+		return event{}, false
+	}
+	ne := binary.NativeEndian
+	msg := b[sizeofNlMsghdr:]
+	if ne.Uint32(msg[0:4]) != cnIdxProc || ne.Uint32(msg[4:8]) != cnValProc {
+		return event{}, false
+	}
+	data := msg[sizeofCnMsg:]
+	if l := int(ne.Uint16(msg[16:18])); l < len(data) {
+		data = data[:l]
+	}
+	// struct proc_event begins with the event type, the cpu, and the timestamp, followed by the event data
+	if len(data) < 24 {
+		return event{}, false
+	}
+	ev := event{tgid: ne.Uint32(data[20:24])}
+	switch ne.Uint32(data[0:4]) {
+	case procEventExec:
+	case procEventExit:
+		ev.exit = true
+		// struct exit_proc_event: process_pid, process_tgid, exit_code, exit_signal, parent_pid, parent_tgid
+		if len(data) >= 40 {
+			ev.parentTgid = ne.Uint32(data[36:40])
+		}
+	default:
+		return event{}, false
+	}
+	return ev, true
+}
+
+// ignorable returns whether ev is an event of a child process of self, e.g., iptables(8) executed by the guest agent
+// for scanning the ports, so that a scan does not trigger another scan.
+// parentOf returns the parent of a running process.
+func ignorable(ev event, self uint32, parentOf func(tgid uint32) (uint32, error)) bool {
+	if ev.exit {
+		return ev.parentTgid == self
+	}
+	ppid, err := parentOf(ev.tgid)
+	if err != nil {
+		// the process has already exited, so its exit event follows
+		return true
+	}
+	return ppid == self
+}
+
+// parsePPID parses /proc/<PID>/stat, and returns the parent process ID.
+func parsePPID(stat []byte) (uint32, error) {
+	// the command name in the parentheses may contain spaces and parentheses
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("unexpected stat %q", stat)
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected stat %q", stat)
+	}
+	ppid, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(ppid), nil
+}
@@ -0,0 +1,68 @@
+package procevents
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// Listen returns a channel that receives a value when a process calls exec(2) or exits.
+// The events of the child processes of the caller are ignored.
+//
+// The notifications are coalesced, so a slow receiver receives a single value for multiple events.
+// Listen requires CAP_NET_ADMIN, and the kernel built with CONFIG_PROC_EVENTS.
+func Listen() (<-chan struct{}, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_CONNECTOR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the NETLINK_CONNECTOR socket: %w", err)
+	}
+	sa := &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: cnIdxProc}
+	if err := unix.Bind(fd, sa); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind the NETLINK_CONNECTOR socket: %w", err)
+	}
+	self := uint32(unix.Getpid())
+	if err := unix.Sendto(fd, listenRequest(self), 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("failed to subscribe to the process events: %w", err)
+	}
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		defer unix.Close(fd)
+		buf := make([]byte, 4096)
+		for {
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			switch {
+			case errors.Is(err, unix.EINTR):
+				continue
+			case errors.Is(err, unix.ENOBUFS):
+				// some events were dropped, so notify them conservatively
+			case err != nil:
+				logrus.WithError(err).Warn("stopped receiving the process events")
+				return
+			default:
+				ev, ok := parseEvent(buf[:n])
+				if !ok || ignorable(ev, self, parentOf) {
+					continue
+				}
+			}
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func parentOf(tgid uint32) (uint32, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", tgid))
+	if err != nil {
+		return 0, err
+	}
+	return parsePPID(b)
+}
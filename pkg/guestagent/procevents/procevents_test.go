@@ -0,0 +1,82 @@
+package procevents
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// message returns the netlink message of a process event, with 40 bytes of struct proc_event.
+func message(what, tgid, parentTgid uint32) []byte {
+	b := make([]byte, sizeofNlMsghdr+sizeofCnMsg+40)
+	ne := binary.NativeEndian
+	msg := b[sizeofNlMsghdr:]
+	ne.PutUint32(msg[0:4], cnIdxProc)
+	ne.PutUint32(msg[4:8], cnValProc)
+	ne.PutUint16(msg[16:18], 40)
+	data := msg[sizeofCnMsg:]
+	ne.PutUint32(data[0:4], what)
+	ne.PutUint32(data[16:20], tgid)
+	ne.PutUint32(data[20:24], tgid)
+	ne.PutUint32(data[32:36], parentTgid)
+	ne.PutUint32(data[36:40], parentTgid)
+	return b
+}
+
+func TestParseEvent(t *testing.T) {
+	ev, ok := parseEvent(message(procEventExec, 42, 0))
+	assert.Assert(t, ok)
+	assert.Equal(t, ev, event{tgid: 42})
+
+	ev, ok = parseEvent(message(procEventExit, 42, 1))
+	assert.Assert(t, ok)
+	assert.Equal(t, ev, event{exit: true, tgid: 42, parentTgid: 1})
+
+	oldKernel := message(procEventExit, 42, 1)[:sizeofNlMsghdr+sizeofCnMsg+32]
+	binary.NativeEndian.PutUint16(oldKernel[sizeofNlMsghdr+16:], 32)
+	ev, ok = parseEvent(oldKernel)
+	assert.Assert(t, ok)
+	assert.Equal(t, ev, event{exit: true, tgid: 42}, "the parent is unknown on the old kernels")
+
+	_, ok = parseEvent(message(0x00000001, 42, 0))
+	assert.Assert(t, !ok, "fork events should be ignored")
+	_, ok = parseEvent(message(procEventExec, 42, 0)[:sizeofNlMsghdr+sizeofCnMsg+4])
+	assert.Assert(t, !ok)
+
+	other := message(procEventExec, 42, 0)
+	binary.NativeEndian.PutUint32(other[sizeofNlMsghdr:], 0x2)
+	_, ok = parseEvent(other)
+	assert.Assert(t, !ok, "messages of other connectors should be ignored")
+}
+
+func TestIgnorable(t *testing.T) {
+	const self = 100
+	parents := map[uint32]uint32{200: self, 300: 1}
+	parentOf := func(tgid uint32) (uint32, error) {
+		if ppid, ok := parents[tgid]; ok {
+			return ppid, nil
+		}
+		return 0, errors.New("no such process")
+	}
+	assert.Assert(t, ignorable(event{tgid: 200}, self, parentOf), "exec of a child")
+	assert.Assert(t, !ignorable(event{tgid: 300}, self, parentOf), "exec of another process")
+	assert.Assert(t, ignorable(event{tgid: 400}, self, parentOf), "exec of an exited process is covered by its exit event")
+	assert.Assert(t, ignorable(event{exit: true, tgid: 200, parentTgid: self}, self, parentOf), "exit of a child")
+	assert.Assert(t, !ignorable(event{exit: true, tgid: 300, parentTgid: 1}, self, parentOf), "exit of another process")
+	assert.Assert(t, !ignorable(event{exit: true, tgid: 300}, self, parentOf), "exit with an unknown parent")
+}
+
+func TestParsePPID(t *testing.T) {
+	ppid, err := parsePPID([]byte("1234 (iptables) R 100 1234 1 0 -1 4194560\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, ppid, uint32(100))
+
+	ppid, err = parsePPID([]byte("1234 (a) b (c) S 7 1234 1 0\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, ppid, uint32(7))
+
+	_, err = parsePPID([]byte("1234 (truncated"))
+	assert.ErrorContains(t, err, "unexpected stat")
+}
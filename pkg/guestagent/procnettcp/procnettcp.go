@@ -15,7 +15,9 @@ type Kind = string
 const (
 	TCP  Kind = "tcp"
 	TCP6 Kind = "tcp6"
-	// TODO: "udp", "udp6", "udplite", "udplite6".
+	UDP  Kind = "udp"
+	UDP6 Kind = "udp6"
+	// TODO: "udplite", "udplite6".
 )
 
 type State = int
@@ -23,6 +25,9 @@ type State = int
 const (
 	TCPEstablished State = 0x1
 	TCPListen      State = 0xA
+	// UDPUnconnected is the state of UDP sockets that are not connected to a remote address,
+	// i.e., the sockets waiting for datagrams.
+	UDPUnconnected State = 0x7
 )
 
 type Entry struct {
@@ -34,7 +39,7 @@ type Entry struct {
 
 func Parse(r io.Reader, kind Kind) ([]Entry, error) {
 	switch kind {
-	case TCP, TCP6:
+	case TCP, TCP6, UDP, UDP6:
 	default:
 		return nil, fmt.Errorf("unexpected kind %q", kind)
 	}
@@ -99,7 +104,7 @@ func Parse(r io.Reader, kind Kind) ([]Entry, error) {
 //
 // See https://serverfault.com/questions/592574/why-does-proc-net-tcp6-represents-1-as-1000
 //
-// ParseAddress is expected to be used for /proc/net/{tcp,tcp6} entries on
+// ParseAddress is expected to be used for /proc/net/{tcp,tcp6,udp,udp6} entries on
 // little endian machines.
 // Not sure how those entries look like on big endian machines.
 func ParseAddress(s string) (net.IP, uint16, error) {
@@ -56,3 +56,24 @@ func TestParseTCP6Zero(t *testing.T) {
 	assert.Equal(t, uint16(22), entries[0].Port)
 	assert.Equal(t, TCPListen, entries[0].State)
 }
+
+func TestParseUDP(t *testing.T) {
+	procNetUDP := `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  361: 3500007F:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000   102        0 30954 2 0000000000000000 0
+  376: 00000000:0044 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 33590 2 0000000000000000 0
+  498: 0B3CA8C0:D5E7 0101A8C0:0035 01 00000000:00000000 00:00000000 00000000     0        0 41236 2 0000000000000000 0
+`
+	entries, err := Parse(strings.NewReader(procNetUDP), UDP)
+	assert.NilError(t, err)
+	t.Log(entries)
+
+	assert.Check(t, net.ParseIP("127.0.0.53").Equal(entries[0].IP))
+	assert.Equal(t, uint16(53), entries[0].Port)
+	assert.Equal(t, UDPUnconnected, entries[0].State)
+
+	assert.Check(t, net.IPv4zero.Equal(entries[1].IP))
+	assert.Equal(t, uint16(68), entries[1].Port)
+	assert.Equal(t, UDPUnconnected, entries[1].State)
+
+	assert.Equal(t, TCPEstablished, entries[2].State)
+}
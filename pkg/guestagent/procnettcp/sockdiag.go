@@ -0,0 +1,99 @@
+package procnettcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// The sizes of the structs of <linux/netlink.h> and <linux/inet_diag.h>.
+const (
+	sizeofNlMsghdr       = 16
+	sizeofInetDiagSockID = 48
+	sizeofInetDiagReqV2  = 8 + sizeofInetDiagSockID
+	sizeofInetDiagMsg    = 4 + sizeofInetDiagSockID + 20
+)
+
+// The values of <linux/netlink.h>, defined here as the syscall package lacks them on non-Linux.
+const (
+	nlmsgError       = 0x2
+	nlmsgDone        = 0x3
+	nlmFRequest      = 0x1
+	nlmFDump         = 0x300
+	sockDiagByFamily = 20
+)
+
+// sockDiagKinds are the kinds of the sockets listed by SockDiag, with the state to list.
+var sockDiagKinds = []struct {
+	kind     Kind
+	family   uint8
+	protocol uint8
+	state    State
+}{
+	{TCP, syscall.AF_INET, syscall.IPPROTO_TCP, TCPListen},
+	{TCP6, syscall.AF_INET6, syscall.IPPROTO_TCP, TCPListen},
+	{UDP, syscall.AF_INET, syscall.IPPROTO_UDP, UDPUnconnected},
+	{UDP6, syscall.AF_INET6, syscall.IPPROTO_UDP, UDPUnconnected},
+}
+
+// inetDiagRequest returns the SOCK_DIAG_BY_FAMILY dump request for the sockets in the state.
+func inetDiagRequest(seq uint32, family, protocol uint8, state State) []byte {
+	b := make([]byte, sizeofNlMsghdr+sizeofInetDiagReqV2)
+	ne := binary.NativeEndian
+	// struct nlmsghdr
+	ne.PutUint32(b[0:4], uint32(len(b)))
+	ne.PutUint16(b[4:6], sockDiagByFamily)
+	ne.PutUint16(b[6:8], nlmFRequest|nlmFDump)
+	ne.PutUint32(b[8:12], seq)
+	// struct inet_diag_req_v2; the socket ID is left zero to match all the sockets
+	b[16] = family
+	b[17] = protocol
+	ne.PutUint32(b[20:24], 1<<uint(state))
+	return b
+}
+
+// parseInetDiagMessages appends the entries in the netlink messages b to entries.
+// done is true when the end of the dump is reached.
+func parseInetDiagMessages(b []byte, kind Kind, entries []Entry) (_ []Entry, done bool, _ error) {
+	ne := binary.NativeEndian
+	for len(b) >= sizeofNlMsghdr {
+		msgLen := int(ne.Uint32(b[0:4]))
+		if msgLen < sizeofNlMsghdr || msgLen > len(b) {
+			return entries, false, fmt.Errorf("invalid netlink message length %d", msgLen)
+		}
+		msg := b[sizeofNlMsghdr:msgLen]
+		switch msgType := ne.Uint16(b[4:6]); msgType {
+		case nlmsgDone:
+			return entries, true, nil
+		case nlmsgError:
+			if len(msg) < 4 {
+				return entries, false, errors.New("truncated netlink error message")
+			}
+			if errno := -int32(ne.Uint32(msg[0:4])); errno != 0 {
+				return entries, false, fmt.Errorf("inet_diag dump for %s failed: %w", kind, syscall.Errno(errno))
+			}
+		case sockDiagByFamily:
+			if len(msg) < sizeofInetDiagMsg {
+				return entries, false, fmt.Errorf("truncated inet_diag message (%d bytes)", len(msg))
+			}
+			// struct inet_diag_msg, with the socket ID in the network byte order
+			ipLen := net.IPv4len
+			if msg[0] == syscall.AF_INET6 {
+				ipLen = net.IPv6len
+			}
+			ip := make(net.IP, ipLen)
+			copy(ip, msg[8:8+ipLen])
+			entries = append(entries, Entry{
+				Kind:  kind,
+				IP:    ip,
+				Port:  binary.BigEndian.Uint16(msg[4:6]),
+				State: State(msg[1]),
+			})
+		}
+		// messages are aligned to 4 bytes
+		b = b[min((msgLen+3)&^3, len(b)):]
+	}
+	return entries, false, nil
+}
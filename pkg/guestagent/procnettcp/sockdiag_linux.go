@@ -0,0 +1,51 @@
+package procnettcp
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// SockDiag lists the listening TCP sockets and the unconnected UDP sockets, using the inet_diag netlink interface.
+//
+// Unlike ParseFiles, the sockets are filtered by the kernel, so the cost does not grow with the number of
+// the connected sockets. An error is returned on the kernels without inet_diag (or udp_diag),
+// and the caller is expected to fall back to ParseFiles. See IsSockDiagUnsupported.
+func SockDiag() ([]Entry, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the NETLINK_SOCK_DIAG socket: %w", err)
+	}
+	defer unix.Close(fd)
+	sa := &unix.SockaddrNetlink{Family: unix.AF_NETLINK}
+	buf := make([]byte, 32*1024)
+	var entries []Entry
+	for i, k := range sockDiagKinds {
+		if err := unix.Sendto(fd, inetDiagRequest(uint32(i+1), k.family, k.protocol, k.state), 0, sa); err != nil {
+			return nil, fmt.Errorf("failed to send the inet_diag request for %s: %w", k.kind, err)
+		}
+		for done := false; !done; {
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if err != nil {
+				return nil, fmt.Errorf("failed to receive the inet_diag response for %s: %w", k.kind, err)
+			}
+			entries, done, err = parseInetDiagMessages(buf[:n], k.kind, entries)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+// IsSockDiagUnsupported returns true if the error of SockDiag means that the kernel lacks inet_diag (or udp_diag),
+// i.e., retrying SockDiag is futile. The other errors, e.g., EINTR and ENOBUFS, may be transient.
+func IsSockDiagUnsupported(err error) bool {
+	for _, errno := range []unix.Errno{unix.EPROTONOSUPPORT, unix.EAFNOSUPPORT, unix.EOPNOTSUPP, unix.ENOENT} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package procnettcp
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gotest.tools/v3/assert"
+)
+
+func TestSockDiag(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer l.Close()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer pc.Close()
+
+	entries, err := SockDiag()
+	if err != nil {
+		t.Skipf("inet_diag is not available: %v", err)
+	}
+	contains := func(kind Kind, port int, state State) bool {
+		for _, e := range entries {
+			if e.Kind == kind && int(e.Port) == port && e.State == state && e.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+				return true
+			}
+		}
+		return false
+	}
+	assert.Assert(t, contains(TCP, l.Addr().(*net.TCPAddr).Port, TCPListen))
+	assert.Assert(t, contains(UDP, pc.LocalAddr().(*net.UDPAddr).Port, UDPUnconnected))
+}
+
+func TestIsSockDiagUnsupported(t *testing.T) {
+	assert.Assert(t, IsSockDiagUnsupported(fmt.Errorf("failed to open the NETLINK_SOCK_DIAG socket: %w", unix.EPROTONOSUPPORT)))
+	// udp_diag is not loaded
+	assert.Assert(t, IsSockDiagUnsupported(fmt.Errorf("inet_diag dump for udp failed: %w", unix.ENOENT)))
+	assert.Assert(t, !IsSockDiagUnsupported(fmt.Errorf("failed to receive the inet_diag response for tcp: %w", unix.EINTR)))
+	assert.Assert(t, !IsSockDiagUnsupported(fmt.Errorf("failed to receive the inet_diag response for tcp: %w", unix.ENOBUFS)))
+}
+
+// openSockets opens the TCP listeners, and conns connections to the first listener,
+// i.e., 2*conns established sockets, which SockDiag skips in the kernel, and ParseFiles has to parse.
+func openSockets(b *testing.B, listeners, conns int) {
+	b.Helper()
+	var ls []net.Listener
+	for i := 0; i < listeners; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { _ = l.Close() })
+		ls = append(ls, l)
+	}
+	for i := 0; i < conns; i++ {
+		c, err := net.Dial("tcp", ls[0].Addr().String())
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { _ = c.Close() })
+		s, err := ls[0].Accept()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { _ = s.Close() })
+	}
+}
+
+// The benchmarks compare SockDiag and ParseFiles with 50 listening sockets and 4000 established sockets.
+const (
+	benchmarkListeners   = 50
+	benchmarkConnections = 2000
+)
+
+func BenchmarkSockDiag(b *testing.B) {
+	if _, err := SockDiag(); err != nil {
+		b.Skipf("inet_diag is not available: %v", err)
+	}
+	openSockets(b, benchmarkListeners, benchmarkConnections)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := SockDiag(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseFiles(b *testing.B) {
+	openSockets(b, benchmarkListeners, benchmarkConnections)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseFiles(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package procnettcp
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// inetDiagMessage returns a SOCK_DIAG_BY_FAMILY response message, as the kernel would send.
+func inetDiagMessage(ip net.IP, port uint16, state State) []byte {
+	b := make([]byte, sizeofNlMsghdr+sizeofInetDiagMsg)
+	ne := binary.NativeEndian
+	ne.PutUint32(b[0:4], uint32(len(b)))
+	ne.PutUint16(b[4:6], sockDiagByFamily)
+	msg := b[sizeofNlMsghdr:]
+	msg[0] = syscall.AF_INET6
+	if ip4 := ip.To4(); ip4 != nil {
+		msg[0] = syscall.AF_INET
+		ip = ip4
+	}
+	msg[1] = uint8(state)
+	binary.BigEndian.PutUint16(msg[4:6], port)
+	copy(msg[8:], ip)
+	return b
+}
+
+func nlmsgDoneMessage() []byte {
+	b := make([]byte, sizeofNlMsghdr+4)
+	binary.NativeEndian.PutUint32(b[0:4], uint32(len(b)))
+	binary.NativeEndian.PutUint16(b[4:6], nlmsgDone)
+	return b
+}
+
+func TestParseInetDiagMessages(t *testing.T) {
+	var b []byte
+	b = append(b, inetDiagMessage(net.ParseIP("127.0.0.1"), 22, TCPListen)...)
+	b = append(b, inetDiagMessage(net.ParseIP("fe80::70a6:57ff:fe71:c75d"), 80, TCPListen)...)
+	entries, done, err := parseInetDiagMessages(b, TCP, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, !done)
+	assert.Equal(t, len(entries), 2)
+	assert.Check(t, net.ParseIP("127.0.0.1").Equal(entries[0].IP))
+	assert.Equal(t, uint16(22), entries[0].Port)
+	assert.Equal(t, TCPListen, entries[0].State)
+	assert.Check(t, net.ParseIP("fe80::70a6:57ff:fe71:c75d").Equal(entries[1].IP))
+	assert.Equal(t, uint16(80), entries[1].Port)
+
+	entries, done, err = parseInetDiagMessages(nlmsgDoneMessage(), TCP, entries)
+	assert.NilError(t, err)
+	assert.Assert(t, done)
+	assert.Equal(t, len(entries), 2)
+
+	errMsg := nlmsgDoneMessage()
+	binary.NativeEndian.PutUint16(errMsg[4:6], nlmsgError)
+	errno := -int32(syscall.ENOENT)
+	binary.NativeEndian.PutUint32(errMsg[16:20], uint32(errno))
+	_, _, err = parseInetDiagMessages(errMsg, UDP, nil)
+	assert.ErrorIs(t, err, syscall.ENOENT)
+}
@@ -0,0 +1,86 @@
+package procstat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Usage is the usage of a filesystem in bytes.
+type Usage struct {
+	MountPoint string
+	Total      uint64
+	Used       uint64
+}
+
+// ParseLoadAverage parses /proc/loadavg, and returns the load averages over 1, 5, and 15 minutes.
+func ParseLoadAverage(r io.Reader) ([]float64, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("unexpected loadavg %q", string(b))
+	}
+	res := make([]float64, 3)
+	for i := range res {
+		res[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// ParseMemoryPressure parses /proc/pressure/memory, and returns the "avg10" value of the "some" line,
+// i.e., the percentage of the time in the last 10 seconds that at least one task was stalled on memory.
+func ParseMemoryPressure(r io.Reader) (float64, error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0] != "some" {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if v, ok := strings.CutPrefix(f, "avg10="); ok {
+				return strconv.ParseFloat(v, 64)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("field \"some avg10\" not found")
+}
+
+// limaMountTypes are the filesystem types of the mounts of Lima (reverse-sshfs, 9p, and virtiofs).
+var limaMountTypes = map[string]struct{}{
+	"fuse.sshfs": {},
+	"9p":         {},
+	"virtiofs":   {},
+}
+
+// ParseLimaMounts parses /proc/mounts, and returns the mount points of the root filesystem and the Lima mounts.
+func ParseLimaMounts(r io.Reader) ([]string, error) {
+	res := []string{"/"}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		if _, ok := limaMountTypes[fields[2]]; !ok {
+			continue
+		}
+		// spaces are escaped as "\040"
+		mountPoint, err := strconv.Unquote(`"` + fields[1] + `"`)
+		if err != nil {
+			mountPoint = fields[1]
+		}
+		res = append(res, mountPoint)
+	}
+	return res, sc.Err()
+}
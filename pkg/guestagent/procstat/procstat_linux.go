@@ -0,0 +1,56 @@
+package procstat
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// LoadAverage parses /proc/loadavg.
+func LoadAverage() ([]float64, error) {
+	r, err := os.Open("/proc/loadavg")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ParseLoadAverage(r)
+}
+
+// MemoryPressure parses /proc/pressure/memory.
+// The file does not exist when the kernel is built without CONFIG_PSI.
+func MemoryPressure() (float64, error) {
+	r, err := os.Open("/proc/pressure/memory")
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return ParseMemoryPressure(r)
+}
+
+// FilesystemUsage returns the total and used bytes of the filesystems of the root and the Lima mounts.
+func FilesystemUsage() ([]Usage, error) {
+	r, err := os.Open("/proc/mounts")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	mountPoints, err := ParseLimaMounts(r)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Usage, 0, len(mountPoints))
+	for _, mountPoint := range mountPoints {
+		var st unix.Statfs_t
+		if err := unix.Statfs(mountPoint, &st); err != nil {
+			return res, fmt.Errorf("failed to statfs %q: %w", mountPoint, err)
+		}
+		bsize := uint64(st.Bsize)
+		res = append(res, Usage{
+			MountPoint: mountPoint,
+			Total:      st.Blocks * bsize,
+			Used:       (st.Blocks - st.Bfree) * bsize,
+		})
+	}
+	return res, nil
+}
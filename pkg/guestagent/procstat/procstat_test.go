@@ -0,0 +1,41 @@
+package procstat
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseLoadAverage(t *testing.T) {
+	loadavg, err := ParseLoadAverage(strings.NewReader("0.52 0.58 0.59 2/580 12345\n"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []float64{0.52, 0.58, 0.59}, loadavg)
+
+	_, err = ParseLoadAverage(strings.NewReader(""))
+	assert.ErrorContains(t, err, "unexpected loadavg")
+}
+
+func TestParseMemoryPressure(t *testing.T) {
+	pressure := `some avg10=1.25 avg60=0.50 avg300=0.10 total=123456
+full avg10=0.75 avg60=0.25 avg300=0.05 total=65432
+`
+	avg10, err := ParseMemoryPressure(strings.NewReader(pressure))
+	assert.NilError(t, err)
+	assert.Equal(t, 1.25, avg10)
+
+	_, err = ParseMemoryPressure(strings.NewReader("full avg10=0.75\n"))
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestParseLimaMounts(t *testing.T) {
+	mounts := `/dev/vda1 / ext4 rw,relatime,discard,errors=remount-ro 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+mount0 /Users/foo virtiofs rw,relatime 0 0
+mount1 /tmp/lima\040dir 9p rw,sync,dirsync,relatime,trans=virtio 0 0
+:/Users/bar /Users/bar fuse.sshfs rw,nosuid,nodev,relatime,user_id=501,group_id=1000 0 0
+`
+	mountPoints, err := ParseLimaMounts(strings.NewReader(mounts))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"/", "/Users/foo", "/tmp/lima dir", "/Users/bar"}, mountPoints)
+}
@@ -2,4 +2,54 @@ package api
 
 type Info struct {
 	SSHLocalPort int `json:"sshLocalPort,omitempty"`
+	// SSHMasterRunning is true when the SSH ControlMaster is running.
+	// Only set when requested, as checking it runs `ssh -O check`.
+	SSHMasterRunning *bool `json:"sshMasterRunning,omitempty"`
+	// GuestAgentEvents is the number of the events received from the guest agent.
+	GuestAgentEvents int64 `json:"guestAgentEvents"`
+	// Paused is true when the vCPUs are paused.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// PortForward is a port or a socket currently forwarded from the guest.
+type PortForward struct {
+	// Protocol is "tcp", "udp", or "unix".
+	Protocol     string `json:"protocol"`
+	GuestAddress string `json:"guestAddress"`
+	HostAddress  string `json:"hostAddress"`
+	// Reverse is true when the socket is forwarded from the host to the guest.
+	Reverse bool `json:"reverse,omitempty"`
+}
+
+// Stats is the resource usage of the guest.
+type Stats struct {
+	// LoadAverage is the load averages over 1, 5, and 15 minutes.
+	LoadAverage []float64 `json:"loadAverage,omitempty"`
+	// MemoryPressure is the "some avg10" value of /proc/pressure/memory, in percent.
+	// Nil when the guest kernel does not support PSI.
+	MemoryPressure *float64 `json:"memoryPressure,omitempty"`
+	// MemoryActual is the memory size reported by the memory balloon, in bytes.
+	// Zero when the memory balloon is not enabled.
+	MemoryActual int64 `json:"memoryActual,omitempty"`
+	// Filesystems is the usage of the root filesystem and the mounts.
+	Filesystems []FilesystemUsage `json:"filesystems,omitempty"`
+	// ForwardedPorts is the number of the TCP ports forwarded from the guest.
+	ForwardedPorts int `json:"forwardedPorts"`
+}
+
+// FilesystemUsage is the usage of a filesystem of the guest, in bytes.
+type FilesystemUsage struct {
+	MountPoint string `json:"mountPoint"`
+	Total      uint64 `json:"total"`
+	Used       uint64 `json:"used"`
+}
+
+// ReloadResult is the result of reloading lima.yaml of the running instance.
+type ReloadResult struct {
+	// PortForwardsChanged is the number of the forwards set up or torn down by the reload.
+	PortForwardsChanged int `json:"portForwardsChanged"`
+	// DiskThrottleChanged is true when the disk throttle was changed on the running instance.
+	DiskThrottleChanged bool `json:"diskThrottleChanged,omitempty"`
+	// RestartRequired describes the changes that are not applied until the instance is restarted.
+	RestartRequired []string `json:"restartRequired,omitempty"`
 }
@@ -6,16 +6,28 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/lima-vm/lima/pkg/hostagent/api"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/httpclientutil"
 )
 
 type HostAgentClient interface {
 	HTTPClient() *http.Client
-	Info(context.Context) (*api.Info, error)
+	// Info returns the state of the host agent. SSHMasterRunning is only set when checkSSHMaster is true.
+	Info(ctx context.Context, checkSSHMaster bool) (*api.Info, error)
+	Stats(context.Context) (*api.Stats, error)
+	PortForwards(context.Context) ([]api.PortForward, error)
+	// Events calls onEvent for the events emitted so far, and for the new events too when follow is true.
+	Events(ctx context.Context, follow bool, onEvent func(events.Event)) error
+	Reload(context.Context) (*api.ReloadResult, error)
+	// Pause stops the vCPUs of the VM. Info reports Paused until Resume is called.
+	Pause(context.Context) error
+	Resume(context.Context) error
 }
 
 // NewHostAgentClient creates a client.
@@ -48,8 +60,8 @@ func (c *client) HTTPClient() *http.Client {
 	return c.Client
 }
 
-func (c *client) Info(ctx context.Context) (*api.Info, error) {
-	u := fmt.Sprintf("http://%s/%s/info", c.dummyHost, c.version)
+func (c *client) Info(ctx context.Context, checkSSHMaster bool) (*api.Info, error) {
+	u := fmt.Sprintf("http://%s/%s/info?sshMaster=%t", c.dummyHost, c.version, checkSSHMaster)
 	resp, err := httpclientutil.Get(ctx, c.HTTPClient(), u)
 	if err != nil {
 		return nil, err
@@ -62,3 +74,86 @@ func (c *client) Info(ctx context.Context) (*api.Info, error) {
 	}
 	return &info, nil
 }
+
+func (c *client) Stats(ctx context.Context) (*api.Stats, error) {
+	u := fmt.Sprintf("http://%s/%s/stats", c.dummyHost, c.version)
+	resp, err := httpclientutil.Get(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var stats api.Stats
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (c *client) PortForwards(ctx context.Context) ([]api.PortForward, error) {
+	u := fmt.Sprintf("http://%s/%s/port-forwards", c.dummyHost, c.version)
+	resp, err := httpclientutil.Get(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var forwards []api.PortForward
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&forwards); err != nil {
+		return nil, err
+	}
+	return forwards, nil
+}
+
+func (c *client) Events(ctx context.Context, follow bool, onEvent func(events.Event)) error {
+	u := fmt.Sprintf("http://%s/%s/events?follow=%t", c.dummyHost, c.version, follow)
+	resp, err := httpclientutil.Get(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev events.Event
+		if err := dec.Decode(&ev); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		onEvent(ev)
+	}
+}
+
+func (c *client) Reload(ctx context.Context) (*api.ReloadResult, error) {
+	u := fmt.Sprintf("http://%s/%s/reload", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var res api.ReloadResult
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *client) Pause(ctx context.Context) error {
+	u := fmt.Sprintf("http://%s/%s/pause", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) Resume(ctx context.Context) error {
+	u := fmt.Sprintf("http://%s/%s/resume", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
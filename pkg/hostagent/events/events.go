@@ -10,6 +10,8 @@ type Status struct {
 	Degraded bool `json:"degraded,omitempty"`
 	// When Exiting is true, Running must be false
 	Exiting bool `json:"exiting,omitempty"`
+	// When Paused is true, the VM was started with its vCPUs paused, and is waiting to be resumed
+	Paused bool `json:"paused,omitempty"`
 
 	Errors []string `json:"errors,omitempty"`
 
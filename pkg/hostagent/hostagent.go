@@ -11,9 +11,12 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc/codes"
@@ -22,7 +25,10 @@ import (
 	"github.com/lima-vm/lima/pkg/driver"
 	"github.com/lima-vm/lima/pkg/driverutil"
 	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/networks/usernet"
 	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/portfwd"
+	"github.com/lima-vm/lima/pkg/progress"
 
 	"github.com/lima-vm/lima/pkg/cidata"
 	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
@@ -50,6 +56,7 @@ type HostAgent struct {
 	sshConfig       *ssh.SSHConfig
 	portForwarder   *portForwarder
 	onClose         []func() error // LIFO
+	reloadMu        sync.Mutex
 
 	driver   driver.Driver
 	signalCh chan os.Signal
@@ -57,9 +64,18 @@ type HostAgent struct {
 	eventEnc   *json.Encoder
 	eventEncMu sync.Mutex
 
+	// eventsMu guards the events emitted so far, and the subscribers of the new events
+	eventsMu         sync.Mutex
+	events           []events.Event
+	eventSubs        map[chan events.Event]struct{}
+	guestAgentEvents atomic.Int64
+
 	vSockPort  int
 	virtioPort string
 
+	startPaused bool
+	paused      atomic.Bool // set by Pause and Resume, and by starting with the vCPUs paused
+
 	clientMu sync.RWMutex
 	client   *guestagentclient.GuestAgentClient
 
@@ -69,6 +85,8 @@ type HostAgent struct {
 
 type options struct {
 	nerdctlArchive string // local path, not URL
+	startPaused    bool
+	cidata         cidata.Overrides
 }
 
 type Opt func(*options) error
@@ -80,6 +98,38 @@ func WithNerdctlArchive(s string) Opt {
 	}
 }
 
+// WithStartPaused starts the VM with its vCPUs paused, so that it can be inspected before the guest runs.
+func WithStartPaused() Opt {
+	return func(o *options) error {
+		o.startPaused = true
+		return nil
+	}
+}
+
+// WithCloudInitUserData merges the file into the generated cloud-init user-data.
+func WithCloudInitUserData(s string) Opt {
+	return func(o *options) error {
+		b, err := os.ReadFile(s)
+		if err != nil {
+			return err
+		}
+		o.cidata.UserData = b
+		return nil
+	}
+}
+
+// WithCloudInitNetworkConfig merges the file into the generated cloud-init network-config.
+func WithCloudInitNetworkConfig(s string) Opt {
+	return func(o *options) error {
+		b, err := os.ReadFile(s)
+		if err != nil {
+			return err
+		}
+		o.cidata.NetworkConfig = b
+		return nil
+	}
+}
+
 // New creates the HostAgent.
 //
 // stdout is for emitting JSON lines of Events.
@@ -121,26 +171,28 @@ func New(instName string, stdout io.Writer, signalCh chan os.Signal, opts ...Opt
 		}
 	}
 
-	vSockPort := 0
-	virtioPort := ""
-	if *y.VMType == limayaml.VZ {
-		vSockPort = 2222
-	} else if *y.VMType == limayaml.WSL2 {
-		port, err := getFreeVSockPort()
-		if err != nil {
-			logrus.WithError(err).Error("failed to get free VSock port")
-		}
-		vSockPort = port
-	} else if *y.VMType == limayaml.QEMU {
-		// virtserialport doesn't seem to work reliably: https://github.com/lima-vm/lima/issues/2064
-		virtioPort = "" // filenames.VirtioPort
+	base := &driver.BaseDriver{
+		Instance:     inst,
+		Yaml:         y,
+		SSHLocalPort: sshLocalPort,
+		StartPaused:  o.startPaused,
 	}
+	limaDriver := driverutil.CreateTargetDriverInstance(base)
+	// virtserialport doesn't seem to work reliably: https://github.com/lima-vm/lima/issues/2064
+	virtioPort := "" // filenames.VirtioPort
+	vSockPort := guestAgentVSockPort(limaDriver, *y.VMType, getFreeVSockPort)
+	base.VSockPort = vSockPort
+	base.VirtioPort = virtioPort
 
-	if err := cidata.GenerateISO9660(inst.Dir, instName, y, udpDNSLocalPort, tcpDNSLocalPort, o.nerdctlArchive, vSockPort, virtioPort); err != nil {
+	if err := cidata.GenerateISO9660(inst.Dir, instName, y, udpDNSLocalPort, tcpDNSLocalPort, o.nerdctlArchive, vSockPort, virtioPort, o.cidata); err != nil {
 		return nil, err
 	}
 
-	sshOpts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent, *y.SSH.ForwardX11, *y.SSH.ForwardX11Trusted)
+	sshOpts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.GenerateDedicatedKey, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent, *y.SSH.ForwardX11, *y.SSH.ForwardX11Trusted, sshutil.ConnectionOpts{
+		ControlPersist:      *y.SSH.ControlPersist,
+		ServerAliveInterval: *y.SSH.ServerAliveInterval,
+		ServerAliveCountMax: *y.SSH.ServerAliveCountMax,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -151,26 +203,7 @@ func New(instName string, stdout io.Writer, signalCh chan os.Signal, opts ...Opt
 		AdditionalArgs: sshutil.SSHArgsFromOpts(sshOpts),
 	}
 
-	rules := make([]limayaml.PortForward, 0, 3+len(y.PortForwards))
-	// Block ports 22 and sshLocalPort on all IPs
-	for _, port := range []int{sshGuestPort, sshLocalPort} {
-		rule := limayaml.PortForward{GuestIP: net.IPv4zero, GuestPort: port, Ignore: true}
-		limayaml.FillPortForwardDefaults(&rule, inst.Dir)
-		rules = append(rules, rule)
-	}
-	rules = append(rules, y.PortForwards...)
-	// Default forwards for all non-privileged ports from "127.0.0.1" and "::1"
-	rule := limayaml.PortForward{}
-	limayaml.FillPortForwardDefaults(&rule, inst.Dir)
-	rules = append(rules, rule)
-
-	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
-		Instance:     inst,
-		Yaml:         y,
-		SSHLocalPort: sshLocalPort,
-		VSockPort:    vSockPort,
-		VirtioPort:   virtioPort,
-	})
+	rules := portForwardRules(y, inst.Dir, sshLocalPort)
 
 	a := &HostAgent{
 		y:                 y,
@@ -185,13 +218,39 @@ func New(instName string, stdout io.Writer, signalCh chan os.Signal, opts ...Opt
 		driver:            limaDriver,
 		signalCh:          signalCh,
 		eventEnc:          json.NewEncoder(stdout),
+		eventSubs:         make(map[chan events.Event]struct{}),
 		vSockPort:         vSockPort,
 		virtioPort:        virtioPort,
+		startPaused:       o.startPaused,
 		guestAgentAliveCh: make(chan struct{}),
 	}
+	a.paused.Store(o.startPaused)
+	a.portForwarder.dialTunnel = a.dialTunnel
+	if usernetIndex := limayaml.FirstUsernetIndex(y); usernetIndex != -1 {
+		a.portForwarder.usernet = usernet.NewClientByName(y.Networks[usernetIndex].Lima)
+		a.portForwarder.usernetMAC = limayaml.MACAddress(inst.Dir)
+	}
 	return a, nil
 }
 
+// portForwardRules returns the rules of the port forwarder, surrounding the rules of y
+// with the rules for blocking the SSH ports and the default rule.
+func portForwardRules(y *limayaml.LimaYAML, instDir string, sshLocalPort int) []limayaml.PortForward {
+	rules := make([]limayaml.PortForward, 0, 3+len(y.PortForwards))
+	// Block ports 22 and sshLocalPort on all IPs
+	for _, port := range []int{sshGuestPort, sshLocalPort} {
+		rule := limayaml.PortForward{GuestIP: net.IPv4zero, GuestPort: port, Ignore: true}
+		limayaml.FillPortForwardDefaults(&rule, instDir)
+		rules = append(rules, rule)
+	}
+	rules = append(rules, y.PortForwards...)
+	// Default forwards for all non-privileged ports from "127.0.0.1" and "::1"
+	rule := limayaml.PortForward{HostIP: y.PortForwardOptions.DefaultBindAddress}
+	limayaml.FillPortForwardDefaults(&rule, instDir)
+	rules = append(rules, rule)
+	return rules
+}
+
 func writeSSHConfigFile(inst *store.Instance, instSSHAddress string, sshLocalPort int, sshOpts []string) error {
 	if inst.Dir == "" {
 		return fmt.Errorf("directory is unknown for the instance %q", inst.Name)
@@ -199,6 +258,7 @@ func writeSSHConfigFile(inst *store.Instance, instSSHAddress string, sshLocalPor
 	var b bytes.Buffer
 	if _, err := fmt.Fprintf(&b, `# This SSH config file can be passed to 'ssh -F'.
 # This file is created by Lima, but not used by Lima itself currently.
+# Run 'limactl ssh-config install' to include this file from ~/.ssh/config.
 # Modifications to this file will be lost on restarting the Lima instance.
 `); err != nil {
 		return err
@@ -287,6 +347,42 @@ func (a *HostAgent) emitEvent(_ context.Context, ev events.Event) {
 	if err := a.eventEnc.Encode(ev); err != nil {
 		logrus.WithField("event", ev).WithError(err).Error("failed to emit an event")
 	}
+	a.publishEvent(ev)
+}
+
+// maxEventHistory is the number of the events retained for SubscribeEvents.
+const maxEventHistory = 100
+
+func (a *HostAgent) publishEvent(ev events.Event) {
+	a.eventsMu.Lock()
+	defer a.eventsMu.Unlock()
+	a.events = append(a.events, ev)
+	if len(a.events) > maxEventHistory {
+		a.events = a.events[len(a.events)-maxEventHistory:]
+	}
+	for ch := range a.eventSubs {
+		select {
+		case ch <- ev:
+		default:
+			logrus.Debug("dropping an event for a slow subscriber")
+		}
+	}
+}
+
+// SubscribeEvents returns the events emitted so far, and the channel of the events emitted from now on.
+// The caller must call unsubscribe when it no longer receives from the channel.
+func (a *HostAgent) SubscribeEvents() (history []events.Event, ch <-chan events.Event, unsubscribe func()) {
+	a.eventsMu.Lock()
+	defer a.eventsMu.Unlock()
+	history = slices.Clone(a.events)
+	c := make(chan events.Event, 16)
+	a.eventSubs[c] = struct{}{}
+	unsubscribe = func() {
+		a.eventsMu.Lock()
+		defer a.eventsMu.Unlock()
+		delete(a.eventSubs, c)
+	}
+	return history, c, unsubscribe
 }
 
 func generatePassword(length int) (string, error) {
@@ -304,6 +400,7 @@ func (a *HostAgent) Run(ctx context.Context) error {
 		a.emitEvent(ctx, exitingEv)
 	}()
 	adjustNofileRlimit()
+	ctx = progress.WithInstanceDir(ctx, a.instDir)
 
 	if limayaml.FirstUsernetIndex(a.y) == -1 && *a.y.HostResolver.Enabled {
 		hosts := a.y.HostResolver.Hosts
@@ -325,6 +422,7 @@ func (a *HostAgent) Run(ctx context.Context) error {
 		defer dnsServer.Shutdown()
 	}
 
+	progress.Emit(ctx, progress.Event{Phase: progress.StartingVM})
 	errCh, err := a.driver.Start(ctx)
 	if err != nil {
 		return err
@@ -401,6 +499,11 @@ func (a *HostAgent) startRoutinesAndWait(ctx context.Context, errCh chan error)
 	}
 	stBooting := stBase
 	a.emitEvent(ctx, events.Event{Status: stBooting})
+	if a.startPaused {
+		stPaused := stBase
+		stPaused.Paused = true
+		a.emitEvent(ctx, events.Event{Status: stPaused})
+	}
 	ctxHA, cancelHA := context.WithCancel(ctx)
 	go func() {
 		stRunning := stBase
@@ -420,6 +523,10 @@ func (a *HostAgent) startRoutinesAndWait(ctx context.Context, errCh chan error)
 				logrus.WithError(closeErr).Warn("an error during shutting down the host agent")
 			}
 			err := a.driver.Stop(ctx)
+			// the exit status of the host agent reflects the exit of the VM, e.g., for `limactl start --foreground`
+			if driverErr != nil {
+				return errors.Join(fmt.Errorf("driver stopped: %w", driverErr), err)
+			}
 			return err
 		case sig := <-a.signalCh:
 			logrus.Infof("Received %s, shutting down the host agent", osutil.SignalName(sig))
@@ -433,13 +540,242 @@ func (a *HostAgent) startRoutinesAndWait(ctx context.Context, errCh chan error)
 	}
 }
 
-func (a *HostAgent) Info(_ context.Context) (*hostagentapi.Info, error) {
+// Info returns the state of the host agent.
+// SSHMasterRunning is only checked when checkSSHMaster is true, as it requires executing ssh.
+func (a *HostAgent) Info(ctx context.Context, checkSSHMaster bool) (*hostagentapi.Info, error) {
 	info := &hostagentapi.Info{
-		SSHLocalPort: a.sshLocalPort,
+		SSHLocalPort:     a.sshLocalPort,
+		GuestAgentEvents: a.guestAgentEvents.Load(),
+		Paused:           a.paused.Load(),
+	}
+	if checkSSHMaster {
+		running := a.sshMasterRunning(ctx)
+		info.SSHMasterRunning = &running
 	}
 	return info, nil
 }
 
+// Pause stops the vCPUs of the VM, without shutting down the guest.
+// The QMP commands are sent by the host agent, so that the paused state can be reported by Info
+// without another process connecting to the QMP socket.
+func (a *HostAgent) Pause(ctx context.Context) error {
+	if err := a.driver.Pause(ctx); err != nil {
+		return err
+	}
+	a.paused.Store(true)
+	return nil
+}
+
+// Resume restarts the vCPUs of the VM paused by Pause, or started with the vCPUs paused.
+func (a *HostAgent) Resume(ctx context.Context) error {
+	if err := a.driver.Resume(ctx); err != nil {
+		return err
+	}
+	a.paused.Store(false)
+	return nil
+}
+
+// sshMasterRunning checks whether the SSH ControlMaster is running, with `ssh -O check`.
+func (a *HostAgent) sshMasterRunning(ctx context.Context) bool {
+	args := a.sshConfig.Args()
+	args = append(args, "-O", "check", "-p", strconv.Itoa(a.sshLocalPort), a.instSSHAddress)
+	cmd := exec.CommandContext(ctx, a.sshConfig.Binary(), args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		logrus.WithError(err).Debugf("the SSH ControlMaster is not running: %q", string(out))
+		return false
+	}
+	return true
+}
+
+// sshMasterCheckInterval is the interval of checking whether the SSH master is running.
+const sshMasterCheckInterval = 10 * time.Second
+
+// watchSSHMaster re-establishes the SSH master when it is found dead, e.g., after the host network was changed
+// and the keepalive timed out, or after `ssh.controlPersist` expired, and then sets up the forwards again.
+func (a *HostAgent) watchSSHMaster(ctx context.Context) {
+	ticker := time.NewTicker(sshMasterCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if a.sshMasterRunning(ctx) {
+			continue
+		}
+		logrus.Warn("The SSH master is not running, re-establishing it")
+		// A new master is started in the background by any ssh command, due to ControlMaster=auto
+		if err := executeSSH(ctx, a.sshConfig, a.sshLocalPort, "true"); err != nil {
+			if ctx.Err() == nil {
+				logrus.WithError(err).Warn("failed to re-establish the SSH master")
+			}
+			continue
+		}
+		logrus.Info("Re-established the SSH master, setting up the forwards again")
+		if *a.y.VMType != limayaml.WSL2 {
+			for _, rule := range a.portForwarder.socketRules() {
+				local := hostAddress(rule, &guestagentapi.IPPort{})
+				if err := forwardSSH(ctx, a.sshConfig, a.sshLocalPort, local, rule.GuestSocket, verbForward, rule.Reverse); err != nil {
+					logrus.WithError(err).Warnf("failed to set up forwarding socket %q", rule.GuestSocket)
+				}
+			}
+		}
+		if a.driver.ForwardGuestAgent() {
+			localUnix := filepath.Join(a.instDir, filenames.GuestAgentSock)
+			if err := forwardSSH(ctx, a.sshConfig, a.sshLocalPort, localUnix, guestAgentSock, verbForward, false); err != nil {
+				logrus.WithError(err).Warn("failed to set up forwarding the guest agent socket")
+			}
+		}
+		a.portForwarder.reforwardTCP(ctx)
+	}
+}
+
+// PortForwards returns the ports and the sockets currently forwarded from the guest.
+func (a *HostAgent) PortForwards(_ context.Context) ([]hostagentapi.PortForward, error) {
+	if *a.y.Plain {
+		return nil, errors.New("port forwarding is not running in plain mode")
+	}
+	return a.portForwarder.forwards(), nil
+}
+
+// Stats returns the resource usage reported by the guest agent, and the memory balloon when it is enabled.
+func (a *HostAgent) Stats(ctx context.Context) (*hostagentapi.Stats, error) {
+	if *a.y.Plain {
+		return nil, errors.New("the guest agent is not running in plain mode")
+	}
+	client, err := a.getOrCreateClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	guestStats, err := client.Stats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the stats from the guest agent: %w", err)
+	}
+	stats := &hostagentapi.Stats{
+		LoadAverage:    guestStats.LoadAverage,
+		MemoryPressure: guestStats.MemoryPressureAvg10,
+		ForwardedPorts: a.portForwarder.numForwarded(),
+	}
+	for _, fs := range guestStats.Filesystems {
+		stats.Filesystems = append(stats.Filesystems, hostagentapi.FilesystemUsage{
+			MountPoint: fs.MountPoint,
+			Total:      fs.Total,
+			Used:       fs.Used,
+		})
+	}
+	if *a.y.MemoryBalloon.Enabled {
+		stats.MemoryActual, err = a.driver.MemoryActual(ctx)
+		if err != nil {
+			logrus.WithError(err).Debug("failed to get the actual memory size from the memory balloon")
+		}
+	}
+	return stats, nil
+}
+
+// Reload re-reads lima.yaml of the running instance, and applies the changes of the port forwarding rules.
+// The forwards that are not affected by the changes are kept, along with their connections.
+// The changes that cannot be applied without restarting the instance, such as the changes of the mounts,
+// are returned as RestartRequired.
+func (a *HostAgent) Reload(ctx context.Context) (*hostagentapi.ReloadResult, error) {
+	if *a.y.Plain {
+		return nil, errors.New("port forwarding is not running in plain mode")
+	}
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+	y, err := store.LoadYAMLByFilePath(filepath.Join(a.instDir, filenames.LimaYAML))
+	if err != nil {
+		return nil, err
+	}
+	oldSocketRules := a.portForwarder.socketRules()
+	res := &hostagentapi.ReloadResult{
+		PortForwardsChanged: a.portForwarder.reload(portForwardRules(y, a.instDir, a.sshLocalPort)),
+	}
+	if *a.y.VMType != limayaml.WSL2 {
+		res.PortForwardsChanged += a.reloadSocketForwards(ctx, oldSocketRules, a.portForwarder.socketRules())
+	}
+	res.RestartRequired = mountChanges(a.y.Mounts, y.Mounts)
+	if !reflect.DeepEqual(a.y.DiskOptions.Throttle, y.DiskOptions.Throttle) {
+		if err := a.driver.SetDiskThrottle(ctx, y.DiskOptions.Throttle); err != nil {
+			logrus.WithError(err).Warn("failed to change the disk throttle of the running instance")
+			res.RestartRequired = append(res.RestartRequired, "disk throttle was modified")
+		} else {
+			a.y.DiskOptions.Throttle = y.DiskOptions.Throttle
+			res.DiskThrottleChanged = true
+		}
+	}
+	res.RestartRequired = append(res.RestartRequired, diskOptionsChanges(a.y.DiskOptions, y.DiskOptions)...)
+	logrus.Infof("Reloaded %s: %d port forwards changed", filenames.LimaYAML, res.PortForwardsChanged)
+	return res, nil
+}
+
+// reloadSocketForwards cancels the socket forwards that are no longer in newRules, and sets up the new ones.
+func (a *HostAgent) reloadSocketForwards(ctx context.Context, oldRules, newRules []limayaml.PortForward) int {
+	var changed int
+	for _, rule := range oldRules {
+		if slices.ContainsFunc(newRules, func(r limayaml.PortForward) bool { return reflect.DeepEqual(r, rule) }) {
+			continue
+		}
+		changed++
+		local := hostAddress(rule, &guestagentapi.IPPort{})
+		if err := forwardSSH(ctx, a.sshConfig, a.sshLocalPort, local, rule.GuestSocket, verbCancel, rule.Reverse); err != nil {
+			logrus.WithError(err).Warnf("failed to stop forwarding socket %q", rule.GuestSocket)
+		}
+	}
+	for _, rule := range newRules {
+		if slices.ContainsFunc(oldRules, func(r limayaml.PortForward) bool { return reflect.DeepEqual(r, rule) }) {
+			continue
+		}
+		changed++
+		local := hostAddress(rule, &guestagentapi.IPPort{})
+		if err := forwardSSH(ctx, a.sshConfig, a.sshLocalPort, local, rule.GuestSocket, verbForward, rule.Reverse); err != nil {
+			logrus.WithError(err).Warnf("failed to set up forwarding socket %q", rule.GuestSocket)
+		}
+	}
+	return changed
+}
+
+// mountChanges describes the mounts added, removed, or modified in newMounts.
+// Mounts cannot be hot-plugged yet, so all of them require restarting the instance.
+func mountChanges(oldMounts, newMounts []limayaml.Mount) []string {
+	var res []string
+	for _, m := range newMounts {
+		i := slices.IndexFunc(oldMounts, func(o limayaml.Mount) bool { return o.MountPoint == m.MountPoint })
+		switch {
+		case i == -1:
+			res = append(res, fmt.Sprintf("mount %q was added", m.MountPoint))
+		case !reflect.DeepEqual(oldMounts[i], m):
+			res = append(res, fmt.Sprintf("mount %q was modified", m.MountPoint))
+		}
+	}
+	for _, m := range oldMounts {
+		if !slices.ContainsFunc(newMounts, func(n limayaml.Mount) bool { return n.MountPoint == m.MountPoint }) {
+			res = append(res, fmt.Sprintf("mount %q was removed", m.MountPoint))
+		}
+	}
+	return res
+}
+
+// diskOptionsChanges describes the disk options modified in newOpts, except for the throttle,
+// which is changed on the running instance.
+func diskOptionsChanges(oldOpts, newOpts limayaml.DiskOptions) []string {
+	var res []string
+	for _, f := range []struct {
+		name     string
+		old, new any
+	}{
+		{"cacheMode", oldOpts.CacheMode, newOpts.CacheMode},
+		{"aio", oldOpts.AIO, newOpts.AIO},
+		{"discard", oldOpts.Discard, newOpts.Discard},
+		{"ephemeral", oldOpts.Ephemeral, newOpts.Ephemeral},
+	} {
+		if !reflect.DeepEqual(f.old, f.new) {
+			res = append(res, fmt.Sprintf("disk option %q was modified", f.name))
+		}
+	}
+	return res
+}
+
 func (a *HostAgent) startHostAgentRoutines(ctx context.Context) error {
 	if *a.y.Plain {
 		logrus.Info("Running in plain mode. Mounts, port forwarding, containerd, etc. will be ignored. Guest agent will not be running.")
@@ -452,6 +788,7 @@ func (a *HostAgent) startHostAgentRoutines(ctx context.Context) error {
 		return nil
 	})
 	var errs []error
+	progress.Emit(ctx, progress.Event{Phase: progress.WaitingForSSH})
 	if err := a.waitForRequirements("essential", a.essentialRequirements()); err != nil {
 		errs = append(errs, err)
 	}
@@ -483,25 +820,33 @@ sudo chown -R "${USER}" /run/host-services`
 			return errors.Join(unmountErrs...)
 		})
 	}
-	if len(a.y.AdditionalDisks) > 0 {
-		a.onClose = append(a.onClose, func() error {
-			var unlockErrs []error
-			for _, d := range a.y.AdditionalDisks {
-				disk, inspectErr := store.InspectDisk(d.Name)
-				if inspectErr != nil {
-					unlockErrs = append(unlockErrs, inspectErr)
-					continue
-				}
-				logrus.Infof("Unmounting disk %q", disk.Name)
-				if unlockErr := disk.Unlock(); unlockErr != nil {
-					unlockErrs = append(unlockErrs, unlockErr)
-				}
+	a.onClose = append(a.onClose, func() error {
+		// the disks are looked up from the store, as they may have been attached or detached with `limactl disk attach|detach`
+		diskNames, err := store.Disks()
+		if err != nil {
+			return err
+		}
+		var unlockErrs []error
+		for _, diskName := range diskNames {
+			disk, inspectErr := store.InspectDisk(diskName)
+			if inspectErr != nil {
+				logrus.WithError(inspectErr).Debugf("failed to inspect disk %q", diskName)
+				continue
 			}
-			return errors.Join(unlockErrs...)
-		})
-	}
+			if disk.InstanceDir != a.instDir {
+				continue
+			}
+			logrus.Infof("Unmounting disk %q", disk.Name)
+			if unlockErr := disk.Unlock(); unlockErr != nil {
+				unlockErrs = append(unlockErrs, unlockErr)
+			}
+		}
+		return errors.Join(unlockErrs...)
+	})
 	if !*a.y.Plain {
 		go a.watchGuestAgentEvents(ctx)
+		go a.watchFilesystemUsage(ctx)
+		go a.watchSSHMaster(ctx)
 	}
 	if err := a.waitForRequirements("optional", a.optionalRequirements()); err != nil {
 		errs = append(errs, err)
@@ -512,9 +857,15 @@ sudo chown -R "${USER}" /run/host-services`
 		case <-a.guestAgentAliveCh:
 			// NOP
 		case <-time.After(time.Minute):
-			errs = append(errs, errors.New("guest agent does not seem to be running; port forwards will not work"))
+			initSystem, err := a.guestInitSystem()
+			if err != nil {
+				logrus.WithError(err).Debug("failed to detect the init system of the guest")
+			}
+			errs = append(errs, guestAgentNotRunningError(initSystem))
 		}
 	}
+	// the provisioning scripts are run by the boot scripts
+	progress.Emit(ctx, progress.Event{Phase: progress.RunningProvision, Message: "boot scripts"})
 	if err := a.waitForRequirements("final", a.finalRequirements()); err != nil {
 		errs = append(errs, err)
 	}
@@ -557,27 +908,23 @@ func (a *HostAgent) watchGuestAgentEvents(ctx context.Context) {
 	// Setup all socket forwards and defer their teardown
 	if *a.y.VMType != limayaml.WSL2 {
 		logrus.Debugf("Forwarding unix sockets")
-		for _, rule := range a.y.PortForwards {
-			if rule.GuestSocket != "" {
-				local := hostAddress(rule, &guestagentapi.IPPort{})
-				_ = forwardSSH(ctx, a.sshConfig, a.sshLocalPort, local, rule.GuestSocket, verbForward, rule.Reverse)
-			}
+		for _, rule := range a.portForwarder.socketRules() {
+			local := hostAddress(rule, &guestagentapi.IPPort{})
+			_ = forwardSSH(ctx, a.sshConfig, a.sshLocalPort, local, rule.GuestSocket, verbForward, rule.Reverse)
 		}
 	}
 
 	localUnix := filepath.Join(a.instDir, filenames.GuestAgentSock)
-	remoteUnix := "/run/lima-guestagent.sock"
+	remoteUnix := guestAgentSock
 
 	a.onClose = append(a.onClose, func() error {
 		logrus.Debugf("Stop forwarding unix sockets")
 		var errs []error
-		for _, rule := range a.y.PortForwards {
-			if rule.GuestSocket != "" {
-				local := hostAddress(rule, &guestagentapi.IPPort{})
-				// using ctx.Background() because ctx has already been cancelled
-				if err := forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, local, rule.GuestSocket, verbCancel, rule.Reverse); err != nil {
-					errs = append(errs, err)
-				}
+		for _, rule := range a.portForwarder.socketRules() {
+			local := hostAddress(rule, &guestagentapi.IPPort{})
+			// using ctx.Background() because ctx has already been cancelled
+			if err := forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, local, rule.GuestSocket, verbCancel, rule.Reverse); err != nil {
+				errs = append(errs, err)
 			}
 		}
 		if a.driver.ForwardGuestAgent() {
@@ -633,6 +980,15 @@ func isGuestAgentSocketAccessible(ctx context.Context, client *guestagentclient.
 	return err == nil
 }
 
+// dialTunnel opens a tunnel to the guest agent, for relaying UDP datagrams.
+func (a *HostAgent) dialTunnel(ctx context.Context) (portfwd.Stream, error) {
+	client, err := a.getOrCreateClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.Tunnel(ctx)
+}
+
 func (a *HostAgent) getOrCreateClient(ctx context.Context) (*guestagentclient.GuestAgentClient, error) {
 	a.clientMu.Lock()
 	defer a.clientMu.Unlock()
@@ -667,6 +1023,7 @@ func (a *HostAgent) processGuestAgentEvents(ctx context.Context, client *guestag
 	logrus.Debugf("guest agent info: %+v", info)
 
 	onEvent := func(ev *guestagentapi.Event) {
+		a.guestAgentEvents.Add(1)
 		logrus.Debugf("guest agent event: %+v", ev)
 		for _, f := range ev.Errors {
 			logrus.Warnf("received error from the guest: %q", f)
@@ -683,6 +1040,9 @@ func (a *HostAgent) processGuestAgentEvents(ctx context.Context, client *guestag
 	return io.EOF
 }
 
+// guestAgentSock is the socket of the guest agent in the guest.
+const guestAgentSock = "/run/lima-guestagent.sock"
+
 const (
 	verbForward = "forward"
 	verbCancel  = "cancel"
@@ -735,8 +1095,9 @@ func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 				}
 			} else {
 				logrus.Infof("Forwarding %q (guest) to %q (host)", remote, local)
-				if err := os.RemoveAll(local); err != nil {
-					logrus.WithError(err).Warnf("Failed to clean up %q (host) before setting up forwarding", local)
+				// An existing socket is only replaced when it is dead, e.g., left behind by a crashed host agent
+				if err := osutil.RemoveStaleSocket(local); err != nil {
+					return fmt.Errorf("can't replace %q (host): %w", local, err)
 				}
 			}
 			if err := os.MkdirAll(filepath.Dir(local), 0o750); err != nil {
@@ -0,0 +1,27 @@
+package hostagent
+
+import (
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/ptr"
+	"gotest.tools/v3/assert"
+)
+
+func TestDiskOptionsChanges(t *testing.T) {
+	oldOpts := limayaml.DiskOptions{
+		CacheMode: ptr.Of(""),
+		Discard:   ptr.Of(false),
+		Throttle:  limayaml.DiskThrottle{IOPS: ptr.Of(int64(0))},
+	}
+	newOpts := oldOpts
+	newOpts.Throttle = limayaml.DiskThrottle{IOPS: ptr.Of(int64(100))}
+	assert.Assert(t, len(diskOptionsChanges(oldOpts, newOpts)) == 0, "the throttle is changed on the running instance")
+
+	newOpts.CacheMode = ptr.Of(limayaml.DiskCacheModeUnsafe)
+	newOpts.Discard = ptr.Of(true)
+	assert.DeepEqual(t, diskOptionsChanges(oldOpts, newOpts), []string{
+		`disk option "cacheMode" was modified`,
+		`disk option "discard" was modified`,
+	})
+}
@@ -0,0 +1,44 @@
+package hostagent
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lima-vm/sshocker/pkg/ssh"
+)
+
+// guestInitSystemScript prints the init system of the guest, following the detection in the boot scripts.
+const guestInitSystemScript = `#!/bin/sh
+if [ -d /run/systemd/system ]; then
+	echo systemd
+elif [ -f /sbin/openrc-run ]; then
+	echo openrc
+elif command -v runsvdir >/dev/null 2>&1; then
+	echo runit
+else
+	cat /proc/1/comm
+fi
+`
+
+// supportedGuestInitSystems are the init systems that the boot scripts install the guest agent service for.
+var supportedGuestInitSystems = []string{"systemd", "openrc", "runit"}
+
+// guestInitSystem returns the init system of the guest, e.g., "systemd".
+func (a *HostAgent) guestInitSystem() (string, error) {
+	stdout, stderr, err := ssh.ExecuteScript(a.instSSHAddress, a.sshLocalPort, a.sshConfig, guestInitSystemScript, "detecting the init system")
+	if err != nil {
+		return "", fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+// guestAgentNotRunningError returns the error for the guest agent that did not start.
+// The error is distinct when the guest agent cannot be started due to an unsupported init system.
+func guestAgentNotRunningError(initSystem string) error {
+	if initSystem != "" && !slices.Contains(supportedGuestInitSystems, initSystem) {
+		return fmt.Errorf("guest agent not running; dynamic port forwarding disabled — init system %q not supported", initSystem)
+	}
+	return errors.New("guest agent does not seem to be running; port forwards will not work")
+}
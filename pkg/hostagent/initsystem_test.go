@@ -0,0 +1,14 @@
+package hostagent
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestGuestAgentNotRunningError(t *testing.T) {
+	assert.Error(t, guestAgentNotRunningError("systemd"), "guest agent does not seem to be running; port forwards will not work")
+	assert.Error(t, guestAgentNotRunningError("runit"), "guest agent does not seem to be running; port forwards will not work")
+	assert.Error(t, guestAgentNotRunningError(""), "guest agent does not seem to be running; port forwards will not work")
+	assert.Error(t, guestAgentNotRunningError("s6-svscan"), `guest agent not running; dynamic port forwarding disabled — init system "s6-svscan" not supported`)
+}
@@ -0,0 +1,69 @@
+package hostagent
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/go-units"
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+)
+
+// filesystemUsageWarnPercent is the usage of a guest filesystem that triggers a warning.
+const filesystemUsageWarnPercent = 90
+
+// watchFilesystemUsage periodically queries the filesystem usage of the guest, and warns when a filesystem is getting full.
+func (a *HostAgent) watchFilesystemUsage(ctx context.Context) {
+	interval, err := limayaml.ParseMetricsInterval(*a.y.GuestAgent.MetricsInterval)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to parse `guestAgent.metricsInterval`")
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	select {
+	case <-ctx.Done():
+		return
+	case <-a.guestAgentAliveCh:
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	warned := make(map[string]bool)
+	for {
+		if client, err := a.getOrCreateClient(ctx); err != nil {
+			logrus.WithError(err).Debug("failed to create the guest agent client")
+		} else if stats, err := client.Stats(ctx); err != nil {
+			logrus.WithError(err).Debug("failed to get the filesystem usage from the guest agent")
+		} else {
+			warnFilesystemUsage(stats.Filesystems, warned)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// warnFilesystemUsage warns when a filesystem crosses filesystemUsageWarnPercent.
+// warned records the filesystems that have been already warned, so that the warning is not repeated on every query.
+func warnFilesystemUsage(filesystems []*guestagentapi.FilesystemUsage, warned map[string]bool) {
+	for _, fs := range filesystems {
+		if fs.Total == 0 {
+			continue
+		}
+		percent := float64(fs.Used) * 100 / float64(fs.Total)
+		if percent < filesystemUsageWarnPercent {
+			delete(warned, fs.MountPoint)
+			continue
+		}
+		if warned[fs.MountPoint] {
+			continue
+		}
+		logrus.Warnf("The guest filesystem %q is %.0f%% full (%s of %s used)", fs.MountPoint, percent,
+			units.BytesSize(float64(fs.Used)), units.BytesSize(float64(fs.Total)))
+		warned[fs.MountPoint] = true
+	}
+}
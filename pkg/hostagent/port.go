@@ -2,10 +2,19 @@ package hostagent
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/lima-vm/lima/pkg/guestagent/api"
+	hostagentapi "github.com/lima-vm/lima/pkg/hostagent/api"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/networks/usernet"
+	"github.com/lima-vm/lima/pkg/portfwd"
 	"github.com/lima-vm/sshocker/pkg/ssh"
 	"github.com/sirupsen/logrus"
 )
@@ -13,8 +22,24 @@ import (
 type portForwarder struct {
 	sshConfig   *ssh.SSHConfig
 	sshHostPort int
-	rules       []limayaml.PortForward
 	vmType      limayaml.VMType
+
+	// eventMu serializes the events and the reloads
+	eventMu    sync.Mutex
+	rules      []limayaml.PortForward
+	guestPorts map[string]*api.IPPort // keyed by guestPortKey
+	eventCtx   context.Context        // the context of the latest event
+
+	// dialTunnel opens a tunnel to the guest agent for relaying UDP datagrams.
+	dialTunnel portfwd.DialFunc
+	// usernet is set when the instance is attached to a usernet network,
+	// which forwards the UDP ports bound to the unspecified address by itself.
+	usernet    *usernet.Client
+	usernetMAC string
+
+	forwardedMu  sync.Mutex
+	forwarded    map[string]struct{}     // keyed by the host address
+	forwardedUDP map[string]func() error // keyed by the host address, the values stop forwarding
 }
 
 const sshGuestPort = 22
@@ -25,8 +50,12 @@ func newPortForwarder(sshConfig *ssh.SSHConfig, sshHostPort int, rules []limayam
 	return &portForwarder{
 		sshConfig:   sshConfig,
 		sshHostPort: sshHostPort,
-		rules:       rules,
 		vmType:      vmType,
+		rules:       rules,
+		guestPorts:  make(map[string]*api.IPPort),
+		forwarded:   make(map[string]struct{}),
+
+		forwardedUDP: make(map[string]func() error),
 	}
 }
 
@@ -44,12 +73,17 @@ func hostAddress(rule limayaml.PortForward, guest *api.IPPort) string {
 	return host.HostString()
 }
 
-func (pf *portForwarder) forwardingAddresses(guest *api.IPPort) (hostAddr, guestAddr string) {
+// forwardingAddresses returns the host address of the first rule matching the guest port,
+// or an empty hostAddr when the port is not forwarded.
+func forwardingAddresses(rules []limayaml.PortForward, guest *api.IPPort) (hostAddr, guestAddr string) {
 	guestIP := net.ParseIP(guest.Ip)
-	for _, rule := range pf.rules {
+	for _, rule := range rules {
 		if rule.GuestSocket != "" {
 			continue
 		}
+		if rule.Proto != limayaml.ProtoAny && rule.Proto != guest.Proto() {
+			continue
+		}
 		if guest.Port < int32(rule.GuestPortRange[0]) || guest.Port > int32(rule.GuestPortRange[1]) {
 			continue
 		}
@@ -74,26 +108,239 @@ func (pf *portForwarder) forwardingAddresses(guest *api.IPPort) (hostAddr, guest
 	return "", guest.HostString()
 }
 
+func guestPortKey(guest *api.IPPort) string {
+	return guest.Proto() + "/" + guest.HostString()
+}
+
 func (pf *portForwarder) OnEvent(ctx context.Context, ev *api.Event) {
+	pf.eventMu.Lock()
+	defer pf.eventMu.Unlock()
+	pf.eventCtx = ctx
 	for _, f := range ev.LocalPortsRemoved {
-		local, remote := pf.forwardingAddresses(f)
+		delete(pf.guestPorts, guestPortKey(f))
+		local, remote := forwardingAddresses(pf.rules, f)
 		if local == "" {
 			continue
 		}
-		logrus.Infof("Stopping forwarding TCP from %s to %s", remote, local)
-		if err := forwardTCP(ctx, pf.sshConfig, pf.sshHostPort, local, remote, verbCancel); err != nil {
-			logrus.WithError(err).Warnf("failed to stop forwarding tcp port %d", f.Port)
-		}
+		pf.stopForwarding(ctx, f, local, remote)
 	}
 	for _, f := range ev.LocalPortsAdded {
-		local, remote := pf.forwardingAddresses(f)
+		pf.guestPorts[guestPortKey(f)] = f
+		local, remote := forwardingAddresses(pf.rules, f)
+		if local == "" {
+			if f.Proto() == limayaml.UDP {
+				logrus.Debugf("Not forwarding UDP %s", remote)
+			} else {
+				logrus.Infof("Not forwarding TCP %s", remote)
+			}
+			continue
+		}
+		pf.startForwarding(ctx, f, local, remote)
+	}
+}
+
+// forwardChange is the change of the host address of a guest port.
+// oldLocal or newLocal is empty when the port is not forwarded before or after the change.
+type forwardChange struct {
+	guest              *api.IPPort
+	oldLocal, newLocal string
+	remote             string
+}
+
+// forwardChanges returns the changes of the forwarding of the guest ports, when the rules are replaced
+// from oldRules to newRules. The guest ports whose host address is not changed are omitted.
+// The changes are sorted by guestPortKey.
+func forwardChanges(guestPorts map[string]*api.IPPort, oldRules, newRules []limayaml.PortForward) []forwardChange {
+	keys := make([]string, 0, len(guestPorts))
+	for k := range guestPorts {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var res []forwardChange
+	for _, k := range keys {
+		f := guestPorts[k]
+		oldLocal, remote := forwardingAddresses(oldRules, f)
+		newLocal, _ := forwardingAddresses(newRules, f)
+		if oldLocal != newLocal {
+			res = append(res, forwardChange{guest: f, oldLocal: oldLocal, newLocal: newLocal, remote: remote})
+		}
+	}
+	return res
+}
+
+// reload replaces the rules, and updates the forwarding of the guest ports whose host address was changed.
+// The other forwards are kept, along with the connections being served by them.
+// reload returns the number of the guest ports whose forwarding was changed.
+func (pf *portForwarder) reload(rules []limayaml.PortForward) int {
+	pf.eventMu.Lock()
+	defer pf.eventMu.Unlock()
+	changes := forwardChanges(pf.guestPorts, pf.rules, rules)
+	pf.rules = rules
+	for _, c := range changes {
+		if c.oldLocal != "" {
+			pf.stopForwarding(pf.eventCtx, c.guest, c.oldLocal, c.remote)
+		}
+		if c.newLocal != "" {
+			pf.startForwarding(pf.eventCtx, c.guest, c.newLocal, c.remote)
+		}
+	}
+	return len(changes)
+}
+
+// reforwardTCP sets up the forwarding of the TCP ports again, e.g., after the SSH master was re-established.
+func (pf *portForwarder) reforwardTCP(ctx context.Context) {
+	pf.eventMu.Lock()
+	defer pf.eventMu.Unlock()
+	for _, f := range pf.guestPorts {
+		if f.Proto() == limayaml.UDP {
+			continue
+		}
+		local, remote := forwardingAddresses(pf.rules, f)
 		if local == "" {
-			logrus.Infof("Not forwarding TCP %s", remote)
 			continue
 		}
-		logrus.Infof("Forwarding TCP from %s to %s", remote, local)
-		if err := forwardTCP(ctx, pf.sshConfig, pf.sshHostPort, local, remote, verbForward); err != nil {
-			logrus.WithError(err).Warnf("failed to set up forwarding tcp port %d (negligible if already forwarded)", f.Port)
+		pf.startForwarding(ctx, f, local, remote)
+	}
+}
+
+// socketRules returns the rules for forwarding the guest sockets.
+func (pf *portForwarder) socketRules() []limayaml.PortForward {
+	pf.eventMu.Lock()
+	defer pf.eventMu.Unlock()
+	var res []limayaml.PortForward
+	for _, rule := range pf.rules {
+		if rule.GuestSocket != "" {
+			res = append(res, rule)
 		}
 	}
+	return res
+}
+
+// forwards returns the guest ports and sockets currently forwarded.
+func (pf *portForwarder) forwards() []hostagentapi.PortForward {
+	pf.eventMu.Lock()
+	defer pf.eventMu.Unlock()
+	var res []hostagentapi.PortForward
+	for _, f := range pf.guestPorts {
+		local, remote := forwardingAddresses(pf.rules, f)
+		if local == "" {
+			continue
+		}
+		res = append(res, hostagentapi.PortForward{Protocol: f.Proto(), GuestAddress: remote, HostAddress: local})
+	}
+	for _, rule := range pf.rules {
+		if rule.GuestSocket == "" {
+			continue
+		}
+		res = append(res, hostagentapi.PortForward{
+			Protocol:     "unix",
+			GuestAddress: rule.GuestSocket,
+			HostAddress:  hostAddress(rule, &api.IPPort{}),
+			Reverse:      rule.Reverse,
+		})
+	}
+	slices.SortFunc(res, func(a, b hostagentapi.PortForward) int {
+		return strings.Compare(a.HostAddress, b.HostAddress)
+	})
+	return res
+}
+
+func (pf *portForwarder) startForwarding(ctx context.Context, f *api.IPPort, local, remote string) {
+	if f.Proto() == limayaml.UDP {
+		logrus.Infof("Forwarding UDP from %s to %s", remote, local)
+		if err := pf.forwardUDP(ctx, f, local, remote); err != nil {
+			logrus.WithError(err).Warnf("failed to set up forwarding udp port %d", f.Port)
+		}
+		return
+	}
+	logrus.Infof("Forwarding TCP from %s to %s", remote, local)
+	if err := forwardTCP(ctx, pf.sshConfig, pf.sshHostPort, local, remote, verbForward); err != nil {
+		logrus.WithError(err).Warnf("failed to set up forwarding tcp port %d (negligible if already forwarded)", f.Port)
+	}
+	pf.forwardedMu.Lock()
+	pf.forwarded[local] = struct{}{}
+	pf.forwardedMu.Unlock()
+}
+
+func (pf *portForwarder) stopForwarding(ctx context.Context, f *api.IPPort, local, remote string) {
+	if f.Proto() == limayaml.UDP {
+		logrus.Infof("Stopping forwarding UDP from %s to %s", remote, local)
+		if err := pf.stopForwardingUDP(local); err != nil {
+			logrus.WithError(err).Warnf("failed to stop forwarding udp port %d", f.Port)
+		}
+		return
+	}
+	logrus.Infof("Stopping forwarding TCP from %s to %s", remote, local)
+	if err := forwardTCP(ctx, pf.sshConfig, pf.sshHostPort, local, remote, verbCancel); err != nil {
+		logrus.WithError(err).Warnf("failed to stop forwarding tcp port %d", f.Port)
+	}
+	pf.forwardedMu.Lock()
+	delete(pf.forwarded, local)
+	pf.forwardedMu.Unlock()
+}
+
+// forwardUDP starts forwarding the UDP port local of the host to the UDP address remote of the guest.
+// The ports bound to the unspecified address are forwarded by usernet when available,
+// and the datagrams are relayed through the guest agent otherwise.
+func (pf *portForwarder) forwardUDP(ctx context.Context, guest *api.IPPort, local, remote string) error {
+	pf.forwardedMu.Lock()
+	_, ok := pf.forwardedUDP[local]
+	pf.forwardedMu.Unlock()
+	if ok {
+		return fmt.Errorf("%s is already forwarded", local)
+	}
+	var stop func() error
+	if pf.usernet != nil && net.ParseIP(guest.Ip).IsUnspecified() {
+		ip, err := pf.usernet.ResolveIPAddress(ctx, pf.usernetMAC)
+		if err != nil {
+			return err
+		}
+		if err := pf.usernet.ExposeUDP(local, net.JoinHostPort(ip, strconv.Itoa(int(guest.Port)))); err != nil {
+			return err
+		}
+		stop = func() error {
+			return pf.usernet.UnExposeUDP(local)
+		}
+	} else {
+		if pf.dialTunnel == nil {
+			return errors.New("the guest agent tunnel is not available")
+		}
+		conn, err := net.ListenPacket("udp", local)
+		if err != nil {
+			return err
+		}
+		fwdCtx, cancel := context.WithCancel(ctx)
+		fwd := portfwd.NewUDPForwarder(conn, remote, pf.dialTunnel, portfwd.DefaultUDPIdleTimeout)
+		go func() {
+			if err := fwd.Serve(fwdCtx); err != nil {
+				logrus.WithError(err).Warnf("failed to forward UDP from %s to %s", remote, local)
+			}
+		}()
+		stop = func() error {
+			cancel()
+			return nil
+		}
+	}
+	pf.forwardedMu.Lock()
+	pf.forwardedUDP[local] = stop
+	pf.forwardedMu.Unlock()
+	return nil
+}
+
+func (pf *portForwarder) stopForwardingUDP(local string) error {
+	pf.forwardedMu.Lock()
+	stop, ok := pf.forwardedUDP[local]
+	delete(pf.forwardedUDP, local)
+	pf.forwardedMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return stop()
+}
+
+// numForwarded returns the number of the TCP and UDP ports currently forwarded from the guest.
+func (pf *portForwarder) numForwarded() int {
+	pf.forwardedMu.Lock()
+	defer pf.forwardedMu.Unlock()
+	return len(pf.forwarded) + len(pf.forwardedUDP)
 }
@@ -0,0 +1,88 @@
+package hostagent
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+func TestForwardChanges(t *testing.T) {
+	rule := func(guestPort, hostPort int, hostIP string) limayaml.PortForward {
+		r := limayaml.PortForward{GuestPort: guestPort, HostPort: hostPort, HostIP: net.ParseIP(hostIP)}
+		limayaml.FillPortForwardDefaults(&r, "")
+		return r
+	}
+	ignore := limayaml.PortForward{GuestPort: 8080, Ignore: true}
+	limayaml.FillPortForwardDefaults(&ignore, "")
+	// the default rule forwards all the ports of 127.0.0.1 to the same ports
+	defaultRule := rule(0, 0, "127.0.0.1")
+
+	guestPorts := map[string]*api.IPPort{}
+	for _, port := range []int32{80, 8080} {
+		p := &api.IPPort{Ip: "127.0.0.1", Port: port, Protocol: "tcp"}
+		guestPorts[guestPortKey(p)] = p
+	}
+
+	testCases := []struct {
+		name     string
+		oldRules []limayaml.PortForward
+		newRules []limayaml.PortForward
+		// "GUEST: OLD -> NEW", with the empty host address for the port not forwarded
+		expected []string
+	}{
+		{
+			name:     "unchanged rules keep the forwards",
+			oldRules: []limayaml.PortForward{rule(80, 10080, ""), defaultRule},
+			newRules: []limayaml.PortForward{rule(80, 10080, ""), defaultRule},
+		},
+		{
+			name:     "added rule",
+			oldRules: []limayaml.PortForward{defaultRule},
+			newRules: []limayaml.PortForward{rule(80, 10080, ""), defaultRule},
+			expected: []string{"127.0.0.1:80: 127.0.0.1:80 -> 127.0.0.1:10080"},
+		},
+		{
+			name:     "removed rule",
+			oldRules: []limayaml.PortForward{rule(80, 10080, ""), defaultRule},
+			newRules: []limayaml.PortForward{defaultRule},
+			expected: []string{"127.0.0.1:80: 127.0.0.1:10080 -> 127.0.0.1:80"},
+		},
+		{
+			name:     "removed rule without the default rule",
+			oldRules: []limayaml.PortForward{rule(8080, 18080, "")},
+			newRules: nil,
+			expected: []string{"127.0.0.1:8080: 127.0.0.1:18080 -> "},
+		},
+		{
+			name:     "changed HostIP",
+			oldRules: []limayaml.PortForward{rule(80, 10080, "127.0.0.1"), defaultRule},
+			newRules: []limayaml.PortForward{rule(80, 10080, "0.0.0.0"), defaultRule},
+			expected: []string{"127.0.0.1:80: 127.0.0.1:10080 -> 0.0.0.0:10080"},
+		},
+		{
+			name:     "the first matching rule wins",
+			oldRules: []limayaml.PortForward{rule(80, 10080, ""), rule(80, 20080, ""), defaultRule},
+			newRules: []limayaml.PortForward{rule(80, 20080, ""), rule(80, 10080, ""), defaultRule},
+			expected: []string{"127.0.0.1:80: 127.0.0.1:10080 -> 127.0.0.1:20080"},
+		},
+		{
+			name:     "ignore rule moved before the forwarding rule",
+			oldRules: []limayaml.PortForward{defaultRule, ignore},
+			newRules: []limayaml.PortForward{ignore, defaultRule},
+			expected: []string{"127.0.0.1:8080: 127.0.0.1:8080 -> "},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var actual []string
+			for _, c := range forwardChanges(guestPorts, tc.oldRules, tc.newRules) {
+				actual = append(actual, fmt.Sprintf("%s: %s -> %s", c.remote, c.oldLocal, c.newLocal))
+			}
+			assert.DeepEqual(t, tc.expected, actual)
+		})
+	}
+}
@@ -18,8 +18,12 @@ func (a *HostAgent) waitForRequirements(label string, requirements []requirement
 	var errs []error
 
 	for i, req := range requirements {
+		var deadline time.Time
+		if req.timeout > 0 {
+			deadline = time.Now().Add(req.timeout)
+		}
 	retryLoop:
-		for j := 0; j < retries; j++ {
+		for j := 0; ; j++ {
 			logrus.Infof("Waiting for the %s requirement %d of %d: %q", label, i+1, len(requirements), req.description)
 			err := a.waitForRequirement(req)
 			if err == nil {
@@ -31,11 +35,16 @@ func (a *HostAgent) waitForRequirements(label string, requirements []requirement
 				errs = append(errs, fmt.Errorf("failed to satisfy the %s requirement %d of %d %q: %s; skipping further checks: %w", label, i+1, len(requirements), req.description, req.debugHint, err))
 				return errors.Join(errs...)
 			}
-			if j == retries-1 {
+			if !deadline.IsZero() && time.Now().Add(sleepDuration).After(deadline) {
+				errs = append(errs, fmt.Errorf("timed out after %v (%s) while waiting for the %s requirement %d of %d %q: %s: %w",
+					req.timeout, req.timeoutField, label, i+1, len(requirements), req.description, req.debugHint, err))
+				break retryLoop
+			}
+			if deadline.IsZero() && j == retries-1 {
 				errs = append(errs, fmt.Errorf("failed to satisfy the %s requirement %d of %d %q: %s: %w", label, i+1, len(requirements), req.description, req.debugHint, err))
 				break retryLoop
 			}
-			time.Sleep(10 * time.Second)
+			time.Sleep(sleepDuration)
 		}
 	}
 	return errors.Join(errs...)
@@ -56,9 +65,16 @@ type requirement struct {
 	script      string
 	debugHint   string
 	fatal       bool
+	// timeout overrides the default retries, and timeoutField is the YAML field of timeout
+	timeout      time.Duration
+	timeoutField string
 }
 
 func (a *HostAgent) essentialRequirements() []requirement {
+	bootTimeout, err := limayaml.ParseBootTimeout(*a.y.Boot.Timeout)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to parse `boot.timeout`, falling back to the default retries")
+	}
 	req := make([]requirement, 0)
 	req = append(req,
 		requirement{
@@ -69,7 +85,10 @@ true
 			debugHint: `Failed to SSH into the guest.
 Make sure that the YAML field "ssh.localPort" is not used by other processes on the host.
 If any private key under ~/.ssh is protected with a passphrase, you need to have ssh-agent to be running.
+Run "limactl logs --source serial" to see the console output of the guest.
 `,
+			timeout:      bootTimeout,
+			timeoutField: "field `boot.timeout`",
 		})
 	if *a.y.Plain {
 		return req
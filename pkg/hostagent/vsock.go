@@ -0,0 +1,37 @@
+package hostagent
+
+import (
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+)
+
+// guestAgentVSockPortDefault is the vsock port of the guest agent, unless the port is allocated dynamically.
+const guestAgentVSockPortDefault = 2222
+
+// vsockSupporter is the subset of driver.Driver used by guestAgentVSockPort.
+type vsockSupporter interface {
+	SupportsVSock() bool
+}
+
+// guestAgentVSockPort returns the vsock port for the guest agent,
+// or 0 when the guest agent socket has to be forwarded over ssh.
+//
+// vsock is preferred when the driver supports it, as it does not depend on the ssh connection.
+// WSL2 requires a free port allocated by freeVSockPort, as the port space is shared by the VMs.
+func guestAgentVSockPort(d vsockSupporter, vmType limayaml.VMType, freeVSockPort func() (int, error)) int {
+	if !d.SupportsVSock() {
+		logrus.Info("Connecting to the guest agent via the socket forwarded over ssh")
+		return 0
+	}
+	port := guestAgentVSockPortDefault
+	if vmType == limayaml.WSL2 {
+		var err error
+		port, err = freeVSockPort()
+		if err != nil || port == 0 {
+			logrus.WithError(err).Warn("failed to get a free vsock port, falling back to the socket forwarded over ssh")
+			return 0
+		}
+	}
+	logrus.Infof("Connecting to the guest agent via vsock port %d", port)
+	return port
+}
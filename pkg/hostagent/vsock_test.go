@@ -0,0 +1,26 @@
+package hostagent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+type fakeVSockDriver bool
+
+func (d fakeVSockDriver) SupportsVSock() bool {
+	return bool(d)
+}
+
+func TestGuestAgentVSockPort(t *testing.T) {
+	freePort := func() (int, error) { return 12345, nil }
+	noFreePort := func() (int, error) { return 0, errors.New("no free port") }
+
+	assert.Equal(t, guestAgentVSockPort(fakeVSockDriver(false), limayaml.QEMU, freePort), 0)
+	assert.Equal(t, guestAgentVSockPort(fakeVSockDriver(true), limayaml.QEMU, freePort), 2222)
+	assert.Equal(t, guestAgentVSockPort(fakeVSockDriver(true), limayaml.VZ, freePort), 2222)
+	assert.Equal(t, guestAgentVSockPort(fakeVSockDriver(true), limayaml.WSL2, freePort), 12345)
+	assert.Equal(t, guestAgentVSockPort(fakeVSockDriver(true), limayaml.WSL2, noFreePort), 0)
+}
@@ -1,9 +1,11 @@
 package ioutilx
 
 import (
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os/exec"
 	"strings"
 
@@ -13,6 +15,8 @@ import (
 )
 
 // ReadAtMaximum reads n at maximum.
+//
+// When the limit is exceeded, the error contains the content type sniffed from the bytes read so far.
 func ReadAtMaximum(r io.Reader, n int64) ([]byte, error) {
 	lr := &io.LimitedReader{
 		R: r,
@@ -21,12 +25,41 @@ func ReadAtMaximum(r io.Reader, n int64) ([]byte, error) {
 	b, err := io.ReadAll(lr)
 	if err != nil {
 		if errors.Is(err, io.EOF) && lr.N <= 0 {
-			err = fmt.Errorf("exceeded the limit (%d bytes): %w", n, err)
+			err = fmt.Errorf("exceeded the limit (%d bytes, content type %q): %w", n, http.DetectContentType(b), err)
 		}
 	}
 	return b, err
 }
 
+// ReadGzipAtMaximum decompresses the gzip stream r, reading compressedN bytes from r at maximum,
+// and returning n decompressed bytes at maximum.
+//
+// The limit of the decompressed bytes prevents a small stream from being expanded unboundedly.
+func ReadGzipAtMaximum(r io.Reader, compressedN, n int64) ([]byte, error) {
+	lr := &io.LimitedReader{
+		R: r,
+		N: compressedN,
+	}
+	zr, err := gzip.NewReader(lr)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	// read one more byte to detect exceeding the limit
+	b, err := io.ReadAll(io.LimitReader(zr, n+1))
+	if err != nil {
+		if lr.N <= 0 {
+			// the compressed stream was truncated at the limit
+			err = fmt.Errorf("exceeded the limit of the compressed stream (%d bytes): %w", compressedN, err)
+		}
+		return nil, err
+	}
+	if int64(len(b)) > n {
+		return nil, fmt.Errorf("exceeded the limit of the decompressed stream (%d bytes)", n)
+	}
+	return b, nil
+}
+
 // FromUTF16le returns an io.Reader for UTF16le data.
 // Windows uses little endian by default, use unicode.UseBOM policy to retrieve BOM from the text,
 // and unicode.LittleEndian as a fallback.
@@ -0,0 +1,36 @@
+package ioutilx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func gzipBytes(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(s))
+	assert.NilError(t, err)
+	assert.NilError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestReadGzipAtMaximum(t *testing.T) {
+	b, err := ReadGzipAtMaximum(bytes.NewReader(gzipBytes(t, "cpus: 2\n")), 1024, 1024)
+	assert.NilError(t, err)
+	assert.Equal(t, "cpus: 2\n", string(b))
+
+	// highly compressible content exceeding the decompressed limit
+	z := gzipBytes(t, strings.Repeat("a", 1024*1024))
+	_, err = ReadGzipAtMaximum(bytes.NewReader(z), 1024*1024, 1024)
+	assert.ErrorContains(t, err, "exceeded the limit of the decompressed stream (1024 bytes)")
+
+	_, err = ReadGzipAtMaximum(bytes.NewReader(z), 16, 1024*1024)
+	assert.ErrorContains(t, err, "exceeded the limit of the compressed stream (16 bytes)")
+
+	_, err = ReadGzipAtMaximum(strings.NewReader("cpus: 2\nmemory: 4GiB\n"), 1024, 1024)
+	assert.ErrorContains(t, err, "invalid header")
+}
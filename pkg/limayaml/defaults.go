@@ -3,6 +3,7 @@ package limayaml
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"net"
 	"os"
@@ -152,6 +153,18 @@ func defaultDiskSizeAsString() string {
 	return "100GiB"
 }
 
+// defaultAudioOutput returns the default QEMU audiodev backend of the host OS.
+func defaultAudioOutput() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "coreaudio"
+	case "linux":
+		return "pa"
+	default:
+		return "none"
+	}
+}
+
 func defaultGuestInstallPrefix() string {
 	return "/usr/local"
 }
@@ -159,7 +172,7 @@ func defaultGuestInstallPrefix() string {
 // FillDefault updates undefined fields in y with defaults from d (or built-in default), and overwrites with values from o.
 // Both d and o may be empty.
 //
-// Maps (`Env`) are being merged: first populated from d, overwritten by y, and again overwritten by o.
+// Maps (`Env`, `Shell.Env`) are being merged: first populated from d, overwritten by y, and again overwritten by o.
 // Slices (e.g. `Mounts`, `Provision`) are appended, starting with o, followed by y, and finally d. This
 // makes sure o takes priority over y over d, in cases it matters (e.g. `PortForwards`, where the first
 // matching rule terminates the search).
@@ -169,7 +182,11 @@ func defaultGuestInstallPrefix() string {
 //     the highest priority Writable setting wins.
 //   - Networks are appended in d, y, o order
 //   - DNS are picked from the highest priority where DNS is not empty.
+//   - Accel is picked from the highest priority where Accel is not empty.
 //   - CACertificates Files and Certs are uniquely appended in d, y, o order
+//   - SSH AuthorizedKeys are uniquely appended in d, y, o order
+//   - SSH PortRange is picked from the highest priority where PortRange is not empty.
+//   - QEMU VFIO devices are uniquely appended in d, y, o order
 func FillDefault(y, d, o *LimaYAML, filePath string) {
 	instDir := filepath.Dir(filePath)
 	if y.VMType == nil {
@@ -242,6 +259,46 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.CPUs = ptr.Of(defaultCPUs())
 	}
 
+	if y.CPUTopology.Sockets == nil {
+		y.CPUTopology.Sockets = d.CPUTopology.Sockets
+	}
+	if o.CPUTopology.Sockets != nil {
+		y.CPUTopology.Sockets = o.CPUTopology.Sockets
+	}
+	if y.CPUTopology.Cores == nil {
+		y.CPUTopology.Cores = d.CPUTopology.Cores
+	}
+	if o.CPUTopology.Cores != nil {
+		y.CPUTopology.Cores = o.CPUTopology.Cores
+	}
+	if y.CPUTopology.Threads == nil {
+		y.CPUTopology.Threads = d.CPUTopology.Threads
+	}
+	if o.CPUTopology.Threads != nil {
+		y.CPUTopology.Threads = o.CPUTopology.Threads
+	}
+	// The topology is left unset unless any of the fields is specified
+	if y.CPUTopology.Sockets != nil || y.CPUTopology.Cores != nil || y.CPUTopology.Threads != nil {
+		if y.CPUTopology.Sockets == nil {
+			y.CPUTopology.Sockets = ptr.Of(1)
+		}
+		if y.CPUTopology.Threads == nil {
+			y.CPUTopology.Threads = ptr.Of(1)
+		}
+		sockets, threads := *y.CPUTopology.Sockets, *y.CPUTopology.Threads
+		if y.CPUTopology.Cores == nil && sockets > 0 && threads > 0 {
+			y.CPUTopology.Cores = ptr.Of(max(1, *y.CPUs/(sockets*threads)))
+		}
+	}
+
+	// Note: NUMA lists are not combined
+	if len(y.NUMA) == 0 {
+		y.NUMA = d.NUMA
+	}
+	if len(o.NUMA) > 0 {
+		y.NUMA = o.NUMA
+	}
+
 	if y.Memory == nil {
 		y.Memory = d.Memory
 	}
@@ -252,6 +309,16 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.Memory = ptr.Of(defaultMemoryAsString())
 	}
 
+	if y.MemoryBalloon.Enabled == nil {
+		y.MemoryBalloon.Enabled = d.MemoryBalloon.Enabled
+	}
+	if o.MemoryBalloon.Enabled != nil {
+		y.MemoryBalloon.Enabled = o.MemoryBalloon.Enabled
+	}
+	if y.MemoryBalloon.Enabled == nil {
+		y.MemoryBalloon.Enabled = ptr.Of(false)
+	}
+
 	if y.Disk == nil {
 		y.Disk = d.Disk
 	}
@@ -262,8 +329,125 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.Disk = ptr.Of(defaultDiskSizeAsString())
 	}
 
+	if y.DiskFormat == nil {
+		y.DiskFormat = d.DiskFormat
+	}
+	if o.DiskFormat != nil {
+		y.DiskFormat = o.DiskFormat
+	}
+	if y.DiskFormat == nil || *y.DiskFormat == "" {
+		// vz only supports raw disks
+		if *y.VMType == VZ {
+			y.DiskFormat = ptr.Of(DiskFormatRaw)
+		} else {
+			y.DiskFormat = ptr.Of(DiskFormatQcow2)
+		}
+	}
+
+	if y.DiskOptions.CacheMode == nil {
+		y.DiskOptions.CacheMode = d.DiskOptions.CacheMode
+	}
+	if o.DiskOptions.CacheMode != nil {
+		y.DiskOptions.CacheMode = o.DiskOptions.CacheMode
+	}
+	if y.DiskOptions.CacheMode == nil {
+		y.DiskOptions.CacheMode = ptr.Of("")
+	}
+
+	if y.DiskOptions.AIO == nil {
+		y.DiskOptions.AIO = d.DiskOptions.AIO
+	}
+	if o.DiskOptions.AIO != nil {
+		y.DiskOptions.AIO = o.DiskOptions.AIO
+	}
+	if y.DiskOptions.AIO == nil {
+		y.DiskOptions.AIO = ptr.Of("")
+	}
+
+	if y.DiskOptions.Discard == nil {
+		y.DiskOptions.Discard = d.DiskOptions.Discard
+	}
+	if o.DiskOptions.Discard != nil {
+		y.DiskOptions.Discard = o.DiskOptions.Discard
+	}
+	if y.DiskOptions.Discard == nil {
+		y.DiskOptions.Discard = ptr.Of(false)
+	}
+
+	if y.DiskOptions.Ephemeral == nil {
+		y.DiskOptions.Ephemeral = d.DiskOptions.Ephemeral
+	}
+	if o.DiskOptions.Ephemeral != nil {
+		y.DiskOptions.Ephemeral = o.DiskOptions.Ephemeral
+	}
+	if y.DiskOptions.Ephemeral == nil {
+		y.DiskOptions.Ephemeral = ptr.Of(false)
+	}
+
+	if y.DiskOptions.Throttle.IOPS == nil {
+		y.DiskOptions.Throttle.IOPS = d.DiskOptions.Throttle.IOPS
+	}
+	if o.DiskOptions.Throttle.IOPS != nil {
+		y.DiskOptions.Throttle.IOPS = o.DiskOptions.Throttle.IOPS
+	}
+	if y.DiskOptions.Throttle.IOPS == nil {
+		y.DiskOptions.Throttle.IOPS = ptr.Of(int64(0))
+	}
+
+	if y.DiskOptions.Throttle.ReadIOPS == nil {
+		y.DiskOptions.Throttle.ReadIOPS = d.DiskOptions.Throttle.ReadIOPS
+	}
+	if o.DiskOptions.Throttle.ReadIOPS != nil {
+		y.DiskOptions.Throttle.ReadIOPS = o.DiskOptions.Throttle.ReadIOPS
+	}
+	if y.DiskOptions.Throttle.ReadIOPS == nil {
+		y.DiskOptions.Throttle.ReadIOPS = ptr.Of(int64(0))
+	}
+
+	if y.DiskOptions.Throttle.WriteIOPS == nil {
+		y.DiskOptions.Throttle.WriteIOPS = d.DiskOptions.Throttle.WriteIOPS
+	}
+	if o.DiskOptions.Throttle.WriteIOPS != nil {
+		y.DiskOptions.Throttle.WriteIOPS = o.DiskOptions.Throttle.WriteIOPS
+	}
+	if y.DiskOptions.Throttle.WriteIOPS == nil {
+		y.DiskOptions.Throttle.WriteIOPS = ptr.Of(int64(0))
+	}
+
+	if y.DiskOptions.Throttle.BPS == nil {
+		y.DiskOptions.Throttle.BPS = d.DiskOptions.Throttle.BPS
+	}
+	if o.DiskOptions.Throttle.BPS != nil {
+		y.DiskOptions.Throttle.BPS = o.DiskOptions.Throttle.BPS
+	}
+	if y.DiskOptions.Throttle.BPS == nil {
+		y.DiskOptions.Throttle.BPS = ptr.Of("0")
+	}
+
+	if y.DiskOptions.Throttle.ReadBPS == nil {
+		y.DiskOptions.Throttle.ReadBPS = d.DiskOptions.Throttle.ReadBPS
+	}
+	if o.DiskOptions.Throttle.ReadBPS != nil {
+		y.DiskOptions.Throttle.ReadBPS = o.DiskOptions.Throttle.ReadBPS
+	}
+	if y.DiskOptions.Throttle.ReadBPS == nil {
+		y.DiskOptions.Throttle.ReadBPS = ptr.Of("0")
+	}
+
+	if y.DiskOptions.Throttle.WriteBPS == nil {
+		y.DiskOptions.Throttle.WriteBPS = d.DiskOptions.Throttle.WriteBPS
+	}
+	if o.DiskOptions.Throttle.WriteBPS != nil {
+		y.DiskOptions.Throttle.WriteBPS = o.DiskOptions.Throttle.WriteBPS
+	}
+	if y.DiskOptions.Throttle.WriteBPS == nil {
+		y.DiskOptions.Throttle.WriteBPS = ptr.Of("0")
+	}
+
 	y.AdditionalDisks = append(append(o.AdditionalDisks, y.AdditionalDisks...), d.AdditionalDisks...)
 
+	y.USBDevices = append(append(o.USBDevices, y.USBDevices...), d.USBDevices...)
+
 	if y.Audio.Device == nil {
 		y.Audio.Device = d.Audio.Device
 	}
@@ -274,6 +458,98 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.Audio.Device = ptr.Of("")
 	}
 
+	if y.Audio.Output == nil {
+		y.Audio.Output = d.Audio.Output
+	}
+	if o.Audio.Output != nil {
+		y.Audio.Output = o.Audio.Output
+	}
+	if y.Audio.Output == nil || *y.Audio.Output == "" {
+		y.Audio.Output = ptr.Of(defaultAudioOutput())
+	}
+
+	if y.TPM.Enabled == nil {
+		y.TPM.Enabled = d.TPM.Enabled
+	}
+	if o.TPM.Enabled != nil {
+		y.TPM.Enabled = o.TPM.Enabled
+	}
+	if y.TPM.Enabled == nil {
+		y.TPM.Enabled = ptr.Of(false)
+	}
+
+	if y.RNG.Enabled == nil {
+		y.RNG.Enabled = d.RNG.Enabled
+	}
+	if o.RNG.Enabled != nil {
+		y.RNG.Enabled = o.RNG.Enabled
+	}
+	if y.RNG.Enabled == nil {
+		y.RNG.Enabled = ptr.Of(true)
+	}
+
+	if y.QEMU.Binary == nil {
+		y.QEMU.Binary = d.QEMU.Binary
+	}
+	if o.QEMU.Binary != nil {
+		y.QEMU.Binary = o.QEMU.Binary
+	}
+	if y.QEMU.Binary == nil {
+		y.QEMU.Binary = ptr.Of("")
+	}
+
+	if y.QEMU.GuestAgent == nil {
+		y.QEMU.GuestAgent = d.QEMU.GuestAgent
+	}
+	if o.QEMU.GuestAgent != nil {
+		y.QEMU.GuestAgent = o.QEMU.GuestAgent
+	}
+	if y.QEMU.GuestAgent == nil {
+		y.QEMU.GuestAgent = ptr.Of(false)
+	}
+
+	if y.QEMU.Machine == nil {
+		y.QEMU.Machine = d.QEMU.Machine
+	}
+	if o.QEMU.Machine != nil {
+		y.QEMU.Machine = o.QEMU.Machine
+	}
+	if y.QEMU.Machine == nil {
+		y.QEMU.Machine = ptr.Of("")
+	}
+
+	if y.QEMU.MinimumVersion == nil {
+		y.QEMU.MinimumVersion = d.QEMU.MinimumVersion
+	}
+	if o.QEMU.MinimumVersion != nil {
+		y.QEMU.MinimumVersion = o.QEMU.MinimumVersion
+	}
+	if y.QEMU.MinimumVersion == nil {
+		y.QEMU.MinimumVersion = ptr.Of("")
+	}
+
+	if y.QEMU.VirtiofsdTimeout == nil {
+		y.QEMU.VirtiofsdTimeout = d.QEMU.VirtiofsdTimeout
+	}
+	if o.QEMU.VirtiofsdTimeout != nil {
+		y.QEMU.VirtiofsdTimeout = o.QEMU.VirtiofsdTimeout
+	}
+	if y.QEMU.VirtiofsdTimeout == nil {
+		y.QEMU.VirtiofsdTimeout = ptr.Of("30s")
+	}
+
+	if y.QEMU.HotplugPorts == nil {
+		y.QEMU.HotplugPorts = d.QEMU.HotplugPorts
+	}
+	if o.QEMU.HotplugPorts != nil {
+		y.QEMU.HotplugPorts = o.QEMU.HotplugPorts
+	}
+	if y.QEMU.HotplugPorts == nil {
+		y.QEMU.HotplugPorts = ptr.Of(0)
+	}
+
+	y.QEMU.VFIO = unique(append(append(d.QEMU.VFIO, y.QEMU.VFIO...), o.QEMU.VFIO...))
+
 	if y.Video.Display == nil {
 		y.Video.Display = d.Video.Display
 	}
@@ -294,6 +570,26 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.Video.VNC.Display = ptr.Of("127.0.0.1:0,to=9")
 	}
 
+	if y.Video.Accel == nil {
+		y.Video.Accel = d.Video.Accel
+	}
+	if o.Video.Accel != nil {
+		y.Video.Accel = o.Video.Accel
+	}
+	if y.Video.Accel == nil {
+		y.Video.Accel = ptr.Of("")
+	}
+
+	if y.Video.VRAM == nil {
+		y.Video.VRAM = d.Video.VRAM
+	}
+	if o.Video.VRAM != nil {
+		y.Video.VRAM = o.Video.VRAM
+	}
+	if y.Video.VRAM == nil {
+		y.Video.VRAM = ptr.Of("")
+	}
+
 	if y.Firmware.LegacyBIOS == nil {
 		y.Firmware.LegacyBIOS = d.Firmware.LegacyBIOS
 	}
@@ -328,10 +624,22 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 	if o.SSH.LocalPort != nil {
 		y.SSH.LocalPort = o.SSH.LocalPort
 	}
+	if len(o.SSH.PortRange) > 0 {
+		y.SSH.PortRange = o.SSH.PortRange
+	}
+	if len(y.SSH.PortRange) == 0 {
+		y.SSH.PortRange = d.SSH.PortRange
+	}
 	if y.SSH.LocalPort == nil {
-		// y.SSH.LocalPort value is not filled here (filled by the hostagent)
 		y.SSH.LocalPort = ptr.Of(0)
 	}
+	// An invalid range is rejected by Validate
+	if r := y.SSH.PortRange; *y.SSH.LocalPort == 0 && len(r) == 2 && 0 < r[0] && r[0] <= r[1] {
+		// The port is derived from the instance name, so that it does not change across loading the YAML.
+		// The conflicts are resolved on starting the instance.
+		y.SSH.LocalPort = ptr.Of(SSHPortInRange(filepath.Base(instDir), y.SSH.PortRange))
+	}
+	// Otherwise y.SSH.LocalPort value is not filled here (filled by the hostagent)
 	if y.SSH.LoadDotSSHPubKeys == nil {
 		y.SSH.LoadDotSSHPubKeys = d.SSH.LoadDotSSHPubKeys
 	}
@@ -372,6 +680,68 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.SSH.ForwardX11Trusted = ptr.Of(false)
 	}
 
+	if y.SSH.GenerateDedicatedKey == nil {
+		y.SSH.GenerateDedicatedKey = d.SSH.GenerateDedicatedKey
+	}
+	if o.SSH.GenerateDedicatedKey != nil {
+		y.SSH.GenerateDedicatedKey = o.SSH.GenerateDedicatedKey
+	}
+	if y.SSH.GenerateDedicatedKey == nil {
+		y.SSH.GenerateDedicatedKey = ptr.Of(false)
+	}
+
+	if y.SSH.ControlPersist == nil {
+		y.SSH.ControlPersist = d.SSH.ControlPersist
+	}
+	if o.SSH.ControlPersist != nil {
+		y.SSH.ControlPersist = o.SSH.ControlPersist
+	}
+	if y.SSH.ControlPersist == nil {
+		y.SSH.ControlPersist = ptr.Of("yes")
+	}
+
+	if y.SSH.ServerAliveInterval == nil {
+		y.SSH.ServerAliveInterval = d.SSH.ServerAliveInterval
+	}
+	if o.SSH.ServerAliveInterval != nil {
+		y.SSH.ServerAliveInterval = o.SSH.ServerAliveInterval
+	}
+	if y.SSH.ServerAliveInterval == nil {
+		y.SSH.ServerAliveInterval = ptr.Of(0)
+	}
+
+	if y.SSH.ServerAliveCountMax == nil {
+		y.SSH.ServerAliveCountMax = d.SSH.ServerAliveCountMax
+	}
+	if o.SSH.ServerAliveCountMax != nil {
+		y.SSH.ServerAliveCountMax = o.SSH.ServerAliveCountMax
+	}
+	if y.SSH.ServerAliveCountMax == nil {
+		y.SSH.ServerAliveCountMax = ptr.Of(3)
+	}
+
+	if y.Shell.WorkDir == nil {
+		y.Shell.WorkDir = d.Shell.WorkDir
+	}
+	if o.Shell.WorkDir != nil {
+		y.Shell.WorkDir = o.Shell.WorkDir
+	}
+	if y.Shell.WorkDir == nil {
+		y.Shell.WorkDir = ptr.Of("")
+	}
+
+	shellEnv := make(map[string]string)
+	for k, v := range d.Shell.Env {
+		shellEnv[k] = v
+	}
+	for k, v := range y.Shell.Env {
+		shellEnv[k] = v
+	}
+	for k, v := range o.Shell.Env {
+		shellEnv[k] = v
+	}
+	y.Shell.Env = shellEnv
+
 	hosts := make(map[string]string)
 	// Values can be either names or IP addresses. Name values are canonicalized in the hostResolver.
 	for k, v := range d.HostResolver.Hosts {
@@ -462,8 +832,21 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		}
 	}
 
+	if y.PortForwardOptions.DefaultBindAddress == nil {
+		y.PortForwardOptions.DefaultBindAddress = d.PortForwardOptions.DefaultBindAddress
+	}
+	if o.PortForwardOptions.DefaultBindAddress != nil {
+		y.PortForwardOptions.DefaultBindAddress = o.PortForwardOptions.DefaultBindAddress
+	}
+	if y.PortForwardOptions.DefaultBindAddress == nil {
+		y.PortForwardOptions.DefaultBindAddress = IPv4loopback1
+	}
+
 	y.PortForwards = append(append(o.PortForwards, y.PortForwards...), d.PortForwards...)
 	for i := range y.PortForwards {
+		if y.PortForwards[i].HostIP == nil {
+			y.PortForwards[i].HostIP = y.PortForwardOptions.DefaultBindAddress
+		}
 		FillPortForwardDefaults(&y.PortForwards[i], instDir)
 		// After defaults processing the singular HostPort and GuestPort values should not be used again.
 	}
@@ -604,6 +987,9 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 			if mount.MountPoint != "" {
 				mounts[i].MountPoint = mount.MountPoint
 			}
+			if mount.Tag != "" {
+				mounts[i].Tag = mount.Tag
+			}
 		} else {
 			location[mount.Location] = len(mounts)
 			mounts = append(mounts, mount)
@@ -647,6 +1033,17 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		if mount.MountPoint == "" {
 			mounts[i].MountPoint = mount.Location
 		}
+		if mount.Tag == "" {
+			mounts[i].Tag = fmt.Sprintf("mount%d", i)
+		}
+	}
+
+	// Note: Accel lists are not combined either
+	if len(y.Accel) == 0 {
+		y.Accel = d.Accel
+	}
+	if len(o.Accel) > 0 {
+		y.Accel = o.Accel
 	}
 
 	// Note: DNS lists are not combined; highest priority setting is picked
@@ -685,6 +1082,8 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 	caCerts := unique(append(append(d.CACertificates.Certs, y.CACertificates.Certs...), o.CACertificates.Certs...))
 	y.CACertificates.Certs = caCerts
 
+	y.SSH.AuthorizedKeys = unique(append(append(d.SSH.AuthorizedKeys, y.SSH.AuthorizedKeys...), o.SSH.AuthorizedKeys...))
+
 	if runtime.GOOS == "darwin" && IsNativeArch(AARCH64) {
 		if y.Rosetta.Enabled == nil {
 			y.Rosetta.Enabled = d.Rosetta.Enabled
@@ -719,6 +1118,56 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.Plain = ptr.Of(false)
 	}
 
+	if y.AutoSnapshot.BeforeEdit == nil {
+		y.AutoSnapshot.BeforeEdit = d.AutoSnapshot.BeforeEdit
+	}
+	if o.AutoSnapshot.BeforeEdit != nil {
+		y.AutoSnapshot.BeforeEdit = o.AutoSnapshot.BeforeEdit
+	}
+	if y.AutoSnapshot.BeforeEdit == nil {
+		y.AutoSnapshot.BeforeEdit = ptr.Of(false)
+	}
+
+	if y.AutoSnapshot.Keep == nil {
+		y.AutoSnapshot.Keep = d.AutoSnapshot.Keep
+	}
+	if o.AutoSnapshot.Keep != nil {
+		y.AutoSnapshot.Keep = o.AutoSnapshot.Keep
+	}
+	if y.AutoSnapshot.Keep == nil {
+		y.AutoSnapshot.Keep = ptr.Of(3)
+	}
+
+	if y.Boot.Timeout == nil {
+		y.Boot.Timeout = d.Boot.Timeout
+	}
+	if o.Boot.Timeout != nil {
+		y.Boot.Timeout = o.Boot.Timeout
+	}
+	if y.Boot.Timeout == nil {
+		y.Boot.Timeout = ptr.Of("10m")
+	}
+
+	if y.Shutdown.Timeout == nil {
+		y.Shutdown.Timeout = d.Shutdown.Timeout
+	}
+	if o.Shutdown.Timeout != nil {
+		y.Shutdown.Timeout = o.Shutdown.Timeout
+	}
+	if y.Shutdown.Timeout == nil {
+		y.Shutdown.Timeout = ptr.Of("3m")
+	}
+
+	if y.GuestAgent.MetricsInterval == nil {
+		y.GuestAgent.MetricsInterval = d.GuestAgent.MetricsInterval
+	}
+	if o.GuestAgent.MetricsInterval != nil {
+		y.GuestAgent.MetricsInterval = o.GuestAgent.MetricsInterval
+	}
+	if y.GuestAgent.MetricsInterval == nil {
+		y.GuestAgent.MetricsInterval = ptr.Of("60s")
+	}
+
 	fixUpForPlainMode(y)
 }
 
@@ -960,6 +1409,14 @@ func IsNativeArch(arch Arch) bool {
 	return nativeX8664 || nativeAARCH64 || nativeARMV7L || nativeRISCV64
 }
 
+// SSHPortInRange returns the SSH local port derived from the instance name, within `ssh.portRange`.
+// portRange must be valid, i.e., [MIN, MAX].
+func SSHPortInRange(instName string, portRange []int) int {
+	sum := sha256.Sum256([]byte(instName))
+	span := uint32(portRange[1] - portRange[0] + 1)
+	return portRange[0] + int(binary.BigEndian.Uint32(sum[:4])%span)
+}
+
 func unique(s []string) []string {
 	keys := make(map[string]bool)
 	list := []string{}
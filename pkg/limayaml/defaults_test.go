@@ -66,19 +66,61 @@ func TestFillDefault(t *testing.T) {
 		CPUs:               ptr.Of(defaultCPUs()),
 		Memory:             ptr.Of(defaultMemoryAsString()),
 		Disk:               ptr.Of(defaultDiskSizeAsString()),
+		DiskFormat:         ptr.Of(DiskFormatQcow2),
 		GuestInstallPrefix: ptr.Of(defaultGuestInstallPrefix()),
 		UpgradePackages:    ptr.Of(false),
+		DiskOptions: DiskOptions{
+			CacheMode: ptr.Of(""),
+			AIO:       ptr.Of(""),
+			Discard:   ptr.Of(false),
+			Ephemeral: ptr.Of(false),
+			Throttle: DiskThrottle{
+				IOPS:      ptr.Of(int64(0)),
+				ReadIOPS:  ptr.Of(int64(0)),
+				WriteIOPS: ptr.Of(int64(0)),
+				BPS:       ptr.Of("0"),
+				ReadBPS:   ptr.Of("0"),
+				WriteBPS:  ptr.Of("0"),
+			},
+		},
+		PortForwardOptions: PortForwardOptions{
+			DefaultBindAddress: IPv4loopback1,
+		},
+		MemoryBalloon: MemoryBalloon{
+			Enabled: ptr.Of(false),
+		},
+		TPM: TPM{
+			Enabled: ptr.Of(false),
+		},
+		RNG: RNG{
+			Enabled: ptr.Of(true),
+		},
+		QEMU: QEMUOpts{
+			Binary:           ptr.Of(""),
+			GuestAgent:       ptr.Of(false),
+			Machine:          ptr.Of(""),
+			MinimumVersion:   ptr.Of(""),
+			VirtiofsdTimeout: ptr.Of("30s"),
+			HotplugPorts:     ptr.Of(0),
+		},
 		Containerd: Containerd{
 			System:   ptr.Of(false),
 			User:     ptr.Of(true),
 			Archives: defaultContainerdArchives(),
 		},
 		SSH: SSH{
-			LocalPort:         ptr.Of(0),
-			LoadDotSSHPubKeys: ptr.Of(true),
-			ForwardAgent:      ptr.Of(false),
-			ForwardX11:        ptr.Of(false),
-			ForwardX11Trusted: ptr.Of(false),
+			LocalPort:            ptr.Of(0),
+			LoadDotSSHPubKeys:    ptr.Of(true),
+			ForwardAgent:         ptr.Of(false),
+			ForwardX11:           ptr.Of(false),
+			ForwardX11Trusted:    ptr.Of(false),
+			GenerateDedicatedKey: ptr.Of(false),
+			ControlPersist:       ptr.Of("yes"),
+			ServerAliveInterval:  ptr.Of(0),
+			ServerAliveCountMax:  ptr.Of(3),
+		},
+		Shell: Shell{
+			WorkDir: ptr.Of(""),
 		},
 		TimeZone: ptr.Of(hostTimeZone()),
 		Firmware: Firmware{
@@ -86,12 +128,15 @@ func TestFillDefault(t *testing.T) {
 		},
 		Audio: Audio{
 			Device: ptr.Of(""),
+			Output: ptr.Of(defaultAudioOutput()),
 		},
 		Video: Video{
 			Display: ptr.Of("none"),
 			VNC: VNCOptions{
 				Display: ptr.Of("127.0.0.1:0,to=9"),
 			},
+			Accel: ptr.Of(""),
+			VRAM:  ptr.Of(""),
 		},
 		HostResolver: HostResolver{
 			Enabled: ptr.Of(true),
@@ -102,6 +147,19 @@ func TestFillDefault(t *testing.T) {
 			RemoveDefaults: ptr.Of(false),
 		},
 		Plain: ptr.Of(false),
+		AutoSnapshot: AutoSnapshot{
+			BeforeEdit: ptr.Of(false),
+			Keep:       ptr.Of(3),
+		},
+		Boot: Boot{
+			Timeout: ptr.Of("10m"),
+		},
+		Shutdown: Shutdown{
+			Timeout: ptr.Of("3m"),
+		},
+		GuestAgent: GuestAgent{
+			MetricsInterval: ptr.Of("60s"),
+		},
 	}
 
 	defaultPortForward := PortForward{
@@ -195,6 +253,7 @@ func TestFillDefault(t *testing.T) {
 
 	expect.Mounts = y.Mounts
 	expect.Mounts[0].MountPoint = expect.Mounts[0].Location
+	expect.Mounts[0].Tag = "mount0"
 	expect.Mounts[0].Writable = ptr.Of(false)
 	expect.Mounts[0].SSHFS.Cache = ptr.Of(true)
 	expect.Mounts[0].SSHFS.FollowSymlinks = ptr.Of(false)
@@ -286,9 +345,19 @@ func TestFillDefault(t *testing.T) {
 			X8664:   "amd64",
 			RISCV64: "riscv64",
 		},
-		CPUs:   ptr.Of(7),
-		Memory: ptr.Of("5GiB"),
-		Disk:   ptr.Of("105GiB"),
+		Accel: []Accel{KVM, TCG},
+		CPUs:  ptr.Of(7),
+		CPUTopology: CPUTopology{
+			Sockets: ptr.Of(1),
+			Cores:   ptr.Of(7),
+			Threads: ptr.Of(1),
+		},
+		NUMA: []NUMANode{
+			{CPUs: "0-6", Memory: "5GiB"},
+		},
+		Memory:     ptr.Of("5GiB"),
+		Disk:       ptr.Of("105GiB"),
+		DiskFormat: ptr.Of(DiskFormatRaw),
 		AdditionalDisks: []Disk{
 			{Name: "data"},
 		},
@@ -302,13 +371,73 @@ func TestFillDefault(t *testing.T) {
 			},
 		},
 		SSH: SSH{
-			LocalPort:         ptr.Of(888),
-			LoadDotSSHPubKeys: ptr.Of(false),
-			ForwardAgent:      ptr.Of(true),
-			ForwardX11:        ptr.Of(false),
-			ForwardX11Trusted: ptr.Of(false),
+			LocalPort:            ptr.Of(888),
+			PortRange:            []int{60000, 61000},
+			LoadDotSSHPubKeys:    ptr.Of(false),
+			ForwardAgent:         ptr.Of(true),
+			ForwardX11:           ptr.Of(false),
+			ForwardX11Trusted:    ptr.Of(false),
+			GenerateDedicatedKey: ptr.Of(true),
+			ControlPersist:       ptr.Of("10m"),
+			ServerAliveInterval:  ptr.Of(15),
+			ServerAliveCountMax:  ptr.Of(4),
+			AuthorizedKeys: []string{
+				"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBQkVYRc6YeEwV2dsDZnzeYh9Ds2xzv8wdrrkXe3mTPS d@example.com",
+			},
+		},
+		Shell: Shell{
+			WorkDir: ptr.Of("/tmp"),
+			Env: map[string]string{
+				"HTTPS_PROXY": "http://proxy.example.com:3128",
+				"EDITOR":      "vi",
+			},
+		},
+		DiskOptions: DiskOptions{
+			CacheMode: ptr.Of(DiskCacheModeUnsafe),
+			AIO:       ptr.Of(DiskAIOThreads),
+			Discard:   ptr.Of(true),
+			Ephemeral: ptr.Of(true),
+			Throttle: DiskThrottle{
+				IOPS:      ptr.Of(int64(1000)),
+				ReadIOPS:  ptr.Of(int64(0)),
+				WriteIOPS: ptr.Of(int64(0)),
+				BPS:       ptr.Of("0"),
+				ReadBPS:   ptr.Of("10MiB"),
+				WriteBPS:  ptr.Of("5MiB"),
+			},
+		},
+		MemoryBalloon: MemoryBalloon{
+			Enabled: ptr.Of(true),
+		},
+		TPM: TPM{
+			Enabled: ptr.Of(true),
+		},
+		RNG: RNG{
+			Enabled: ptr.Of(false),
+		},
+		QEMU: QEMUOpts{
+			Binary:           ptr.Of("/opt/qemu-8.2/bin/qemu-system-x86_64"),
+			GuestAgent:       ptr.Of(true),
+			Machine:          ptr.Of("pc-q35-8.2"),
+			MinimumVersion:   ptr.Of("8.2.0"),
+			VirtiofsdTimeout: ptr.Of("1m"),
+			HotplugPorts:     ptr.Of(2),
+			VFIO:             []string{"0000:01:00.0"},
 		},
 		TimeZone: ptr.Of("Zulu"),
+		AutoSnapshot: AutoSnapshot{
+			BeforeEdit: ptr.Of(true),
+			Keep:       ptr.Of(5),
+		},
+		Boot: Boot{
+			Timeout: ptr.Of("5m"),
+		},
+		Shutdown: Shutdown{
+			Timeout: ptr.Of("30s"),
+		},
+		GuestAgent: GuestAgent{
+			MetricsInterval: ptr.Of("5m"),
+		},
 		Firmware: Firmware{
 			LegacyBIOS: ptr.Of(true),
 			Images: []FileWithVMType{
@@ -321,13 +450,16 @@ func TestFillDefault(t *testing.T) {
 			},
 		},
 		Audio: Audio{
-			Device: ptr.Of("coreaudio"),
+			Device: ptr.Of(AudioDeviceAC97),
+			Output: ptr.Of("alsa"),
 		},
 		Video: Video{
 			Display: ptr.Of("cocoa"),
 			VNC: VNCOptions{
 				Display: ptr.Of("none"),
 			},
+			Accel: ptr.Of(VideoAccelVirgl),
+			VRAM:  ptr.Of("64MiB"),
 		},
 		HostResolver: HostResolver{
 			Enabled: ptr.Of(false),
@@ -375,6 +507,9 @@ func TestFillDefault(t *testing.T) {
 			HostPortRange:  [2]int{80, 80},
 			Proto:          TCP,
 		}},
+		PortForwardOptions: PortForwardOptions{
+			DefaultBindAddress: net.IPv4zero,
+		},
 		CopyToHost: []CopyToHost{{}},
 		Env: map[string]string{
 			"ONE": "one",
@@ -396,6 +531,7 @@ func TestFillDefault(t *testing.T) {
 	// Also verify that archive arch is filled in
 	expect.Containerd.Archives[0].Arch = *d.Arch
 	expect.Mounts[0].MountPoint = expect.Mounts[0].Location
+	expect.Mounts[0].Tag = "mount0"
 	expect.Mounts[0].SSHFS.Cache = ptr.Of(true)
 	expect.Mounts[0].SSHFS.FollowSymlinks = ptr.Of(false)
 	expect.Mounts[0].SSHFS.SFTPDriver = ptr.Of("")
@@ -435,11 +571,16 @@ func TestFillDefault(t *testing.T) {
 	// User-provided defaults should not override user-provided config values
 
 	y = filledDefaults
+	y.Accel = []Accel{TCG}
 	y.DNS = []net.IP{net.ParseIP("8.8.8.8")}
 	y.AdditionalDisks = []Disk{{Name: "overridden"}}
 
 	expect = y
 
+	// y does not specify any of the cpuTopology fields
+	expect.CPUTopology = d.CPUTopology
+	// y does not specify numa
+	expect.NUMA = d.NUMA
 	expect.Provision = append(append([]Provision{}, y.Provision...), d.Provision...)
 	expect.Probes = append(append([]Probe{}, y.Probes...), d.Probes...)
 	expect.PortForwards = append(append([]PortForward{}, y.PortForwards...), d.PortForwards...)
@@ -454,10 +595,19 @@ func TestFillDefault(t *testing.T) {
 
 	expect.HostResolver.Hosts["default"] = d.HostResolver.Hosts["default"]
 
+	// SSH authorized keys are appended in d, y order
+	expect.SSH.AuthorizedKeys = append(append([]string{}, d.SSH.AuthorizedKeys...), y.SSH.AuthorizedKeys...)
+	expect.QEMU.VFIO = append(append([]string{}, d.QEMU.VFIO...), y.QEMU.VFIO...)
+
+	// y.SSH.LocalPort is 0, so it is derived from the instance name within d.SSH.PortRange
+	expect.SSH.PortRange = d.SSH.PortRange
+	expect.SSH.LocalPort = ptr.Of(SSHPortInRange(filepath.Base(filepath.Dir(filePath)), d.SSH.PortRange))
+
 	// d.DNS will be ignored, and not appended to y.DNS
 
 	// "TWO" does not exist in filledDefaults.Env, so is set from d.Env
 	expect.Env["TWO"] = d.Env["TWO"]
+	expect.Shell.Env = d.Shell.Env
 
 	FillDefault(&y, &d, &LimaYAML{}, filePath)
 	assert.DeepEqual(t, &y, &expect, opts...)
@@ -475,9 +625,20 @@ func TestFillDefault(t *testing.T) {
 			X8664:   "pentium",
 			RISCV64: "sifive-u54",
 		},
-		CPUs:   ptr.Of(12),
-		Memory: ptr.Of("7GiB"),
-		Disk:   ptr.Of("117GiB"),
+		Accel: []Accel{HVF},
+		CPUs:  ptr.Of(12),
+		CPUTopology: CPUTopology{
+			Sockets: ptr.Of(2),
+			Cores:   ptr.Of(3),
+			Threads: ptr.Of(2),
+		},
+		NUMA: []NUMANode{
+			{CPUs: "0-5", Memory: "3GiB"},
+			{CPUs: "6-11", Memory: "4GiB"},
+		},
+		Memory:     ptr.Of("7GiB"),
+		Disk:       ptr.Of("117GiB"),
+		DiskFormat: ptr.Of(DiskFormatQcow2),
 		AdditionalDisks: []Disk{
 			{Name: "test"},
 		},
@@ -495,24 +656,86 @@ func TestFillDefault(t *testing.T) {
 			},
 		},
 		SSH: SSH{
-			LocalPort:         ptr.Of(4433),
-			LoadDotSSHPubKeys: ptr.Of(true),
-			ForwardAgent:      ptr.Of(true),
-			ForwardX11:        ptr.Of(false),
-			ForwardX11Trusted: ptr.Of(false),
+			LocalPort:            ptr.Of(4433),
+			PortRange:            []int{50000, 50999},
+			LoadDotSSHPubKeys:    ptr.Of(true),
+			ForwardAgent:         ptr.Of(true),
+			ForwardX11:           ptr.Of(false),
+			ForwardX11Trusted:    ptr.Of(false),
+			GenerateDedicatedKey: ptr.Of(false),
+			ControlPersist:       ptr.Of("1h"),
+			ServerAliveInterval:  ptr.Of(30),
+			ServerAliveCountMax:  ptr.Of(5),
+			AuthorizedKeys: []string{
+				"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHvRZYAU5W6gvbZfb2A/7U4jVJAH2aMWpcXIjRmtMFHe o@example.com",
+			},
+		},
+		Shell: Shell{
+			WorkDir: ptr.Of("/var/tmp"),
+			Env: map[string]string{
+				"HTTPS_PROXY": "http://proxy.example.org:8080",
+			},
+		},
+		DiskOptions: DiskOptions{
+			CacheMode: ptr.Of(DiskCacheModeNone),
+			AIO:       ptr.Of(DiskAIONative),
+			Discard:   ptr.Of(false),
+			Ephemeral: ptr.Of(false),
+			Throttle: DiskThrottle{
+				IOPS:      ptr.Of(int64(0)),
+				ReadIOPS:  ptr.Of(int64(500)),
+				WriteIOPS: ptr.Of(int64(100)),
+				BPS:       ptr.Of("1GiB"),
+				ReadBPS:   ptr.Of("0"),
+				WriteBPS:  ptr.Of("0"),
+			},
+		},
+		MemoryBalloon: MemoryBalloon{
+			Enabled: ptr.Of(false),
+		},
+		TPM: TPM{
+			Enabled: ptr.Of(false),
+		},
+		RNG: RNG{
+			Enabled: ptr.Of(true),
+		},
+		QEMU: QEMUOpts{
+			Binary:           ptr.Of("/usr/local/bin/qemu-system-x86_64"),
+			GuestAgent:       ptr.Of(false),
+			Machine:          ptr.Of("pc"),
+			MinimumVersion:   ptr.Of("9.0.0"),
+			VirtiofsdTimeout: ptr.Of("2m"),
+			HotplugPorts:     ptr.Of(4),
+			VFIO:             []string{"0000:01:00.0", "0000:02:00.0"},
 		},
 		TimeZone: ptr.Of("Universal"),
+		AutoSnapshot: AutoSnapshot{
+			BeforeEdit: ptr.Of(false),
+			Keep:       ptr.Of(1),
+		},
+		Boot: Boot{
+			Timeout: ptr.Of("90s"),
+		},
+		Shutdown: Shutdown{
+			Timeout: ptr.Of("0"),
+		},
+		GuestAgent: GuestAgent{
+			MetricsInterval: ptr.Of("0"),
+		},
 		Firmware: Firmware{
 			LegacyBIOS: ptr.Of(true),
 		},
 		Audio: Audio{
-			Device: ptr.Of("coreaudio"),
+			Device: ptr.Of(AudioDeviceUSBAudio),
+			Output: ptr.Of("none"),
 		},
 		Video: Video{
 			Display: ptr.Of("cocoa"),
 			VNC: VNCOptions{
 				Display: ptr.Of("none"),
 			},
+			Accel: ptr.Of(""),
+			VRAM:  ptr.Of("128MiB"),
 		},
 		HostResolver: HostResolver{
 			Enabled: ptr.Of(false),
@@ -526,6 +749,7 @@ func TestFillDefault(t *testing.T) {
 		Mounts: []Mount{
 			{
 				Location: "/var/log",
+				Tag:      "logs",
 				Writable: ptr.Of(true),
 				SSHFS: SSHFS{
 					Cache:          ptr.Of(false),
@@ -579,6 +803,9 @@ func TestFillDefault(t *testing.T) {
 			HostPortRange:  [2]int{8080, 8080},
 			Proto:          TCP,
 		}},
+		PortForwardOptions: PortForwardOptions{
+			DefaultBindAddress: net.ParseIP("127.0.0.2"),
+		},
 		CopyToHost: []CopyToHost{{}},
 		Env: map[string]string{
 			"TWO":   "deux",
@@ -610,6 +837,7 @@ func TestFillDefault(t *testing.T) {
 
 	// o.Mounts just makes d.Mounts[0] writable because the Location matches
 	expect.Mounts = append(append([]Mount{}, d.Mounts...), y.Mounts...)
+	expect.Mounts[0].Tag = "logs"
 	expect.Mounts[0].Writable = ptr.Of(true)
 	expect.Mounts[0].SSHFS.Cache = ptr.Of(false)
 	expect.Mounts[0].SSHFS.FollowSymlinks = ptr.Of(true)
@@ -632,12 +860,22 @@ func TestFillDefault(t *testing.T) {
 	// ONE remains from filledDefaults.Env; the rest are set from o
 	expect.Env["ONE"] = y.Env["ONE"]
 
+	// EDITOR remains from d.Shell.Env; HTTPS_PROXY is overridden by o
+	expect.Shell.Env = map[string]string{
+		"HTTPS_PROXY": o.Shell.Env["HTTPS_PROXY"],
+		"EDITOR":      d.Shell.Env["EDITOR"],
+	}
+
 	expect.CACertificates.RemoveDefaults = ptr.Of(true)
 	expect.CACertificates.Files = []string{"ca.crt"}
 	expect.CACertificates.Certs = []string{
 		"-----BEGIN CERTIFICATE-----\nYOUR-ORGS-TRUSTED-CA-CERT\n-----END CERTIFICATE-----\n",
 	}
 
+	expect.SSH.AuthorizedKeys = append(append([]string{}, d.SSH.AuthorizedKeys...), o.SSH.AuthorizedKeys...)
+	// "0000:01:00.0" is not duplicated
+	expect.QEMU.VFIO = []string{"0000:01:00.0", "0000:02:00.0"}
+
 	expect.Rosetta = Rosetta{
 		Enabled: ptr.Of(false),
 		BinFmt:  ptr.Of(false),
@@ -647,3 +885,25 @@ func TestFillDefault(t *testing.T) {
 	FillDefault(&y, &d, &o, filePath)
 	assert.DeepEqual(t, &y, &expect, opts...)
 }
+
+func TestFillDefaultBindAddress(t *testing.T) {
+	y := LimaYAML{
+		PortForwardOptions: PortForwardOptions{DefaultBindAddress: net.IPv4zero},
+		PortForwards: []PortForward{
+			{GuestPort: 80},
+			{GuestPort: 443, HostIP: IPv4loopback1},
+		},
+	}
+	FillDefault(&y, &LimaYAML{}, &LimaYAML{}, filepath.Join(t.TempDir(), "lima.yaml"))
+	assert.Check(t, y.PortForwards[0].HostIP.Equal(net.IPv4zero))
+	assert.Check(t, y.PortForwards[1].HostIP.Equal(IPv4loopback1))
+}
+
+func TestSSHPortInRange(t *testing.T) {
+	for _, name := range []string{"default", "foo", "bar", "k8s-worker-1"} {
+		port := SSHPortInRange(name, []int{60000, 60009})
+		assert.Assert(t, port >= 60000 && port <= 60009, port)
+		assert.Equal(t, port, SSHPortInRange(name, []int{60000, 60009}))
+	}
+	assert.Equal(t, 60022, SSHPortInRange("foo", []int{60022, 60022}))
+}
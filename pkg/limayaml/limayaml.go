@@ -7,31 +7,43 @@ import (
 )
 
 type LimaYAML struct {
-	VMType             *VMType       `yaml:"vmType,omitempty" json:"vmType,omitempty"`
-	OS                 *OS           `yaml:"os,omitempty" json:"os,omitempty"`
-	Arch               *Arch         `yaml:"arch,omitempty" json:"arch,omitempty"`
-	Images             []Image       `yaml:"images" json:"images"` // REQUIRED
-	CPUType            CPUType       `yaml:"cpuType,omitempty" json:"cpuType,omitempty"`
-	CPUs               *int          `yaml:"cpus,omitempty" json:"cpus,omitempty"`
-	Memory             *string       `yaml:"memory,omitempty" json:"memory,omitempty"` // go-units.RAMInBytes
-	Disk               *string       `yaml:"disk,omitempty" json:"disk,omitempty"`     // go-units.RAMInBytes
-	AdditionalDisks    []Disk        `yaml:"additionalDisks,omitempty" json:"additionalDisks,omitempty"`
-	Mounts             []Mount       `yaml:"mounts,omitempty" json:"mounts,omitempty"`
-	MountType          *MountType    `yaml:"mountType,omitempty" json:"mountType,omitempty"`
-	MountInotify       *bool         `yaml:"mountInotify,omitempty" json:"mountInotify,omitempty"`
-	SSH                SSH           `yaml:"ssh,omitempty" json:"ssh,omitempty"` // REQUIRED (FIXME)
-	Firmware           Firmware      `yaml:"firmware,omitempty" json:"firmware,omitempty"`
-	Audio              Audio         `yaml:"audio,omitempty" json:"audio,omitempty"`
-	Video              Video         `yaml:"video,omitempty" json:"video,omitempty"`
-	Provision          []Provision   `yaml:"provision,omitempty" json:"provision,omitempty"`
-	UpgradePackages    *bool         `yaml:"upgradePackages,omitempty" json:"upgradePackages,omitempty"`
-	Containerd         Containerd    `yaml:"containerd,omitempty" json:"containerd,omitempty"`
-	GuestInstallPrefix *string       `yaml:"guestInstallPrefix,omitempty" json:"guestInstallPrefix,omitempty"`
-	Probes             []Probe       `yaml:"probes,omitempty" json:"probes,omitempty"`
-	PortForwards       []PortForward `yaml:"portForwards,omitempty" json:"portForwards,omitempty"`
-	CopyToHost         []CopyToHost  `yaml:"copyToHost,omitempty" json:"copyToHost,omitempty"`
-	Message            string        `yaml:"message,omitempty" json:"message,omitempty"`
-	Networks           []Network     `yaml:"networks,omitempty" json:"networks,omitempty"`
+	VMType             *VMType            `yaml:"vmType,omitempty" json:"vmType,omitempty"`
+	OS                 *OS                `yaml:"os,omitempty" json:"os,omitempty"`
+	Arch               *Arch              `yaml:"arch,omitempty" json:"arch,omitempty"`
+	Images             []Image            `yaml:"images" json:"images"` // REQUIRED
+	CPUType            CPUType            `yaml:"cpuType,omitempty" json:"cpuType,omitempty"`
+	Accel              []Accel            `yaml:"accel,omitempty" json:"accel,omitempty"`
+	CPUs               *int               `yaml:"cpus,omitempty" json:"cpus,omitempty"`
+	CPUTopology        CPUTopology        `yaml:"cpuTopology,omitempty" json:"cpuTopology,omitempty"`
+	NUMA               []NUMANode         `yaml:"numa,omitempty" json:"numa,omitempty"`
+	Memory             *string            `yaml:"memory,omitempty" json:"memory,omitempty"` // go-units.RAMInBytes
+	Disk               *string            `yaml:"disk,omitempty" json:"disk,omitempty"`     // go-units.RAMInBytes
+	DiskFormat         *string            `yaml:"diskFormat,omitempty" json:"diskFormat,omitempty"`
+	DiskOptions        DiskOptions        `yaml:"diskOptions,omitempty" json:"diskOptions,omitempty"`
+	MemoryBalloon      MemoryBalloon      `yaml:"memoryBalloon,omitempty" json:"memoryBalloon,omitempty"`
+	AdditionalDisks    []Disk             `yaml:"additionalDisks,omitempty" json:"additionalDisks,omitempty"`
+	USBDevices         []USBDevice        `yaml:"usbDevices,omitempty" json:"usbDevices,omitempty"`
+	Mounts             []Mount            `yaml:"mounts,omitempty" json:"mounts,omitempty"`
+	MountType          *MountType         `yaml:"mountType,omitempty" json:"mountType,omitempty"`
+	MountInotify       *bool              `yaml:"mountInotify,omitempty" json:"mountInotify,omitempty"`
+	SSH                SSH                `yaml:"ssh,omitempty" json:"ssh,omitempty"` // REQUIRED (FIXME)
+	Shell              Shell              `yaml:"shell,omitempty" json:"shell,omitempty"`
+	Firmware           Firmware           `yaml:"firmware,omitempty" json:"firmware,omitempty"`
+	Audio              Audio              `yaml:"audio,omitempty" json:"audio,omitempty"`
+	Video              Video              `yaml:"video,omitempty" json:"video,omitempty"`
+	TPM                TPM                `yaml:"tpm,omitempty" json:"tpm,omitempty"`
+	RNG                RNG                `yaml:"rng,omitempty" json:"rng,omitempty"`
+	QEMU               QEMUOpts           `yaml:"qemu,omitempty" json:"qemu,omitempty"`
+	Provision          []Provision        `yaml:"provision,omitempty" json:"provision,omitempty"`
+	UpgradePackages    *bool              `yaml:"upgradePackages,omitempty" json:"upgradePackages,omitempty"`
+	Containerd         Containerd         `yaml:"containerd,omitempty" json:"containerd,omitempty"`
+	GuestInstallPrefix *string            `yaml:"guestInstallPrefix,omitempty" json:"guestInstallPrefix,omitempty"`
+	Probes             []Probe            `yaml:"probes,omitempty" json:"probes,omitempty"`
+	PortForwards       []PortForward      `yaml:"portForwards,omitempty" json:"portForwards,omitempty"`
+	PortForwardOptions PortForwardOptions `yaml:"portForwardOptions,omitempty" json:"portForwardOptions,omitempty"`
+	CopyToHost         []CopyToHost       `yaml:"copyToHost,omitempty" json:"copyToHost,omitempty"`
+	Message            string             `yaml:"message,omitempty" json:"message,omitempty"`
+	Networks           []Network          `yaml:"networks,omitempty" json:"networks,omitempty"`
 	// `network` was deprecated in Lima v0.7.0, removed in Lima v0.14.0. Use `networks` instead.
 	Env          map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
 	DNS          []net.IP          `yaml:"dns,omitempty" json:"dns,omitempty"`
@@ -42,6 +54,10 @@ type LimaYAML struct {
 	Rosetta           Rosetta        `yaml:"rosetta,omitempty" json:"rosetta,omitempty"`
 	Plain             *bool          `yaml:"plain,omitempty" json:"plain,omitempty"`
 	TimeZone          *string        `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	AutoSnapshot      AutoSnapshot   `yaml:"autoSnapshot,omitempty" json:"autoSnapshot,omitempty"`
+	Boot              Boot           `yaml:"boot,omitempty" json:"boot,omitempty"`
+	Shutdown          Shutdown       `yaml:"shutdown,omitempty" json:"shutdown,omitempty"`
+	GuestAgent        GuestAgent     `yaml:"guestAgent,omitempty" json:"guestAgent,omitempty"`
 }
 
 type (
@@ -49,6 +65,7 @@ type (
 	Arch      = string
 	MountType = string
 	VMType    = string
+	Accel     = string
 )
 
 type CPUType = map[Arch]string
@@ -69,8 +86,90 @@ const (
 	QEMU VMType = "qemu"
 	VZ   VMType = "vz"
 	WSL2 VMType = "wsl2"
+
+	KVM  Accel = "kvm"
+	HVF  Accel = "hvf"
+	WHPX Accel = "whpx"
+	NVMM Accel = "nvmm"
+	TCG  Accel = "tcg"
+)
+
+// CPUTopology is the SMP topology of the vCPUs. The product of the fields must be equal to `cpus`.
+type CPUTopology struct {
+	Sockets *int `yaml:"sockets,omitempty" json:"sockets,omitempty"`
+	Cores   *int `yaml:"cores,omitempty" json:"cores,omitempty"`
+	Threads *int `yaml:"threads,omitempty" json:"threads,omitempty"`
+}
+
+// NUMANode is a NUMA node of the guest. The nodes must cover all the vCPUs and all the memory.
+type NUMANode struct {
+	CPUs   string `yaml:"cpus" json:"cpus"`     // REQUIRED; e.g., "0-3" or "0-1,4-5"
+	Memory string `yaml:"memory" json:"memory"` // REQUIRED; go-units.RAMInBytes
+}
+
+type DiskOptions struct {
+	// CacheMode is the QEMU cache mode of the disks ("", "writeback", "none", "unsafe")
+	CacheMode *string `yaml:"cacheMode,omitempty" json:"cacheMode,omitempty"`
+	// AIO is the QEMU AIO mode of the disks ("", "threads", "native", "io_uring")
+	AIO *string `yaml:"aio,omitempty" json:"aio,omitempty"`
+	// Discard also converts zero writes into discard requests, so that the disk images shrink
+	Discard *bool `yaml:"discard,omitempty" json:"discard,omitempty"`
+	// Ephemeral discards the writes to the disks on shutdown, with the QEMU `-snapshot` option
+	Ephemeral *bool `yaml:"ephemeral,omitempty" json:"ephemeral,omitempty"`
+	// Throttle is the I/O throttling of the main disk
+	Throttle DiskThrottle `yaml:"throttle,omitempty" json:"throttle,omitempty"`
+}
+
+// DiskThrottle is the QEMU I/O throttling of a disk. Zero means unlimited.
+// The total limits cannot be combined with the read and write limits.
+type DiskThrottle struct {
+	IOPS      *int64  `yaml:"iops,omitempty" json:"iops,omitempty"`
+	ReadIOPS  *int64  `yaml:"readIOPS,omitempty" json:"readIOPS,omitempty"`
+	WriteIOPS *int64  `yaml:"writeIOPS,omitempty" json:"writeIOPS,omitempty"`
+	BPS       *string `yaml:"bps,omitempty" json:"bps,omitempty"`           // go-units.RAMInBytes, per second
+	ReadBPS   *string `yaml:"readBPS,omitempty" json:"readBPS,omitempty"`   // go-units.RAMInBytes, per second
+	WriteBPS  *string `yaml:"writeBPS,omitempty" json:"writeBPS,omitempty"` // go-units.RAMInBytes, per second
+}
+
+const (
+	DiskCacheModeWriteback = "writeback"
+	DiskCacheModeNone      = "none"
+	DiskCacheModeUnsafe    = "unsafe"
+
+	DiskAIOThreads = "threads"
+	DiskAIONative  = "native"
+	DiskAIOIOUring = "io_uring"
+
+	DiskFormatQcow2 = "qcow2"
+	DiskFormatRaw   = "raw"
 )
 
+type MemoryBalloon struct {
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+}
+
+type AutoSnapshot struct {
+	BeforeEdit *bool `yaml:"beforeEdit,omitempty" json:"beforeEdit,omitempty"`
+	Keep       *int  `yaml:"keep,omitempty" json:"keep,omitempty"`
+}
+
+type Boot struct {
+	// Timeout is the duration to wait for SSH to be ready after the VM has started (time.ParseDuration).
+	Timeout *string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+type Shutdown struct {
+	// Timeout is the duration to wait for the guest to shut down after the ACPI powerdown event (time.ParseDuration).
+	// "0" kills the VM immediately without sending the ACPI event.
+	Timeout *string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+type GuestAgent struct {
+	// MetricsInterval is the interval of querying the filesystem usage of the guest (time.ParseDuration).
+	// "0" disables the query.
+	MetricsInterval *string `yaml:"metricsInterval,omitempty" json:"metricsInterval,omitempty"`
+}
+
 type Rosetta struct {
 	Enabled *bool `yaml:"enabled" json:"enabled"`
 	BinFmt  *bool `yaml:"binfmt" json:"binfmt"`
@@ -105,13 +204,23 @@ type Disk struct {
 	FSArgs []string `yaml:"fsArgs,omitempty" json:"fsArgs,omitempty"`
 }
 
+// USBDevice selects a host USB device either by `vendorId` and `productId`, or by `hostBus` and `hostAddr`.
+type USBDevice struct {
+	VendorID  *string `yaml:"vendorId,omitempty" json:"vendorId,omitempty"`   // hexadecimal, e.g., "0x1050"
+	ProductID *string `yaml:"productId,omitempty" json:"productId,omitempty"` // hexadecimal, e.g., "0x0407"
+	HostBus   *int    `yaml:"hostBus,omitempty" json:"hostBus,omitempty"`
+	HostAddr  *int    `yaml:"hostAddr,omitempty" json:"hostAddr,omitempty"`
+}
+
 type Mount struct {
-	Location   string   `yaml:"location" json:"location"` // REQUIRED
-	MountPoint string   `yaml:"mountPoint,omitempty" json:"mountPoint,omitempty"`
-	Writable   *bool    `yaml:"writable,omitempty" json:"writable,omitempty"`
-	SSHFS      SSHFS    `yaml:"sshfs,omitempty" json:"sshfs,omitempty"`
-	NineP      NineP    `yaml:"9p,omitempty" json:"9p,omitempty"`
-	Virtiofs   Virtiofs `yaml:"virtiofs,omitempty" json:"virtiofs,omitempty"`
+	Location   string `yaml:"location" json:"location"` // REQUIRED
+	MountPoint string `yaml:"mountPoint,omitempty" json:"mountPoint,omitempty"`
+	// Tag is the tag of the 9p and virtiofs devices, used by the guest to identify the mount
+	Tag      string   `yaml:"tag,omitempty" json:"tag,omitempty"`
+	Writable *bool    `yaml:"writable,omitempty" json:"writable,omitempty"`
+	SSHFS    SSHFS    `yaml:"sshfs,omitempty" json:"sshfs,omitempty"`
+	NineP    NineP    `yaml:"9p,omitempty" json:"9p,omitempty"`
+	Virtiofs Virtiofs `yaml:"virtiofs,omitempty" json:"virtiofs,omitempty"`
 }
 
 type SFTPDriver = string
@@ -140,12 +249,35 @@ type Virtiofs struct {
 
 type SSH struct {
 	LocalPort *int `yaml:"localPort,omitempty" json:"localPort,omitempty"`
+	// PortRange is the range of LocalPort, as [MIN, MAX], used when LocalPort is 0.
+	// Usually set in $LIMA_HOME/_config/default.yaml.
+	PortRange []int `yaml:"portRange,omitempty" json:"portRange,omitempty"`
 
 	// LoadDotSSHPubKeys loads ~/.ssh/*.pub in addition to $LIMA_HOME/_config/user.pub .
 	LoadDotSSHPubKeys *bool `yaml:"loadDotSSHPubKeys,omitempty" json:"loadDotSSHPubKeys,omitempty"` // default: true
 	ForwardAgent      *bool `yaml:"forwardAgent,omitempty" json:"forwardAgent,omitempty"`           // default: false
 	ForwardX11        *bool `yaml:"forwardX11,omitempty" json:"forwardX11,omitempty"`               // default: false
 	ForwardX11Trusted *bool `yaml:"forwardX11Trusted,omitempty" json:"forwardX11Trusted,omitempty"` // default: false
+
+	// GenerateDedicatedKey uses $LIMA_HOME/<INSTANCE>/ssh_key instead of $LIMA_HOME/_config/user .
+	GenerateDedicatedKey *bool `yaml:"generateDedicatedKey,omitempty" json:"generateDedicatedKey,omitempty"` // default: false
+
+	// ControlPersist is "yes" or the idle time after which the ControlMaster exits, e.g., "10m".
+	ControlPersist *string `yaml:"controlPersist,omitempty" json:"controlPersist,omitempty"` // default: "yes"
+	// ServerAliveInterval is the interval of the keepalive messages in seconds. 0 disables the messages.
+	ServerAliveInterval *int `yaml:"serverAliveInterval,omitempty" json:"serverAliveInterval,omitempty"` // default: 0
+	ServerAliveCountMax *int `yaml:"serverAliveCountMax,omitempty" json:"serverAliveCountMax,omitempty"` // default: 3
+
+	// AuthorizedKeys are the public keys added to ~/.ssh/authorized_keys of the guest, in addition to the keys of Lima.
+	AuthorizedKeys []string `yaml:"authorizedKeys,omitempty" json:"authorizedKeys,omitempty"`
+}
+
+type Shell struct {
+	// WorkDir is the working directory of `limactl shell` in the guest, unless `--workdir` is specified.
+	// When WorkDir is empty, the current directory of the host is used if it exists in the guest.
+	WorkDir *string `yaml:"workdir,omitempty" json:"workdir,omitempty"` // default: ""
+	// Env is set for every `limactl shell` session. `--env` and `--preserve-env` take precedence.
+	Env map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
 }
 
 type Firmware struct {
@@ -159,10 +291,50 @@ type Firmware struct {
 }
 
 type Audio struct {
-	// Device is a QEMU audiodev string
+	// Device is the emulated sound card (AudioDeviceIntelHDA, AudioDeviceAC97, AudioDeviceUSBAudio, or "none").
+	// For backward compatibility, a QEMU audiodev string such as "coreaudio" is also accepted,
+	// and is interpreted as the output of an Intel HDA sound card.
 	Device *string `yaml:"device,omitempty" json:"device,omitempty"`
+	// Output is the QEMU audiodev backend on the host, e.g., "coreaudio", "pa", "alsa", "none"
+	Output *string `yaml:"output,omitempty" json:"output,omitempty"`
+}
+
+const (
+	AudioDeviceIntelHDA = "intel-hda"
+	AudioDeviceAC97     = "ac97"
+	AudioDeviceUSBAudio = "usb-audio"
+)
+
+type TPM struct {
+	// Enabled attaches a TPM 2.0 device emulated by swtpm
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
 }
 
+type RNG struct {
+	// Enabled attaches a virtio-rng device backed by the host's /dev/urandom (QEMU's builtin backend on Windows)
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+}
+
+type QEMUOpts struct {
+	// Binary is the absolute path of the qemu-system-* binary, overriding the one found in $PATH
+	Binary *string `yaml:"binary,omitempty" json:"binary,omitempty"`
+	// GuestAgent adds a virtio-serial channel for the QEMU guest agent (qemu-ga), which is used for shutting down the guest
+	GuestAgent *bool `yaml:"guestAgent,omitempty" json:"guestAgent,omitempty"`
+	// Machine is the QEMU machine type, e.g., "pc-q35-8.2", overriding "q35" (x86_64) or "virt" (others)
+	Machine *string `yaml:"machine,omitempty" json:"machine,omitempty"`
+	// MinimumVersion is the minimum QEMU version required by the template, e.g., "8.2.0"
+	MinimumVersion *string `yaml:"minimumVersion,omitempty" json:"minimumVersion,omitempty"`
+	// VirtiofsdTimeout is the duration to wait for virtiofsd to create the vhost-user socket (time.ParseDuration)
+	VirtiofsdTimeout *string `yaml:"virtiofsdTimeout,omitempty" json:"virtiofsdTimeout,omitempty"`
+	// HotplugPorts is the number of PCIe root ports reserved for hot-plugging NICs into the running instance
+	HotplugPorts *int `yaml:"hotplugPorts,omitempty" json:"hotplugPorts,omitempty"`
+	// VFIO is the list of the PCI addresses of the host devices passed through with VFIO, e.g., "0000:01:00.0" (Linux hosts only)
+	VFIO []string `yaml:"vfio,omitempty" json:"vfio,omitempty"`
+}
+
+// MaxHotplugPorts is the maximum of `qemu.hotplugPorts`.
+const MaxHotplugPorts = 16
+
 type VNCOptions struct {
 	Display *string `yaml:"display,omitempty" json:"display,omitempty"`
 }
@@ -171,8 +343,14 @@ type Video struct {
 	// Display is a QEMU display string
 	Display *string    `yaml:"display,omitempty" json:"display,omitempty"`
 	VNC     VNCOptions `yaml:"vnc" json:"vnc"`
+	// Accel is the 3D acceleration of the display ("" or VideoAccelVirgl)
+	Accel *string `yaml:"accel,omitempty" json:"accel,omitempty"`
+	// VRAM is the maximum host memory for the virtio-gpu resources (go-units.RAMInBytes)
+	VRAM *string `yaml:"vram,omitempty" json:"vram,omitempty"`
 }
 
+const VideoAccelVirgl = "virgl"
+
 type ProvisionMode = string
 
 const (
@@ -212,9 +390,16 @@ type Probe struct {
 type Proto = string
 
 const (
-	TCP Proto = "tcp"
+	TCP      Proto = "tcp"
+	UDP      Proto = "udp"
+	ProtoAny Proto = "any"
 )
 
+type PortForwardOptions struct {
+	// DefaultBindAddress is the host IP of the rules that do not specify `hostIP`, including the fallback rule
+	DefaultBindAddress net.IP `yaml:"defaultBindAddress,omitempty" json:"defaultBindAddress,omitempty"`
+}
+
 type PortForward struct {
 	GuestIPMustBeZero bool   `yaml:"guestIPMustBeZero,omitempty" json:"guestIPMustBeZero,omitempty"`
 	GuestIP           net.IP `yaml:"guestIP,omitempty" json:"guestIP,omitempty"`
@@ -7,16 +7,43 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/coreos/go-semver/semver"
 	"github.com/docker/go-units"
 	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/pbnjay/memory"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
 )
 
+// ValidateAuthorizedKey checks that key is a single line of an SSH public key in the authorized_keys format,
+// e.g., "ssh-ed25519 AAAA... user@example.com".
+func ValidateAuthorizedKey(key string) error {
+	if strings.ContainsAny(key, "\r\n") {
+		return errors.New("must be a single line")
+	}
+	if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key)); err != nil {
+		return fmt.Errorf("failed to parse %q as an SSH public key: %w", key, err)
+	}
+	return nil
+}
+
+// ValidateEnvKey checks that key is a valid name of an environment variable.
+func ValidateEnvKey(key string) error {
+	if !envKeyRegexp.MatchString(key) {
+		return fmt.Errorf("invalid variable name %q", key)
+	}
+	return nil
+}
+
 func validateFileObject(f File, fieldName string) error {
 	if !strings.Contains(f.Location, "://") {
 		if _, err := localpathutil.Expand(f.Location); err != nil {
@@ -104,16 +131,109 @@ func Validate(y *LimaYAML, warn bool) error {
 		}
 	}
 
+	for i, accel := range y.Accel {
+		switch accel {
+		case KVM, HVF, WHPX, NVMM, TCG:
+		default:
+			return fmt.Errorf("field `accel[%d]` must be %q, %q, %q, %q, or %q; got %q", i, KVM, HVF, WHPX, NVMM, TCG, accel)
+		}
+	}
+
 	if *y.CPUs == 0 {
 		return errors.New("field `cpus` must be set")
 	}
 
-	if _, err := units.RAMInBytes(*y.Memory); err != nil {
+	if err := validateCPUTopology(y.CPUTopology, *y.CPUs); err != nil {
+		return err
+	}
+	if err := validateNUMA(y.NUMA, *y.CPUs, *y.Memory); err != nil {
+		return err
+	}
+
+	if *y.CPUs < 0 {
+		return fmt.Errorf("field `cpus` must be positive, got %d", *y.CPUs)
+	}
+
+	memBytes, err := units.RAMInBytes(*y.Memory)
+	if err != nil {
 		return fmt.Errorf("field `memory` has an invalid value: %w", err)
 	}
+	if memBytes <= 0 {
+		return fmt.Errorf("field `memory` must be positive, got %q", *y.Memory)
+	}
 
+	// "0" is accepted for booting the base disk directly, without creating the diff disk
 	if _, err := units.RAMInBytes(*y.Disk); err != nil {
-		return fmt.Errorf("field `memory` has an invalid value: %w", err)
+		return fmt.Errorf("field `disk` has an invalid value: %w", err)
+	}
+
+	// audio.output is only used for the sound cards of QEMU; the legacy audiodev strings
+	// of audio.device are passed through as they are
+	if *y.VMType == QEMU {
+		switch *y.Audio.Device {
+		case AudioDeviceIntelHDA, AudioDeviceAC97, AudioDeviceUSBAudio:
+			if err := validateAudioOutput(*y.Audio.Output); err != nil {
+				return err
+			}
+		}
+	}
+	switch *y.DiskFormat {
+	case DiskFormatQcow2:
+		if *y.VMType == VZ {
+			return fmt.Errorf("field `diskFormat` must be %q for vmType %q, got %q", DiskFormatRaw, VZ, *y.DiskFormat)
+		}
+	case DiskFormatRaw:
+	default:
+		return fmt.Errorf("field `diskFormat` must be %q or %q, got %q", DiskFormatQcow2, DiskFormatRaw, *y.DiskFormat)
+	}
+	if err := validateDiskOptions(y.DiskOptions, runtime.GOOS); err != nil {
+		return err
+	}
+	if err := validateDiskThrottle(y.DiskOptions.Throttle); err != nil {
+		return err
+	}
+	if *y.QEMU.Binary != "" && !filepath.IsAbs(*y.QEMU.Binary) {
+		return fmt.Errorf("field `qemu.binary` must be an absolute path, got %q", *y.QEMU.Binary)
+	}
+	if *y.QEMU.MinimumVersion != "" {
+		if _, err := semver.NewVersion(*y.QEMU.MinimumVersion); err != nil {
+			return fmt.Errorf("field `qemu.minimumVersion` must be a semantic version, e.g., \"8.2.0\": %w", err)
+		}
+	}
+	if *y.QEMU.HotplugPorts < 0 || *y.QEMU.HotplugPorts > MaxHotplugPorts {
+		return fmt.Errorf("field `qemu.hotplugPorts` must be between 0 and %d, got %d", MaxHotplugPorts, *y.QEMU.HotplugPorts)
+	}
+	if *y.QEMU.HotplugPorts > 0 && !machineHasPCIe(*y.QEMU.Machine) {
+		return fmt.Errorf("field `qemu.hotplugPorts` requires a PCIe machine such as \"q35\" or \"virt\", got `qemu.machine` %q", *y.QEMU.Machine)
+	}
+	for i, addr := range y.QEMU.VFIO {
+		if *y.VMType != QEMU {
+			return fmt.Errorf("field `qemu.vfio` requires `vmType` %q, got %q", QEMU, *y.VMType)
+		}
+		if !pciAddressRegexp.MatchString(addr) {
+			return fmt.Errorf("field `qemu.vfio[%d]` must be a PCI address with the domain, e.g., \"0000:01:00.0\", got %q", i, addr)
+		}
+	}
+	switch *y.Video.Accel {
+	case "", VideoAccelVirgl:
+	default:
+		return fmt.Errorf("field `video.accel` must be \"\" or %q, got %q", VideoAccelVirgl, *y.Video.Accel)
+	}
+
+	if *y.Video.VRAM != "" {
+		if _, err := units.RAMInBytes(*y.Video.VRAM); err != nil {
+			return fmt.Errorf("field `video.vram` has an invalid value: %w", err)
+		}
+	}
+
+	if *y.Audio.Device == AudioDeviceAC97 && *y.Arch != X8664 {
+		return fmt.Errorf("field `audio.device` %q is only supported for architecture %q", AudioDeviceAC97, X8664)
+	}
+
+	for i, dev := range y.USBDevices {
+		if err := validateUSBDevice(dev); err != nil {
+			return fmt.Errorf("field `usbDevices[%d]` is invalid: %w", i, err)
+		}
 	}
 
 	u, err := osutil.LimaUser(false)
@@ -152,12 +272,50 @@ func Validate(y *LimaYAML, warn bool) error {
 			return fmt.Errorf("field `msize` has an invalid value: %w", err)
 		}
 	}
+	if err := validateMountTags(y.Mounts); err != nil {
+		return err
+	}
 
+	if len(y.SSH.PortRange) > 0 {
+		if len(y.SSH.PortRange) != 2 {
+			return fmt.Errorf("field `ssh.portRange` must be [MIN, MAX], got %v", y.SSH.PortRange)
+		}
+		for i, port := range y.SSH.PortRange {
+			if err := validatePort(fmt.Sprintf("ssh.portRange[%d]", i), port); err != nil {
+				return err
+			}
+		}
+		if y.SSH.PortRange[0] > y.SSH.PortRange[1] {
+			return fmt.Errorf("field `ssh.portRange` must be [MIN, MAX], got %v", y.SSH.PortRange)
+		}
+	}
 	if *y.SSH.LocalPort != 0 {
 		if err := validatePort("ssh.localPort", *y.SSH.LocalPort); err != nil {
 			return err
 		}
 	}
+	if *y.SSH.ControlPersist != "yes" && !sshTimeRegexp.MatchString(*y.SSH.ControlPersist) {
+		return fmt.Errorf("field `ssh.controlPersist` must be \"yes\" or a time interval such as \"10m\", got %q", *y.SSH.ControlPersist)
+	}
+	if *y.SSH.ServerAliveInterval < 0 {
+		return fmt.Errorf("field `ssh.serverAliveInterval` must be 0 or greater, got %d", *y.SSH.ServerAliveInterval)
+	}
+	if *y.SSH.ServerAliveCountMax < 1 {
+		return fmt.Errorf("field `ssh.serverAliveCountMax` must be 1 or greater, got %d", *y.SSH.ServerAliveCountMax)
+	}
+	for i, key := range y.SSH.AuthorizedKeys {
+		if err := ValidateAuthorizedKey(key); err != nil {
+			return fmt.Errorf("field `ssh.authorizedKeys[%d]` is invalid: %w", i, err)
+		}
+	}
+	if *y.Shell.WorkDir != "" && !path.IsAbs(*y.Shell.WorkDir) {
+		return fmt.Errorf("field `shell.workdir` must be an absolute path in the guest, got %q", *y.Shell.WorkDir)
+	}
+	for k := range y.Shell.Env {
+		if err := ValidateEnvKey(k); err != nil {
+			return fmt.Errorf("field `shell.env` is invalid: %w", err)
+		}
+	}
 
 	switch *y.MountType {
 	case REVSSHFS, NINEP, VIRTIOFS, WSLMount:
@@ -271,8 +429,14 @@ func Validate(y *LimaYAML, warn bool) error {
 			return fmt.Errorf("field `%s.hostSocket` must be less than UNIX_PATH_MAX=%d characters, but is %d",
 				field, osutil.UnixPathMax, len(rule.HostSocket))
 		}
-		if rule.Proto != TCP {
-			return fmt.Errorf("field `%s.proto` must be %q", field, TCP)
+		switch rule.Proto {
+		case TCP:
+		case UDP, ProtoAny:
+			if rule.GuestSocket != "" || rule.HostSocket != "" {
+				return fmt.Errorf("field `%s.proto` must be %q for sockets", field, TCP)
+			}
+		default:
+			return fmt.Errorf("field `%s.proto` must be %q, %q, or %q", field, TCP, UDP, ProtoAny)
 		}
 		if rule.Reverse && rule.GuestSocket == "" {
 			return fmt.Errorf("field `%s.reverse` must be %t", field, false)
@@ -301,6 +465,23 @@ func Validate(y *LimaYAML, warn bool) error {
 		return fmt.Errorf("field `dns` must be empty when field `HostResolver.Enabled` is true")
 	}
 
+	if *y.AutoSnapshot.Keep < 1 {
+		return fmt.Errorf("field `autoSnapshot.keep` must be positive, got %d", *y.AutoSnapshot.Keep)
+	}
+
+	if _, err := ParseBootTimeout(*y.Boot.Timeout); err != nil {
+		return fmt.Errorf("field `boot.timeout` is invalid: %w", err)
+	}
+	if _, err := ParseShutdownTimeout(*y.Shutdown.Timeout); err != nil {
+		return fmt.Errorf("field `shutdown.timeout` is invalid: %w", err)
+	}
+	if _, err := ParseVirtiofsdTimeout(*y.QEMU.VirtiofsdTimeout); err != nil {
+		return fmt.Errorf("field `qemu.virtiofsdTimeout` is invalid: %w", err)
+	}
+	if _, err := ParseMetricsInterval(*y.GuestAgent.MetricsInterval); err != nil {
+		return fmt.Errorf("field `guestAgent.metricsInterval` is invalid: %w", err)
+	}
+
 	if err := validateNetwork(y); err != nil {
 		return err
 	}
@@ -310,8 +491,310 @@ func Validate(y *LimaYAML, warn bool) error {
 	return nil
 }
 
+// validateDiskOptions returns an error if the disk options are invalid, or not supported on the host OS.
+func validateDiskOptions(o DiskOptions, goos string) error {
+	switch *o.CacheMode {
+	case "", DiskCacheModeWriteback, DiskCacheModeNone, DiskCacheModeUnsafe:
+	default:
+		return fmt.Errorf("field `diskOptions.cacheMode` must be one of %q, %q, %q, got %q",
+			DiskCacheModeWriteback, DiskCacheModeNone, DiskCacheModeUnsafe, *o.CacheMode)
+	}
+	switch *o.AIO {
+	case "", DiskAIOThreads:
+	case DiskAIONative, DiskAIOIOUring:
+		if goos != "linux" {
+			return fmt.Errorf("field `diskOptions.aio` %q is only supported on Linux hosts", *o.AIO)
+		}
+		// QEMU requires cache.direct=on for aio=native
+		if *o.AIO == DiskAIONative && *o.CacheMode != DiskCacheModeNone {
+			return fmt.Errorf("field `diskOptions.aio` %q requires `diskOptions.cacheMode` to be %q, got %q",
+				DiskAIONative, DiskCacheModeNone, *o.CacheMode)
+		}
+	default:
+		return fmt.Errorf("field `diskOptions.aio` must be one of %q, %q, %q, got %q",
+			DiskAIOThreads, DiskAIONative, DiskAIOIOUring, *o.AIO)
+	}
+	return nil
+}
+
+// validateDiskThrottle returns an error if the throttling limits are negative, unparsable, or conflicting.
+func validateDiskThrottle(t DiskThrottle) error {
+	for _, f := range []struct {
+		name  string
+		value int64
+	}{{"iops", *t.IOPS}, {"readIOPS", *t.ReadIOPS}, {"writeIOPS", *t.WriteIOPS}} {
+		if f.value < 0 {
+			return fmt.Errorf("field `diskOptions.throttle.%s` must be non-negative, got %d", f.name, f.value)
+		}
+	}
+	for _, f := range []struct {
+		name  string
+		value string
+	}{{"bps", *t.BPS}, {"readBPS", *t.ReadBPS}, {"writeBPS", *t.WriteBPS}} {
+		v, err := units.RAMInBytes(f.value)
+		if err != nil {
+			return fmt.Errorf("field `diskOptions.throttle.%s` has an invalid value %q: %w", f.name, f.value, err)
+		}
+		if v < 0 {
+			return fmt.Errorf("field `diskOptions.throttle.%s` must be non-negative, got %q", f.name, f.value)
+		}
+	}
+	if *t.IOPS > 0 && (*t.ReadIOPS > 0 || *t.WriteIOPS > 0) {
+		return errors.New("field `diskOptions.throttle.iops` cannot be combined with `readIOPS` and `writeIOPS`")
+	}
+	// the values were validated above
+	bps, _ := units.RAMInBytes(*t.BPS)
+	readBPS, _ := units.RAMInBytes(*t.ReadBPS)
+	writeBPS, _ := units.RAMInBytes(*t.WriteBPS)
+	if bps > 0 && (readBPS > 0 || writeBPS > 0) {
+		return errors.New("field `diskOptions.throttle.bps` cannot be combined with `readBPS` and `writeBPS`")
+	}
+	return nil
+}
+
+// maxMountTagLength is the maximum length of the tag of virtio-fs devices.
+// The tag of 9p devices can be longer, but the same limit is applied for simplicity.
+const maxMountTagLength = 36
+
+var mountTagRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// envKeyRegexp matches the valid names of environment variables.
+var envKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sshTimeRegexp matches the time format of sshd_config(5), e.g., "600", "10m", "1h30m".
+var sshTimeRegexp = regexp.MustCompile(`^([0-9]+[sSmMhHdDwW]?)+$`)
+
+// pciAddressRegexp matches the PCI addresses in the "domain:bus:device.function" format, e.g., "0000:01:00.0".
+var pciAddressRegexp = regexp.MustCompile(`^[0-9a-f]{4}:[0-9a-f]{2}:[0-1][0-9a-f]\.[0-7]$`)
+
+// validateMountTags validates `mounts[].tag`, which must be unique.
+func validateMountTags(mounts []Mount) error {
+	tags := make(map[string]int, len(mounts))
+	for i, f := range mounts {
+		if len(f.Tag) > maxMountTagLength {
+			return fmt.Errorf("field `mounts[%d].tag` must not be longer than %d bytes, got %q", i, maxMountTagLength, f.Tag)
+		}
+		if !mountTagRegexp.MatchString(f.Tag) {
+			return fmt.Errorf("field `mounts[%d].tag` must consist of alphanumeric characters, '_', '.', and '-', got %q", i, f.Tag)
+		}
+		if j, ok := tags[f.Tag]; ok {
+			return fmt.Errorf("field `mounts[%d].tag` %q is already used by `mounts[%d]`", i, f.Tag, j)
+		}
+		tags[f.Tag] = i
+	}
+	return nil
+}
+
+// ParseBootTimeout parses the value of `boot.timeout`, and rejects non-positive durations.
+func ParseBootTimeout(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration %q must be positive", s)
+	}
+	return d, nil
+}
+
+// ParseVirtiofsdTimeout parses the value of `qemu.virtiofsdTimeout`, and rejects non-positive durations.
+func ParseVirtiofsdTimeout(s string) (time.Duration, error) {
+	return ParseBootTimeout(s)
+}
+
+// machineHasPCIe returns true if the QEMU machine type has the PCIe root complex, which accepts "pcie-root-port".
+// The empty machine type is the default of the architecture, i.e., "q35" or "virt".
+func machineHasPCIe(machine string) bool {
+	return machine == "" || strings.Contains(machine, "q35") || machine == "virt" || strings.HasPrefix(machine, "virt-")
+}
+
+// ValidateHostResources validates the fields that depend on the current host, e.g., `memory` must not exceed the host memory.
+// This is not a part of [Validate], as an existing instance must not be considered to be broken
+// just because it was created on a larger host.
+func ValidateHostResources(y *LimaYAML) error {
+	memBytes, err := units.RAMInBytes(*y.Memory)
+	if err != nil {
+		return fmt.Errorf("field `memory` has an invalid value: %w", err)
+	}
+	if hostMemory := memory.TotalMemory(); hostMemory != 0 && uint64(memBytes) > hostMemory {
+		return fmt.Errorf("field `memory` (%q) must not exceed the host memory (%s)", *y.Memory, units.BytesSize(float64(hostMemory)))
+	}
+	return nil
+}
+
+// ParseShutdownTimeout parses the value of `shutdown.timeout`, and rejects negative durations.
+func ParseShutdownTimeout(s string) (time.Duration, error) {
+	return parseNonNegativeDuration(s)
+}
+
+// ParseMetricsInterval parses the value of `guestAgent.metricsInterval`, and rejects negative durations.
+func ParseMetricsInterval(s string) (time.Duration, error) {
+	return parseNonNegativeDuration(s)
+}
+
+func parseNonNegativeDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative, got %q", s)
+	}
+	return d, nil
+}
+
+// validateAudioOutput returns an error if the QEMU audiodev backend is not available on the host OS.
+func validateAudioOutput(output string) error {
+	available := []string{"none"}
+	switch runtime.GOOS {
+	case "darwin":
+		available = append(available, "coreaudio")
+	case "linux":
+		available = append(available, "pa", "pipewire", "alsa", "oss")
+	case "windows":
+		available = append(available, "dsound")
+	}
+	if !slices.Contains(available, output) {
+		return fmt.Errorf("field `audio.output` must be one of %v on %s, got %q", available, runtime.GOOS, output)
+	}
+	return nil
+}
+
+func validateCPUTopology(t CPUTopology, cpus int) error {
+	if t.Sockets == nil && t.Cores == nil && t.Threads == nil {
+		return nil
+	}
+	if t.Sockets == nil || t.Cores == nil || t.Threads == nil {
+		return errors.New("field `cpuTopology` must specify all of `sockets`, `cores`, and `threads`")
+	}
+	if *t.Sockets < 1 || *t.Cores < 1 || *t.Threads < 1 {
+		return fmt.Errorf("field `cpuTopology` must have positive values, got sockets=%d, cores=%d, threads=%d",
+			*t.Sockets, *t.Cores, *t.Threads)
+	}
+	if product := *t.Sockets * *t.Cores * *t.Threads; product != cpus {
+		return fmt.Errorf("field `cpuTopology` (sockets=%d, cores=%d, threads=%d) has %d vCPUs, but field `cpus` is %d; "+
+			"adjust either `cpus` or `cpuTopology` so that sockets*cores*threads equals cpus",
+			*t.Sockets, *t.Cores, *t.Threads, product, cpus)
+	}
+	return nil
+}
+
+// validateNUMA returns an error unless the NUMA nodes cover each of the vCPUs exactly once,
+// and the memory of the nodes sums up to the memory size.
+func validateNUMA(nodes []NUMANode, cpus int, memory string) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	memBytes, err := units.RAMInBytes(memory)
+	if err != nil {
+		return err
+	}
+	owner := make([]int, cpus)
+	for i := range owner {
+		owner[i] = -1
+	}
+	var nodesMemBytes int64
+	for i, node := range nodes {
+		field := fmt.Sprintf("numa[%d]", i)
+		nodeCPUs, err := ParseCPURanges(node.CPUs)
+		if err != nil {
+			return fmt.Errorf("field `%s.cpus` has an invalid value: %w", field, err)
+		}
+		for _, c := range nodeCPUs {
+			if c >= cpus {
+				return fmt.Errorf("field `%s.cpus` has vCPU %d, but field `cpus` is %d", field, c, cpus)
+			}
+			if owner[c] != -1 {
+				return fmt.Errorf("field `%s.cpus` has vCPU %d, which is already assigned to `numa[%d]`", field, c, owner[c])
+			}
+			owner[c] = i
+		}
+		nodeMemBytes, err := units.RAMInBytes(node.Memory)
+		if err != nil {
+			return fmt.Errorf("field `%s.memory` has an invalid value: %w", field, err)
+		}
+		if nodeMemBytes <= 0 {
+			return fmt.Errorf("field `%s.memory` must be positive, got %q", field, node.Memory)
+		}
+		nodesMemBytes += nodeMemBytes
+	}
+	if c := slices.Index(owner, -1); c != -1 {
+		return fmt.Errorf("field `numa` does not assign vCPU %d to any node; the nodes must cover all the %d vCPUs", c, cpus)
+	}
+	if nodesMemBytes != memBytes {
+		return fmt.Errorf("field `numa` has %s of memory in total, but field `memory` is %s",
+			units.BytesSize(float64(nodesMemBytes)), units.BytesSize(float64(memBytes)))
+	}
+	return nil
+}
+
+// ParseCPURanges parses the comma-separated list of vCPU indices and ranges, such as "0-3,6".
+func ParseCPURanges(s string) ([]int, error) {
+	var res []int
+	for _, r := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(r), "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vCPU index %q", lo)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(hi)
+			if err != nil {
+				return nil, fmt.Errorf("invalid vCPU index %q", hi)
+			}
+		}
+		if first < 0 || last < first || last-first >= 1<<16 {
+			return nil, fmt.Errorf("invalid vCPU range %q", r)
+		}
+		for c := first; c <= last; c++ {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func validateUSBDevice(dev USBDevice) error {
+	byID := dev.VendorID != nil || dev.ProductID != nil
+	byAddr := dev.HostBus != nil || dev.HostAddr != nil
+	switch {
+	case byID && byAddr:
+		return errors.New("`vendorId` and `productId` cannot be combined with `hostBus` and `hostAddr`")
+	case byID:
+		if dev.VendorID == nil || dev.ProductID == nil {
+			return errors.New("both `vendorId` and `productId` must be set")
+		}
+		if _, err := ParseUSBID(*dev.VendorID); err != nil {
+			return fmt.Errorf("field `vendorId` has an invalid value: %w", err)
+		}
+		if _, err := ParseUSBID(*dev.ProductID); err != nil {
+			return fmt.Errorf("field `productId` has an invalid value: %w", err)
+		}
+	case byAddr:
+		if dev.HostBus == nil || dev.HostAddr == nil {
+			return errors.New("both `hostBus` and `hostAddr` must be set")
+		}
+		if *dev.HostBus < 0 || *dev.HostAddr < 0 {
+			return errors.New("`hostBus` and `hostAddr` must not be negative")
+		}
+	default:
+		return errors.New("either `vendorId` and `productId`, or `hostBus` and `hostAddr` must be set")
+	}
+	return nil
+}
+
+// ParseUSBID parses a hexadecimal USB vendor or product ID, with or without the "0x" prefix.
+func ParseUSBID(s string) (uint16, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(s), "0x"), 16, 16)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(v), nil
+}
+
 func validateNetwork(y *LimaYAML) error {
 	interfaceName := make(map[string]int)
+	macAddress := make(map[string]int)
 	for i, nw := range y.Networks {
 		field := fmt.Sprintf("networks[%d]", i)
 		if nw.Lima != "" {
@@ -365,6 +848,10 @@ func validateNetwork(y *LimaYAML) error {
 			if len(hw) != 6 {
 				return fmt.Errorf("field `%s.macAddress` must be a 48 bit (6 bytes) MAC address; actual length of %q is %d bytes", field, nw.MACAddress, len(hw))
 			}
+			if prev, ok := macAddress[hw.String()]; ok {
+				return fmt.Errorf("field `%s.macAddress` value %q has already been used by field `networks[%d].macAddress`", field, nw.MACAddress, prev)
+			}
+			macAddress[hw.String()] = i
 		}
 		// FillDefault() will make sure that nw.Interface is not the empty string
 		if len(nw.Interface) >= 16 {
@@ -414,10 +901,25 @@ func warnExperimental(y *LimaYAML) {
 	if y.Video.Display != nil && strings.Contains(*y.Video.Display, "vnc") {
 		logrus.Warn("`video.display: vnc` is experimental")
 	}
+	if y.Video.Accel != nil && *y.Video.Accel != "" {
+		logrus.Warn("`video.accel` is experimental")
+	}
 	if y.Audio.Device != nil && *y.Audio.Device != "" {
 		logrus.Warn("`audio.device` is experimental")
 	}
 	if y.MountInotify != nil && *y.MountInotify {
 		logrus.Warn("`mountInotify` is experimental")
 	}
+	if y.MemoryBalloon.Enabled != nil && *y.MemoryBalloon.Enabled {
+		logrus.Warn("`memoryBalloon.enabled` is experimental")
+	}
+	if len(y.USBDevices) > 0 {
+		logrus.Warn("`usbDevices` is experimental")
+	}
+	if len(y.NUMA) > 0 {
+		logrus.Warn("`numa` is experimental")
+	}
+	if y.TPM.Enabled != nil && *y.TPM.Enabled {
+		logrus.Warn("`tpm.enabled` is experimental")
+	}
 }
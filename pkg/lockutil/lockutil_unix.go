@@ -44,6 +44,25 @@ func WithDirLock(dir string, fn func() error) error {
 	return fn()
 }
 
+// TryLockFile acquires an exclusive lock on the file without blocking, creating the file if needed.
+// The returned function releases the lock.
+func TryLockFile(path string) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := Flock(f, unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to lock %q: %w", path, err)
+	}
+	return func() {
+		if err := Flock(f, unix.LOCK_UN); err != nil {
+			logrus.WithError(err).Errorf("failed to unlock %q", path)
+		}
+		_ = f.Close()
+	}, nil
+}
+
 func Flock(f *os.File, flags int) error {
 	fd := int(f.Fd())
 	for {
@@ -53,6 +53,26 @@ func WithDirLock(dir string, fn func() error) error {
 	return fn()
 }
 
+// TryLockFile acquires an exclusive lock on the file without blocking, creating the file if needed.
+// The returned function releases the lock.
+func TryLockFile(path string) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// 2 exclusive lock | 1 lock immediately
+	if err := lockFileEx(syscall.Handle(f.Fd()), 2|1, 0, 1, 0, &syscall.Overlapped{}); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to lock %q: %w", path, err)
+	}
+	return func() {
+		if err := unlockFileEx(syscall.Handle(f.Fd()), 0, 1, 0, &syscall.Overlapped{}); err != nil {
+			logrus.WithError(err).Errorf("failed to unlock %q", path)
+		}
+		_ = f.Close()
+	}, nil
+}
+
 func lockFileEx(h syscall.Handle, flags, reserved, locklow, lockhigh uint32, ol *syscall.Overlapped) (err error) {
 	r, _, err := procLockFileEx.Call(uintptr(h), uintptr(flags), uintptr(reserved), uintptr(locklow), uintptr(lockhigh), uintptr(unsafe.Pointer(ol)))
 	if r == 0 {
@@ -35,7 +35,7 @@ func Reconcile(ctx context.Context, newInst string) error {
 			return err
 		}
 		// newInst is about to be started, so its networks should be running
-		if instance.Status != store.StatusRunning && instName != newInst {
+		if instance.Status != store.StatusRunning && instance.Status != store.StatusPaused && instName != newInst {
 			continue
 		}
 		for _, nw := range instance.Networks {
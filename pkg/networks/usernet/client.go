@@ -49,6 +49,22 @@ func (c *Client) UnExposeSSH(sshPort int) error {
 	})
 }
 
+// ExposeUDP forwards the UDP port local of the host to the UDP address remote of the guest.
+func (c *Client) ExposeUDP(local, remote string) error {
+	return c.delegate.Expose(&types.ExposeRequest{
+		Local:    local,
+		Remote:   remote,
+		Protocol: "udp",
+	})
+}
+
+func (c *Client) UnExposeUDP(local string) error {
+	return c.delegate.Unexpose(&types.UnexposeRequest{
+		Local:    local,
+		Protocol: "udp",
+	})
+}
+
 func (c *Client) AddDNSHosts(hosts map[string]string) error {
 	hosts["host.lima.internal"] = GatewayIP(c.subnet)
 	zones := dnshosts.ExtractZones(hosts)
@@ -0,0 +1,30 @@
+package osutil
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// RemoveStaleSocket removes the UNIX socket at path, if no process is listening on it.
+// It returns an error if path exists but is not a socket, or if the socket is still in use.
+func RemoveStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%q exists and is not a socket", path)
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("socket %q is already in use", path)
+	}
+	return os.Remove(path)
+}
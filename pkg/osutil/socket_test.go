@@ -0,0 +1,42 @@
+package osutil
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRemoveStaleSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on windows")
+	}
+	dir := t.TempDir()
+
+	assert.NilError(t, RemoveStaleSocket(filepath.Join(dir, "missing.sock")))
+
+	file := filepath.Join(dir, "file")
+	assert.NilError(t, os.WriteFile(file, nil, 0o644))
+	assert.ErrorContains(t, RemoveStaleSocket(file), "is not a socket")
+	assert.ErrorContains(t, RemoveStaleSocket(dir), "is not a socket")
+
+	live := filepath.Join(dir, "live.sock")
+	ln, err := net.Listen("unix", live)
+	assert.NilError(t, err)
+	defer ln.Close()
+	assert.ErrorContains(t, RemoveStaleSocket(live), "is already in use")
+	_, err = os.Lstat(live)
+	assert.NilError(t, err)
+
+	dead := filepath.Join(dir, "dead.sock")
+	ln2, err := net.Listen("unix", dead)
+	assert.NilError(t, err)
+	ln2.(*net.UnixListener).SetUnlinkOnClose(false)
+	assert.NilError(t, ln2.Close())
+	assert.NilError(t, RemoveStaleSocket(dead))
+	_, err = os.Lstat(dead)
+	assert.Assert(t, os.IsNotExist(err))
+}
@@ -0,0 +1,36 @@
+package pause
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+)
+
+// Pause stops the vCPUs of the running instance.
+// The request is sent to the host agent, which tracks the paused state of the instance.
+func Pause(ctx context.Context, inst *store.Instance) error {
+	if inst.Status != store.StatusRunning {
+		return fmt.Errorf("expected status %q, got %q", store.StatusRunning, inst.Status)
+	}
+	haClient, err := hostagentclient.NewHostAgentClient(filepath.Join(inst.Dir, filenames.HostAgentSock))
+	if err != nil {
+		return err
+	}
+	return haClient.Pause(ctx)
+}
+
+// Resume restarts the vCPUs of the paused instance.
+func Resume(ctx context.Context, inst *store.Instance) error {
+	if inst.Status != store.StatusPaused {
+		return fmt.Errorf("expected status %q, got %q", store.StatusPaused, inst.Status)
+	}
+	haClient, err := hostagentclient.NewHostAgentClient(filepath.Join(inst.Dir, filenames.HostAgentSock))
+	if err != nil {
+		return err
+	}
+	return haClient.Resume(ctx)
+}
@@ -0,0 +1,61 @@
+package portfwd
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+)
+
+// ServeTunnel is the guest side of a UDP flow.
+// It relays the datagrams of the stream to the address specified in the first message,
+// and the replies back to the stream, until the stream is closed.
+func ServeTunnel(stream Stream) error {
+	msg, err := stream.Recv()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+	conn, err := net.Dial("udp", msg.GuestAddr)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				// The previous datagram was rejected with ICMP "port unreachable"
+				if errors.Is(err, syscall.ECONNREFUSED) {
+					continue
+				}
+				return
+			}
+			if err := stream.Send(&api.TunnelMessage{Data: append([]byte(nil), buf[:n]...)}); err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		_ = conn.Close()
+		<-done
+	}()
+	for {
+		if _, err := conn.Write(msg.Data); err != nil && !errors.Is(err, syscall.ECONNREFUSED) {
+			return err
+		}
+		msg, err = stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Package portfwd relays UDP datagrams between the host and the guest over the tunnel of the guest agent.
+package portfwd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultUDPIdleTimeout is the duration after which an inactive flow is closed.
+const DefaultUDPIdleTimeout = 60 * time.Second
+
+// maxDatagramSize is the maximum size of a UDP payload.
+const maxDatagramSize = 65535
+
+// Stream is a tunnel stream, implemented by both the client and the server sides of the Tunnel RPC.
+type Stream interface {
+	Send(*api.TunnelMessage) error
+	Recv() (*api.TunnelMessage, error)
+}
+
+// DialFunc opens a tunnel stream to the guest agent.
+// The stream must be closed when ctx is cancelled.
+type DialFunc func(ctx context.Context) (Stream, error)
+
+// UDPForwarder relays the datagrams received on a host socket to a guest address.
+//
+// Each client address of the host socket gets its own flow, i.e., its own tunnel stream
+// and its own UDP socket in the guest, so that the replies can be sent back to the right client.
+type UDPForwarder struct {
+	conn        net.PacketConn
+	guestAddr   string
+	dial        DialFunc
+	idleTimeout time.Duration
+
+	flowsMu sync.Mutex
+	flows   map[string]*udpFlow // keyed by the client address
+}
+
+type udpFlow struct {
+	stream     Stream
+	cancel     context.CancelFunc
+	lastActive atomic.Int64 // UnixNano
+}
+
+func (fl *udpFlow) touch() {
+	fl.lastActive.Store(time.Now().UnixNano())
+}
+
+func NewUDPForwarder(conn net.PacketConn, guestAddr string, dial DialFunc, idleTimeout time.Duration) *UDPForwarder {
+	return &UDPForwarder{
+		conn:        conn,
+		guestAddr:   guestAddr,
+		dial:        dial,
+		idleTimeout: idleTimeout,
+		flows:       make(map[string]*udpFlow),
+	}
+}
+
+// Serve relays the datagrams until ctx is cancelled.
+// The conn is closed on return.
+func (f *UDPForwarder) Serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		_ = f.conn.Close()
+	}()
+	go f.expireFlows(ctx)
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		fl, err := f.flow(ctx, addr)
+		if err != nil {
+			logrus.WithError(err).Warnf("failed to open a tunnel for the UDP flow from %s to %s", addr, f.guestAddr)
+			continue
+		}
+		fl.touch()
+		msg := &api.TunnelMessage{
+			GuestAddr: f.guestAddr,
+			Data:      append([]byte(nil), buf[:n]...),
+		}
+		if err := fl.stream.Send(msg); err != nil {
+			logrus.WithError(err).Debugf("failed to send a UDP datagram from %s to %s", addr, f.guestAddr)
+			f.closeFlow(addr.String(), fl)
+		}
+	}
+}
+
+// NumFlows returns the number of the active flows.
+func (f *UDPForwarder) NumFlows() int {
+	f.flowsMu.Lock()
+	defer f.flowsMu.Unlock()
+	return len(f.flows)
+}
+
+func (f *UDPForwarder) flow(ctx context.Context, addr net.Addr) (*udpFlow, error) {
+	key := addr.String()
+	f.flowsMu.Lock()
+	defer f.flowsMu.Unlock()
+	if fl, ok := f.flows[key]; ok {
+		return fl, nil
+	}
+	flowCtx, cancel := context.WithCancel(ctx)
+	stream, err := f.dial(flowCtx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	fl := &udpFlow{
+		stream: stream,
+		cancel: cancel,
+	}
+	fl.touch()
+	f.flows[key] = fl
+	logrus.Debugf("opened the UDP flow from %s to %s", key, f.guestAddr)
+	go f.relayReplies(key, addr, fl)
+	return fl, nil
+}
+
+func (f *UDPForwarder) relayReplies(key string, addr net.Addr, fl *udpFlow) {
+	defer f.closeFlow(key, fl)
+	for {
+		msg, err := fl.stream.Recv()
+		if err != nil {
+			return
+		}
+		fl.touch()
+		if _, err := f.conn.WriteTo(msg.Data, addr); err != nil {
+			return
+		}
+	}
+}
+
+func (f *UDPForwarder) closeFlow(key string, fl *udpFlow) {
+	f.flowsMu.Lock()
+	if f.flows[key] == fl {
+		delete(f.flows, key)
+		logrus.Debugf("closed the UDP flow from %s to %s", key, f.guestAddr)
+	}
+	f.flowsMu.Unlock()
+	fl.cancel()
+}
+
+func (f *UDPForwarder) expireFlows(ctx context.Context) {
+	ticker := time.NewTicker(f.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			var idle []*udpFlow
+			f.flowsMu.Lock()
+			for key, fl := range f.flows {
+				if now.Sub(time.Unix(0, fl.lastActive.Load())) > f.idleTimeout {
+					logrus.Debugf("closing the idle UDP flow from %s to %s", key, f.guestAddr)
+					delete(f.flows, key)
+					idle = append(idle, fl)
+				}
+			}
+			f.flowsMu.Unlock()
+			for _, fl := range idle {
+				fl.cancel()
+			}
+		}
+	}
+}
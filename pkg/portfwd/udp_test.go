@@ -0,0 +1,127 @@
+package portfwd
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+)
+
+// pipeStream is one end of an in-memory tunnel stream.
+type pipeStream struct {
+	ctx  context.Context
+	send chan<- *api.TunnelMessage
+	recv <-chan *api.TunnelMessage
+}
+
+func (s *pipeStream) Send(msg *api.TunnelMessage) error {
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	case s.send <- msg:
+		return nil
+	}
+}
+
+func (s *pipeStream) Recv() (*api.TunnelMessage, error) {
+	select {
+	case <-s.ctx.Done():
+		return nil, io.EOF
+	case msg := <-s.recv:
+		return msg, nil
+	}
+}
+
+// dialPipe runs ServeTunnel on the other end of the stream, like the guest agent does.
+func dialPipe(ctx context.Context) (Stream, error) {
+	toGuest := make(chan *api.TunnelMessage)
+	toHost := make(chan *api.TunnelMessage)
+	go func() {
+		_ = ServeTunnel(&pipeStream{ctx: ctx, send: toHost, recv: toGuest})
+	}()
+	return &pipeStream{ctx: ctx, send: toGuest, recv: toHost}, nil
+}
+
+func startEchoServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.WriteTo(append([]byte("echo: "), buf[:n]...), addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func startForwarder(t *testing.T, idleTimeout time.Duration) (*UDPForwarder, string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	f := NewUDPForwarder(conn, startEchoServer(t), dialPipe, idleTimeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- f.Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.NilError(t, <-done)
+	})
+	return f, conn.LocalAddr().String()
+}
+
+func roundTrip(t *testing.T, conn net.Conn, s string) string {
+	_, err := conn.Write([]byte(s))
+	assert.NilError(t, err)
+	assert.NilError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, maxDatagramSize)
+	n, err := conn.Read(buf)
+	assert.NilError(t, err)
+	return string(buf[:n])
+}
+
+func TestUDPForwarder(t *testing.T) {
+	f, addr := startForwarder(t, DefaultUDPIdleTimeout)
+
+	client1, err := net.Dial("udp", addr)
+	assert.NilError(t, err)
+	defer client1.Close()
+	client2, err := net.Dial("udp", addr)
+	assert.NilError(t, err)
+	defer client2.Close()
+
+	assert.Equal(t, "echo: hello", roundTrip(t, client1, "hello"))
+	assert.Equal(t, "echo: world", roundTrip(t, client2, "world"))
+	assert.Equal(t, "echo: again", roundTrip(t, client1, "again"))
+	assert.Equal(t, 2, f.NumFlows())
+}
+
+func TestUDPForwarderIdleTimeout(t *testing.T) {
+	f, addr := startForwarder(t, 100*time.Millisecond)
+
+	client, err := net.Dial("udp", addr)
+	assert.NilError(t, err)
+	defer client.Close()
+
+	assert.Equal(t, "echo: hello", roundTrip(t, client, "hello"))
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if n := f.NumFlows(); n != 0 {
+			return poll.Continue("%d flows are still open", n)
+		}
+		return poll.Success()
+	}, poll.WithTimeout(5*time.Second))
+
+	// A new flow is opened for the next datagram
+	assert.Equal(t, "echo: again", roundTrip(t, client, "again"))
+	assert.Equal(t, 1, f.NumFlows())
+}
@@ -0,0 +1,94 @@
+// Package progress defines the structured progress events emitted while starting an instance.
+//
+// Unlike the log messages, the phases are stable, so that GUI frontends can show the progress
+// without parsing the log messages.
+// The events are appended to the "ha.events.log" file of the instance directory,
+// and are also logged with the "progress" field when $LIMA_LOG_FORMAT is "json" (`limactl --log-format=json`).
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+type Phase = string
+
+const (
+	// DownloadingImage is emitted while downloading the image and the other files, with Current and Total.
+	DownloadingImage Phase = "downloading-image"
+	CreatingDisk     Phase = "creating-disk"
+	StartingVM       Phase = "starting-vm"
+	WaitingForSSH    Phase = "waiting-for-ssh"
+	// RunningProvision is emitted while running the provisioning scripts, with Script for the ansible playbooks.
+	RunningProvision Phase = "running-provision"
+	Ready            Phase = "ready"
+)
+
+type Event struct {
+	Time  time.Time `json:"time"`
+	Phase Phase     `json:"phase"`
+	// Message is a human-readable description, e.g., the name of the file being downloaded.
+	// Message is not stable.
+	Message string `json:"message,omitempty"`
+	// Current and Total are the number of bytes downloaded so far, and the total size (-1 if unknown).
+	Current int64 `json:"current,omitempty"`
+	Total   int64 `json:"total,omitempty"`
+	// Script is the 1-based index of the provisioning script in the `provision` field.
+	Script int `json:"script,omitempty"`
+}
+
+type instanceDirKey struct{}
+
+// WithInstanceDir returns a context that emits the events into the events log file of instDir.
+// Emit is no-op for a context without the instance dir.
+func WithInstanceDir(ctx context.Context, instDir string) context.Context {
+	return context.WithValue(ctx, instanceDirKey{}, instDir)
+}
+
+// JSON returns true when the log format is JSON.
+func JSON() bool {
+	return os.Getenv("LIMA_LOG_FORMAT") == "json"
+}
+
+var mu sync.Mutex
+
+// Emit appends ev to the events log file of the instance dir of ctx, and logs it in the JSON log format.
+func Emit(ctx context.Context, ev Event) {
+	instDir, ok := ctx.Value(instanceDirKey{}).(string)
+	if !ok {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to marshal a progress event")
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if JSON() {
+		msg := ev.Message
+		if msg == "" {
+			msg = ev.Phase
+		}
+		logrus.WithField("progress", ev).Info(msg)
+	}
+	f, err := os.OpenFile(filepath.Join(instDir, filenames.HostAgentEventsLog), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to open the events log file")
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		logrus.WithError(err).Warn("failed to write a progress event")
+	}
+}
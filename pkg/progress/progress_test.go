@@ -0,0 +1,28 @@
+package progress
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func TestEmit(t *testing.T) {
+	instDir := t.TempDir()
+	// no-op without the instance dir
+	Emit(context.Background(), Event{Phase: Ready})
+
+	ctx := WithInstanceDir(context.Background(), instDir)
+	Emit(ctx, Event{Phase: DownloadingImage, Current: 1, Total: 2})
+	Emit(ctx, Event{Phase: RunningProvision, Script: 3})
+	b, err := os.ReadFile(filepath.Join(instDir, filenames.HostAgentEventsLog))
+	assert.NilError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Equal(t, len(lines), 2)
+	assert.Assert(t, strings.Contains(lines[0], `"phase":"downloading-image","current":1,"total":2`), lines[0])
+	assert.Assert(t, strings.Contains(lines[1], `"phase":"running-provision","script":3`), lines[1])
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os/exec"
 
+	"github.com/docker/go-units"
 	"github.com/sirupsen/logrus"
 )
 
@@ -91,6 +92,26 @@ func ConvertToRaw(source, dest string) error {
 	return nil
 }
 
+// ConvertToStandaloneQcow2 converts the qcow2 image source to the qcow2 image dest, which does not have a backing file.
+// The internal snapshots are not converted.
+// forceShare allows reading the image while it is in use.
+func ConvertToStandaloneQcow2(source, dest string, forceShare bool) error {
+	args := []string{"convert", "-f", "qcow2", "-O", "qcow2"}
+	if forceShare {
+		args = append(args, "--force-share")
+	}
+	args = append(args, source, dest)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("qemu-img", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run %v: stdout=%q, stderr=%q: %w",
+			cmd.Args, stdout.String(), stderr.String(), err)
+	}
+	return nil
+}
+
 func ParseInfo(b []byte) (*Info, error) {
 	var imgInfo Info
 	if err := json.Unmarshal(b, &imgInfo); err != nil {
@@ -111,6 +132,48 @@ func GetInfo(f string) (*Info, error) {
 	return ParseInfo(stdout.Bytes())
 }
 
+// Check corresponds to the output of `qemu-img check --output=json FILE`.
+type Check struct {
+	Filename          string `json:"filename,omitempty"`
+	Format            string `json:"format,omitempty"`
+	AllocatedClusters int64  `json:"allocated-clusters,omitempty"`
+	TotalClusters     int64  `json:"total-clusters,omitempty"`
+	ImageEndOffset    int64  `json:"image-end-offset,omitempty"`
+	Corruptions       int    `json:"corruptions,omitempty"`
+	Leaks             int    `json:"leaks,omitempty"`
+}
+
+func ParseCheck(b []byte) (*Check, error) {
+	var imgCheck Check
+	if err := json.Unmarshal(b, &imgCheck); err != nil {
+		return nil, err
+	}
+	return &imgCheck, nil
+}
+
+func GetCheck(f string) (*Check, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("qemu-img", "check", "--output=json", f)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// exit status 2 and 3 report corruptions and leaks, with the JSON output
+	if err := cmd.Run(); err != nil && stdout.Len() == 0 {
+		return nil, fmt.Errorf("failed to run %v: stdout=%q, stderr=%q: %w",
+			cmd.Args, stdout.String(), stderr.String(), err)
+	}
+	return ParseCheck(stdout.Bytes())
+}
+
+// NeedsGrow returns whether the image has to be grown to size bytes.
+// NeedsGrow returns an error when size is less than the current virtual size, as shrinking is unsupported.
+func NeedsGrow(info *Info, size int64) (bool, error) {
+	if size < info.VSize {
+		return false, fmt.Errorf("specified size %q is less than the current disk size %q. Disk shrinking is currently unavailable",
+			units.BytesSize(float64(size)), units.BytesSize(float64(info.VSize)))
+	}
+	return size > info.VSize, nil
+}
+
 func AcceptableAsBasedisk(info *Info) error {
 	switch info.Format {
 	case "qcow2", "raw":
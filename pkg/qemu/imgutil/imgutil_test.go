@@ -210,3 +210,42 @@ func TestParseInfo(t *testing.T) {
 		})
 	})
 }
+
+func TestParseCheck(t *testing.T) {
+	// qemu-img check --output=json foo.qcow2
+	const s = `{
+    "image-end-offset": 262144,
+    "total-clusters": 65536,
+    "check-errors": 0,
+    "allocated-clusters": 1,
+    "filename": "foo.qcow2",
+    "format": "qcow2",
+    "fragmented-clusters": 0
+}`
+	imgCheck, err := ParseCheck([]byte(s))
+	assert.NilError(t, err)
+	assert.Equal(t, imgCheck.Format, "qcow2")
+	assert.Equal(t, imgCheck.AllocatedClusters, int64(1))
+	assert.Equal(t, imgCheck.TotalClusters, int64(65536))
+	assert.Equal(t, imgCheck.ImageEndOffset, int64(262144))
+}
+
+func TestNeedsGrow(t *testing.T) {
+	const size = 4294967296
+	for _, format := range []string{"qcow2", "raw"} {
+		t.Run(format, func(t *testing.T) {
+			info := &Info{Format: format, VSize: size}
+
+			grow, err := NeedsGrow(info, size*2)
+			assert.NilError(t, err)
+			assert.Check(t, grow)
+
+			grow, err = NeedsGrow(info, size)
+			assert.NilError(t, err)
+			assert.Check(t, !grow)
+
+			_, err = NeedsGrow(info, size/2)
+			assert.ErrorContains(t, err, "shrinking")
+		})
+	}
+}
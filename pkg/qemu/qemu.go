@@ -1,36 +1,48 @@
 package qemu
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"io"
 	"io/fs"
+	"math"
+	"net"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/lima-vm/lima/pkg/nativeimgutil"
 	"github.com/lima-vm/lima/pkg/networks/usernet"
 	"github.com/lima-vm/lima/pkg/osutil"
 
 	"github.com/coreos/go-semver/semver"
-	"github.com/digitalocean/go-qemu/qmp"
 	"github.com/digitalocean/go-qemu/qmp/raw"
 	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/driver"
 	"github.com/lima-vm/lima/pkg/fileutils"
 	"github.com/lima-vm/lima/pkg/iso9660util"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/qemu/imgutil"
+	"github.com/lima-vm/lima/pkg/qemu/qmpconn"
 	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
 	"github.com/lima-vm/lima/pkg/store/filenames"
 	"github.com/mattn/go-shellwords"
 	"github.com/sirupsen/logrus"
@@ -41,6 +53,26 @@ type Config struct {
 	InstanceDir  string
 	LimaYAML     *limayaml.LimaYAML
 	SSHLocalPort int
+	StartPaused  bool // start with the vCPUs paused ("-S")
+	VSockPort    int  // enables vhost-vsock-pci for the guest agent, when not 0
+
+	// qmp is shared with the driver, to serialize the QMP commands within the process.
+	qmp *qmpMonitor
+}
+
+// monitor returns the QMP monitor of the instance.
+func (cfg Config) monitor() *qmpMonitor {
+	if cfg.qmp != nil {
+		return cfg.qmp
+	}
+	return newQMPMonitor(filepath.Join(cfg.InstanceDir, filenames.QMPSock))
+}
+
+// VSockCID returns the deterministic vsock context ID of the instance.
+// The CIDs 0-2 are reserved, and the CIDs above 2^31 are avoided for the compatibility with the guest kernels.
+func VSockCID(instDir string) uint32 {
+	sha := sha256.Sum256([]byte(osutil.MachineID() + instDir))
+	return 3 + binary.BigEndian.Uint32(sha[0:4])%(math.MaxInt32-3)
 }
 
 // MinimumQemuVersion is the minimum supported QEMU version.
@@ -48,11 +80,434 @@ const (
 	MinimumQemuVersion = "4.0.0"
 )
 
+// diffDiskDriveID is the drive ID of the diffdisk, used for QMP commands such as "block_resize".
+const diffDiskDriveID = "diffdisk"
+
+// baseDiskDriveID is the drive ID of the basedisk, when the basedisk is used as the main disk without the diffdisk.
+const baseDiskDriveID = "basedisk"
+
+// mainDiskDriveID returns the drive ID of the main disk.
+func mainDiskDriveID(y *limayaml.LimaYAML) string {
+	if diskSize, _ := units.RAMInBytes(*y.Disk); diskSize > 0 {
+		return diffDiskDriveID
+	}
+	return baseDiskDriveID
+}
+
+// balloonDeviceID is the device ID of the virtio-balloon device.
+const balloonDeviceID = "balloon0"
+
+// usbBusID is the ID of the XHCI controller.
+const usbBusID = "usb-bus"
+
+// additionalDiskID returns the drive ID (or the node name, when hot-plugged) and the device ID of the additional disk.
+func additionalDiskID(name string) string {
+	return "lima-disk-" + name
+}
+
+// usbDeviceID returns the device ID of `usbDevices[index]`.
+func usbDeviceID(index int) string {
+	return fmt.Sprintf("usbdev%d", index)
+}
+
+// usbHostProperties returns the properties of the "usb-host" device for dev, in the order of the command line.
+func usbHostProperties(dev limayaml.USBDevice) ([][2]string, error) {
+	if dev.VendorID != nil && dev.ProductID != nil {
+		vendorID, err := limayaml.ParseUSBID(*dev.VendorID)
+		if err != nil {
+			return nil, err
+		}
+		productID, err := limayaml.ParseUSBID(*dev.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		return [][2]string{
+			{"vendorid", fmt.Sprintf("0x%04x", vendorID)},
+			{"productid", fmt.Sprintf("0x%04x", productID)},
+		}, nil
+	}
+	if dev.HostBus != nil && dev.HostAddr != nil {
+		return [][2]string{
+			{"hostbus", strconv.Itoa(*dev.HostBus)},
+			{"hostaddr", strconv.Itoa(*dev.HostAddr)},
+		}, nil
+	}
+	return nil, errors.New("either `vendorId` and `productId`, or `hostBus` and `hostAddr` must be set")
+}
+
+// usbHostDeviceArg returns the "-device" argument for `usbDevices[index]`.
+func usbHostDeviceArg(index int, dev limayaml.USBDevice) (string, error) {
+	props, err := usbHostProperties(dev)
+	if err != nil {
+		return "", err
+	}
+	arg := fmt.Sprintf("usb-host,bus=%s,id=%s", usbBusID, usbDeviceID(index))
+	for _, p := range props {
+		arg += "," + p[0] + "=" + p[1]
+	}
+	return arg, nil
+}
+
+// AttachUSBDevice attaches `usbDevices[index]` to the running instance using the QMP "device_add" command.
+func AttachUSBDevice(cfg Config, index int) error {
+	if index < 0 || index >= len(cfg.LimaYAML.USBDevices) {
+		return fmt.Errorf("USB device index %d is out of range (the instance has %d USB devices)", index, len(cfg.LimaYAML.USBDevices))
+	}
+	props, err := usbHostProperties(cfg.LimaYAML.USBDevices[index])
+	if err != nil {
+		return err
+	}
+	args := map[string]any{
+		"driver": "usb-host",
+		"bus":    usbBusID,
+		"id":     usbDeviceID(index),
+	}
+	for _, p := range props {
+		// the QMP command needs the numeric values, while the command line accepts strings
+		v, err := strconv.ParseUint(p[1], 0, 16)
+		if err != nil {
+			return err
+		}
+		args[p[0]] = v
+	}
+	cmd, err := json.Marshal(map[string]any{
+		"execute":   "device_add",
+		"arguments": args,
+	})
+	if err != nil {
+		return err
+	}
+	qmpClient, release, err := cfg.monitor().acquire(qmpConnectTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+	logrus.Infof("Sending QMP device_add command")
+	_, err = qmpClient.Run(cmd)
+	return err
+}
+
+// DetachUSBDevice detaches `usbDevices[index]` from the running instance using the QMP "device_del" command.
+func DetachUSBDevice(cfg Config, index int) error {
+	if index < 0 || index >= len(cfg.LimaYAML.USBDevices) {
+		return fmt.Errorf("USB device index %d is out of range (the instance has %d USB devices)", index, len(cfg.LimaYAML.USBDevices))
+	}
+	qmpClient, release, err := cfg.monitor().acquire(qmpConnectTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+	rawClient := raw.NewMonitor(qmpClient)
+	logrus.Infof("Sending QMP device_del command")
+	return rawClient.DeviceDel(usbDeviceID(index))
+}
+
+// scsiBusID is the ID of the SCSI bus of the virtio-scsi controller, which also hosts the cloud-init CD-ROM.
+// Additional disks are hot-plugged into this bus, as the PCIe root bus of q35 and virt does not support hot-plugging.
+const scsiBusID = "scsi0.0"
+
+// AttachDisk hot-plugs the additional disk to the running instance,
+// using the QMP "blockdev-add" and "device_add" commands.
+// The disk is attached as a SCSI disk until the next start, which attaches it as a virtio disk.
+func AttachDisk(cfg Config, disk *store.Disk) error {
+	id := additionalDiskID(disk.Name)
+	blockdevAdd, err := json.Marshal(map[string]any{
+		"execute": "blockdev-add",
+		"arguments": map[string]any{
+			"driver":    disk.Format,
+			"node-name": id,
+			"file": map[string]any{
+				"driver":   "file",
+				"filename": filepath.Join(disk.Dir, filenames.DataDisk),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	deviceAdd, err := json.Marshal(map[string]any{
+		"execute": "device_add",
+		"arguments": map[string]any{
+			"driver": "scsi-hd",
+			"bus":    scsiBusID,
+			"drive":  id,
+			"id":     id,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	qmpClient, release, err := cfg.monitor().acquire(qmpConnectTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+	logrus.Infof("Sending QMP blockdev-add command")
+	if _, err := qmpClient.Run(blockdevAdd); err != nil {
+		return err
+	}
+	logrus.Infof("Sending QMP device_add command")
+	if _, err := qmpClient.Run(deviceAdd); err != nil {
+		rawClient := raw.NewMonitor(qmpClient)
+		if delErr := rawClient.BlockdevDel(id); delErr != nil {
+			err = errors.Join(err, delErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// DetachDisk hot-unplugs the additional disk from the running instance, using the QMP "device_del" command.
+// A disk that was hot-plugged is also removed from the block layer, using the QMP "blockdev-del" command.
+func DetachDisk(cfg Config, diskName string) error {
+	id := additionalDiskID(diskName)
+	qmpClient, release, err := cfg.monitor().acquire(qmpConnectTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+	b, err := qmpClient.Run([]byte(`{"execute": "query-block"}`))
+	if err != nil {
+		return err
+	}
+	qdev, hotplugged, err := findAdditionalDisk(b, id)
+	if err != nil {
+		return err
+	}
+	rawClient := raw.NewMonitor(qmpClient)
+	logrus.Infof("Sending QMP device_del command")
+	if err := rawClient.DeviceDel(qdev); err != nil {
+		return fmt.Errorf("failed to detach disk %q (hint: stop the instance, the disk is then detached on the next start): %w", diskName, err)
+	}
+	if !hotplugged {
+		// the drive is deleted by QEMU along with the device
+		return nil
+	}
+	// the device is deleted asynchronously, after the guest releases it
+	logrus.Infof("Sending QMP blockdev-del command")
+	const timeout = 10 * time.Second
+	for deadline := time.Now().Add(timeout); ; time.Sleep(500 * time.Millisecond) {
+		err = rawClient.BlockdevDel(id)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+	}
+}
+
+// hotplugPortID returns the ID of the PCIe root port reserved by `qemu.hotplugPorts`.
+func hotplugPortID(index int) string {
+	return fmt.Sprintf("hotplug%d", index)
+}
+
+// hotplugNICPrefix is the prefix of the IDs of the NICs added by AddNIC.
+const hotplugNICPrefix = "nic-hotplug"
+
+// hotplugNetdevID returns the ID of the network backend of the NIC added by AddNIC.
+func hotplugNetdevID(nicID string) string {
+	return nicID + "-netdev"
+}
+
+// AddNIC hot-plugs a virtio-net NIC connected to nw (a network of networks.yaml, or a QEMU-compatible socket)
+// into the running instance, using the QMP "getfd", "netdev_add", and "device_add" commands.
+// The NIC is plugged into a free port reserved by `qemu.hotplugPorts`, or into the root bus when no port is reserved.
+// The NIC is not persisted; it is gone on the next start.
+// It returns the ID of the NIC, for RemoveNIC.
+func AddNIC(cfg Config, nw limayaml.Network) (string, error) {
+	sock, err := hotplugNICSock(nw)
+	if err != nil {
+		return "", err
+	}
+	qmpClient, release, err := cfg.monitor().acquire(qmpConnectTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	rawClient := raw.NewMonitor(qmpClient)
+	peripherals, err := rawClient.QomList("/machine/peripheral")
+	if err != nil {
+		return "", err
+	}
+	used := make(map[string]bool)
+	for _, p := range peripherals {
+		used[p.Name] = true
+	}
+	ports := *cfg.LimaYAML.QEMU.HotplugPorts
+	index := 0
+	for used[fmt.Sprintf("%s%d", hotplugNICPrefix, index)] {
+		index++
+	}
+	if ports > 0 && index >= ports {
+		return "", fmt.Errorf("all the %d ports reserved by `qemu.hotplugPorts` are in use", ports)
+	}
+	id := fmt.Sprintf("%s%d", hotplugNICPrefix, index)
+	netdevID := hotplugNetdevID(id)
+	mac := nw.MACAddress
+	if mac == "" {
+		mac = limayaml.MACAddress(fmt.Sprintf("%s#%s", cfg.InstanceDir, id))
+	}
+
+	addr, err := net.ResolveUnixAddr("unix", sock)
+	if err != nil {
+		return "", err
+	}
+	conn, err := net.DialUnix("unix", nil, addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to %q: %w", sock, err)
+	}
+	defer conn.Close()
+	f, err := conn.File()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	getfd, err := json.Marshal(map[string]any{
+		"execute":   "getfd",
+		"arguments": map[string]any{"fdname": netdevID},
+	})
+	if err != nil {
+		return "", err
+	}
+	logrus.Infof("Sending QMP getfd command")
+	if _, err := qmpClient.RunWithFile(getfd, f); err != nil {
+		return "", err
+	}
+	netdevAdd, err := json.Marshal(map[string]any{
+		"execute":   "netdev_add",
+		"arguments": map[string]any{"type": "socket", "id": netdevID, "fd": netdevID},
+	})
+	if err != nil {
+		return "", err
+	}
+	logrus.Infof("Sending QMP netdev_add command")
+	if _, err := qmpClient.Run(netdevAdd); err != nil {
+		if closeErr := rawClient.Closefd(netdevID); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+		return "", err
+	}
+	deviceArgs := map[string]any{
+		"driver": "virtio-net-pci",
+		"id":     id,
+		"netdev": netdevID,
+		"mac":    mac,
+	}
+	if ports > 0 {
+		deviceArgs["bus"] = hotplugPortID(index)
+	}
+	deviceAdd, err := json.Marshal(map[string]any{
+		"execute":   "device_add",
+		"arguments": deviceArgs,
+	})
+	if err != nil {
+		return "", err
+	}
+	logrus.Infof("Sending QMP device_add command")
+	if _, err := qmpClient.Run(deviceAdd); err != nil {
+		if strings.Contains(err.Error(), "does not support hotplugging") {
+			err = fmt.Errorf("%w (hint: set `qemu.hotplugPorts` and restart the instance)", err)
+		}
+		if delErr := rawClient.NetdevDel(netdevID); delErr != nil {
+			err = errors.Join(err, delErr)
+		}
+		return "", err
+	}
+	return id, nil
+}
+
+// hotplugNICSock returns the path of the socket for the network backend of nw.
+func hotplugNICSock(nw limayaml.Network) (string, error) {
+	switch {
+	case nw.Lima != "" && nw.Socket != "":
+		return "", errors.New("a network and a socket cannot be specified together")
+	case nw.Socket != "":
+		return nw.Socket, nil
+	case nw.Lima == "":
+		return "", errors.New("either a network or a socket has to be specified")
+	}
+	nwCfg, err := networks.Config()
+	if err != nil {
+		return "", err
+	}
+	isUsernet, err := nwCfg.Usernet(nw.Lima)
+	if err != nil {
+		return "", err
+	}
+	if isUsernet {
+		return usernet.Sock(nw.Lima, usernet.QEMUSock)
+	}
+	if runtime.GOOS != "darwin" {
+		return "", fmt.Errorf("networks.yaml '%s' configuration is only supported on macOS right now", nw.Lima)
+	}
+	return networks.Sock(nw.Lima)
+}
+
+// RemoveNIC hot-unplugs the NIC added by AddNIC from the running instance,
+// using the QMP "device_del" and "netdev_del" commands.
+func RemoveNIC(cfg Config, id string) error {
+	if !strings.HasPrefix(id, hotplugNICPrefix) {
+		return fmt.Errorf("%q is not a NIC added by AddNIC (expected the %q prefix)", id, hotplugNICPrefix)
+	}
+	qmpClient, release, err := cfg.monitor().acquire(qmpConnectTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+	rawClient := raw.NewMonitor(qmpClient)
+	logrus.Infof("Sending QMP device_del command")
+	if err := rawClient.DeviceDel(id); err != nil {
+		return err
+	}
+	// the device is deleted asynchronously, after the guest releases it
+	logrus.Infof("Sending QMP netdev_del command")
+	const timeout = 10 * time.Second
+	for deadline := time.Now().Add(timeout); ; time.Sleep(500 * time.Millisecond) {
+		err = rawClient.NetdevDel(hotplugNetdevID(id))
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+	}
+}
+
+// findAdditionalDisk returns the QOM path (or the ID) of the device of the additional disk in the "query-block" response,
+// and whether the disk was hot-plugged.
+func findAdditionalDisk(queryBlockResp []byte, id string) (qdev string, hotplugged bool, _ error) {
+	var resp struct {
+		Return []struct {
+			Device   string `json:"device"`
+			Qdev     string `json:"qdev,omitempty"`
+			Inserted *struct {
+				NodeName string `json:"node-name,omitempty"`
+			} `json:"inserted,omitempty"`
+		} `json:"return"`
+	}
+	if err := json.Unmarshal(queryBlockResp, &resp); err != nil {
+		return "", false, err
+	}
+	for _, b := range resp.Return {
+		switch {
+		case b.Device == id:
+			// attached on start with "-drive", as a virtio-blk device with no ID
+		case b.Device == "" && b.Inserted != nil && b.Inserted.NodeName == id:
+			hotplugged = true
+		default:
+			continue
+		}
+		if b.Qdev == "" {
+			return "", false, fmt.Errorf("block device %q is not attached to a device", id)
+		}
+		// the QOM path of virtio-blk ends with the child "virtio-backend" of the PCI device
+		return strings.TrimSuffix(b.Qdev, "/virtio-backend"), hotplugged, nil
+	}
+	return "", false, fmt.Errorf("block device %q was not found", id)
+}
+
 // EnsureDisk also ensures the kernel and the initrd.
 func EnsureDisk(ctx context.Context, cfg Config) error {
 	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
-	if _, err := os.Stat(diffDisk); err == nil || !errors.Is(err, os.ErrNotExist) {
-		// disk is already ensured
+	if _, err := os.Stat(diffDisk); err == nil {
+		// disk is already ensured, but may have to be grown to the size in lima.yaml
+		return growDisk(cfg)
+	} else if !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
@@ -97,6 +552,9 @@ func EnsureDisk(ctx context.Context, cfg Config) error {
 	if diskSize == 0 {
 		return nil
 	}
+	if err := fileutils.EnsureDecompressedBaseDisk(ctx, baseDisk, diskSize); err != nil {
+		return err
+	}
 	isBaseDiskISO, err := iso9660util.IsISO9660(baseDisk)
 	if err != nil {
 		return err
@@ -111,6 +569,24 @@ func EnsureDisk(ctx context.Context, cfg Config) error {
 	if baseDiskInfo.Format == "" {
 		return fmt.Errorf("failed to inspect the format of %q", baseDisk)
 	}
+	if *cfg.LimaYAML.DiskFormat == limayaml.DiskFormatRaw {
+		// raw disks cannot have a backing file, so the base disk is converted
+		if isBaseDiskISO {
+			diffDiskF, err := os.Create(diffDisk)
+			if err != nil {
+				return err
+			}
+			if err = nativeimgutil.MakeSparse(diffDiskF, diskSize); err != nil {
+				diffDiskF.Close()
+				return err
+			}
+			return diffDiskF.Close()
+		}
+		if err = nativeimgutil.ConvertToRaw(baseDisk, diffDisk, &diskSize, false); err != nil {
+			return fmt.Errorf("failed to convert %q to a raw disk %q: %w", baseDisk, diffDisk, err)
+		}
+		return nil
+	}
 	args := []string{"create", "-f", "qcow2"}
 	if !isBaseDiskISO {
 		args = append(args, "-F", baseDiskInfo.Format, "-b", baseDisk)
@@ -123,6 +599,38 @@ func EnsureDisk(ctx context.Context, cfg Config) error {
 	return nil
 }
 
+// growDisk grows the existing main disk (diffdisk) of the stopped instance to the size in lima.yaml.
+// The partition and the filesystem are expanded by cloud-init (growpart) inside the guest on boot.
+//
+// A size smaller than the disk is only warned, as the disk can be larger than lima.yaml, e.g.,
+// when lima.yaml was edited manually, or when the base image is larger than the size in lima.yaml.
+func growDisk(cfg Config) error {
+	size, _ := units.RAMInBytes(*cfg.LimaYAML.Disk)
+	if size == 0 {
+		return nil
+	}
+	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
+	info, err := imgutil.GetInfo(diffDisk)
+	if err != nil {
+		return fmt.Errorf("failed to get the information of %q: %w", diffDisk, err)
+	}
+	if size < info.VSize {
+		logrus.Warnf("The disk size %q of lima.yaml is less than the current size %s of %q, keeping the current size",
+			*cfg.LimaYAML.Disk, units.BytesSize(float64(info.VSize)), diffDisk)
+		return nil
+	}
+	if size == info.VSize {
+		return nil
+	}
+	logrus.Infof("Growing disk %q from %s to %s", diffDisk,
+		units.BytesSize(float64(info.VSize)), units.BytesSize(float64(size)))
+	if err := ResizeDisk(cfg, false, size); err != nil {
+		return err
+	}
+	logrus.Info("The partition and the filesystem will be expanded by cloud-init (growpart) inside the guest on boot")
+	return nil
+}
+
 func CreateDataDisk(dir, format string, size int) error {
 	dataDisk := filepath.Join(dir, filenames.DataDisk)
 	if _, err := os.Stat(dataDisk); err == nil || !errors.Is(err, fs.ErrNotExist) {
@@ -138,10 +646,15 @@ func CreateDataDisk(dir, format string, size int) error {
 	return nil
 }
 
-func ResizeDataDisk(dir, format string, size int) error {
+// ResizeDataDisk resizes the named disk. Shrinking the disk requires shrink to be true.
+func ResizeDataDisk(dir, format string, size int, shrink bool) error {
 	dataDisk := filepath.Join(dir, filenames.DataDisk)
 
-	args := []string{"resize", "-f", format, dataDisk, strconv.Itoa(size)}
+	args := []string{"resize", "-f", format}
+	if shrink {
+		args = append(args, "--shrink")
+	}
+	args = append(args, dataDisk, strconv.Itoa(size))
 	cmd := exec.Command("qemu-img", args...)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
@@ -149,30 +662,361 @@ func ResizeDataDisk(dir, format string, size int) error {
 	return nil
 }
 
-func newQmpClient(cfg Config) (*qmp.SocketMonitor, error) {
-	qmpSock := filepath.Join(cfg.InstanceDir, filenames.QMPSock)
-	qmpClient, err := qmp.NewSocketMonitor("unix", qmpSock, 5*time.Second)
+// ResizeDisk grows the main disk (diffdisk) of the instance to size bytes.
+//
+// When the instance is running, the disk is resized online using the QMP "block_resize" command.
+// Otherwise, the disk is resized using "qemu-img resize".
+//
+// ResizeDisk refuses to shrink the disk.
+func ResizeDisk(cfg Config, run bool, size int64) error {
+	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
+	info, err := imgutil.GetInfo(diffDisk)
+	if err != nil {
+		return fmt.Errorf("failed to get the information of %q: %w", diffDisk, err)
+	}
+	grow, err := imgutil.NeedsGrow(info, size)
+	if err != nil {
+		return err
+	}
+	if !grow {
+		logrus.Infof("Disk %q is already %s", diffDisk, units.BytesSize(float64(size)))
+		return nil
+	}
+	if run {
+		qmpClient, release, err := cfg.monitor().acquire(qmpConnectTimeout)
+		if err != nil {
+			return err
+		}
+		defer release()
+		rawClient := raw.NewMonitor(qmpClient)
+		logrus.Infof("Sending QMP block_resize command")
+		device := diffDiskDriveID
+		return rawClient.BlockResize(&device, nil, size)
+	}
+	args := []string{"resize", "-f", info.Format, diffDisk, strconv.FormatInt(size, 10)}
+	cmd := exec.Command("qemu-img", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
+	}
+	return nil
+}
+
+// Screenshot returns the current framebuffer of the running instance, using the QMP "screendump" command.
+// The framebuffer is dumped to a temporary PPM file in the instance directory, as QEMU writes the file by itself.
+func Screenshot(cfg Config) (image.Image, error) {
+	f, err := os.CreateTemp(cfg.InstanceDir, "screendump-*.ppm")
+	if err != nil {
+		return nil, err
+	}
+	ppmPath := f.Name()
+	defer os.Remove(ppmPath)
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	qmpClient, release, err := cfg.monitor().acquire(qmpConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	rawClient := raw.NewMonitor(qmpClient)
+	logrus.Info("Sending QMP screendump command")
+	if err := rawClient.Screendump(ppmPath); err != nil {
+		return nil, err
+	}
+	f, err = os.Open(ppmPath)
 	if err != nil {
 		return nil, err
 	}
-	return qmpClient, nil
+	defer f.Close()
+	return decodePPM(bufio.NewReader(f))
 }
 
-func sendHmpCommand(cfg Config, cmd, tag string) (string, error) {
-	qmpClient, err := newQmpClient(cfg)
+// decodePPM decodes a binary PPM ("P6") image with 8-bit samples, as written by QEMU.
+func decodePPM(r *bufio.Reader) (image.Image, error) {
+	var header [4]int // magic (unused), width, height, maxval
+	for i := range header {
+		token, err := readPPMToken(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the PPM header: %w", err)
+		}
+		if i == 0 {
+			if token != "P6" {
+				return nil, fmt.Errorf("unsupported PPM format %q", token)
+			}
+			continue
+		}
+		header[i], err = strconv.Atoi(token)
+		if err != nil || header[i] <= 0 {
+			return nil, fmt.Errorf("invalid PPM header value %q", token)
+		}
+	}
+	width, height, maxval := header[1], header[2], header[3]
+	if maxval > 255 {
+		return nil, fmt.Errorf("unsupported PPM maxval %d", maxval)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	pixel := make([]byte, 3)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if _, err := io.ReadFull(r, pixel); err != nil {
+				return nil, fmt.Errorf("failed to read the PPM pixels: %w", err)
+			}
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(int(pixel[0]) * 255 / maxval),
+				G: uint8(int(pixel[1]) * 255 / maxval),
+				B: uint8(int(pixel[2]) * 255 / maxval),
+				A: 255,
+			})
+		}
+	}
+	return img, nil
+}
+
+// readPPMToken reads a whitespace-separated token of the PPM header, skipping "#" comments.
+// The single whitespace character after the token is consumed.
+func readPPMToken(r *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case c == '#' && len(token) == 0:
+			if _, err := r.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, c)
+		}
+	}
+}
+
+// SetMemoryTarget sets the target memory size of the running instance using the QMP "balloon" command,
+// and waits for the balloon to reach the target.
+func SetMemoryTarget(cfg Config, size int64) error {
+	if !*cfg.LimaYAML.MemoryBalloon.Enabled {
+		return errors.New("field `memoryBalloon.enabled` must be set to true (and the instance must be restarted) to change the memory of a running instance")
+	}
+	if size <= 0 {
+		return fmt.Errorf("specified size %d is not positive", size)
+	}
+	if memBytes, err := units.RAMInBytes(*cfg.LimaYAML.Memory); err == nil && size > memBytes {
+		return fmt.Errorf("specified size %q is larger than the memory size %q", units.BytesSize(float64(size)), units.BytesSize(float64(memBytes)))
+	}
+	qmpClient, release, err := cfg.monitor().acquire(qmpConnectTimeout)
 	if err != nil {
-		return "", err
+		return err
 	}
-	if err := qmpClient.Connect(); err != nil {
+	defer release()
+	rawClient := raw.NewMonitor(qmpClient)
+	if used, err := guestMemoryUsage(rawClient); err != nil {
+		logrus.WithError(err).Debug("failed to get the guest memory usage")
+	} else if size < used {
+		logrus.Warnf("specified size %q is less than the current guest memory usage %q; the guest may start swapping or killing processes",
+			units.BytesSize(float64(size)), units.BytesSize(float64(used)))
+	}
+	logrus.Infof("Sending QMP balloon command")
+	if err := rawClient.Balloon(size); err != nil {
+		return err
+	}
+	// the guest inflates or deflates the balloon asynchronously
+	var info raw.BalloonInfo
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+		info, err = rawClient.QueryBalloon()
+		if err != nil {
+			return err
+		}
+		if info.Actual == size {
+			break
+		}
+	}
+	logrus.Infof("The memory size is now %s (target: %s)", units.BytesSize(float64(info.Actual)), units.BytesSize(float64(size)))
+	return nil
+}
+
+// MemoryActual returns the actual memory size of the running instance, using the QMP "query-balloon" command.
+func MemoryActual(cfg Config) (int64, error) {
+	if !*cfg.LimaYAML.MemoryBalloon.Enabled {
+		return 0, errors.New("field `memoryBalloon.enabled` is not set to true")
+	}
+	qmpClient, release, err := cfg.monitor().acquire(qmpConnectTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	rawClient := raw.NewMonitor(qmpClient)
+	info, err := rawClient.QueryBalloon()
+	if err != nil {
+		return 0, err
+	}
+	return info.Actual, nil
+}
+
+// guestMemoryUsage returns the memory used by the guest, according to the statistics reported by the balloon driver.
+// The statistics are only available when the polling has been enabled.
+func guestMemoryUsage(rawClient *raw.Monitor) (int64, error) {
+	path := "/machine/peripheral/" + balloonDeviceID
+	// enable the polling for the next invocation
+	if err := rawClient.QomSet(path, "guest-stats-polling-interval", 2); err != nil {
+		return 0, err
+	}
+	ret, err := rawClient.QomGet(path, "guest-stats")
+	if err != nil {
+		return 0, err
+	}
+	b, err := json.Marshal(ret)
+	if err != nil {
+		return 0, err
+	}
+	var guestStats struct {
+		Stats      map[string]int64 `json:"stats"`
+		LastUpdate int64            `json:"last-update"`
+	}
+	if err := json.Unmarshal(b, &guestStats); err != nil {
+		return 0, err
+	}
+	total, available := guestStats.Stats["stat-total-memory"], guestStats.Stats["stat-available-memory"]
+	if guestStats.LastUpdate == 0 || total <= 0 || available < 0 {
+		return 0, errors.New("guest memory statistics are not available yet")
+	}
+	return total - available, nil
+}
+
+// qemuGuestAgentPort is the virtio-serial port name that qemu-ga listens on in the guest.
+const qemuGuestAgentPort = "org.qemu.guest_agent.0"
+
+// destructiveQMPCommands are refused by [RunQMPCommand] unless forced.
+var destructiveQMPCommands = map[string]struct{}{
+	"quit":                  {},
+	"system_reset":          {},
+	"system_powerdown":      {},
+	"device_del":            {},
+	"blockdev-del":          {},
+	"migrate":               {},
+	"human-monitor-command": {}, // can execute arbitrary HMP commands such as "quit"
+}
+
+// RunQMPCommand executes a QMP command with the optional JSON arguments, and returns the raw JSON response.
+// Destructive commands such as "quit" are refused unless force is true.
+func RunQMPCommand(instanceDir, command string, arguments json.RawMessage, timeout time.Duration, force bool) ([]byte, error) {
+	if _, ok := destructiveQMPCommands[command]; ok && !force {
+		return nil, fmt.Errorf("refusing to run the destructive QMP command %q without force", command)
+	}
+	req := map[string]any{"execute": command}
+	if len(arguments) != 0 {
+		if !json.Valid(arguments) {
+			return nil, fmt.Errorf("the arguments of the QMP command %q are not valid JSON: %q", command, string(arguments))
+		}
+		req["arguments"] = arguments
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	// the deadline applies to the whole exchange, including the handshake,
+	// as QEMU does not respond while another QMP client is connected
+	deadline := time.Now().Add(timeout)
+	conn, err := qmpconn.Dial(filepath.Join(instanceDir, filenames.QMPSock), timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	resp, err := conn.Run(b)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, fmt.Errorf("timeout waiting for the response of the QMP command %q: %w", command, err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+func sendHmpCommand(cfg Config, cmd, tag string) (string, error) {
+	qmpClient, release, err := cfg.monitor().acquire(qmpConnectTimeout)
+	if err != nil {
 		return "", err
 	}
-	defer func() { _ = qmpClient.Disconnect() }()
+	defer release()
 	rawClient := raw.NewMonitor(qmpClient)
 	logrus.Infof("Sending HMP %s command", cmd)
 	hmc := fmt.Sprintf("%s %s", cmd, tag)
 	return rawClient.HumanMonitorCommand(hmc, nil)
 }
 
+// CompactDisk reclaims the unused space of the main disk (diffdisk) of the stopped instance,
+// by converting the disk to a new qcow2 image and atomically replacing the disk with it.
+// The backing file of the disk is preserved.
+// When check is true, the reclaimable space is only estimated, without modifying the disk.
+func CompactDisk(cfg Config, check bool) error {
+	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
+	info, err := imgutil.GetInfo(diffDisk)
+	if err != nil {
+		return fmt.Errorf("failed to get the information of %q: %w", diffDisk, err)
+	}
+	if info.Format != "qcow2" {
+		return fmt.Errorf("disk %q has format %q, only qcow2 can be compacted", diffDisk, info.Format)
+	}
+	// qemu-img convert does not copy the internal snapshots
+	list, err := List(cfg, false)
+	if err != nil {
+		return fmt.Errorf("failed to list the snapshots of %q: %w", diffDisk, err)
+	}
+	if len(list.Snapshots) > 0 {
+		return fmt.Errorf("disk %q has %d snapshot(s), which would be lost by the compaction (hint: delete them with `limactl snapshot delete`)",
+			diffDisk, len(list.Snapshots))
+	}
+	if check {
+		imgCheck, err := imgutil.GetCheck(diffDisk)
+		if err != nil {
+			return err
+		}
+		allocated := imgCheck.AllocatedClusters * int64(info.ClusterSize)
+		reclaimable := max(info.ActualSize-allocated, 0)
+		logrus.Infof("Disk %q: actual size %s, allocated %s, reclaimable at least %s (zero-filled blocks are reclaimed too, but not counted)",
+			diffDisk, units.BytesSize(float64(info.ActualSize)), units.BytesSize(float64(allocated)), units.BytesSize(float64(reclaimable)))
+		return nil
+	}
+
+	tmp := diffDisk + ".compact.tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	args := []string{"convert", "-p", "-f", "qcow2", "-O", "qcow2"}
+	if info.BackingFilename != "" {
+		// only the differences from the backing file are written
+		args = append(args, "-B", info.BackingFilename)
+		if info.BackingFilenameFormat != "" {
+			args = append(args, "-F", info.BackingFilenameFormat)
+		}
+	}
+	args = append(args, diffDisk, tmp)
+	if err := execImgCommandWithProgress(fmt.Sprintf("Compacting %q", diffDisk), args...); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+	tmpInfo, err := imgutil.GetInfo(tmp)
+	if err != nil {
+		_ = os.RemoveAll(tmp)
+		return fmt.Errorf("failed to get the information of %q: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, diffDisk); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+	logrus.Infof("Compacted %q from %s to %s", diffDisk,
+		units.BytesSize(float64(info.ActualSize)), units.BytesSize(float64(tmpInfo.ActualSize)))
+	return nil
+}
+
 func execImgCommand(cfg Config, args ...string) (string, error) {
 	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
 	args = append(args, diffDisk)
@@ -185,7 +1029,35 @@ func execImgCommand(cfg Config, args ...string) (string, error) {
 	return string(b), err
 }
 
+// checkSnapshotSupport returns an error if the diffdisk is not qcow2.
+// When the instance is running, the additional disks have to be qcow2 too, as "savevm" snapshots all the writable disks.
+func checkSnapshotSupport(cfg Config, run bool) error {
+	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
+	info, err := imgutil.GetInfo(diffDisk)
+	if err != nil {
+		return fmt.Errorf("failed to get the information of %q: %w", diffDisk, err)
+	}
+	if info.Format != limayaml.DiskFormatQcow2 {
+		return fmt.Errorf("snapshots require qcow2, but disk %q is %s", diffDisk, info.Format)
+	}
+	if run {
+		for _, d := range cfg.LimaYAML.AdditionalDisks {
+			disk, err := store.InspectDisk(d.Name)
+			if err != nil {
+				return err
+			}
+			if disk.Format != limayaml.DiskFormatQcow2 {
+				return fmt.Errorf("snapshots require qcow2, but additional disk %q is %s", d.Name, disk.Format)
+			}
+		}
+	}
+	return nil
+}
+
 func Del(cfg Config, run bool, tag string) error {
+	if err := checkSnapshotSupport(cfg, run); err != nil {
+		return err
+	}
 	if run {
 		out, err := sendHmpCommand(cfg, "delvm", tag)
 		// there can still be output, even if no error!
@@ -200,6 +1072,9 @@ func Del(cfg Config, run bool, tag string) error {
 }
 
 func Save(cfg Config, run bool, tag string) error {
+	if err := checkSnapshotSupport(cfg, run); err != nil {
+		return err
+	}
 	if run {
 		out, err := sendHmpCommand(cfg, "savevm", tag)
 		// there can still be output, even if no error!
@@ -214,38 +1089,212 @@ func Save(cfg Config, run bool, tag string) error {
 }
 
 func Load(cfg Config, run bool, tag string) error {
+	if err := checkSnapshotSupport(cfg, run); err != nil {
+		return err
+	}
 	if run {
 		out, err := sendHmpCommand(cfg, "loadvm", tag)
 		// there can still be output, even if no error!
 		if out != "" {
 			logrus.Warnf("output: %s", strings.TrimSpace(out))
 		}
-		return err
-	}
-	// -a  applies a snapshot
-	_, err := execImgCommand(cfg, "snapshot", "-a", tag)
-	return err
+		return err
+	}
+	// -a  applies a snapshot
+	_, err := execImgCommand(cfg, "snapshot", "-a", tag)
+	return err
+}
+
+// List returns all snapshots.
+func List(cfg Config, run bool) (*driver.SnapshotList, error) {
+	if err := checkSnapshotSupport(cfg, run); err != nil {
+		return nil, err
+	}
+	var out string
+	if run {
+		var err error
+		out, err = sendHmpCommand(cfg, "info", "snapshots")
+		if err != nil {
+			return nil, err
+		}
+		out = strings.ReplaceAll(out, "\r", "")
+		out = strings.Replace(out, "List of snapshots present on all disks:\n", "", 1)
+		out = strings.Replace(out, "There is no snapshot available.\n", "", 1)
+	} else {
+		// -l  lists all snapshots
+		args := []string{"snapshot", "-l"}
+		var err error
+		out, err = execImgCommand(cfg, args...)
+		if err != nil {
+			return nil, err
+		}
+		// remove the redundant heading
+		out = strings.Replace(out, "Snapshot list:\n", "", 1)
+	}
+	snapshots, err := parseSnapshotList(out, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	return &driver.SnapshotList{Snapshots: snapshots, Text: out}, nil
+}
+
+// Export converts the disk of the snapshot to a standalone qcow2 image.
+// The snapshot can be exported from a running instance, as snapshots are never modified.
+func Export(cfg Config, run bool, tag, dst string) error {
+	if _, err := os.Stat(dst); !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("file %q already exists", dst)
+	}
+	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
+	args := []string{"convert", "-p", "-f", "qcow2", "-O", "qcow2", "-l", "snapshot.name=" + tag}
+	if run {
+		args = append(args, "--force-share")
+	}
+	args = append(args, diffDisk, dst)
+	return execImgCommandWithProgress(fmt.Sprintf("Exporting snapshot %q to %q", tag, dst), args...)
+}
+
+// Import creates a snapshot from the image exported by Export.
+// The current state of the disk is retained.
+func Import(cfg Config, tag, src string) error {
+	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
+	srcInfo, err := imgutil.GetInfo(src)
+	if err != nil {
+		return fmt.Errorf("failed to get the information of %q: %w", src, err)
+	}
+	diffDiskInfo, err := imgutil.GetInfo(diffDisk)
+	if err != nil {
+		return fmt.Errorf("failed to get the information of %q: %w", diffDisk, err)
+	}
+	if srcInfo.VSize != diffDiskInfo.VSize {
+		return fmt.Errorf("the virtual size of %q (%s) does not match the virtual size of the instance disk (%s)",
+			src, units.BytesSize(float64(srcInfo.VSize)), units.BytesSize(float64(diffDiskInfo.VSize)))
+	}
+	list, err := List(cfg, false)
+	if err != nil {
+		return err
+	}
+	for _, s := range list.Snapshots {
+		if s.Tag == tag {
+			return fmt.Errorf("snapshot %q already exists", tag)
+		}
+	}
+	// Save the current state, overwrite the disk with the image, snapshot it, and then restore the current state.
+	const tmpTag = "lima-import-tmp"
+	if _, err := execImgCommand(cfg, "snapshot", "-c", tmpTag); err != nil {
+		return fmt.Errorf("failed to save the current state: %w", err)
+	}
+	args := []string{"convert", "-p", "-n", "-f", srcInfo.Format, "-O", "qcow2", src, diffDisk}
+	convertErr := execImgCommandWithProgress(fmt.Sprintf("Importing %q as snapshot %q", src, tag), args...)
+	if convertErr == nil {
+		if _, err := execImgCommand(cfg, "snapshot", "-c", tag); err != nil {
+			convertErr = fmt.Errorf("failed to create snapshot %q: %w", tag, err)
+		}
+	}
+	if _, err := execImgCommand(cfg, "snapshot", "-a", tmpTag); err != nil {
+		return errors.Join(convertErr, fmt.Errorf("failed to restore the current state from the temporary snapshot %q: %w", tmpTag, err))
+	}
+	if _, err := execImgCommand(cfg, "snapshot", "-d", tmpTag); err != nil {
+		logrus.WithError(err).Warnf("failed to delete the temporary snapshot %q", tmpTag)
+	}
+	return convertErr
+}
+
+// execImgCommandWithProgress runs qemu-img with the "-p" flag, and logs the progress for every 10%.
+func execImgCommandWithProgress(title string, args ...string) error {
+	logrus.Infof("%s (this may take minutes)", title)
+	begin := time.Now()
+	cmd := exec.Command("qemu-img", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// the progress is printed like "    (12.34/100%)\r"
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(scanCarriageReturns)
+	lastLogged := -1
+	for scanner.Scan() {
+		var percent float64
+		if _, err := fmt.Sscanf(strings.TrimSpace(scanner.Text()), "(%f/100%%)", &percent); err != nil {
+			continue
+		}
+		if step := int(percent) / 10; step > lastLogged {
+			lastLogged = step
+			logrus.Infof("%s: %d%%", title, step*10)
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to run %v: %q: %w", cmd.Args, stderr.String(), err)
+	}
+	logrus.Infof("%s: done in %v", title, time.Since(begin).Round(time.Second))
+	return nil
+}
+
+// scanCarriageReturns is a bufio.SplitFunc that splits on both '\r' and '\n'.
+func scanCarriageReturns(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// snapshotLineRegexp matches a line of the snapshot table printed by both `qemu-img snapshot -l` and HMP `info snapshots`:
+//
+//	ID        TAG               VM SIZE                DATE        VM CLOCK     ICOUNT
+//	1         foo               128 MiB 2024-01-02 03:04:05 00:01:23.456
+//
+// The ICOUNT column is missing in QEMU < 5.2, and QEMU < 4.0 prints the VM SIZE like "1.2G".
+var snapshotLineRegexp = regexp.MustCompile(`^(\S+)\s+(.+?)\s+([0-9.]+(?: ?[KMGTPE]?i?B?))\s+(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})\s+(\S+)(?:\s+\S+)?$`)
+
+// parseSnapshotList parses the snapshot table. The dates are interpreted in loc.
+func parseSnapshotList(out string, loc *time.Location) ([]driver.Snapshot, error) {
+	var res []driver.Snapshot
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "ID ") {
+			continue
+		}
+		m := snapshotLineRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("failed to parse snapshot line %q", line)
+		}
+		size, err := units.RAMInBytes(m[3])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the VM size %q: %w", m[3], err)
+		}
+		createdAt, err := time.ParseInLocation("2006-01-02 15:04:05", m[4], loc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the date %q: %w", m[4], err)
+		}
+		vmClock, err := parseVMClock(m[5])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the VM clock %q: %w", m[5], err)
+		}
+		res = append(res, driver.Snapshot{
+			Tag:         m[2],
+			VMStateSize: size,
+			CreatedAt:   createdAt,
+			VMClock:     vmClock,
+		})
+	}
+	return res, nil
 }
 
-// List returns a space-separated list of all snapshots, with header and newlines.
-func List(cfg Config, run bool) (string, error) {
-	if run {
-		out, err := sendHmpCommand(cfg, "info", "snapshots")
-		if err == nil {
-			out = strings.ReplaceAll(out, "\r", "")
-			out = strings.Replace(out, "List of snapshots present on all disks:\n", "", 1)
-			out = strings.Replace(out, "There is no snapshot available.\n", "", 1)
-		}
-		return out, err
-	}
-	// -l  lists all snapshots
-	args := []string{"snapshot", "-l"}
-	out, err := execImgCommand(cfg, args...)
-	if err == nil {
-		// remove the redundant heading, result is not machine-parseable
-		out = strings.Replace(out, "Snapshot list:\n", "", 1)
+// parseVMClock parses the VM CLOCK column like "00:01:23.456". The hours may exceed 23.
+func parseVMClock(s string) (time.Duration, error) {
+	var h, m int
+	var sec float64
+	if _, err := fmt.Sscanf(s, "%d:%d:%f", &h, &m, &sec); err != nil {
+		return 0, err
 	}
-	return out, err
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second)).Round(time.Millisecond), nil
 }
 
 func argValue(args []string, key string) (string, bool) {
@@ -309,6 +1358,13 @@ type features struct {
 	// e.g. "Available CPUs:\n...\nx86 base...\nx86 host...\n...\n"
 	// Not machine-readable, but checking strings.Contains() should be fine.
 	CPUHelp []byte
+	// DeviceHelp is the output of `qemu-system-x86_64 -device help`
+	// e.g. "...\nname \"virtio-vga-gl\", bus PCI\n..."
+	// Not machine-readable, but checking strings.Contains() should be fine.
+	DeviceHelp []byte
+	// DisplayHelp is the output of `qemu-system-x86_64 -display help`
+	// e.g. "Available display backend types:\nnone\ngtk\nsdl\negl-headless\n"
+	DisplayHelp []byte
 
 	// VersionGEQ7 is true when the QEMU version seems v7.0.0 or later
 	VersionGEQ7 bool
@@ -316,61 +1372,202 @@ type features struct {
 
 func inspectFeatures(exe, machine string) (*features, error) {
 	var (
-		f      features
-		stdout bytes.Buffer
-		stderr bytes.Buffer
+		f   features
+		err error
 	)
-	cmd := exec.Command(exe, "-M", "none", "-accel", "help")
+	f.AccelHelp, err = runHelp(exe, "-M", "none", "-accel", "help")
+	if err != nil {
+		return nil, err
+	}
+	if f.NetdevHelp, err = runHelp(exe, "-M", "none", "-netdev", "help"); err != nil {
+		logrus.Warn(err)
+	}
+	if f.MachineHelp, err = runHelp(exe, "-machine", "help"); err != nil {
+		logrus.Warn(err)
+	}
+	f.VersionGEQ7 = strings.Contains(string(f.MachineHelp), "-7.0")
+	// Avoid error: "No machine specified, and there is no default"
+	if f.CPUHelp, err = runHelp(exe, "-cpu", "help", "-machine", machine); err != nil {
+		logrus.Warn(err)
+	}
+	if f.DeviceHelp, err = runHelp(exe, "-M", "none", "-device", "help"); err != nil {
+		logrus.Warn(err)
+	}
+	if f.DisplayHelp, err = runHelp(exe, "-M", "none", "-display", "help"); err != nil {
+		logrus.Warn(err)
+	}
+	return &f, nil
+}
+
+// runHelp runs QEMU with a "help" argument and returns its output.
+// Each invocation uses its own buffers, as the results are retained in [features].
+func runHelp(exe string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(exe, args...)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	if err := cmd.Run(); err != nil {
 		return nil, fmt.Errorf("failed to run %v: stdout=%q, stderr=%q", cmd.Args, stdout.String(), stderr.String())
 	}
-	f.AccelHelp = stdout.Bytes()
 	// on older versions qemu will write "help" output to stderr
-	if len(f.AccelHelp) == 0 {
-		f.AccelHelp = stderr.Bytes()
+	if stdout.Len() == 0 {
+		return stderr.Bytes(), nil
 	}
+	return stdout.Bytes(), nil
+}
 
-	cmd = exec.Command(exe, "-M", "none", "-netdev", "help")
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		logrus.Warnf("failed to run %v: stdout=%q, stderr=%q", cmd.Args, stdout.String(), stderr.String())
-	} else {
-		f.NetdevHelp = stdout.Bytes()
-		if len(f.NetdevHelp) == 0 {
-			f.NetdevHelp = stderr.Bytes()
-		}
+// capsCacheFile is the cache of the capabilities of the QEMU binaries, under $LIMA_HOME/_cache.
+const capsCacheFile = "qemu-caps.json"
+
+// qemuCaps is the result of inspecting a QEMU binary, cached in [capsCacheFile].
+// The cache entry is invalidated when the modification time or the size of the binary changes.
+type qemuCaps struct {
+	ModTime  time.Time `json:"modTime"`
+	Size     int64     `json:"size"`
+	Features features  `json:"features"`
+	Version  string    `json:"version"`
+
+	versionErr error
+}
+
+func (c *qemuCaps) version() (*semver.Version, error) {
+	if c.versionErr != nil {
+		return nil, c.versionErr
 	}
+	return semver.NewVersion(c.Version)
+}
 
-	cmd = exec.Command(exe, "-machine", "help")
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		logrus.Warnf("failed to run %v: stdout=%q, stderr=%q", cmd.Args, stdout.String(), stderr.String())
+// inspectCaps returns the features and the version of the QEMU binary.
+// Running the binary several times takes a while, so the result is cached in [capsCacheFile].
+func inspectCaps(exe, machine string) (*qemuCaps, error) {
+	st, err := os.Stat(exe)
+	if err != nil {
+		return nil, err
+	}
+	var cacheFile string
+	if cacheDir, err := dirnames.LimaCacheDir(); err != nil {
+		logrus.WithError(err).Debug("failed to get the cache directory")
 	} else {
-		f.MachineHelp = stdout.Bytes()
-		if len(f.MachineHelp) == 0 {
-			f.MachineHelp = stderr.Bytes()
+		cacheFile = filepath.Join(cacheDir, capsCacheFile)
+	}
+	// the output of `-cpu help` depends on the machine type
+	key := exe + " -machine " + machine
+	cache := readCapsCache(cacheFile)
+	if c, ok := cache[key]; ok && c.ModTime.Equal(st.ModTime()) && c.Size == st.Size() {
+		logrus.Debugf("Using the cached capabilities of %q from %q", exe, cacheFile)
+		return c, nil
+	}
+	f, err := inspectFeatures(exe, machine)
+	if err != nil {
+		return nil, err
+	}
+	c := &qemuCaps{
+		ModTime:  st.ModTime(),
+		Size:     st.Size(),
+		Features: *f,
+	}
+	version, err := DetectVersion(exe)
+	if err != nil {
+		// not cached, so that the version is detected again on the next start
+		c.versionErr = err
+		return c, nil
+	}
+	c.Version = version.String()
+	if cacheFile != "" {
+		cache[key] = c
+		if err := writeCapsCache(cacheFile, cache); err != nil {
+			logrus.WithError(err).Debugf("failed to write %q", cacheFile)
 		}
 	}
-	f.VersionGEQ7 = strings.Contains(string(f.MachineHelp), "-7.0")
+	return c, nil
+}
 
-	// Avoid error: "No machine specified, and there is no default"
-	cmd = exec.Command(exe, "-cpu", "help", "-machine", machine)
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		logrus.Warnf("failed to run %v: stdout=%q, stderr=%q", cmd.Args, stdout.String(), stderr.String())
-	} else {
-		f.CPUHelp = stdout.Bytes()
-		if len(f.CPUHelp) == 0 {
-			f.CPUHelp = stderr.Bytes()
+func readCapsCache(cacheFile string) map[string]*qemuCaps {
+	cache := make(map[string]*qemuCaps)
+	if cacheFile == "" {
+		return cache
+	}
+	b, err := os.ReadFile(cacheFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logrus.WithError(err).Debugf("failed to read %q", cacheFile)
 		}
+		return cache
+	}
+	if err := json.Unmarshal(b, &cache); err != nil {
+		logrus.WithError(err).Debugf("failed to parse %q, ignoring", cacheFile)
+		return make(map[string]*qemuCaps)
 	}
+	return cache
+}
 
-	return &f, nil
+// writeCapsCache writes the cache atomically, as several instances may be started concurrently.
+func writeCapsCache(cacheFile string, cache map[string]*qemuCaps) error {
+	b, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(cacheFile)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, capsCacheFile+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cacheFile)
+}
+
+// virglDisplay returns the "-display" value and the GPU device for `video.accel: virgl`.
+// For `video.display: vnc`, the returned display is "egl-headless", and the VNC server has to be configured with "-vnc".
+// An error is returned when the QEMU binary does not support the combination.
+func virglDisplay(goos string, arch limayaml.Arch, display string, f *features) (displayArg, gpuDevice string, err error) {
+	gpuDevice = "virtio-gpu-gl-pci"
+	if arch == limayaml.X8664 {
+		gpuDevice = "virtio-vga-gl"
+	}
+	if !strings.Contains(string(f.DeviceHelp), `"`+gpuDevice+`"`) {
+		return "", "", fmt.Errorf("device %q is not supported by the QEMU binary", gpuDevice)
+	}
+	backend, opts, _ := strings.Cut(display, ",")
+	switch backend {
+	case "vnc":
+		backend, opts = "egl-headless", ""
+	case "default":
+		backend = "gtk"
+		if goos == "darwin" {
+			backend = "cocoa"
+		}
+	case "gtk", "sdl", "cocoa", "egl-headless":
+	default:
+		return "", "", fmt.Errorf("display %q does not support OpenGL", display)
+	}
+	var found bool
+	for _, line := range strings.Split(string(f.DisplayHelp), "\n") {
+		if strings.TrimSpace(line) == backend {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", "", fmt.Errorf("display %q is not supported by the QEMU binary", backend)
+	}
+	displayArg = backend
+	if opts != "" {
+		displayArg += "," + opts
+	}
+	if backend != "egl-headless" {
+		displayArg += ",gl=on"
+	}
+	return displayArg, gpuDevice, nil
 }
 
 // showDarwinARM64HVFQEMU620Warning shows a warning on M1 macOS when QEMU is older than 6.2.0_1.
@@ -413,6 +1610,40 @@ func showDarwinARM64HVFQEMU620Warning(exe, accel string, features *features) {
 	logrus.Warn(w)
 }
 
+// numaArgs returns the "-object" and "-numa" arguments for the NUMA nodes.
+// virtiofs requires the memory to be shared with virtiofsd, so the memory of the nodes is backed by /dev/shm.
+func numaArgs(nodes []limayaml.NUMANode, memBytes int64, virtiofs bool) ([]string, error) {
+	var (
+		args          []string
+		nodesMemBytes int64
+	)
+	for i, node := range nodes {
+		nodeMemBytes, err := units.RAMInBytes(node.Memory)
+		if err != nil {
+			return nil, err
+		}
+		nodesMemBytes += nodeMemBytes
+		memdev := fmt.Sprintf("numa-mem%d", i)
+		if virtiofs {
+			args = append(args, "-object", fmt.Sprintf("memory-backend-file,id=%s,size=%d,mem-path=/dev/shm,share=on", memdev, nodeMemBytes))
+		} else {
+			args = append(args, "-object", fmt.Sprintf("memory-backend-ram,id=%s,size=%d", memdev, nodeMemBytes))
+		}
+		numa := fmt.Sprintf("node,nodeid=%d,memdev=%s", i, memdev)
+		// each of the ranges needs its own "cpus=" property
+		for _, r := range strings.Split(node.CPUs, ",") {
+			numa += ",cpus=" + strings.TrimSpace(r)
+		}
+		args = append(args, "-numa", numa)
+	}
+	if nodesMemBytes != memBytes {
+		// memBytes may have been adjusted by adjustMemBytesDarwinARM64HVF
+		return nil, fmt.Errorf("field `numa` has %s of memory in total, but the memory size is %s",
+			units.BytesSize(float64(nodesMemBytes)), units.BytesSize(float64(memBytes)))
+	}
+	return args, nil
+}
+
 // adjustMemBytesDarwinARM64HVF adjusts the memory to be <= 3 GiB, only when the following conditions are met:
 //
 // - Host OS   <  macOS 12.4
@@ -455,6 +1686,111 @@ func adjustMemBytesDarwinARM64HVF(memBytes int64, accel string, features *featur
 	return memBytes
 }
 
+// machineNames returns the machine types listed in the output of `qemu-system-* -machine help`.
+func machineNames(machineHelp []byte) []string {
+	var (
+		names    []string
+		inHeader bool
+	)
+	for _, line := range strings.Split(string(machineHelp), "\n") {
+		// only parse the lines following the "Supported machines are:" header
+		if strings.HasSuffix(line, ":") {
+			inHeader = line == "Supported machines are:"
+			continue
+		}
+		fields := strings.Fields(line)
+		if !inHeader || len(fields) == 0 {
+			continue
+		}
+		names = append(names, fields[0])
+	}
+	return names
+}
+
+// validateMachine returns an error with the supported machine types if the QEMU binary does not support the machine type.
+func validateMachine(machine string, machineHelp []byte) error {
+	names := machineNames(machineHelp)
+	if len(names) == 0 {
+		logrus.Warnf("failed to detect the supported machine types, not validating field `qemu.machine` %q", machine)
+		return nil
+	}
+	if slices.Contains(names, machine) {
+		return nil
+	}
+	return fmt.Errorf("field `qemu.machine` %q is not supported by the QEMU binary, supported machine types: %s", machine, strings.Join(names, ", "))
+}
+
+// diskDriveOptions returns the "-drive" options for `diskOptions`, with the leading comma.
+func diskDriveOptions(o limayaml.DiskOptions) string {
+	opts := ",discard=on"
+	if *o.Discard {
+		opts = ",discard=unmap,detect-zeroes=unmap"
+	}
+	if *o.CacheMode != "" {
+		opts += ",cache=" + *o.CacheMode
+	}
+	if *o.AIO != "" {
+		opts += ",aio=" + *o.AIO
+	}
+	return opts
+}
+
+// diskThrottle returns the QMP "block_set_io_throttle" arguments for `diskOptions.throttle`, without the device.
+func diskThrottle(t limayaml.DiskThrottle) (*raw.BlockIOThrottle, error) {
+	bps := make([]int64, 3)
+	for i, s := range []string{*t.BPS, *t.ReadBPS, *t.WriteBPS} {
+		v, err := units.RAMInBytes(s)
+		if err != nil {
+			return nil, err
+		}
+		bps[i] = v
+	}
+	return &raw.BlockIOThrottle{
+		Bps:    bps[0],
+		BpsRd:  bps[1],
+		BpsWr:  bps[2],
+		Iops:   *t.IOPS,
+		IopsRd: *t.ReadIOPS,
+		IopsWr: *t.WriteIOPS,
+	}, nil
+}
+
+// diskThrottleDriveOptions returns the "-drive" options for the throttling limits, with the leading comma.
+func diskThrottleDriveOptions(t *raw.BlockIOThrottle) string {
+	var opts string
+	for _, f := range []struct {
+		name  string
+		value int64
+	}{
+		{"iops-total", t.Iops}, {"iops-read", t.IopsRd}, {"iops-write", t.IopsWr},
+		{"bps-total", t.Bps}, {"bps-read", t.BpsRd}, {"bps-write", t.BpsWr},
+	} {
+		if f.value > 0 {
+			opts += fmt.Sprintf(",throttling.%s=%d", f.name, f.value)
+		}
+	}
+	return opts
+}
+
+// SetDiskThrottle sets the I/O throttling of the main disk of the running instance, using the QMP "block_set_io_throttle" command.
+// Zero limits remove the throttling.
+func SetDiskThrottle(cfg Config, t limayaml.DiskThrottle) error {
+	throttle, err := diskThrottle(t)
+	if err != nil {
+		return err
+	}
+	device := mainDiskDriveID(cfg.LimaYAML)
+	throttle.Device = &device
+	qmpClient, release, err := cfg.monitor().acquire(qmpConnectTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+	rawClient := raw.NewMonitor(qmpClient)
+	logrus.Infof("Sending QMP block_set_io_throttle command")
+	return rawClient.BlockSetIOThrottle(throttle)
+}
+
 // qemuMachine returns string to use for -machine.
 func qemuMachine(arch limayaml.Arch) string {
 	if arch == limayaml.X8664 {
@@ -463,19 +1799,34 @@ func qemuMachine(arch limayaml.Arch) string {
 	return "virt"
 }
 
+// isQ35Machine returns true for "q35" and its versioned machine types, e.g., "pc-q35-8.2".
+func isQ35Machine(machine string) bool {
+	return machine == "q35" || strings.HasPrefix(machine, "pc-q35-")
+}
+
 func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err error) {
 	y := cfg.LimaYAML
-	exe, args, err = Exe(*y.Arch)
+	exe, args, err = ExeFromYAML(y)
 	if err != nil {
 		return "", nil, err
 	}
 
-	features, err := inspectFeatures(exe, qemuMachine(*y.Arch))
+	machineType := qemuMachine(*y.Arch)
+	if *y.QEMU.Machine != "" {
+		machineType = *y.QEMU.Machine
+	}
+	caps, err := inspectCaps(exe, machineType)
 	if err != nil {
 		return "", nil, err
 	}
+	features := &caps.Features
+	if *y.QEMU.Machine != "" {
+		if err := validateMachine(machineType, features.MachineHelp); err != nil {
+			return "", nil, err
+		}
+	}
 
-	version, err := getQemuVersion(exe)
+	version, err := caps.version()
 	if err != nil {
 		logrus.WithError(err).Warning("Failed to detect QEMU version")
 	} else {
@@ -490,7 +1841,10 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 	}
 
 	// Architecture
-	accel := Accel(*y.Arch)
+	accel, err := selectAccel(*y.Arch, y.Accel, features.AccelHelp)
+	if err != nil {
+		return "", nil, err
+	}
 	if !strings.Contains(string(features.AccelHelp), accel) {
 		return "", nil, fmt.Errorf("accelerator %q is not supported by %s", accel, exe)
 	}
@@ -504,7 +1858,13 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 	memBytes = adjustMemBytesDarwinARM64HVF(memBytes, accel, features)
 	args = appendArgsIfNoConflict(args, "-m", strconv.Itoa(int(memBytes>>20)))
 
-	if *y.MountType == limayaml.VIRTIOFS {
+	if len(y.NUMA) > 0 {
+		numaArgs, err := numaArgs(y.NUMA, memBytes, *y.MountType == limayaml.VIRTIOFS)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, numaArgs...)
+	} else if *y.MountType == limayaml.VIRTIOFS {
 		args = appendArgsIfNoConflict(args, "-object",
 			fmt.Sprintf("memory-backend-file,id=virtiofs-shm,size=%s,mem-path=/dev/shm,share=on", strconv.Itoa(int(memBytes))))
 		args = appendArgsIfNoConflict(args, "-numa", "node,memdev=virtiofs-shm")
@@ -520,6 +1880,11 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 			}
 		}
 	}
+	if accel == limayaml.TCG && strings.HasPrefix(cpu, "host") {
+		// "host" is only available with hardware acceleration
+		logrus.Warnf("cpu %q is not supported by accelerator %q, using \"max\" instead", cpu, accel)
+		cpu = "max" + strings.TrimPrefix(cpu, "host")
+	}
 	if !strings.Contains(string(features.CPUHelp), strings.Split(cpu, ",")[0]) {
 		return "", nil, fmt.Errorf("cpu %q is not supported by %s", cpu, exe)
 	}
@@ -529,24 +1894,27 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 	switch *y.Arch {
 	case limayaml.X8664:
 		if strings.HasPrefix(cpu, "qemu64") && runtime.GOOS != "windows" {
-			// use q35 machine with vmware io port disabled.
-			args = appendArgsIfNoConflict(args, "-machine", "q35,vmport=off")
+			// use the machine (q35 by default) with vmware io port disabled.
+			args = appendArgsIfNoConflict(args, "-machine", machineType+",vmport=off")
 			// use tcg accelerator with multi threading with 512MB translation block size
 			// https://qemu-project.gitlab.io/qemu/devel/multi-thread-tcg.html?highlight=tcg
 			// https://qemu-project.gitlab.io/qemu/system/invocation.html?highlight=tcg%20opts
 			// this will make sure each vCPU will be backed by 1 host user thread.
 			args = appendArgsIfNoConflict(args, "-accel", "tcg,thread=multi,tb-size=512")
 			// This will disable CPU S3/S4 state.
-			args = append(args, "-global", "ICH9-LPC.disable_s3=1")
-			args = append(args, "-global", "ICH9-LPC.disable_s4=1")
+			// ICH9-LPC only exists on q35, e.g., `qemu.machine: pc` fails with these options.
+			if isQ35Machine(machineType) {
+				args = append(args, "-global", "ICH9-LPC.disable_s3=1")
+				args = append(args, "-global", "ICH9-LPC.disable_s4=1")
+			}
 		} else if runtime.GOOS == "windows" && accel == "whpx" {
 			// whpx: injection failed, MSI (0, 0) delivery: 0, dest_mode: 0, trigger mode: 0, vector: 0
-			args = appendArgsIfNoConflict(args, "-machine", "q35,accel="+accel+",kernel-irqchip=off")
+			args = appendArgsIfNoConflict(args, "-machine", machineType+",accel="+accel+",kernel-irqchip=off")
 		} else {
-			args = appendArgsIfNoConflict(args, "-machine", "q35,accel="+accel)
+			args = appendArgsIfNoConflict(args, "-machine", machineType+",accel="+accel)
 		}
 	case limayaml.AARCH64:
-		machine := "virt,accel=" + accel
+		machine := machineType + ",accel=" + accel
 		// QEMU >= 7.0 requires highmem=off NOT to be set, otherwise fails with "Addressing limited to 32 bits, but memory exceeds it by 1073741824 bytes"
 		// QEMU <  7.0 requires highmem=off to be set, otherwise fails with "VCPU supports less PA bits (36) than requested by the memory map (40)"
 		// https://github.com/lima-vm/lima/issues/680
@@ -557,16 +1925,20 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 		}
 		args = appendArgsIfNoConflict(args, "-machine", machine)
 	case limayaml.RISCV64:
-		machine := "virt,accel=" + accel
+		machine := machineType + ",accel=" + accel
 		args = appendArgsIfNoConflict(args, "-machine", machine)
 	case limayaml.ARMV7L:
-		machine := "virt,accel=" + accel
+		machine := machineType + ",accel=" + accel
 		args = appendArgsIfNoConflict(args, "-machine", machine)
 	}
 
 	// SMP
+	sockets, cores, threads := 1, *y.CPUs, 1
+	if t := y.CPUTopology; t.Sockets != nil && t.Cores != nil && t.Threads != nil {
+		sockets, cores, threads = *t.Sockets, *t.Cores, *t.Threads
+	}
 	args = appendArgsIfNoConflict(args, "-smp",
-		fmt.Sprintf("%d,sockets=1,cores=%d,threads=1", *y.CPUs, *y.CPUs))
+		fmt.Sprintf("%d,sockets=%d,cores=%d,threads=%d", *y.CPUs, sockets, cores, threads))
 
 	// Firmware
 	legacyBIOS := *y.Firmware.LegacyBIOS
@@ -612,7 +1984,7 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 	// Disk
 	baseDisk := filepath.Join(cfg.InstanceDir, filenames.BaseDisk)
 	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
-	extraDisks := []string{}
+	extraDisks := []*store.Disk{}
 	if len(y.AdditionalDisks) > 0 {
 		for _, d := range y.AdditionalDisks {
 			diskName := d.Name
@@ -639,13 +2011,13 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 				logrus.Errorf("could not lock disk %q: %q", diskName, err)
 				return "", nil, err
 			}
-			dataDisk := filepath.Join(disk.Dir, filenames.DataDisk)
-			extraDisks = append(extraDisks, dataDisk)
+			extraDisks = append(extraDisks, disk)
 		}
 	}
 
 	isBaseDiskCDROM, err := iso9660util.IsISO9660(baseDisk)
-	if err != nil {
+	// The base disk is missing when the diff disk is standalone, e.g., for an instance imported by `limactl import`
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return "", nil, err
 	}
 	if isBaseDiskCDROM {
@@ -654,8 +2026,24 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 	} else {
 		args = appendArgsIfNoConflict(args, "-boot", "order=c,splash-time=0,menu=on")
 	}
+	diskOpts := diskDriveOptions(y.DiskOptions)
+	throttle, err := diskThrottle(y.DiskOptions.Throttle)
+	if err != nil {
+		return "", nil, err
+	}
+	mainDiskOpts := diskOpts + diskThrottleDriveOptions(throttle)
+	if *y.DiskOptions.Ephemeral {
+		// The writes to the main disk go to a temporary file, and are discarded on shutdown.
+		// The additional disks are kept persistent, as they are meant to outlive the instance.
+		mainDiskOpts += ",snapshot=on"
+	}
 	if diskSize, _ := units.RAMInBytes(*cfg.LimaYAML.Disk); diskSize > 0 {
-		args = append(args, "-drive", fmt.Sprintf("file=%s,if=virtio,discard=on", diffDisk))
+		// the format is inspected, as `diskFormat` may have been changed after creating the disk
+		diffDiskInfo, err := imgutil.GetInfo(diffDisk)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to get the information of %q: %w", diffDisk, err)
+		}
+		args = append(args, "-drive", fmt.Sprintf("id=%s,file=%s,format=%s,if=virtio", diffDiskDriveID, diffDisk, diffDiskInfo.Format)+mainDiskOpts)
 	} else if !isBaseDiskCDROM {
 		baseDiskInfo, err := imgutil.GetInfo(baseDisk)
 		if err != nil {
@@ -667,10 +2055,11 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 		if baseDiskInfo.Format == "" {
 			return "", nil, fmt.Errorf("failed to inspect the format of %q", baseDisk)
 		}
-		args = append(args, "-drive", fmt.Sprintf("file=%s,format=%s,if=virtio,discard=on", baseDisk, baseDiskInfo.Format))
+		args = append(args, "-drive", fmt.Sprintf("id=%s,file=%s,format=%s,if=virtio", baseDiskDriveID, baseDisk, baseDiskInfo.Format)+mainDiskOpts)
 	}
 	for _, extraDisk := range extraDisks {
-		args = append(args, "-drive", fmt.Sprintf("file=%s,if=virtio,discard=on", extraDisk))
+		dataDisk := filepath.Join(extraDisk.Dir, filenames.DataDisk)
+		args = append(args, "-drive", fmt.Sprintf("id=%s,file=%s,format=%s,if=virtio", additionalDiskID(extraDisk.Name), dataDisk, extraDisk.Format)+diskOpts)
 	}
 
 	// cloud-init
@@ -750,54 +2139,148 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 		}
 		args = append(args, "-device", fmt.Sprintf("virtio-net-pci,netdev=net%d,mac=%s", i+1, nw.MACAddress))
 	}
+	// Reserve the ports for AddNIC
+	for i := 0; i < *y.QEMU.HotplugPorts; i++ {
+		args = append(args, "-device", fmt.Sprintf("pcie-root-port,id=%s,chassis=%d", hotplugPortID(i), i+1))
+	}
+
+	// PCI passthrough
+	for _, addr := range y.QEMU.VFIO {
+		args = append(args, "-device", "vfio-pci,host="+addr)
+	}
 
 	// virtio-rng-pci accelerates starting up the OS, according to https://wiki.gentoo.org/wiki/QEMU/Options
-	args = append(args, "-device", "virtio-rng-pci")
+	if *y.RNG.Enabled {
+		args = append(args, rngArgs(runtime.GOOS)...)
+	}
+
+	// Memory balloon
+	args = append(args, memoryBalloonArgs(y)...)
 
 	// Input
 	input := "mouse"
 
 	// Sound
-	if *y.Audio.Device != "" {
-		id := "default"
-		// audio device
-		audiodev := *y.Audio.Device
-		audiodev += fmt.Sprintf(",id=%s", id)
-		args = append(args, "-audiodev", audiodev)
-		// audio controller
-		args = append(args, "-device", "ich9-intel-hda")
-		// audio codec
-		args = append(args, "-device", fmt.Sprintf("hda-output,audiodev=%s", id))
+	const audiodevID = "default"
+	audioDevice, audioOutput := *y.Audio.Device, *y.Audio.Output
+	switch audioDevice {
+	case "", "none", limayaml.AudioDeviceIntelHDA, limayaml.AudioDeviceAC97, limayaml.AudioDeviceUSBAudio:
+	default:
+		// `audio.device` used to be the QEMU audiodev string
+		audioDevice, audioOutput = limayaml.AudioDeviceIntelHDA, audioDevice
+	}
+	if audioDevice != "" && audioDevice != "none" {
+		args = append(args, "-audiodev", fmt.Sprintf("%s,id=%s", audioOutput, audiodevID))
+		switch audioDevice {
+		case limayaml.AudioDeviceIntelHDA:
+			// audio controller
+			args = append(args, "-device", "ich9-intel-hda")
+			// audio codec
+			args = append(args, "-device", fmt.Sprintf("hda-output,audiodev=%s", audiodevID))
+		case limayaml.AudioDeviceAC97:
+			args = append(args, "-device", fmt.Sprintf("AC97,audiodev=%s", audiodevID))
+		case limayaml.AudioDeviceUSBAudio:
+			// added after the XHCI controller, below
+		}
 	}
 	// Graphics
+	var glDisplay, glDevice string
+	if *y.Video.Accel == limayaml.VideoAccelVirgl {
+		if !features.VersionGEQ7 && (*y.Arch == limayaml.AARCH64 || *y.Arch == limayaml.ARMV7L) {
+			err = errors.New("virtio-gpu is not used with QEMU older than 7.0")
+		} else {
+			glDisplay, glDevice, err = virglDisplay(runtime.GOOS, *y.Arch, *y.Video.Display, features)
+		}
+		if err != nil {
+			logrus.WithError(err).Warn("field `video.accel` cannot be satisfied, falling back to the unaccelerated display")
+		}
+	}
 	if *y.Video.Display != "" {
 		display := *y.Video.Display
 		if display == "vnc" {
-			display += "=" + *y.Video.VNC.Display
-			display += ",password=on"
+			vnc := *y.Video.VNC.Display + ",password=on"
+			if glDisplay != "" {
+				args = append(args, "-vnc", vnc)
+			} else {
+				display += "=" + vnc
+			}
 			// use tablet to avoid double cursors
 			input = "tablet"
 		}
+		if glDisplay != "" {
+			display = glDisplay
+		}
 		args = appendArgsIfNoConflict(args, "-display", display)
 	}
 
+	// properties of the virtio-gpu device
+	var gpuProps string
+	if *y.Video.VRAM != "" {
+		vram, err := units.RAMInBytes(*y.Video.VRAM)
+		if err != nil {
+			return "", nil, err
+		}
+		gpuProps = fmt.Sprintf(",max_hostmem=%d", vram)
+	}
+
 	switch *y.Arch {
 	case limayaml.X8664, limayaml.RISCV64:
-		args = append(args, "-device", "virtio-vga")
+		if glDevice != "" {
+			args = append(args, "-device", glDevice+gpuProps)
+		} else {
+			args = append(args, "-device", "virtio-vga"+gpuProps)
+		}
 		args = append(args, "-device", "virtio-keyboard-pci")
 		args = append(args, "-device", "virtio-"+input+"-pci")
-		args = append(args, "-device", "qemu-xhci,id=usb-bus")
+		args = append(args, "-device", "qemu-xhci,id="+usbBusID)
 	case limayaml.AARCH64, limayaml.ARMV7L:
-		if features.VersionGEQ7 {
-			args = append(args, "-device", "virtio-gpu")
+		if glDevice != "" {
+			args = append(args, "-device", glDevice+gpuProps)
+			args = append(args, "-device", "virtio-keyboard-pci")
+			args = append(args, "-device", "virtio-"+input+"-pci")
+		} else if features.VersionGEQ7 {
+			args = append(args, "-device", "virtio-gpu"+gpuProps)
 			args = append(args, "-device", "virtio-keyboard-pci")
 			args = append(args, "-device", "virtio-"+input+"-pci")
 		} else { // kernel panic with virtio and old versions of QEMU
+			if gpuProps != "" {
+				logrus.Warn("field `video.vram` is ignored for ramfb (QEMU older than 7.0)")
+			}
 			args = append(args, "-vga", "none", "-device", "ramfb")
-			args = append(args, "-device", "usb-kbd,bus=usb-bus")
-			args = append(args, "-device", "usb-"+input+",bus=usb-bus")
+			args = append(args, "-device", "usb-kbd,bus="+usbBusID)
+			args = append(args, "-device", "usb-"+input+",bus="+usbBusID)
+		}
+		args = append(args, "-device", "qemu-xhci,id="+usbBusID)
+	}
+
+	// TPM
+	if *y.TPM.Enabled {
+		var tpmDevice string
+		switch *y.Arch {
+		case limayaml.X8664:
+			tpmDevice = "tpm-tis"
+		case limayaml.AARCH64:
+			tpmDevice = "tpm-tis-device"
+		default:
+			return "", nil, fmt.Errorf("field `tpm.enabled` is not supported for architecture %q", *y.Arch)
+		}
+		swtpmSock := filepath.Join(cfg.InstanceDir, filenames.SwtpmSock)
+		args = append(args, "-chardev", "socket,id=chrtpm,path="+swtpmSock)
+		args = append(args, "-tpmdev", "emulator,id=tpm0,chardev=chrtpm")
+		args = append(args, "-device", tpmDevice+",tpmdev=tpm0")
+	}
+
+	if audioDevice == limayaml.AudioDeviceUSBAudio {
+		args = append(args, "-device", fmt.Sprintf("usb-audio,bus=%s,audiodev=%s", usbBusID, audiodevID))
+	}
+
+	// USB passthrough (on the XHCI controller above)
+	for i, dev := range y.USBDevices {
+		arg, err := usbHostDeviceArg(i, dev)
+		if err != nil {
+			return "", nil, fmt.Errorf("field `usbDevices[%d]` is invalid: %w", i, err)
 		}
-		args = append(args, "-device", "qemu-xhci,id=usb-bus")
+		args = append(args, "-device", arg)
 	}
 
 	// Parallel
@@ -814,7 +2297,19 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 		return "", nil, err
 	}
 	const serialChardev = "char-serial"
-	args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s,server=on,wait=off,logfile=%s", serialChardev, serialSock, serialLog))
+	serialChardevOpts := fmt.Sprintf("socket,id=%s,path=%s,server=on,wait=off,logfile=%s", serialChardev, serialSock, serialLog)
+	if *y.Video.Accel != "" {
+		// record the effective display device, as the fallback is easy to miss
+		header := fmt.Sprintf("[lima] video.accel=%s: using display device %q\n", *y.Video.Accel, glDevice)
+		if glDevice == "" {
+			header = fmt.Sprintf("[lima] video.accel=%s: not available, using the unaccelerated display device\n", *y.Video.Accel)
+		}
+		if err := os.WriteFile(serialLog, []byte(header), 0o644); err != nil {
+			return "", nil, err
+		}
+		serialChardevOpts += ",logappend=on"
+	}
+	args = append(args, "-chardev", serialChardevOpts)
 	args = append(args, "-serial", "chardev:"+serialChardev)
 
 	// Serial (PCI, ARM only)
@@ -850,11 +2345,14 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 	args = append(args, "-device", "virtio-serial-pci,id=virtio-serial0,max_ports=1")
 	args = append(args, "-device", fmt.Sprintf("virtconsole,chardev=%s,id=console0", serialvChardev))
 
-	// We also want to enable vsock here, but QEMU does not support vsock for macOS hosts
+	// vsock for the guest agent; QEMU does not support vsock for macOS hosts
+	if cfg.VSockPort != 0 {
+		args = append(args, "-device", fmt.Sprintf("vhost-vsock-pci,guest-cid=%d", VSockCID(cfg.InstanceDir)))
+	}
 
 	if *y.MountType == limayaml.NINEP || *y.MountType == limayaml.VIRTIOFS {
 		for i, f := range y.Mounts {
-			tag := fmt.Sprintf("mount%d", i)
+			tag := f.Tag
 			location, err := localpathutil.Expand(f.Location)
 			if err != nil {
 				return "", nil, err
@@ -901,12 +2399,26 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 	// Guest agent via serialport
 	guestSock := filepath.Join(cfg.InstanceDir, filenames.GuestAgentSock)
 	args = append(args, "-chardev", fmt.Sprintf("socket,path=%s,server=on,wait=off,id=qga0", guestSock))
-	args = append(args, "-device", "virtio-serial")
-	args = append(args, "-device", "virtserialport,chardev=qga0,name="+filenames.VirtioPort)
+	args = append(args, "-device", "virtio-serial,id=virtio-serial1")
+	args = append(args, "-device", "virtserialport,bus=virtio-serial1.0,chardev=qga0,name="+filenames.VirtioPort)
+
+	// QEMU guest agent (qemu-ga) via serialport
+	if *y.QEMU.GuestAgent {
+		qemuGuestSock := filepath.Join(cfg.InstanceDir, filenames.QEMUGuestAgentSock)
+		if err := os.RemoveAll(qemuGuestSock); err != nil {
+			return "", nil, err
+		}
+		const qemuGuestChardev = "char-qemu-ga"
+		args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s,server=on,wait=off", qemuGuestChardev, qemuGuestSock))
+		args = append(args, "-device", "virtserialport,bus=virtio-serial1.0,chardev="+qemuGuestChardev+",name="+qemuGuestAgentPort)
+	}
 
 	// QEMU process
 	args = append(args, "-name", "lima-"+cfg.Name)
 	args = append(args, "-pidfile", filepath.Join(cfg.InstanceDir, filenames.PIDFile(*y.VMType)))
+	if cfg.StartPaused {
+		args = append(args, "-S")
+	}
 
 	return exe, args, nil
 }
@@ -1004,6 +2516,37 @@ func VirtiofsdCmdline(cfg Config, mountIndex int) ([]string, error) {
 	}, nil
 }
 
+// FindSwtpm returns the path of the swtpm binary.
+func FindSwtpm() (string, error) {
+	exe, err := exec.LookPath("swtpm")
+	if err != nil {
+		return "", fmt.Errorf("field `tpm.enabled` requires swtpm to be installed "+
+			"(hint: `brew install swtpm` on macOS, `sudo apt-get install swtpm` or `sudo dnf install swtpm` on Linux): %w", err)
+	}
+	return exe, nil
+}
+
+// SwtpmCmdline returns the arguments of swtpm, and creates the state directory.
+func SwtpmCmdline(cfg Config) ([]string, error) {
+	stateDir := filepath.Join(cfg.InstanceDir, filenames.SwtpmStateDir)
+	if err := os.MkdirAll(stateDir, 0o700); err != nil {
+		return nil, err
+	}
+	swtpmSock := filepath.Join(cfg.InstanceDir, filenames.SwtpmSock)
+	// qemu_driver has to wait for the socket to appear, so make sure any old ones are removed here.
+	if err := os.Remove(swtpmSock); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logrus.Warnf("Failed to remove old swtpm socket: %v", err)
+	}
+	return []string{
+		"socket",
+		"--tpm2",
+		"--tpmstate", "dir=" + stateDir,
+		"--ctrl", "type=unixio,path=" + swtpmSock,
+		// exit when QEMU disconnects
+		"--terminate",
+	}, nil
+}
+
 // qemuArch returns the arch string used by qemu.
 func qemuArch(arch limayaml.Arch) string {
 	if arch == limayaml.ARMV7L {
@@ -1032,6 +2575,29 @@ func Exe(arch limayaml.Arch) (exe string, args []string, err error) {
 	return exe, args, nil
 }
 
+// ExeFromYAML returns `qemu.binary` when it is set, otherwise the binary found by [Exe].
+func ExeFromYAML(y *limayaml.LimaYAML) (exe string, args []string, err error) {
+	if y.QEMU.Binary != nil && *y.QEMU.Binary != "" {
+		return *y.QEMU.Binary, nil, nil
+	}
+	return Exe(*y.Arch)
+}
+
+// validateExecutable returns an error if exe is not an executable regular file.
+func validateExecutable(exe string) error {
+	st, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	if !st.Mode().IsRegular() {
+		return fmt.Errorf("%q is not a regular file", exe)
+	}
+	if runtime.GOOS != "windows" && st.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("%q is not executable", exe)
+	}
+	return nil
+}
+
 func Accel(arch limayaml.Arch) string {
 	if limayaml.IsNativeArch(arch) {
 		switch runtime.GOOS {
@@ -1048,6 +2614,63 @@ func Accel(arch limayaml.Arch) string {
 	return "tcg"
 }
 
+// SelectAccel returns the first available accelerator in accels.
+// When accels is empty, SelectAccel returns the result of Accel.
+func SelectAccel(arch limayaml.Arch, accels []limayaml.Accel) (string, error) {
+	return selectAccel(arch, accels, nil)
+}
+
+// selectAccel is similar to SelectAccel, but also skips the accelerators missing in accelHelp, if accelHelp is not nil.
+func selectAccel(arch limayaml.Arch, accels []limayaml.Accel, accelHelp []byte) (string, error) {
+	if len(accels) == 0 {
+		return Accel(arch), nil
+	}
+	var tried []string
+	for _, accel := range accels {
+		err := CheckAccel(arch, accel)
+		if err == nil && accelHelp != nil && !strings.Contains(string(accelHelp), accel) {
+			err = errors.New("not supported by QEMU")
+		}
+		if err != nil {
+			logrus.WithError(err).Debugf("accelerator %q is not available", accel)
+			tried = append(tried, fmt.Sprintf("%s (%v)", accel, err))
+			continue
+		}
+		return accel, nil
+	}
+	return "", fmt.Errorf("none of the accelerators specified in field `accel` is available: %s", strings.Join(tried, ", "))
+}
+
+// CheckAccel returns an error if the accelerator is not available on the host for the arch.
+func CheckAccel(arch limayaml.Arch, accel limayaml.Accel) error {
+	if accel == limayaml.TCG {
+		return nil
+	}
+	if !limayaml.IsNativeArch(arch) {
+		return fmt.Errorf("arch %q is not the native arch", arch)
+	}
+	goos := map[limayaml.Accel]string{
+		limayaml.KVM:  "linux",
+		limayaml.HVF:  "darwin",
+		limayaml.WHPX: "windows",
+		limayaml.NVMM: "netbsd",
+	}[accel]
+	if goos == "" {
+		return fmt.Errorf("unknown accelerator %q", accel)
+	}
+	if runtime.GOOS != goos {
+		return fmt.Errorf("only available on %s", goos)
+	}
+	if accel == limayaml.KVM {
+		f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		_ = f.Close()
+	}
+	return nil
+}
+
 func parseQemuVersion(output string) (*semver.Version, error) {
 	lines := strings.Split(output, "\n")
 	regex := regexp.MustCompile(`^QEMU emulator version (\d+\.\d+\.\d+)`)
@@ -1058,7 +2681,8 @@ func parseQemuVersion(output string) (*semver.Version, error) {
 	return &semver.Version{}, fmt.Errorf("failed to parse %v", output)
 }
 
-func getQemuVersion(qemuExe string) (*semver.Version, error) {
+// DetectVersion returns the version of the QEMU binary, parsed from the output of `qemu-system-* --version`.
+func DetectVersion(qemuExe string) (*semver.Version, error) {
 	var (
 		stdout bytes.Buffer
 		stderr bytes.Buffer
@@ -1131,3 +2755,24 @@ func getFirmware(qemuExe string, arch limayaml.Arch) (string, error) {
 	}
 	return "", fmt.Errorf("could not find firmware for %q (hint: try copying the \"edk-%s-code.fd\" firmware to $HOME/.local/share/qemu/)", arch, qemuExe)
 }
+
+// memoryBalloonArgs returns the arguments for the virtio-balloon device, which is addressed by SetMemoryTarget and MemoryActual.
+func memoryBalloonArgs(y *limayaml.LimaYAML) []string {
+	if !*y.MemoryBalloon.Enabled {
+		return nil
+	}
+	return []string{"-device", "virtio-balloon-pci,id=" + balloonDeviceID}
+}
+
+// rngArgs returns the arguments for the virtio-rng device.
+// The rng-random backend is only available on POSIX builds of QEMU, so the default
+// rng-builtin backend is used on Windows.
+func rngArgs(goos string) []string {
+	if goos == "windows" {
+		return []string{"-device", "virtio-rng-pci"}
+	}
+	return []string{
+		"-object", "rng-random,id=rng0,filename=/dev/urandom",
+		"-device", "virtio-rng-pci,rng=rng0",
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
 	"io"
 	"io/fs"
 	"net"
@@ -15,16 +17,22 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
-	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/coreos/go-semver/semver"
 	"github.com/digitalocean/go-qemu/qmp/raw"
+	"github.com/docker/go-units"
 	"github.com/lima-vm/lima/pkg/driver"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/networks/usernet"
+	"github.com/lima-vm/lima/pkg/qemu/qmpconn"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/yqutil"
+	"github.com/mdlayher/vsock"
 	"github.com/sirupsen/logrus"
 )
 
@@ -34,6 +42,10 @@ type LimaQemuDriver struct {
 	qWaitCh chan error
 
 	vhostCmds []*exec.Cmd
+	swtpmCmd  *exec.Cmd
+
+	qmpOnce sync.Once
+	qmp     *qmpMonitor
 }
 
 func New(driver *driver.BaseDriver) *LimaQemuDriver {
@@ -42,19 +54,239 @@ func New(driver *driver.BaseDriver) *LimaQemuDriver {
 	}
 }
 
+// monitor returns the QMP monitor of the instance.
+// The monitor is created on the first use, as the driver may be created without the instance, for validating the YAML.
+func (l *LimaQemuDriver) monitor() *qmpMonitor {
+	l.qmpOnce.Do(func() {
+		l.qmp = newQMPMonitor(filepath.Join(l.Instance.Dir, filenames.QMPSock))
+	})
+	return l.qmp
+}
+
 func (l *LimaQemuDriver) Validate() error {
-	if *l.Yaml.MountType == limayaml.VIRTIOFS && runtime.GOOS != "linux" {
+	if err := ValidateMountType(l.Yaml); err != nil {
+		return err
+	}
+	if err := validateDisplayHost(*l.Yaml.Video.Display); err != nil {
+		return err
+	}
+	if *l.Yaml.QEMU.Binary != "" {
+		if err := validateExecutable(*l.Yaml.QEMU.Binary); err != nil {
+			return fmt.Errorf("field `qemu.binary` is invalid: %w", err)
+		}
+	}
+	if *l.Yaml.QEMU.MinimumVersion != "" {
+		if err := validateMinimumVersion(l.Yaml); err != nil {
+			return err
+		}
+	}
+	if *l.Yaml.TPM.Enabled {
+		if _, err := FindSwtpm(); err != nil {
+			return err
+		}
+	}
+	warnUSBDevicePermissions(l.Yaml.USBDevices)
+	if len(l.Yaml.QEMU.VFIO) > 0 {
+		if runtime.GOOS != "linux" {
+			return errors.New("field `qemu.vfio` is only supported on Linux hosts")
+		}
+		for i, addr := range l.Yaml.QEMU.VFIO {
+			if err := validateVFIODevice(sysfsPCIDevices, devVFIO, addr); err != nil {
+				return fmt.Errorf("field `qemu.vfio[%d]` is invalid: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateMountType returns an error if `mountType` is not supported by the QEMU driver on the host.
+func ValidateMountType(y *limayaml.LimaYAML) error {
+	if *y.MountType == limayaml.VIRTIOFS && runtime.GOOS != "linux" {
 		return fmt.Errorf("field `mountType` must be %q or %q for QEMU driver on non-Linux, got %q",
-			limayaml.REVSSHFS, limayaml.NINEP, *l.Yaml.MountType)
+			limayaml.REVSSHFS, limayaml.NINEP, *y.MountType)
+	}
+	return nil
+}
+
+const (
+	sysfsPCIDevices = "/sys/bus/pci/devices"
+	devVFIO         = "/dev/vfio"
+)
+
+// validateVFIODevice returns an error if the PCI device addr cannot be passed through with VFIO, i.e.,
+// if the device is not bound to the "vfio-pci" driver of the host, if another device of the same IOMMU group is bound
+// to a host driver, or if the user cannot access the VFIO group device.
+// sysfsDir is usually "/sys/bus/pci/devices", and devVFIODir is usually "/dev/vfio".
+func validateVFIODevice(sysfsDir, devVFIODir, addr string) error {
+	devDir := filepath.Join(sysfsDir, addr)
+	if _, err := os.Stat(devDir); err != nil {
+		return fmt.Errorf("PCI device %q was not found on the host: %w", addr, err)
+	}
+	groupPath, err := os.Readlink(filepath.Join(devDir, "iommu_group"))
+	if err != nil {
+		return fmt.Errorf("PCI device %q has no IOMMU group (hint: enable IOMMU, e.g., with the \"intel_iommu=on\" kernel parameter): %w", addr, err)
+	}
+	driver, err := pciDeviceDriver(devDir)
+	if err != nil {
+		return err
+	}
+	switch driver {
+	case "vfio-pci":
+	case "":
+		return fmt.Errorf("PCI device %q is not bound to any driver (hint: bind it to \"vfio-pci\")", addr)
+	default:
+		return fmt.Errorf("PCI device %q is bound to %q, not to \"vfio-pci\" (hint: `echo %s | sudo tee /sys/bus/pci/devices/%s/driver/unbind`, "+
+			"and then bind it to \"vfio-pci\")", addr, driver, addr, addr)
+	}
+	// QEMU fails with "group N is not viable" unless all the devices of the group are released from the host drivers
+	group := filepath.Base(groupPath)
+	groupDevices, err := os.ReadDir(filepath.Join(devDir, "iommu_group", "devices"))
+	if err != nil {
+		return err
+	}
+	for _, d := range groupDevices {
+		driver, err := pciDeviceDriver(filepath.Join(sysfsDir, d.Name()))
+		if err != nil {
+			return err
+		}
+		switch driver {
+		// the bridges bound to "pcieport" do not break the viability of the group
+		case "", "vfio-pci", "pci-stub", "pcieport":
+		default:
+			return fmt.Errorf("PCI device %q is in the IOMMU group %s with device %q bound to %q (hint: bind all the devices of the group to \"vfio-pci\")",
+				addr, group, d.Name(), driver)
+		}
+	}
+	groupDev := filepath.Join(devVFIODir, group)
+	f, err := os.OpenFile(groupDev, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("cannot open %q for PCI device %q (hint: `sudo chown $USER %s`): %w", groupDev, addr, groupDev, err)
+	}
+	return f.Close()
+}
+
+// pciDeviceDriver returns the name of the host driver bound to the PCI device, or "" when no driver is bound.
+func pciDeviceDriver(devDir string) (string, error) {
+	driverPath, err := os.Readlink(filepath.Join(devDir, "driver"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return filepath.Base(driverPath), nil
+}
+
+// validateMinimumVersion returns an error if the QEMU binary is older than `qemu.minimumVersion`.
+func validateMinimumVersion(y *limayaml.LimaYAML) error {
+	required, err := semver.NewVersion(*y.QEMU.MinimumVersion)
+	if err != nil {
+		return fmt.Errorf("field `qemu.minimumVersion` is invalid: %w", err)
+	}
+	exe, _, err := ExeFromYAML(y)
+	if err != nil {
+		return err
+	}
+	detected, err := DetectVersion(exe)
+	if err != nil {
+		return fmt.Errorf("failed to detect the version of %q: %w", exe, err)
+	}
+	if detected.LessThan(*required) {
+		return fmt.Errorf("QEMU %s (%s) is older than %s, required by field `qemu.minimumVersion`", detected, exe, required)
 	}
 	return nil
 }
 
+// validateDisplayHost returns an error if the display needs a graphical session that is missing on the host.
+func validateDisplayHost(display string) error {
+	backend, _, _ := strings.Cut(display, ",")
+	if backend != "sdl" && backend != "gtk" {
+		return nil
+	}
+	if runtime.GOOS == "linux" && os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return fmt.Errorf("field `video.display` %q requires a graphical session, but neither $DISPLAY nor $WAYLAND_DISPLAY is set "+
+			"(hint: use \"vnc\" or \"none\" on a headless host)", display)
+	}
+	return nil
+}
+
+// warnUSBDevicePermissions warns if QEMU is unlikely to be able to open the USB devices.
+func warnUSBDevicePermissions(devices []limayaml.USBDevice) {
+	if len(devices) == 0 {
+		return
+	}
+	switch runtime.GOOS {
+	case "linux":
+		for i, dev := range devices {
+			devPath, err := usbDevicePath(dev)
+			if err != nil {
+				logrus.WithError(err).Warnf("field `usbDevices[%d]`: the device was not found on the host", i)
+				continue
+			}
+			f, err := os.OpenFile(devPath, os.O_RDWR, 0)
+			if err != nil {
+				logrus.WithError(err).Warnf("field `usbDevices[%d]`: QEMU may not be able to open %q (hint: add a udev rule to grant the access)", i, devPath)
+				continue
+			}
+			_ = f.Close()
+		}
+	case "darwin":
+		logrus.Warn("field `usbDevices`: QEMU cannot claim USB devices that are in use by a macOS driver, " +
+			"and may need to be run with elevated privileges")
+	}
+}
+
+// usbDevicePath returns the path of the USB device under /dev/bus/usb on Linux.
+func usbDevicePath(dev limayaml.USBDevice) (string, error) {
+	if dev.HostBus != nil && dev.HostAddr != nil {
+		devPath := fmt.Sprintf("/dev/bus/usb/%03d/%03d", *dev.HostBus, *dev.HostAddr)
+		if _, err := os.Stat(devPath); err != nil {
+			return "", err
+		}
+		return devPath, nil
+	}
+	if dev.VendorID == nil || dev.ProductID == nil {
+		return "", errors.New("no device is selected")
+	}
+	vendorID, err := limayaml.ParseUSBID(*dev.VendorID)
+	if err != nil {
+		return "", err
+	}
+	productID, err := limayaml.ParseUSBID(*dev.ProductID)
+	if err != nil {
+		return "", err
+	}
+	sysDirs, err := filepath.Glob("/sys/bus/usb/devices/*")
+	if err != nil {
+		return "", err
+	}
+	readSysfs := func(dir, name string) string {
+		b, _ := os.ReadFile(filepath.Join(dir, name))
+		return strings.TrimSpace(string(b))
+	}
+	for _, dir := range sysDirs {
+		if readSysfs(dir, "idVendor") != fmt.Sprintf("%04x", vendorID) || readSysfs(dir, "idProduct") != fmt.Sprintf("%04x", productID) {
+			continue
+		}
+		busNum, err := strconv.Atoi(readSysfs(dir, "busnum"))
+		if err != nil {
+			return "", err
+		}
+		devNum, err := strconv.Atoi(readSysfs(dir, "devnum"))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("/dev/bus/usb/%03d/%03d", busNum, devNum), nil
+	}
+	return "", fmt.Errorf("no USB device with ID %04x:%04x", vendorID, productID)
+}
+
 func (l *LimaQemuDriver) CreateDisk(ctx context.Context) error {
 	qCfg := Config{
 		Name:        l.Instance.Name,
 		InstanceDir: l.Instance.Dir,
 		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
 	}
 	return EnsureDisk(ctx, qCfg)
 }
@@ -67,11 +299,17 @@ func (l *LimaQemuDriver) Start(ctx context.Context) (chan error, error) {
 		}
 	}()
 
+	// a stale override of the shutdown timeout must not apply to this run
+	_ = os.RemoveAll(filepath.Join(l.Instance.Dir, filenames.ShutdownTimeout))
+
 	qCfg := Config{
 		Name:         l.Instance.Name,
 		InstanceDir:  l.Instance.Dir,
 		LimaYAML:     l.Yaml,
+		qmp:          l.monitor(),
 		SSHLocalPort: l.SSHLocalPort,
+		StartPaused:  l.StartPaused,
+		VSockPort:    l.VSockPort,
 	}
 	qExe, qArgs, err := Cmdline(ctx, qCfg)
 	if err != nil {
@@ -117,19 +355,27 @@ func (l *LimaQemuDriver) Start(ctx context.Context) (chan error, error) {
 	}
 	go logPipeRoutine(qStderr, "qemu[stderr]")
 
+	vhostStderrs := make([]*tailBuffer, len(vhostCmds))
+	vhostStderrWriters := make([]*io.PipeWriter, len(vhostCmds))
 	for i, vhostCmd := range vhostCmds {
 		vhostStdout, err := vhostCmd.StdoutPipe()
 		if err != nil {
 			return nil, err
 		}
 		go logPipeRoutine(vhostStdout, fmt.Sprintf("virtiofsd-%d[stdout]", i))
-		vhostStderr, err := vhostCmd.StderrPipe()
-		if err != nil {
-			return nil, err
-		}
+		// The stderr is kept for the error message, so it is not read via StderrPipe,
+		// which may lose the last lines when the process exits.
+		vhostStderr, vhostStderrWriter := io.Pipe()
+		vhostStderrs[i] = &tailBuffer{}
+		vhostStderrWriters[i] = vhostStderrWriter
+		vhostCmd.Stderr = io.MultiWriter(vhostStderrs[i], vhostStderrWriter)
 		go logPipeRoutine(vhostStderr, fmt.Sprintf("virtiofsd-%d[stderr]", i))
 	}
 
+	vhostTimeout, err := limayaml.ParseVirtiofsdTimeout(*l.Yaml.QEMU.VirtiofsdTimeout)
+	if err != nil {
+		return nil, err
+	}
 	for i, vhostCmd := range vhostCmds {
 		i := i
 		vhostCmd := vhostCmd
@@ -141,33 +387,14 @@ func (l *LimaQemuDriver) Start(ctx context.Context) (chan error, error) {
 
 		vhostWaitCh := make(chan error)
 		go func() {
-			vhostWaitCh <- vhostCmd.Wait()
+			err := vhostCmd.Wait()
+			_ = vhostStderrWriters[i].Close()
+			vhostWaitCh <- err
 		}()
 
 		vhostSock := filepath.Join(l.Instance.Dir, fmt.Sprintf(filenames.VhostSock, i))
-		vhostSockExists := false
-		for attempt := 0; attempt < 5; attempt++ {
-			logrus.Debugf("Try waiting for %s to appear (attempt %d)", vhostSock, attempt)
-
-			if _, err := os.Stat(vhostSock); err != nil {
-				if !errors.Is(err, fs.ErrNotExist) {
-					logrus.Warnf("Failed to check for vhost socket: %v", err)
-				}
-			} else {
-				vhostSockExists = true
-				break
-			}
-
-			retry := time.NewTimer(200 * time.Millisecond)
-			select {
-			case err = <-vhostWaitCh:
-				return nil, fmt.Errorf("virtiofsd never created vhost socket: %w", err)
-			case <-retry.C:
-			}
-		}
-
-		if !vhostSockExists {
-			return nil, fmt.Errorf("vhost socket %s never appeared", vhostSock)
+		if err := waitVhostSock(vhostSock, vhostTimeout, vhostWaitCh, vhostStderrs[i]); err != nil {
+			return nil, err
 		}
 
 		go func() {
@@ -177,11 +404,36 @@ func (l *LimaQemuDriver) Start(ctx context.Context) (chan error, error) {
 		}()
 	}
 
+	if *l.Yaml.QEMU.GuestAgent {
+		defer func() {
+			if l.qCmd == nil {
+				return
+			}
+			qgaSock := filepath.Join(l.Instance.Dir, filenames.QEMUGuestAgentSock)
+			if err := waitFileExists(qgaSock, 10*time.Second); err != nil {
+				logrus.WithError(err).Warn("the socket of the QEMU guest agent did not appear")
+			}
+		}()
+	}
+
+	if *l.Yaml.TPM.Enabled {
+		swtpmCmd, err := startSwtpm(ctx, qCfg)
+		if err != nil {
+			return nil, err
+		}
+		l.swtpmCmd = swtpmCmd
+	}
+
 	logrus.Infof("Starting QEMU (hint: to watch the boot progress, see %q)", filepath.Join(qCfg.InstanceDir, "serial*.log"))
 	logrus.Debugf("qCmd.Args: %v", qCmd.Args)
 	if err := qCmd.Start(); err != nil {
+		_ = l.killSwtpm()
 		return nil, err
 	}
+	l.logEvent(eventStart).WithField("pid", qCmd.Process.Pid).Info("QEMU has started")
+	if l.StartPaused {
+		logrus.Info("QEMU has started with the vCPUs paused")
+	}
 	l.qCmd = qCmd
 	l.qWaitCh = make(chan error)
 	go func() {
@@ -200,8 +452,243 @@ func (l *LimaQemuDriver) Start(ctx context.Context) (chan error, error) {
 	return l.qWaitCh, nil
 }
 
+// vhostSockSlowThreshold is the duration after which waitVhostSock tells the user that virtiofsd is slow to start up.
+const vhostSockSlowThreshold = 3 * time.Second
+
+// waitVhostSock waits for virtiofsd to create vhostSock.
+// vhostWaitCh receives the result of the virtiofsd process, and vhostStderr is its stderr.
+func waitVhostSock(vhostSock string, timeout time.Duration, vhostWaitCh <-chan error, vhostStderr *tailBuffer) error {
+	start := time.Now()
+	slowReported := false
+	for attempt := 0; ; attempt++ {
+		logrus.Debugf("Try waiting for %s to appear (attempt %d)", vhostSock, attempt)
+		if _, err := os.Stat(vhostSock); err == nil {
+			return nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			logrus.Warnf("Failed to check for vhost socket: %v", err)
+		}
+
+		elapsed := time.Since(start)
+		if elapsed >= timeout {
+			return fmt.Errorf("vhost socket %s never appeared in %v (hint: increase `qemu.virtiofsdTimeout`)", vhostSock, timeout)
+		}
+		if !slowReported && elapsed >= vhostSockSlowThreshold {
+			logrus.Infof("Waiting for virtiofsd to create the vhost socket %s (timeout: %v)", vhostSock, timeout)
+			slowReported = true
+		}
+
+		retry := time.NewTimer(200 * time.Millisecond)
+		select {
+		case err := <-vhostWaitCh:
+			retry.Stop()
+			if err == nil {
+				err = errors.New("exited with status 0")
+			}
+			if stderr := strings.TrimSpace(vhostStderr.String()); stderr != "" {
+				return fmt.Errorf("virtiofsd never created vhost socket %s: %w (stderr: %q)", vhostSock, err, stderr)
+			}
+			return fmt.Errorf("virtiofsd never created vhost socket %s: %w", vhostSock, err)
+		case <-retry.C:
+		}
+	}
+}
+
+// tailBufferSize is the maximum number of bytes kept by tailBuffer.
+const tailBufferSize = 4096
+
+// tailBuffer is an io.Writer that keeps the last tailBufferSize bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > tailBufferSize {
+		b.buf = b.buf[len(b.buf)-tailBufferSize:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// startSwtpm starts swtpm, and waits for its control socket to appear.
+func startSwtpm(ctx context.Context, qCfg Config) (*exec.Cmd, error) {
+	swtpmExe, err := FindSwtpm()
+	if err != nil {
+		return nil, err
+	}
+	args, err := SwtpmCmdline(qCfg)
+	if err != nil {
+		return nil, err
+	}
+	swtpmCmd := exec.CommandContext(ctx, swtpmExe, args...)
+	swtpmStdout, err := swtpmCmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	go logPipeRoutine(swtpmStdout, "swtpm[stdout]")
+	swtpmStderr, err := swtpmCmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	go logPipeRoutine(swtpmStderr, "swtpm[stderr]")
+	logrus.Debugf("swtpmCmd.Args: %v", swtpmCmd.Args)
+	if err := swtpmCmd.Start(); err != nil {
+		return nil, err
+	}
+	swtpmWaitCh := make(chan error, 1)
+	go func() {
+		swtpmWaitCh <- swtpmCmd.Wait()
+	}()
+	swtpmSock := filepath.Join(qCfg.InstanceDir, filenames.SwtpmSock)
+	for attempt := 0; attempt < 25; attempt++ {
+		if _, err := os.Stat(swtpmSock); err == nil {
+			go func() {
+				if err := <-swtpmWaitCh; err != nil {
+					logrus.Errorf("Error from swtpm: %v", err)
+				}
+			}()
+			return swtpmCmd, nil
+		}
+		retry := time.NewTimer(200 * time.Millisecond)
+		select {
+		case err = <-swtpmWaitCh:
+			return nil, fmt.Errorf("swtpm never created the socket %s: %w", swtpmSock, err)
+		case <-retry.C:
+		}
+	}
+	_ = swtpmCmd.Process.Kill()
+	return nil, fmt.Errorf("swtpm socket %s never appeared", swtpmSock)
+}
+
 func (l *LimaQemuDriver) Stop(ctx context.Context) error {
-	return l.shutdownQEMU(ctx, 3*time.Minute, l.qCmd, l.qWaitCh)
+	return l.shutdownQEMU(ctx, l.ShutdownTimeout(), l.qCmd, l.qWaitCh)
+}
+
+func (l *LimaQemuDriver) Pause(_ context.Context) error {
+	return l.sendQMPCommand("stop", func(rawClient *raw.Monitor) error {
+		return rawClient.Stop()
+	})
+}
+
+func (l *LimaQemuDriver) Resume(_ context.Context) error {
+	return l.sendQMPCommand("cont", func(rawClient *raw.Monitor) error {
+		return rawClient.Cont()
+	})
+}
+
+func (l *LimaQemuDriver) sendQMPCommand(name string, f func(*raw.Monitor) error) error {
+	return l.monitor().do(qmpConnectTimeout, func(rawClient *raw.Monitor) error {
+		logrus.Infof("Sending QMP %s command", name)
+		return f(rawClient)
+	})
+}
+
+func (l *LimaQemuDriver) SetMemoryTarget(_ context.Context, size int64) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return SetMemoryTarget(qCfg, size)
+}
+
+func (l *LimaQemuDriver) MemoryActual(_ context.Context) (int64, error) {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return MemoryActual(qCfg)
+}
+
+func (l *LimaQemuDriver) SetDiskThrottle(_ context.Context, throttle limayaml.DiskThrottle) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return SetDiskThrottle(qCfg, throttle)
+}
+
+func (l *LimaQemuDriver) AttachUSBDevice(_ context.Context, index int) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return AttachUSBDevice(qCfg, index)
+}
+
+func (l *LimaQemuDriver) Screenshot(_ context.Context) (image.Image, error) {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return Screenshot(qCfg)
+}
+
+func (l *LimaQemuDriver) DetachUSBDevice(_ context.Context, index int) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return DetachUSBDevice(qCfg, index)
+}
+
+func (l *LimaQemuDriver) AttachDisk(_ context.Context, disk *store.Disk) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return AttachDisk(qCfg, disk)
+}
+
+func (l *LimaQemuDriver) DetachDisk(_ context.Context, diskName string) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return DetachDisk(qCfg, diskName)
+}
+
+func (l *LimaQemuDriver) AddNIC(_ context.Context, nw limayaml.Network) (string, error) {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return AddNIC(qCfg, nw)
+}
+
+func (l *LimaQemuDriver) RemoveNIC(_ context.Context, id string) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return RemoveNIC(qCfg, id)
 }
 
 func (l *LimaQemuDriver) ChangeDisplayPassword(_ context.Context, password string) error {
@@ -230,44 +717,43 @@ func waitFileExists(path string, timeout time.Duration) error {
 	return nil
 }
 
-func (l *LimaQemuDriver) changeVNCPassword(password string) error {
-	qmpSockPath := filepath.Join(l.Instance.Dir, filenames.QMPSock)
-	err := waitFileExists(qmpSockPath, 30*time.Second)
-	if err != nil {
-		return err
-	}
-	qmpClient, err := qmp.NewSocketMonitor("unix", qmpSockPath, 5*time.Second)
-	if err != nil {
-		return err
-	}
-	if err := qmpClient.Connect(); err != nil {
-		return err
-	}
-	defer func() { _ = qmpClient.Disconnect() }()
-	rawClient := raw.NewMonitor(qmpClient)
-	err = rawClient.ChangeVNCPassword(password)
-	if err != nil {
-		return err
+// connectQMPWithRetry connects to the QMP socket, retrying with backoff until the timeout.
+// The socket may exist but reject connections while QEMU is still initializing,
+// or may not respond while another client is connected.
+func connectQMPWithRetry(qmpSockPath string, timeout time.Duration) (*qmpconn.Conn, error) {
+	deadline := time.Now().Add(timeout)
+	backoff := 100 * time.Millisecond
+	for {
+		conn, err := qmpconn.Dial(qmpSockPath, min(qmpConnectTimeout, max(time.Until(deadline), backoff)))
+		if err == nil {
+			return conn, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout connecting to %s: %w", qmpSockPath, err)
+		}
+		logrus.WithError(err).Debugf("QMP socket %s is not ready yet, retrying in %v", qmpSockPath, backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 2*time.Second)
 	}
-	return nil
+}
+
+func (l *LimaQemuDriver) changeVNCPassword(password string) error {
+	return l.monitor().do(30*time.Second, func(rawClient *raw.Monitor) error {
+		return rawClient.ChangeVNCPassword(password)
+	})
 }
 
 func (l *LimaQemuDriver) getVNCDisplayPort() (string, error) {
-	qmpSockPath := filepath.Join(l.Instance.Dir, filenames.QMPSock)
-	qmpClient, err := qmp.NewSocketMonitor("unix", qmpSockPath, 5*time.Second)
-	if err != nil {
-		return "", err
-	}
-	if err := qmpClient.Connect(); err != nil {
-		return "", err
-	}
-	defer func() { _ = qmpClient.Disconnect() }()
-	rawClient := raw.NewMonitor(qmpClient)
-	info, err := rawClient.QueryVNC()
-	if err != nil {
-		return "", err
-	}
-	return *info.Service, nil
+	var service string
+	err := l.monitor().do(30*time.Second, func(rawClient *raw.Monitor) error {
+		info, err := rawClient.QueryVNC()
+		if err != nil {
+			return err
+		}
+		service = *info.Service
+		return nil
+	})
+	return service, err
 }
 
 func (l *LimaQemuDriver) removeVNCFiles() error {
@@ -295,8 +781,38 @@ func (l *LimaQemuDriver) killVhosts() error {
 	return errors.Join(errs...)
 }
 
+// Values of the "event" field of the structured log entries emitted by the driver.
+const (
+	eventStart           = "start"
+	eventQMPConnect      = "qmp-connect"
+	eventShutdownAttempt = "shutdown-attempt"
+	eventShutdown        = "shutdown"
+	eventKill            = "kill"
+)
+
+// logEvent returns a log entry for a driver event, with the fields that identify the instance.
+// The fields are machine-readable when `$LIMA_LOG_FORMAT` is set to "json".
+func (l *LimaQemuDriver) logEvent(event string) *logrus.Entry {
+	return logrus.WithFields(logrus.Fields{
+		"instance": l.Instance.Name,
+		"event":    event,
+	})
+}
+
+func (l *LimaQemuDriver) killSwtpm() error {
+	if l.swtpmCmd == nil {
+		return nil
+	}
+	// swtpm usually exits by itself when QEMU disconnects, due to `--terminate`
+	if err := l.swtpmCmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to kill swtpm: %w", err)
+	}
+	return nil
+}
+
 func (l *LimaQemuDriver) shutdownQEMU(ctx context.Context, timeout time.Duration, qCmd *exec.Cmd, qWaitCh <-chan error) error {
-	logrus.Info("Shutting down QEMU with ACPI")
+	begin := time.Now()
+	l.logEvent(eventShutdownAttempt).WithField("pid", qCmd.Process.Pid).Info("Shutting down QEMU with ACPI")
 	if usernetIndex := limayaml.FirstUsernetIndex(l.Yaml); usernetIndex != -1 {
 		client := usernet.NewClientByName(l.Yaml.Networks[usernetIndex].Lima)
 		err := client.UnExposeSSH(l.SSHLocalPort)
@@ -304,54 +820,221 @@ func (l *LimaQemuDriver) shutdownQEMU(ctx context.Context, timeout time.Duration
 			logrus.Warnf("Failed to remove SSH binding for port %d", l.SSHLocalPort)
 		}
 	}
-	qmpSockPath := filepath.Join(l.Instance.Dir, filenames.QMPSock)
-	qmpClient, err := qmp.NewSocketMonitor("unix", qmpSockPath, 5*time.Second)
-	if err != nil {
-		logrus.WithError(err).Warnf("failed to open the QMP socket %q, forcibly killing QEMU", qmpSockPath)
+	if timeout == 0 {
+		logrus.Info("The shutdown timeout is 0, forcibly killing QEMU without ACPI")
 		return l.killQEMU(ctx, timeout, qCmd, qWaitCh)
 	}
-	if err := qmpClient.Connect(); err != nil {
-		logrus.WithError(err).Warnf("failed to connect to the QMP socket %q, forcibly killing QEMU", qmpSockPath)
-		return l.killQEMU(ctx, timeout, qCmd, qWaitCh)
+	if *l.Yaml.QEMU.GuestAgent {
+		if err := l.guestShutdown(ctx); err != nil {
+			logrus.WithError(err).Warn("failed to shut down the guest via the QEMU guest agent, falling back to ACPI")
+		} else {
+			return l.waitQEMUExit(ctx, begin, timeout, qCmd, qWaitCh)
+		}
 	}
-	defer func() { _ = qmpClient.Disconnect() }()
-	rawClient := raw.NewMonitor(qmpClient)
-	logrus.Info("Sending QMP system_powerdown command")
-	if err := rawClient.SystemPowerdown(); err != nil {
-		logrus.WithError(err).Warnf("failed to send system_powerdown command via the QMP socket %q, forcibly killing QEMU", qmpSockPath)
+	var connected bool
+	err := l.monitor().do(qmpConnectTimeout, func(rawClient *raw.Monitor) error {
+		connected = true
+		l.logEvent(eventQMPConnect).WithField("socket", l.monitor().sockPath).Debug("Connected to the QMP socket")
+		// the guest cannot handle the ACPI event while its vCPUs are stopped
+		if status, err := rawClient.QueryStatus(); err == nil && !status.Running {
+			logrus.Infof("Sending QMP cont command, as QEMU is in %q state", status.Status)
+			if err := rawClient.Cont(); err != nil {
+				logrus.WithError(err).Warn("failed to send cont command via the QMP socket")
+			}
+		}
+		logrus.Info("Sending QMP system_powerdown command")
+		return rawClient.SystemPowerdown()
+	})
+	if err != nil {
+		if !connected {
+			logrus.WithError(err).Warnf("failed to connect to the QMP socket %q, forcibly killing QEMU", l.monitor().sockPath)
+		} else {
+			logrus.WithError(err).Warnf("failed to send system_powerdown command via the QMP socket %q, forcibly killing QEMU", l.monitor().sockPath)
+		}
 		return l.killQEMU(ctx, timeout, qCmd, qWaitCh)
 	}
+	return l.waitQEMUExit(ctx, begin, timeout, qCmd, qWaitCh)
+}
+
+// waitQEMUExit waits for QEMU to exit after requesting the guest to shut down, and kills QEMU after the timeout.
+func (l *LimaQemuDriver) waitQEMUExit(ctx context.Context, begin time.Time, timeout time.Duration, qCmd *exec.Cmd, qWaitCh <-chan error) error {
 	deadline := time.After(timeout)
 	select {
 	case qWaitErr := <-qWaitCh:
-		entry := logrus.NewEntry(logrus.StandardLogger())
+		entry := l.logEvent(eventShutdown).WithField("duration", time.Since(begin).String())
 		if qWaitErr != nil {
 			entry = entry.WithError(qWaitErr)
 		}
 		entry.Info("QEMU has exited")
 		_ = l.removeVNCFiles()
-		return errors.Join(qWaitErr, l.killVhosts())
+		return errors.Join(qWaitErr, l.killVhosts(), l.killSwtpm())
 	case <-deadline:
 	}
 	logrus.Warnf("QEMU did not exit in %v, forcibly killing QEMU", timeout)
 	return l.killQEMU(ctx, timeout, qCmd, qWaitCh)
 }
 
+// guestShutdown requests the QEMU guest agent (qemu-ga) to power off the guest.
+// Unlike the ACPI event, this works for guests that ignore ACPI.
+func (l *LimaQemuDriver) guestShutdown(ctx context.Context) error {
+	conn, _, err := l.dialGuestAgent(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	logrus.Info("Sending guest-shutdown command to the QEMU guest agent")
+	// the agent does not respond to guest-shutdown on success
+	_, err = fmt.Fprintln(conn, `{"execute":"guest-shutdown","arguments":{"mode":"powerdown"}}`)
+	return err
+}
+
+// dialGuestAgent connects to the QEMU guest agent (qemu-ga), and synchronizes the channel with "guest-sync".
+// The returned decoder must be used for reading the responses, as it may have buffered them.
+func (l *LimaQemuDriver) dialGuestAgent(ctx context.Context) (net.Conn, *json.Decoder, error) {
+	sock := filepath.Join(l.Instance.Dir, filenames.QEMUGuestAgentSock)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", sock)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	// guest-sync flushes stale data in the channel, and confirms that the agent is running in the guest
+	syncID := time.Now().UnixNano() % (1 << 31)
+	if _, err := fmt.Fprintf(conn, `{"execute":"guest-sync","arguments":{"id":%d}}`+"\n", syncID); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	dec := json.NewDecoder(conn)
+	for {
+		var resp struct {
+			Return *int64 `json:"return"`
+		}
+		if err := dec.Decode(&resp); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("the QEMU guest agent did not respond (hint: install qemu-guest-agent in the guest): %w", err)
+		}
+		if resp.Return != nil && *resp.Return == syncID {
+			return conn, dec, nil
+		}
+	}
+}
+
+// GuestIPs returns the IP addresses of the running guest, grouped by the interface name.
+// The addresses are queried from the QEMU guest agent with "guest-network-get-interfaces" when `qemu.guestAgent` is enabled,
+// and are looked up from the DHCP leases of the usernet networks otherwise, or when the guest agent is not responding.
+func (l *LimaQemuDriver) GuestIPs(ctx context.Context) (map[string][]net.IP, error) {
+	if *l.Yaml.QEMU.GuestAgent {
+		ips, err := l.guestAgentIPs(ctx)
+		if err == nil {
+			return ips, nil
+		}
+		if limayaml.FirstUsernetIndex(l.Yaml) == -1 {
+			return nil, err
+		}
+		logrus.WithError(err).Warn("Failed to query the IP addresses from the QEMU guest agent, falling back to the usernet leases")
+	}
+	return l.usernetIPs(ctx)
+}
+
+func (l *LimaQemuDriver) guestAgentIPs(ctx context.Context) (map[string][]net.IP, error) {
+	conn, dec, err := l.dialGuestAgent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := fmt.Fprintln(conn, `{"execute":"guest-network-get-interfaces"}`); err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Return []guestNetworkInterface `json:"return"`
+		Error  *struct {
+			Desc string `json:"desc"`
+		} `json:"error,omitempty"`
+	}
+	if err := dec.Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("guest-network-get-interfaces failed: %s", resp.Error.Desc)
+	}
+	return parseGuestNetworkInterfaces(resp.Return), nil
+}
+
+// guestNetworkInterface corresponds to GuestNetworkInterface of the QEMU guest agent.
+type guestNetworkInterface struct {
+	Name        string `json:"name"`
+	IPAddresses []struct {
+		IPAddressType string `json:"ip-address-type"`
+		IPAddress     string `json:"ip-address"`
+		Prefix        int    `json:"prefix"`
+	} `json:"ip-addresses,omitempty"`
+}
+
+// parseGuestNetworkInterfaces returns the non-loopback addresses of the interfaces, grouped by the interface name.
+func parseGuestNetworkInterfaces(ifaces []guestNetworkInterface) map[string][]net.IP {
+	res := make(map[string][]net.IP)
+	for _, iface := range ifaces {
+		for _, a := range iface.IPAddresses {
+			ip := net.ParseIP(a.IPAddress)
+			if ip == nil || ip.IsLoopback() {
+				continue
+			}
+			res[iface.Name] = append(res[iface.Name], ip)
+		}
+	}
+	return res
+}
+
+// usernetIPs looks up the IP addresses of the usernet networks from the DHCP leases, by the MAC addresses.
+func (l *LimaQemuDriver) usernetIPs(ctx context.Context) (map[string][]net.IP, error) {
+	res := make(map[string][]net.IP)
+	for _, nw := range l.Yaml.Networks {
+		if !networks.IsUsernet(nw.Lima) {
+			continue
+		}
+		client := usernet.NewClientByName(nw.Lima)
+		if client == nil {
+			return nil, fmt.Errorf("failed to create the client of usernet network %q", nw.Lima)
+		}
+		leases, err := client.Leases(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the leases of usernet network %q: %w", nw.Lima, err)
+		}
+		for ipAddr, macAddr := range leases {
+			if macAddr != nw.MACAddress {
+				continue
+			}
+			if ip := net.ParseIP(ipAddr); ip != nil {
+				res[nw.Interface] = append(res[nw.Interface], ip)
+			}
+		}
+	}
+	if len(res) == 0 {
+		return nil, errors.New("no IP address was found (hint: enable `qemu.guestAgent`, or use a usernet network)")
+	}
+	return res, nil
+}
+
 func (l *LimaQemuDriver) killQEMU(_ context.Context, _ time.Duration, qCmd *exec.Cmd, qWaitCh <-chan error) error {
 	var qWaitErr error
 	if qCmd.ProcessState == nil {
+		entry := l.logEvent(eventKill).WithField("pid", qCmd.Process.Pid)
+		begin := time.Now()
 		if killErr := qCmd.Process.Kill(); killErr != nil {
-			logrus.WithError(killErr).Warn("failed to kill QEMU")
+			entry.WithError(killErr).Warn("failed to kill QEMU")
 		}
 		qWaitErr = <-qWaitCh
-		logrus.WithError(qWaitErr).Info("QEMU has exited, after killing forcibly")
+		entry.WithField("duration", time.Since(begin).String()).WithError(qWaitErr).Info("QEMU has exited, after killing forcibly")
 	} else {
 		logrus.Info("QEMU has already exited")
 	}
 	qemuPIDPath := filepath.Join(l.Instance.Dir, filenames.PIDFile(*l.Yaml.VMType))
 	_ = os.RemoveAll(qemuPIDPath)
 	_ = l.removeVNCFiles()
-	return errors.Join(qWaitErr, l.killVhosts())
+	return errors.Join(qWaitErr, l.killVhosts(), l.killSwtpm())
 }
 
 func logPipeRoutine(r io.Reader, header string) {
@@ -362,43 +1045,163 @@ func logPipeRoutine(r io.Reader, header string) {
 	}
 }
 
+// running returns true if the QEMU process is running, regardless of whether its vCPUs are paused.
+func (l *LimaQemuDriver) running() bool {
+	return l.Instance.Status == store.StatusRunning || l.Instance.Status == store.StatusPaused
+}
+
 func (l *LimaQemuDriver) DeleteSnapshot(_ context.Context, tag string) error {
 	qCfg := Config{
 		Name:        l.Instance.Name,
 		InstanceDir: l.Instance.Dir,
 		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
 	}
-	return Del(qCfg, l.Instance.Status == store.StatusRunning, tag)
+	return Del(qCfg, l.running(), tag)
 }
 
+// errEphemeralSnapshot is returned for the snapshot operations that cannot be done while `diskOptions.ephemeral` is in effect,
+// as the running VM writes to the temporary file of `snapshot=on`, not to the main disk.
+var errEphemeralSnapshot = errors.New("cannot create or apply a snapshot while an instance with `diskOptions.ephemeral` is running")
+
 func (l *LimaQemuDriver) CreateSnapshot(_ context.Context, tag string) error {
+	if l.running() && *l.Yaml.DiskOptions.Ephemeral {
+		return errEphemeralSnapshot
+	}
 	qCfg := Config{
 		Name:        l.Instance.Name,
 		InstanceDir: l.Instance.Dir,
 		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
 	}
-	return Save(qCfg, l.Instance.Status == store.StatusRunning, tag)
+	return Save(qCfg, l.running(), tag)
 }
 
 func (l *LimaQemuDriver) ApplySnapshot(_ context.Context, tag string) error {
+	if l.running() && *l.Yaml.DiskOptions.Ephemeral {
+		return errEphemeralSnapshot
+	}
 	qCfg := Config{
 		Name:        l.Instance.Name,
 		InstanceDir: l.Instance.Dir,
 		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
 	}
-	return Load(qCfg, l.Instance.Status == store.StatusRunning, tag)
+	return Load(qCfg, l.running(), tag)
 }
 
-func (l *LimaQemuDriver) ListSnapshots(_ context.Context) (string, error) {
+func (l *LimaQemuDriver) ListSnapshots(_ context.Context) (*driver.SnapshotList, error) {
 	qCfg := Config{
 		Name:        l.Instance.Name,
 		InstanceDir: l.Instance.Dir,
 		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
 	}
-	return List(qCfg, l.Instance.Status == store.StatusRunning)
+	return List(qCfg, l.running())
+}
+
+func (l *LimaQemuDriver) ExportSnapshot(_ context.Context, tag, path string) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return Export(qCfg, l.running(), tag, path)
+}
+
+func (l *LimaQemuDriver) ImportSnapshot(_ context.Context, tag, path string) error {
+	if l.running() {
+		return errors.New("cannot import a snapshot into a running instance")
+	}
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return Import(qCfg, tag, path)
+}
+
+func (l *LimaQemuDriver) CompactDisk(_ context.Context, check bool) error {
+	if l.running() {
+		return fmt.Errorf("expected status %q, got %q", store.StatusStopped, l.Instance.Status)
+	}
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	return CompactDisk(qCfg, check)
+}
+
+func (l *LimaQemuDriver) ResizeDisk(_ context.Context, size int64) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Yaml,
+		qmp:         l.monitor(),
+	}
+	running := l.running()
+	if err := ResizeDisk(qCfg, running, size); err != nil {
+		return err
+	}
+	// persist the new size, so that it is not reverted on the next start
+	disk := strconv.FormatInt(size, 10)
+	if size%units.GiB == 0 {
+		disk = fmt.Sprintf("%dGiB", size/units.GiB)
+	}
+	filePath := filepath.Join(l.Instance.Dir, filenames.LimaYAML)
+	yContent, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	yBytes, err := yqutil.EvaluateExpression(fmt.Sprintf(".disk = %q", disk), yContent)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, yBytes, 0o644); err != nil {
+		return err
+	}
+	l.Yaml.Disk = &disk
+	if running {
+		logrus.Info("The disk was resized. To use the new space, grow the partition and the filesystem inside the guest, " +
+			"e.g., `sudo growpart /dev/vda 1 && sudo resize2fs /dev/vda1`, or restart the instance")
+	}
+	return nil
+}
+
+const vhostVSockDevice = "/dev/vhost-vsock"
+
+// SupportsVSock returns true on Linux hosts with vhost-vsock, as QEMU does not support vsock for other hosts.
+func (l *LimaQemuDriver) SupportsVSock() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	f, err := os.OpenFile(vhostVSockDevice, os.O_RDWR, 0)
+	if err != nil {
+		logrus.WithError(err).Debugf("vsock is not available (hint: load the \"vhost_vsock\" kernel module)")
+		return false
+	}
+	_ = f.Close()
+	return true
+}
+
+// ForwardGuestAgent returns true even when vsock is enabled, so that the socket forwarded over ssh
+// remains available as the fallback for the guests that cannot listen on vsock.
+func (l *LimaQemuDriver) ForwardGuestAgent() bool {
+	return true
 }
 
 func (l *LimaQemuDriver) GuestAgentConn(ctx context.Context) (net.Conn, error) {
+	if l.VSockPort != 0 {
+		conn, err := vsock.Dial(VSockCID(l.Instance.Dir), uint32(l.VSockPort), nil)
+		if err == nil {
+			return conn, nil
+		}
+		logrus.WithError(err).Debugf("failed to connect to the guest agent via vsock port %d, falling back to the forwarded socket", l.VSockPort)
+	}
 	var d net.Dialer
 	dialContext, err := d.DialContext(ctx, "unix", filepath.Join(l.Instance.Dir, filenames.GuestAgentSock))
 	return dialContext, err
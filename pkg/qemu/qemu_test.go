@@ -1,8 +1,29 @@
 package qemu
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/ptr"
+	"github.com/lima-vm/lima/pkg/qemu/qmpconn/qmpconntest"
+	"github.com/lima-vm/lima/pkg/store/filenames"
 	"gotest.tools/v3/assert"
 )
 
@@ -86,3 +107,734 @@ func TestParseQemuVersion(t *testing.T) {
 		assert.Equal(t, tc.expectedValue, v.String())
 	}
 }
+
+func TestParseSnapshotList(t *testing.T) {
+	loc := time.FixedZone("test", 9*60*60)
+	type testCase struct {
+		name     string
+		output   string
+		expected []driver.Snapshot
+	}
+	testCases := []testCase{
+		{
+			// qemu-img 8.2, after removing the "Snapshot list:" heading
+			name: "qemu-img with icount",
+			output: "ID        TAG               VM SIZE                DATE        VM CLOCK     ICOUNT\n" +
+				"1         disk-only             0 B 2024-03-27 10:21:00  00:00:00.000          0\n" +
+				"2         running           417 MiB 2024-03-27 10:22:41  00:01:12.345           \n",
+			expected: []driver.Snapshot{
+				{Tag: "disk-only", VMStateSize: 0, CreatedAt: time.Date(2024, 3, 27, 10, 21, 0, 0, loc), VMClock: 0},
+				{Tag: "running", VMStateSize: 417 * 1024 * 1024, CreatedAt: time.Date(2024, 3, 27, 10, 22, 41, 0, loc), VMClock: 72345 * time.Millisecond},
+			},
+		},
+		{
+			// qemu-img 4.2
+			name: "qemu-img without icount",
+			output: "ID        TAG                 VM SIZE                DATE       VM CLOCK\n" +
+				"1         snap1               1.5 GiB 2020-01-02 03:04:05   00:10:00.001\n",
+			expected: []driver.Snapshot{
+				{Tag: "snap1", VMStateSize: 1536 * 1024 * 1024, CreatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, loc), VMClock: 600001 * time.Millisecond},
+			},
+		},
+		{
+			// HMP "info snapshots", after removing the heading
+			name: "hmp",
+			output: "ID        TAG               VM SIZE                DATE        VM CLOCK     ICOUNT\n" +
+				"--        snap2             328 MiB 2024-01-01 12:00:00  00:00:10.123           \n",
+			expected: []driver.Snapshot{
+				{Tag: "snap2", VMStateSize: 328 * 1024 * 1024, CreatedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, loc), VMClock: 10123 * time.Millisecond},
+			},
+		},
+		{
+			name:     "empty",
+			output:   "",
+			expected: nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			snapshots, err := parseSnapshotList(tc.output, loc)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tc.expected, snapshots)
+		})
+	}
+
+	_, err := parseSnapshotList("garbage\n", loc)
+	assert.ErrorContains(t, err, "failed to parse snapshot line")
+}
+
+func TestSelectAccel(t *testing.T) {
+	// the foreign arch can only use tcg
+	arch := limayaml.RISCV64
+	if limayaml.IsNativeArch(arch) {
+		arch = limayaml.X8664
+	}
+	accel, err := selectAccel(arch, []limayaml.Accel{limayaml.KVM, limayaml.HVF, limayaml.TCG}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, limayaml.TCG, accel)
+
+	_, err = selectAccel(arch, []limayaml.Accel{limayaml.KVM, limayaml.HVF}, nil)
+	assert.ErrorContains(t, err, "kvm (arch")
+	assert.ErrorContains(t, err, "hvf (arch")
+
+	_, err = selectAccel(arch, []limayaml.Accel{limayaml.TCG}, []byte("Accelerators supported in QEMU binary:\nkvm\n"))
+	assert.ErrorContains(t, err, "tcg (not supported by QEMU)")
+
+	accel, err = selectAccel(arch, nil, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, Accel(arch), accel)
+}
+
+func TestScanCarriageReturns(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader("    (0.00/100%)\r    (50.01/100%)\r    (100.00/100%)\n"))
+	scanner.Split(scanCarriageReturns)
+	var tokens []string
+	for scanner.Scan() {
+		tokens = append(tokens, strings.TrimSpace(scanner.Text()))
+	}
+	assert.NilError(t, scanner.Err())
+	assert.DeepEqual(t, []string{"(0.00/100%)", "(50.01/100%)", "(100.00/100%)"}, tokens)
+}
+
+func TestUSBHostDeviceArg(t *testing.T) {
+	arg, err := usbHostDeviceArg(0, limayaml.USBDevice{VendorID: ptr.Of("1050"), ProductID: ptr.Of("0x407")})
+	assert.NilError(t, err)
+	assert.Equal(t, "usb-host,bus=usb-bus,id=usbdev0,vendorid=0x1050,productid=0x0407", arg)
+
+	arg, err = usbHostDeviceArg(1, limayaml.USBDevice{HostBus: ptr.Of(1), HostAddr: ptr.Of(5)})
+	assert.NilError(t, err)
+	assert.Equal(t, "usb-host,bus=usb-bus,id=usbdev1,hostbus=1,hostaddr=5", arg)
+
+	_, err = usbHostDeviceArg(2, limayaml.USBDevice{})
+	assert.ErrorContains(t, err, "must be set")
+}
+
+func TestVirglDisplay(t *testing.T) {
+	f := &features{
+		DeviceHelp:  []byte("name \"virtio-vga-gl\", bus PCI\nname \"virtio-gpu-gl-pci\", bus PCI, alias \"virtio-gpu-gl\"\n"),
+		DisplayHelp: []byte("Available display backend types:\nnone\ngtk\negl-headless\n"),
+	}
+	display, device, err := virglDisplay("linux", limayaml.X8664, "default", f)
+	assert.NilError(t, err)
+	assert.Equal(t, "gtk,gl=on", display)
+	assert.Equal(t, "virtio-vga-gl", device)
+
+	display, device, err = virglDisplay("linux", limayaml.AARCH64, "vnc", f)
+	assert.NilError(t, err)
+	assert.Equal(t, "egl-headless", display)
+	assert.Equal(t, "virtio-gpu-gl-pci", device)
+
+	_, _, err = virglDisplay("darwin", limayaml.X8664, "default", f)
+	assert.ErrorContains(t, err, "not supported by the QEMU binary")
+
+	_, _, err = virglDisplay("linux", limayaml.X8664, "none", f)
+	assert.ErrorContains(t, err, "does not support OpenGL")
+}
+
+func TestConnectQMPWithRetryTimeout(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "qmp.sock")
+	_, err := connectQMPWithRetry(sock, 300*time.Millisecond)
+	assert.ErrorContains(t, err, "timeout connecting to "+sock)
+}
+
+func TestWaitVhostSock(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "virtiofsd-0.sock")
+	err := waitVhostSock(sock, 300*time.Millisecond, make(chan error), &tailBuffer{})
+	assert.ErrorContains(t, err, "never appeared in 300ms")
+
+	waitCh := make(chan error, 1)
+	waitCh <- errors.New("exit status 1")
+	stderr := &tailBuffer{}
+	_, _ = stderr.Write([]byte("Error: no such file or directory\n"))
+	err = waitVhostSock(sock, time.Minute, waitCh, stderr)
+	assert.ErrorContains(t, err, `exit status 1 (stderr: "Error: no such file or directory")`)
+
+	assert.NilError(t, os.WriteFile(sock, nil, 0o600))
+	assert.NilError(t, waitVhostSock(sock, time.Minute, make(chan error), &tailBuffer{}))
+}
+
+func TestTailBuffer(t *testing.T) {
+	var b tailBuffer
+	_, _ = b.Write([]byte(strings.Repeat("a", tailBufferSize)))
+	_, _ = b.Write([]byte("bc"))
+	assert.Equal(t, len(b.String()), tailBufferSize)
+	assert.Assert(t, strings.HasSuffix(b.String(), "abc"))
+}
+
+func TestRunQMPCommandRefusesDestructive(t *testing.T) {
+	_, err := RunQMPCommand(t.TempDir(), "quit", nil, time.Second, false)
+	assert.ErrorContains(t, err, "refusing to run the destructive QMP command \"quit\"")
+
+	_, err = RunQMPCommand(t.TempDir(), "query-status", json.RawMessage("{"), time.Second, false)
+	assert.ErrorContains(t, err, "not valid JSON")
+}
+
+func TestRunQMPCommandTimeout(t *testing.T) {
+	srv := qmpconntest.NewServer(t, queryStatusHandler)
+	instDir := filepath.Dir(srv.SockPath)
+	resp, err := RunQMPCommand(instDir, "query-status", nil, time.Second, false)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(resp), `"status":"running"`))
+
+	// another client is connected, so QEMU does not send the greeting
+	conn, err := net.Dial("unix", srv.SockPath)
+	assert.NilError(t, err)
+	defer conn.Close()
+	begin := time.Now()
+	_, err = RunQMPCommand(instDir, "query-status", nil, 500*time.Millisecond, false)
+	assert.ErrorContains(t, err, "failed to read the greeting")
+	assert.Assert(t, time.Since(begin) < 5*time.Second)
+}
+
+func TestDecodePPM(t *testing.T) {
+	ppm := "P6\n# comment\n2 1\n255\n" + "\xff\x00\x00" + "\x00\x80\xff"
+	img, err := decodePPM(bufio.NewReader(strings.NewReader(ppm)))
+	assert.NilError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 2, 1), img.Bounds())
+	assert.Equal(t, color.RGBA{R: 0xff, A: 0xff}, img.At(0, 0))
+	assert.Equal(t, color.RGBA{G: 0x80, B: 0xff, A: 0xff}, img.At(1, 0))
+
+	_, err = decodePPM(bufio.NewReader(strings.NewReader("P3\n1 1\n255\n0 0 0\n")))
+	assert.ErrorContains(t, err, "unsupported PPM format")
+
+	_, err = decodePPM(bufio.NewReader(strings.NewReader("P6\n2 2\n255\n\x00\x00\x00")))
+	assert.ErrorContains(t, err, "failed to read the PPM pixels")
+}
+
+func TestDiskDriveOptions(t *testing.T) {
+	opts := limayaml.DiskOptions{CacheMode: ptr.Of(""), AIO: ptr.Of(""), Discard: ptr.Of(false)}
+	assert.Equal(t, ",discard=on", diskDriveOptions(opts))
+
+	opts = limayaml.DiskOptions{CacheMode: ptr.Of("none"), AIO: ptr.Of("native"), Discard: ptr.Of(true)}
+	assert.Equal(t, ",discard=unmap,detect-zeroes=unmap,cache=none,aio=native", diskDriveOptions(opts))
+}
+
+func TestDiskThrottleDriveOptions(t *testing.T) {
+	throttle, err := diskThrottle(limayaml.DiskThrottle{
+		IOPS: ptr.Of(int64(0)), ReadIOPS: ptr.Of(int64(500)), WriteIOPS: ptr.Of(int64(100)),
+		BPS: ptr.Of("10MiB"), ReadBPS: ptr.Of("0"), WriteBPS: ptr.Of("0"),
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, int64(10*1024*1024), throttle.Bps)
+	assert.Equal(t, ",throttling.iops-read=500,throttling.iops-write=100,throttling.bps-total=10485760", diskThrottleDriveOptions(throttle))
+
+	throttle, err = diskThrottle(limayaml.DiskThrottle{
+		IOPS: ptr.Of(int64(0)), ReadIOPS: ptr.Of(int64(0)), WriteIOPS: ptr.Of(int64(0)),
+		BPS: ptr.Of("0"), ReadBPS: ptr.Of("0"), WriteBPS: ptr.Of("0"),
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, "", diskThrottleDriveOptions(throttle))
+}
+
+func TestValidateMachine(t *testing.T) {
+	machineHelp := []byte(`Supported machines are:
+pc                   Standard PC (i440FX + PIIX, 1996) (alias of pc-i440fx-8.2)
+pc-i440fx-8.2        Standard PC (i440FX + PIIX, 1996) (default)
+q35                  Standard PC (Q35 + ICH9, 2009) (alias of pc-q35-8.2)
+pc-q35-8.2           Standard PC (Q35 + ICH9, 2009)
+none                 empty machine
+`)
+	assert.DeepEqual(t, []string{"pc", "pc-i440fx-8.2", "q35", "pc-q35-8.2", "none"}, machineNames(machineHelp))
+	assert.NilError(t, validateMachine("pc-q35-8.2", machineHelp))
+	assert.ErrorContains(t, validateMachine("pc-q35-9.9", machineHelp), "supported machine types: pc, pc-i440fx-8.2, q35, pc-q35-8.2, none")
+	assert.NilError(t, validateMachine("pc-q35-9.9", nil))
+
+	// other help outputs must not be parsed as machine types
+	assert.Assert(t, machineNames([]byte("Accelerators supported in QEMU binary:\ntcg\nkvm\n")) == nil)
+	mixed := append([]byte("Available netdev backend types:\nsocket\nuser\n"), machineHelp...)
+	assert.DeepEqual(t, []string{"pc", "pc-i440fx-8.2", "q35", "pc-q35-8.2", "none"}, machineNames(mixed))
+}
+
+func TestIsQ35Machine(t *testing.T) {
+	assert.Assert(t, isQ35Machine("q35"))
+	assert.Assert(t, isQ35Machine("pc-q35-8.2"))
+	assert.Assert(t, !isQ35Machine("pc"))
+	assert.Assert(t, !isQ35Machine("pc-i440fx-8.2"))
+	assert.Assert(t, !isQ35Machine("microvm"))
+}
+
+func TestFindAdditionalDisk(t *testing.T) {
+	queryBlockResp := []byte(`{"return": [
+{"device": "diffdisk", "qdev": "/machine/peripheral-anon/device[1]/virtio-backend", "inserted": {"node-name": "#block123"}},
+{"device": "lima-disk-foo", "qdev": "/machine/peripheral-anon/device[2]/virtio-backend", "inserted": {"node-name": "#block456"}},
+{"device": "", "qdev": "lima-disk-bar", "inserted": {"node-name": "lima-disk-bar"}}
+]}`)
+	qdev, hotplugged, err := findAdditionalDisk(queryBlockResp, "lima-disk-foo")
+	assert.NilError(t, err)
+	assert.Equal(t, "/machine/peripheral-anon/device[2]", qdev)
+	assert.Check(t, !hotplugged)
+
+	qdev, hotplugged, err = findAdditionalDisk(queryBlockResp, "lima-disk-bar")
+	assert.NilError(t, err)
+	assert.Equal(t, "lima-disk-bar", qdev)
+	assert.Check(t, hotplugged)
+
+	_, _, err = findAdditionalDisk(queryBlockResp, "lima-disk-baz")
+	assert.ErrorContains(t, err, "was not found")
+}
+
+func TestParseGuestNetworkInterfaces(t *testing.T) {
+	// the response of guest-network-get-interfaces
+	resp := []byte(`[
+{"name": "lo", "ip-addresses": [{"ip-address-type": "ipv4", "ip-address": "127.0.0.1", "prefix": 8}, {"ip-address-type": "ipv6", "ip-address": "::1", "prefix": 128}]},
+{"name": "eth0", "hardware-address": "52:55:55:12:34:56", "ip-addresses": [{"ip-address-type": "ipv4", "ip-address": "192.168.5.15", "prefix": 24}, {"ip-address-type": "ipv6", "ip-address": "fe80::5055:55ff:fe12:3456", "prefix": 64}]},
+{"name": "lima0", "hardware-address": "52:55:55:65:43:21"}
+]`)
+	var ifaces []guestNetworkInterface
+	assert.NilError(t, json.Unmarshal(resp, &ifaces))
+	assert.DeepEqual(t, map[string][]net.IP{
+		"eth0": {net.ParseIP("192.168.5.15"), net.ParseIP("fe80::5055:55ff:fe12:3456")},
+	}, parseGuestNetworkInterfaces(ifaces))
+}
+
+func TestNUMAArgs(t *testing.T) {
+	nodes := []limayaml.NUMANode{{CPUs: "0-1", Memory: "1GiB"}, {CPUs: "2,4-5", Memory: "2GiB"}}
+	args, err := numaArgs(nodes, 3<<30, false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{
+		"-object", "memory-backend-ram,id=numa-mem0,size=1073741824",
+		"-numa", "node,nodeid=0,memdev=numa-mem0,cpus=0-1",
+		"-object", "memory-backend-ram,id=numa-mem1,size=2147483648",
+		"-numa", "node,nodeid=1,memdev=numa-mem1,cpus=2,cpus=4-5",
+	}, args)
+
+	args, err = numaArgs(nodes[:1], 1<<30, true)
+	assert.NilError(t, err)
+	assert.Equal(t, "memory-backend-file,id=numa-mem0,size=1073741824,mem-path=/dev/shm,share=on", args[1])
+
+	_, err = numaArgs(nodes, 4<<30, false)
+	assert.ErrorContains(t, err, "in total")
+}
+
+func TestInspectCaps(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on windows")
+	}
+	t.Setenv("LIMA_HOME", t.TempDir())
+	dir := t.TempDir()
+	count := filepath.Join(dir, "count")
+	exe := filepath.Join(dir, "qemu-system-x86_64")
+	script := `#!/bin/sh
+echo >>` + count + `
+if [ "$1" = "--version" ]; then
+  echo "QEMU emulator version 9.0.2"
+else
+  echo "tcg"
+fi
+`
+	assert.NilError(t, os.WriteFile(exe, []byte(script), 0o755))
+	probes := func() int {
+		b, err := os.ReadFile(count)
+		assert.NilError(t, err)
+		return strings.Count(string(b), "\n")
+	}
+
+	caps, err := inspectCaps(exe, "q35")
+	assert.NilError(t, err)
+	assert.Equal(t, "9.0.2", caps.Version)
+	assert.Assert(t, strings.Contains(string(caps.Features.AccelHelp), "tcg"))
+	n := probes()
+
+	// cached
+	caps, err = inspectCaps(exe, "q35")
+	assert.NilError(t, err)
+	assert.Equal(t, "9.0.2", caps.Version)
+	assert.Assert(t, strings.Contains(string(caps.Features.AccelHelp), "tcg"))
+	assert.Equal(t, n, probes())
+
+	// invalidated when the binary changes
+	modTime := time.Now().Add(time.Hour)
+	assert.NilError(t, os.Chtimes(exe, modTime, modTime))
+	_, err = inspectCaps(exe, "q35")
+	assert.NilError(t, err)
+	assert.Equal(t, 2*n, probes())
+}
+
+func TestInspectFeatures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on windows")
+	}
+	exe := filepath.Join(t.TempDir(), "qemu-system-x86_64")
+	// print the option preceding "help", e.g., "-accel help" prints "accel-help"
+	script := `#!/bin/sh
+prev=
+for a in "$@"; do
+  if [ "$a" = "help" ]; then
+    echo "${prev#-}-help"
+  fi
+  prev=$a
+done
+`
+	assert.NilError(t, os.WriteFile(exe, []byte(script), 0o755))
+	f, err := inspectFeatures(exe, "q35")
+	assert.NilError(t, err)
+	assert.Equal(t, "accel-help\n", string(f.AccelHelp))
+	assert.Equal(t, "netdev-help\n", string(f.NetdevHelp))
+	assert.Equal(t, "machine-help\n", string(f.MachineHelp))
+	assert.Equal(t, "cpu-help\n", string(f.CPUHelp))
+	assert.Equal(t, "device-help\n", string(f.DeviceHelp))
+	assert.Equal(t, "display-help\n", string(f.DisplayHelp))
+}
+
+func TestValidateVFIODevice(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+	sysfsDir := t.TempDir()
+	groupsDir := t.TempDir()
+	driversDir := t.TempDir()
+	devVFIODir := t.TempDir()
+	mkdev := func(addr, group, driver string) {
+		devDir := filepath.Join(sysfsDir, addr)
+		groupDir := filepath.Join(groupsDir, group)
+		assert.NilError(t, os.MkdirAll(filepath.Join(groupDir, "devices"), 0o755))
+		assert.NilError(t, os.MkdirAll(devDir, 0o755))
+		assert.NilError(t, os.Symlink(groupDir, filepath.Join(devDir, "iommu_group")))
+		assert.NilError(t, os.Symlink(devDir, filepath.Join(groupDir, "devices", addr)))
+		if driver != "" {
+			assert.NilError(t, os.Symlink(filepath.Join(driversDir, driver), filepath.Join(devDir, "driver")))
+		}
+	}
+	mkdev("0000:01:00.0", "1", "vfio-pci")
+	mkdev("0000:01:00.1", "1", "")
+	mkdev("0000:00:01.0", "1", "pcieport")
+	mkdev("0000:02:00.0", "2", "nvidia")
+	mkdev("0000:03:00.0", "3", "")
+	mkdev("0000:05:00.0", "5", "vfio-pci")
+	mkdev("0000:05:00.1", "5", "snd_hda_intel")
+	mkdev("0000:06:00.0", "6", "vfio-pci")
+	assert.NilError(t, os.MkdirAll(filepath.Join(sysfsDir, "0000:07:00.0"), 0o755))
+	for _, group := range []string{"1", "5"} {
+		assert.NilError(t, os.WriteFile(filepath.Join(devVFIODir, group), nil, 0o600))
+	}
+
+	assert.NilError(t, validateVFIODevice(sysfsDir, devVFIODir, "0000:01:00.0"))
+	assert.ErrorContains(t, validateVFIODevice(sysfsDir, devVFIODir, "0000:02:00.0"), `bound to "nvidia"`)
+	assert.ErrorContains(t, validateVFIODevice(sysfsDir, devVFIODir, "0000:03:00.0"), "not bound to any driver")
+	assert.ErrorContains(t, validateVFIODevice(sysfsDir, devVFIODir, "0000:04:00.0"), "not found")
+	assert.ErrorContains(t, validateVFIODevice(sysfsDir, devVFIODir, "0000:05:00.0"),
+		`in the IOMMU group 5 with device "0000:05:00.1" bound to "snd_hda_intel"`)
+	assert.ErrorContains(t, validateVFIODevice(sysfsDir, devVFIODir, "0000:06:00.0"), "cannot open")
+	assert.ErrorContains(t, validateVFIODevice(sysfsDir, devVFIODir, "0000:07:00.0"), "has no IOMMU group")
+}
+
+func TestVSockCID(t *testing.T) {
+	cid := VSockCID("/home/user/.lima/default")
+	assert.Assert(t, cid >= 3)
+	assert.Assert(t, cid <= math.MaxInt32)
+	assert.Equal(t, cid, VSockCID("/home/user/.lima/default"))
+	assert.Assert(t, cid != VSockCID("/home/user/.lima/other"))
+}
+
+func TestRNGArgs(t *testing.T) {
+	assert.DeepEqual(t, rngArgs("linux"), []string{
+		"-object", "rng-random,id=rng0,filename=/dev/urandom",
+		"-device", "virtio-rng-pci,rng=rng0",
+	})
+	// rng-random is not available on Windows builds of QEMU
+	assert.DeepEqual(t, rngArgs("windows"), []string{"-device", "virtio-rng-pci"})
+}
+
+func TestAddNIC(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("passing a file descriptor is not supported on Windows")
+	}
+	srv := qmpconntest.NewServer(t, func(cmd qmpconntest.Command) (any, error) {
+		if cmd.Execute == "qom-list" {
+			return []map[string]string{{"name": "nic-hotplug0", "type": "child<virtio-net-pci>"}}, nil
+		}
+		return nil, nil
+	})
+	// the socket of the network backend
+	nwSock := filepath.Join(t.TempDir(), "nw.sock")
+	l, err := net.Listen("unix", nwSock)
+	assert.NilError(t, err)
+	defer l.Close()
+
+	cfg := Config{
+		InstanceDir: filepath.Dir(srv.SockPath),
+		LimaYAML:    &limayaml.LimaYAML{QEMU: limayaml.QEMUOpts{HotplugPorts: ptr.Of(2)}},
+	}
+	id, err := AddNIC(cfg, limayaml.Network{Socket: nwSock, MACAddress: "52:55:55:00:00:01"})
+	assert.NilError(t, err)
+	assert.Equal(t, "nic-hotplug1", id)
+	assert.DeepEqual(t, []string{"qom-list", "getfd", "netdev_add", "device_add"}, srv.Executed())
+	var deviceArgs map[string]string
+	assert.NilError(t, json.Unmarshal(srv.Commands()[3].Arguments, &deviceArgs))
+	assert.DeepEqual(t, map[string]string{
+		"driver": "virtio-net-pci",
+		"id":     "nic-hotplug1",
+		"netdev": "nic-hotplug1-netdev",
+		"mac":    "52:55:55:00:00:01",
+		"bus":    "hotplug1",
+	}, deviceArgs)
+
+	// all the reserved ports are in use
+	cfg.LimaYAML.QEMU.HotplugPorts = ptr.Of(1)
+	_, err = AddNIC(cfg, limayaml.Network{Socket: nwSock})
+	assert.ErrorContains(t, err, "all the 1 ports reserved by `qemu.hotplugPorts` are in use")
+}
+
+func TestRemoveNIC(t *testing.T) {
+	srv := qmpconntest.NewServer(t, func(qmpconntest.Command) (any, error) {
+		return nil, nil
+	})
+	cfg := Config{InstanceDir: filepath.Dir(srv.SockPath)}
+	assert.NilError(t, RemoveNIC(cfg, "nic-hotplug0"))
+	assert.DeepEqual(t, []string{"device_del", "netdev_del"}, srv.Executed())
+
+	assert.ErrorContains(t, RemoveNIC(cfg, "net0"), "is not a NIC added by AddNIC")
+}
+
+func TestSetDiskThrottle(t *testing.T) {
+	srv := qmpconntest.NewServer(t, func(qmpconntest.Command) (any, error) {
+		return nil, nil
+	})
+	cfg := Config{
+		InstanceDir: filepath.Dir(srv.SockPath),
+		LimaYAML:    &limayaml.LimaYAML{Disk: ptr.Of("100GiB")},
+	}
+	throttle := limayaml.DiskThrottle{
+		IOPS:      ptr.Of(int64(100)),
+		ReadIOPS:  ptr.Of(int64(0)),
+		WriteIOPS: ptr.Of(int64(0)),
+		BPS:       ptr.Of("1MiB"),
+		ReadBPS:   ptr.Of("0"),
+		WriteBPS:  ptr.Of("0"),
+	}
+	assert.NilError(t, SetDiskThrottle(cfg, throttle))
+
+	// the basedisk is the main disk when the diffdisk is not created
+	cfg.LimaYAML.Disk = ptr.Of("0")
+	throttle.IOPS = ptr.Of(int64(0))
+	assert.NilError(t, SetDiskThrottle(cfg, throttle))
+
+	assert.DeepEqual(t, []string{"block_set_io_throttle", "block_set_io_throttle"}, srv.Executed())
+	var args []map[string]any
+	for _, cmd := range srv.Commands() {
+		var m map[string]any
+		assert.NilError(t, json.Unmarshal(cmd.Arguments, &m))
+		args = append(args, m)
+	}
+	assert.Equal(t, args[0]["device"], diffDiskDriveID)
+	assert.Equal(t, args[0]["iops"], float64(100))
+	assert.Equal(t, args[0]["bps"], float64(1024*1024))
+	assert.Equal(t, args[1]["device"], baseDiskDriveID)
+	assert.Equal(t, args[1]["iops"], float64(0))
+}
+
+// fakeQEMUImg puts a fake qemu-img in PATH, which reports vsize as the virtual size of any image,
+// and records the arguments of the other subcommands in the returned file.
+func fakeQEMUImg(t *testing.T, vsize int64) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake qemu-img is a shell script")
+	}
+	binDir := t.TempDir()
+	logPath := filepath.Join(binDir, "qemu-img.log")
+	script := fmt.Sprintf(`#!/bin/sh
+if [ "$1" = info ]; then
+	echo '{"format": "qcow2", "virtual-size": %d}'
+	exit 0
+fi
+echo "$@" >>%q
+`, vsize, logPath)
+	assert.NilError(t, os.WriteFile(filepath.Join(binDir, "qemu-img"), []byte(script), 0o755))
+	t.Setenv("PATH", binDir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	return logPath
+}
+
+func TestResizeDisk(t *testing.T) {
+	const size = 100 * 1024 * 1024 * 1024
+	logPath := fakeQEMUImg(t, size)
+	srv := qmpconntest.NewServer(t, func(qmpconntest.Command) (any, error) {
+		return nil, nil
+	})
+	cfg := Config{InstanceDir: filepath.Dir(srv.SockPath)}
+	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
+	qemuImgArgs := func() string {
+		b, err := os.ReadFile(logPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return ""
+		}
+		assert.NilError(t, err)
+		return string(b)
+	}
+
+	// a stopped instance is resized with qemu-img
+	assert.NilError(t, ResizeDisk(cfg, false, 2*size))
+	assert.Equal(t, qemuImgArgs(), fmt.Sprintf("resize -f qcow2 %s %d\n", diffDisk, int64(2*size)))
+	assert.Equal(t, len(srv.Executed()), 0)
+
+	// a running instance is resized with QMP
+	assert.NilError(t, os.Remove(logPath))
+	assert.NilError(t, ResizeDisk(cfg, true, 2*size))
+	assert.Equal(t, qemuImgArgs(), "")
+	assert.DeepEqual(t, srv.Executed(), []string{"block_resize"})
+	var args map[string]any
+	assert.NilError(t, json.Unmarshal(srv.Commands()[0].Arguments, &args))
+	assert.Equal(t, args["device"], diffDiskDriveID)
+	assert.Equal(t, args["size"], float64(2*size))
+
+	// the same size is a no-op
+	for _, run := range []bool{false, true} {
+		assert.NilError(t, ResizeDisk(cfg, run, size))
+	}
+
+	// shrinking is rejected
+	for _, run := range []bool{false, true} {
+		assert.ErrorContains(t, ResizeDisk(cfg, run, size/2), "Disk shrinking is currently unavailable")
+	}
+	assert.Equal(t, qemuImgArgs(), "")
+	assert.Equal(t, len(srv.Executed()), 1)
+}
+
+func TestGrowDisk(t *testing.T) {
+	const size = 100 * 1024 * 1024 * 1024
+	logPath := fakeQEMUImg(t, size)
+	cfg := Config{InstanceDir: t.TempDir(), LimaYAML: &limayaml.LimaYAML{}}
+	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
+
+	// a disk larger than lima.yaml does not prevent the instance from starting
+	cfg.LimaYAML.Disk = ptr.Of("50GiB")
+	assert.NilError(t, growDisk(cfg))
+	_, err := os.Stat(logPath)
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+
+	cfg.LimaYAML.Disk = ptr.Of("100GiB")
+	assert.NilError(t, growDisk(cfg))
+	_, err = os.Stat(logPath)
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+
+	cfg.LimaYAML.Disk = ptr.Of("200GiB")
+	assert.NilError(t, growDisk(cfg))
+	b, err := os.ReadFile(logPath)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), fmt.Sprintf("resize -f qcow2 %s %d\n", diffDisk, int64(2*size)))
+}
+
+func TestMemoryBalloonArgs(t *testing.T) {
+	y := &limayaml.LimaYAML{MemoryBalloon: limayaml.MemoryBalloon{Enabled: ptr.Of(true)}}
+	assert.DeepEqual(t, memoryBalloonArgs(y), []string{"-device", "virtio-balloon-pci,id=balloon0"})
+	y.MemoryBalloon.Enabled = ptr.Of(false)
+	assert.Equal(t, len(memoryBalloonArgs(y)), 0)
+}
+
+func TestMemoryActual(t *testing.T) {
+	srv := qmpconntest.NewServer(t, func(cmd qmpconntest.Command) (any, error) {
+		if cmd.Execute == "query-balloon" {
+			return map[string]int64{"actual": 3 * 1024 * 1024 * 1024}, nil
+		}
+		return nil, errors.New("unexpected command")
+	})
+	cfg := Config{
+		InstanceDir: filepath.Dir(srv.SockPath),
+		LimaYAML:    &limayaml.LimaYAML{MemoryBalloon: limayaml.MemoryBalloon{Enabled: ptr.Of(true)}},
+	}
+	actual, err := MemoryActual(cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, actual, int64(3*1024*1024*1024))
+
+	cfg.LimaYAML.MemoryBalloon.Enabled = ptr.Of(false)
+	_, err = MemoryActual(cfg)
+	assert.ErrorContains(t, err, "`memoryBalloon.enabled` is not set to true")
+	assert.DeepEqual(t, srv.Executed(), []string{"query-balloon"})
+}
+
+func TestSetMemoryTarget(t *testing.T) {
+	const gib = 1024 * 1024 * 1024
+	var target atomic.Int64
+	srv := qmpconntest.NewServer(t, func(cmd qmpconntest.Command) (any, error) {
+		switch cmd.Execute {
+		case "qom-get":
+			return map[string]any{
+				"stats":       map[string]int64{"stat-total-memory": 4 * gib, "stat-available-memory": 3 * gib},
+				"last-update": 1,
+			}, nil
+		case "balloon":
+			var args struct {
+				Value int64 `json:"value"`
+			}
+			if err := json.Unmarshal(cmd.Arguments, &args); err != nil {
+				return nil, err
+			}
+			target.Store(args.Value)
+		case "query-balloon":
+			return map[string]int64{"actual": target.Load()}, nil
+		}
+		return nil, nil
+	})
+	cfg := Config{
+		InstanceDir: filepath.Dir(srv.SockPath),
+		LimaYAML: &limayaml.LimaYAML{
+			Memory:        ptr.Of("4GiB"),
+			MemoryBalloon: limayaml.MemoryBalloon{Enabled: ptr.Of(true)},
+		},
+	}
+	assert.NilError(t, SetMemoryTarget(cfg, 2*gib))
+	assert.DeepEqual(t, srv.Executed(), []string{"qom-set", "qom-get", "balloon", "query-balloon"})
+	assert.Equal(t, target.Load(), int64(2*gib))
+
+	// the bounds are checked before sending any command
+	assert.ErrorContains(t, SetMemoryTarget(cfg, 8*gib), `specified size "8GiB" is larger than the memory size "4GiB"`)
+	assert.ErrorContains(t, SetMemoryTarget(cfg, 0), "is not positive")
+	cfg.LimaYAML.MemoryBalloon.Enabled = ptr.Of(false)
+	assert.ErrorContains(t, SetMemoryTarget(cfg, 2*gib), "`memoryBalloon.enabled` must be set to true")
+	assert.Equal(t, len(srv.Executed()), 4)
+}
+
+func TestNewWithoutInstance(t *testing.T) {
+	// the driver is created without the instance for validating the YAML, e.g., by `limactl doctor`
+	l := New(&driver.BaseDriver{Yaml: &limayaml.LimaYAML{}})
+	assert.Assert(t, l.qmp == nil)
+}
+
+// fakeQEMUSystem writes a fake qemu-system-x86_64, which prints the version and the minimal help outputs for Cmdline.
+func fakeQEMUSystem(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake qemu-system-x86_64 is a shell script")
+	}
+	exe := filepath.Join(t.TempDir(), "qemu-system-x86_64")
+	script := `#!/bin/sh
+if [ "$1" = "--version" ]; then
+  echo "QEMU emulator version 9.0.2"
+else
+  echo "tcg kvm hvf whpx qemu64 q35"
+fi
+`
+	assert.NilError(t, os.WriteFile(exe, []byte(script), 0o755))
+	return exe
+}
+
+func TestCmdlineEphemeral(t *testing.T) {
+	t.Setenv("LIMA_HOME", t.TempDir())
+	fakeQEMUImg(t, 100*1024*1024*1024)
+	exe := fakeQEMUSystem(t)
+	instDir := t.TempDir()
+	diffDisk := filepath.Join(instDir, filenames.DiffDisk)
+	for _, ephemeral := range []bool{false, true} {
+		y, err := limayaml.Load([]byte(fmt.Sprintf(`
+images: [{location: /image.img}]
+arch: x86_64
+cpuType: {x86_64: qemu64}
+firmware: {legacyBIOS: true}
+video: {display: none}
+qemu: {binary: %q}
+diskOptions: {ephemeral: %v}
+`, exe, ephemeral)), filepath.Join(instDir, filenames.LimaYAML))
+		assert.NilError(t, err)
+		_, args, err := Cmdline(context.Background(), Config{Name: "ephemeral", InstanceDir: instDir, LimaYAML: y})
+		assert.NilError(t, err)
+		var drive string
+		for i, arg := range args {
+			if arg == "-drive" && strings.Contains(args[i+1], "file="+diffDisk+",") {
+				drive = args[i+1]
+			}
+		}
+		assert.Assert(t, drive != "", "no -drive for %q in %v", diffDisk, args)
+		assert.Equal(t, ephemeral, strings.HasSuffix(drive, ",snapshot=on"), drive)
+		// `-snapshot` would make the additional disks ephemeral too
+		assert.Assert(t, !slices.Contains(args, "-snapshot"))
+	}
+}
@@ -0,0 +1,82 @@
+package qemu
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/digitalocean/go-qemu/qmp/raw"
+
+	"github.com/lima-vm/lima/pkg/qemu/qmpconn"
+)
+
+// qmpConnectTimeout is the default timeout of connecting to the QMP socket, including the handshake.
+const qmpConnectTimeout = 5 * time.Second
+
+// qmpMonitor serializes the QMP commands sent by the process.
+//
+// A connection is opened for each use, and closed right after it, as QEMU serves one QMP client at a time:
+// holding the connection would block the other processes, such as `limactl list` and `limactl pause`.
+type qmpMonitor struct {
+	sockPath string
+
+	mu sync.Mutex
+}
+
+func newQMPMonitor(sockPath string) *qmpMonitor {
+	return &qmpMonitor{
+		sockPath: sockPath,
+	}
+}
+
+// acquire connects to the QMP socket, waiting for the socket to accept connections up to connectTimeout.
+// The caller must call release when done with the client, so that the other callers can connect.
+func (m *qmpMonitor) acquire(connectTimeout time.Duration) (client *qmpClient, release func(), _ error) {
+	m.mu.Lock()
+	if err := waitFileExists(m.sockPath, connectTimeout); err != nil {
+		m.mu.Unlock()
+		return nil, nil, err
+	}
+	conn, err := connectQMPWithRetry(m.sockPath, connectTimeout)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, nil, err
+	}
+	release = func() {
+		_ = conn.Close()
+		m.mu.Unlock()
+	}
+	return &qmpClient{Conn: conn}, release, nil
+}
+
+// do runs f with the connected monitor, waiting for the socket to accept connections up to connectTimeout.
+func (m *qmpMonitor) do(connectTimeout time.Duration, f func(*raw.Monitor) error) error {
+	client, release, err := m.acquire(connectTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return f(raw.NewMonitor(client))
+}
+
+// qmpClient adapts [qmpconn.Conn] to [qmp.Monitor], for [raw.NewMonitor].
+type qmpClient struct {
+	*qmpconn.Conn
+}
+
+var _ qmp.Monitor = (*qmpClient)(nil)
+
+// Connect does nothing, as the handshake is done by [qmpconn.Dial].
+func (c *qmpClient) Connect() error {
+	return nil
+}
+
+func (c *qmpClient) Disconnect() error {
+	return c.Close()
+}
+
+func (c *qmpClient) Events(context.Context) (<-chan qmp.Event, error) {
+	return nil, errors.New("QMP events are not supported")
+}
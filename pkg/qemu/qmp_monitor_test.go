@@ -0,0 +1,41 @@
+package qemu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp/raw"
+	"gotest.tools/v3/assert"
+
+	"github.com/lima-vm/lima/pkg/qemu/qmpconn"
+	"github.com/lima-vm/lima/pkg/qemu/qmpconn/qmpconntest"
+)
+
+func queryStatusHandler(cmd qmpconntest.Command) (any, error) {
+	return map[string]any{"running": true, "singlestep": false, "status": "running"}, nil
+}
+
+func TestQMPMonitorDisconnects(t *testing.T) {
+	srv := qmpconntest.NewServer(t, queryStatusHandler)
+	m := newQMPMonitor(srv.SockPath)
+	queryStatus := func(rawClient *raw.Monitor) error {
+		_, err := rawClient.QueryStatus()
+		return err
+	}
+	assert.NilError(t, m.do(time.Second, queryStatus))
+	assert.NilError(t, m.do(time.Second, queryStatus))
+
+	// another process can connect, as the connection is not held after do()
+	conn, err := qmpconn.Dial(srv.SockPath, time.Second)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"query-status", "query-status"}, srv.Executed())
+
+	// while another process is connected, connecting times out instead of hanging
+	begin := time.Now()
+	err = m.do(500*time.Millisecond, queryStatus)
+	assert.ErrorContains(t, err, "timeout connecting")
+	assert.Assert(t, time.Since(begin) < 5*time.Second)
+
+	assert.NilError(t, conn.Close())
+	assert.NilError(t, m.do(time.Second, queryStatus))
+}
@@ -0,0 +1,132 @@
+// Package qmpconn implements a minimal client of the QEMU Machine Protocol (QMP).
+//
+// Unlike qmp.SocketMonitor of go-qemu, the handshake is bounded by a deadline.
+// QEMU serves one QMP client at a time, and does not send the greeting to the other clients
+// until the current client disconnects, so connecting without a deadline may hang forever.
+package qmpconn
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Conn is a QMP connection.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex
+}
+
+// Dial connects to the QMP socket and negotiates the capabilities, within timeout.
+func Dial(sockPath string, timeout time.Duration) (*Conn, error) {
+	deadline := time.Now().Add(timeout)
+	conn, err := net.DialTimeout("unix", sockPath, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+	if err := c.handshake(deadline); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to connect to the QMP socket %q: %w", sockPath, err)
+	}
+	return c, nil
+}
+
+func (c *Conn) handshake(deadline time.Time) error {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	line, err := c.r.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read the greeting: %w", err)
+	}
+	var greeting struct {
+		QMP json.RawMessage `json:"QMP"`
+	}
+	if err := json.Unmarshal(line, &greeting); err != nil {
+		return fmt.Errorf("failed to parse the greeting %q: %w", string(line), err)
+	}
+	if greeting.QMP == nil {
+		return fmt.Errorf("unexpected greeting %q", string(line))
+	}
+	if _, err := c.Run([]byte(`{"execute": "qmp_capabilities"}`)); err != nil {
+		return err
+	}
+	return c.conn.SetDeadline(time.Time{})
+}
+
+// SetDeadline sets the deadline of the subsequent commands. A zero value disables the deadline.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Run executes the QMP command, and returns the raw JSON response.
+// An error is returned if QEMU returns an error.
+func (c *Conn) Run(command []byte) ([]byte, error) {
+	return c.RunWithFile(command, nil)
+}
+
+// RunWithFile behaves like Run, but also passes the file descriptor of f, e.g., for the "getfd" command.
+func (c *Conn) RunWithFile(command []byte, f *os.File) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f == nil {
+		if _, err := c.conn.Write(command); err != nil {
+			return nil, err
+		}
+	} else {
+		unixConn, ok := c.conn.(*net.UnixConn)
+		if !ok {
+			return nil, errors.New("passing a file requires a UNIX socket")
+		}
+		rights, err := unixRights(f)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, err := unixConn.WriteMsgUnix(command, rights, nil); err != nil {
+			return nil, err
+		}
+	}
+	return c.readResponse()
+}
+
+// readResponse reads the response of the command, skipping the asynchronous events.
+func (c *Conn) readResponse() ([]byte, error) {
+	for {
+		line, err := c.r.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		var msg struct {
+			Event string `json:"event"`
+			Error *struct {
+				Class string `json:"class"`
+				Desc  string `json:"desc"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return nil, fmt.Errorf("failed to parse the response %q: %w", string(line), err)
+		}
+		if msg.Event != "" {
+			continue
+		}
+		if msg.Error != nil {
+			return nil, errors.New(msg.Error.Desc)
+		}
+		return line, nil
+	}
+}
@@ -0,0 +1,72 @@
+package qmpconn
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lima-vm/lima/pkg/qemu/qmpconn/qmpconntest"
+)
+
+func TestRun(t *testing.T) {
+	srv := qmpconntest.NewServer(t, func(cmd qmpconntest.Command) (any, error) {
+		if cmd.Execute == "stop" {
+			return nil, errors.New("cannot stop")
+		}
+		return map[string]any{"status": "running"}, nil
+	})
+	c, err := Dial(srv.SockPath, 5*time.Second)
+	assert.NilError(t, err)
+	defer c.Close()
+
+	resp, err := c.Run([]byte(`{"execute": "query-status"}`))
+	assert.NilError(t, err)
+	assert.Equal(t, `{"return":{"status":"running"}}`+"\n", string(resp))
+
+	_, err = c.Run([]byte(`{"execute": "stop"}`))
+	assert.Error(t, err, "cannot stop")
+	assert.DeepEqual(t, []string{"query-status", "stop"}, srv.Executed())
+}
+
+func TestRunSkipsEvents(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "qmp.sock")
+	l, err := net.Listen("unix", sockPath)
+	assert.NilError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 1024)
+		_, _ = conn.Write([]byte(`{"QMP": {"version": {}, "capabilities": []}}` + "\n"))
+		_, _ = conn.Read(buf)
+		_, _ = conn.Write([]byte(`{"return": {}}` + "\n"))
+		_, _ = conn.Read(buf)
+		_, _ = conn.Write([]byte(`{"event": "RESUME", "timestamp": {}}` + "\n" + `{"return": {"status": "running"}}` + "\n"))
+	}()
+	c, err := Dial(sockPath, 5*time.Second)
+	assert.NilError(t, err)
+	defer c.Close()
+	resp, err := c.Run([]byte(`{"execute": "query-status"}`))
+	assert.NilError(t, err)
+	assert.Equal(t, `{"return": {"status": "running"}}`+"\n", string(resp))
+}
+
+func TestDialTimeout(t *testing.T) {
+	// like QEMU serving another client, the server accepts the connection but does not send the greeting
+	sockPath := filepath.Join(t.TempDir(), "qmp.sock")
+	l, err := net.Listen("unix", sockPath)
+	assert.NilError(t, err)
+	defer l.Close()
+
+	begin := time.Now()
+	_, err = Dial(sockPath, 200*time.Millisecond)
+	assert.ErrorContains(t, err, "failed to read the greeting")
+	assert.Assert(t, time.Since(begin) < 5*time.Second)
+}
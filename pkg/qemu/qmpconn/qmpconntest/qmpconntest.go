@@ -0,0 +1,111 @@
+// Package qmpconntest provides a fake QMP server for testing.
+package qmpconntest
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Command is a QMP command received by [Server].
+type Command struct {
+	Execute   string          `json:"execute"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// Handler returns the "return" value of the command, or an error to be returned as the QMP error.
+type Handler func(cmd Command) (any, error)
+
+// Server is a fake QMP server listening on a UNIX socket.
+// Like QEMU, it serves one client at a time.
+type Server struct {
+	SockPath string
+
+	mu       sync.Mutex
+	commands []Command
+}
+
+// NewServer starts a fake QMP server that is closed on the cleanup of t.
+// The "qmp_capabilities" command is handled by the server, and the other commands are passed to handler.
+func NewServer(t testing.TB, handler Handler) *Server {
+	t.Helper()
+	s := &Server{
+		SockPath: filepath.Join(t.TempDir(), "qmp.sock"),
+	}
+	l, err := net.Listen("unix", s.SockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn, handler)
+		}
+	}()
+	return s
+}
+
+// Commands returns the commands received so far, excluding "qmp_capabilities".
+func (s *Server) Commands() []Command {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Command(nil), s.commands...)
+}
+
+// Executed returns the names of the commands received so far, excluding "qmp_capabilities".
+func (s *Server) Executed() []string {
+	var res []string
+	for _, cmd := range s.Commands() {
+		res = append(res, cmd.Execute)
+	}
+	return res
+}
+
+func (s *Server) serve(conn net.Conn, handler Handler) {
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+	if err := enc.Encode(map[string]any{
+		"QMP": map[string]any{
+			"version":      map[string]any{"qemu": map[string]int{"major": 9, "minor": 0, "micro": 0}},
+			"capabilities": []string{"oob"},
+		},
+	}); err != nil {
+		return
+	}
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	for {
+		var cmd Command
+		if err := dec.Decode(&cmd); err != nil {
+			return
+		}
+		var (
+			ret any = struct{}{}
+			err error
+		)
+		if cmd.Execute != "qmp_capabilities" {
+			s.mu.Lock()
+			s.commands = append(s.commands, cmd)
+			s.mu.Unlock()
+			ret, err = handler(cmd)
+		}
+		var resp map[string]any
+		if err != nil {
+			resp = map[string]any{"error": map[string]string{"class": "GenericError", "desc": err.Error()}}
+		} else {
+			if ret == nil {
+				ret = struct{}{}
+			}
+			resp = map[string]any{"return": ret}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
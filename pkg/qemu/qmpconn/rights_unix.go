@@ -0,0 +1,12 @@
+//go:build !windows
+
+package qmpconn
+
+import (
+	"os"
+	"syscall"
+)
+
+func unixRights(f *os.File) ([]byte, error) {
+	return syscall.UnixRights(int(f.Fd())), nil
+}
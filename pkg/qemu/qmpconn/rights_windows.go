@@ -0,0 +1,10 @@
+package qmpconn
+
+import (
+	"errors"
+	"os"
+)
+
+func unixRights(_ *os.File) ([]byte, error) {
+	return nil, errors.New("passing a file is not supported on Windows")
+}
@@ -0,0 +1,26 @@
+package resize
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/driverutil"
+	"github.com/lima-vm/lima/pkg/store"
+)
+
+// Memory changes the memory size of the running instance using the memory balloon.
+func Memory(ctx context.Context, inst *store.Instance, size int64) error {
+	if inst.Status != store.StatusRunning {
+		return fmt.Errorf("expected status %q, got %q", store.StatusRunning, inst.Status)
+	}
+	y, err := inst.LoadYAML()
+	if err != nil {
+		return err
+	}
+	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
+		Instance: inst,
+		Yaml:     y,
+	})
+	return limaDriver.SetMemoryTarget(ctx, size)
+}
@@ -0,0 +1,32 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"image"
+
+	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/driverutil"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+)
+
+// Take returns the current framebuffer of the running instance.
+// The framebuffer is available even when no display such as VNC is configured.
+func Take(ctx context.Context, inst *store.Instance) (image.Image, error) {
+	if inst.VMType != limayaml.QEMU {
+		return nil, fmt.Errorf("screenshot is not supported by vmType %q", inst.VMType)
+	}
+	if inst.Status != store.StatusRunning && inst.Status != store.StatusPaused {
+		return nil, fmt.Errorf("expected status %q, got %q", store.StatusRunning, inst.Status)
+	}
+	y, err := inst.LoadYAML()
+	if err != nil {
+		return nil, err
+	}
+	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
+		Instance: inst,
+		Yaml:     y,
+	})
+	return limaDriver.Screenshot(ctx)
+}
@@ -2,10 +2,18 @@ package snapshot
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
 
 	"github.com/lima-vm/lima/pkg/driver"
 	"github.com/lima-vm/lima/pkg/driverutil"
 	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
 )
 
 func Del(ctx context.Context, inst *store.Instance, tag string) error {
@@ -44,10 +52,26 @@ func Load(ctx context.Context, inst *store.Instance, tag string) error {
 	return limaDriver.ApplySnapshot(ctx, tag)
 }
 
-func List(ctx context.Context, inst *store.Instance) (string, error) {
+// LoadStopped applies the snapshot to the stopped instance, after checking that the snapshot exists.
+func LoadStopped(ctx context.Context, inst *store.Instance, tag string) error {
+	if inst.Status != store.StatusStopped {
+		return fmt.Errorf("expected status %q, got %q", store.StatusStopped, inst.Status)
+	}
+	list, err := List(ctx, inst)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(list.Snapshots, func(s driver.Snapshot) bool { return s.Tag == tag }) {
+		return fmt.Errorf("snapshot %q does not exist in instance %q", tag, inst.Name)
+	}
+	logrus.Infof("Applying the snapshot %q", tag)
+	return Load(ctx, inst, tag)
+}
+
+func List(ctx context.Context, inst *store.Instance) (*driver.SnapshotList, error) {
 	y, err := inst.LoadYAML()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
 		Instance: inst,
@@ -55,3 +79,48 @@ func List(ctx context.Context, inst *store.Instance) (string, error) {
 	})
 	return limaDriver.ListSnapshots(ctx)
 }
+
+// Export writes the disk of the snapshot to a standalone image file.
+// Export refuses to run against a running instance, unless force is true.
+func Export(ctx context.Context, inst *store.Instance, tag, path string, force bool) error {
+	if inst.Status != store.StatusStopped && !force {
+		return fmt.Errorf("expected status %q, got %q (Hint: use --force to export the snapshot of a running instance)", store.StatusStopped, inst.Status)
+	}
+	y, err := inst.LoadYAML()
+	if err != nil {
+		return err
+	}
+	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
+		Instance: inst,
+		Yaml:     y,
+	})
+	return limaDriver.ExportSnapshot(ctx, tag, path)
+}
+
+// Import creates a snapshot from a file created by Export.
+func Import(ctx context.Context, inst *store.Instance, tag, path string) error {
+	if inst.Status != store.StatusStopped {
+		return fmt.Errorf("expected status %q, got %q", store.StatusStopped, inst.Status)
+	}
+	y, err := inst.LoadYAML()
+	if err != nil {
+		return err
+	}
+	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
+		Instance: inst,
+		Yaml:     y,
+	})
+	return limaDriver.ImportSnapshot(ctx, tag, path)
+}
+
+// Format returns a human-readable table of the snapshots.
+func Format(snapshots []driver.Snapshot) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 4, 8, 4, ' ', 0)
+	fmt.Fprintln(w, "TAG\tVM SIZE\tDATE\tVM CLOCK")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Tag, units.BytesSize(float64(s.VMStateSize)), s.CreatedAt.Format(time.DateTime), s.VMClock)
+	}
+	_ = w.Flush()
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package sshutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+)
+
+// The Include directive in ~/.ssh/config is guarded by these markers, so that it can be updated and removed.
+const (
+	includeBeginMarker = "# BEGIN LIMA (managed by `limactl ssh-config install`)"
+	includeEndMarker   = "# END LIMA"
+)
+
+// UserSSHConfigPath returns the path of ~/.ssh/config.
+func UserSSHConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".ssh", "config"), nil
+}
+
+// IncludePattern returns the pattern that matches the ssh.config files of all the instances,
+// e.g., "~/.lima/*/ssh.config". The path is quoted when it contains spaces.
+func IncludePattern() (string, error) {
+	limaDir, err := dirnames.LimaDir()
+	if err != nil {
+		return "", err
+	}
+	pattern := filepath.Join(limaDir, "*", filenames.SSHConfig)
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		if rel, err := filepath.Rel(homeDir, pattern); err == nil && !strings.HasPrefix(rel, "..") {
+			pattern = "~/" + filepath.ToSlash(rel)
+		}
+	}
+	if strings.ContainsAny(pattern, " \t") {
+		pattern = `"` + pattern + `"`
+	}
+	return pattern, nil
+}
+
+// InstallInclude adds "Include includePattern" to the beginning of the ssh config file configPath,
+// guarded by the marker comments. A stale directive added by Lima is replaced.
+// The file is created if it does not exist.
+// It returns false if the file already contains the same directive.
+func InstallInclude(configPath, includePattern string) (bool, error) {
+	b, err := os.ReadFile(configPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	newB := addIncludeBlock(b, includePattern)
+	if bytes.Equal(b, newB) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0o700); err != nil {
+		return false, err
+	}
+	return true, writeSSHConfig(configPath, newB)
+}
+
+// UninstallInclude removes the directive added by InstallInclude from the ssh config file configPath.
+// It returns false if the file does not contain the directive.
+func UninstallInclude(configPath string) (bool, error) {
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	newB, found := removeIncludeBlock(b)
+	if !found {
+		return false, nil
+	}
+	return true, writeSSHConfig(configPath, newB)
+}
+
+// writeSSHConfig replaces the content of configPath, preserving the permission of the existing file.
+// A symlink, as created by dotfile managers, is preserved by replacing its target.
+func writeSSHConfig(configPath string, b []byte) error {
+	resolved, err := filepath.EvalSymlinks(configPath)
+	switch {
+	case err == nil:
+		configPath = resolved
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	perm := os.FileMode(0o600)
+	if st, err := os.Stat(configPath); err == nil {
+		perm = st.Mode().Perm()
+	}
+	tmp := configPath + ".lima.tmp"
+	if err := os.WriteFile(tmp, b, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, configPath)
+}
+
+// addIncludeBlock returns the content with the Include directive at the beginning.
+// The directive has to precede the Host and Match blocks, otherwise it is only included for the block.
+func addIncludeBlock(content []byte, includePattern string) []byte {
+	content, _ = removeIncludeBlock(content)
+	block := fmt.Sprintf("%s\nInclude %s\n%s\n", includeBeginMarker, includePattern, includeEndMarker)
+	if len(content) > 0 {
+		block += "\n"
+	}
+	return append([]byte(block), content...)
+}
+
+// removeIncludeBlock returns the content without the block guarded by the markers, and whether the block was found.
+func removeIncludeBlock(content []byte) ([]byte, bool) {
+	lines := strings.SplitAfter(string(content), "\n")
+	var (
+		res     strings.Builder
+		found   bool
+		inBlock bool
+		skipGap bool
+	)
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !inBlock && trimmed == includeBeginMarker:
+			inBlock, found = true, true
+		case inBlock:
+			if trimmed == includeEndMarker {
+				inBlock = false
+				// remove the empty line inserted by addIncludeBlock
+				skipGap = true
+			}
+		case skipGap && trimmed == "":
+			skipGap = false
+		default:
+			skipGap = false
+			res.WriteString(line)
+		}
+	}
+	return []byte(res.String()), found
+}
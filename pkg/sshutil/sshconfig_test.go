@@ -0,0 +1,83 @@
+package sshutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestInstallInclude(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), ".ssh", "config")
+	const userConfig = "Host example\n  User foo\n"
+
+	// creates the file
+	changed, err := InstallInclude(configPath, "~/.lima/*/ssh.config")
+	assert.NilError(t, err)
+	assert.Check(t, changed)
+	b, err := os.ReadFile(configPath)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), includeBeginMarker+"\nInclude ~/.lima/*/ssh.config\n"+includeEndMarker+"\n")
+
+	// prepends the block to the existing content, idempotently
+	assert.NilError(t, os.WriteFile(configPath, []byte(userConfig), 0o600))
+	for i := 0; i < 2; i++ {
+		changed, err = InstallInclude(configPath, "~/.lima/*/ssh.config")
+		assert.NilError(t, err)
+		assert.Equal(t, changed, i == 0)
+	}
+	b, err = os.ReadFile(configPath)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), includeBeginMarker+"\nInclude ~/.lima/*/ssh.config\n"+includeEndMarker+"\n\n"+userConfig)
+
+	// replaces the stale pattern
+	changed, err = InstallInclude(configPath, `"/opt/lima home/*/ssh.config"`)
+	assert.NilError(t, err)
+	assert.Check(t, changed)
+	b, err = os.ReadFile(configPath)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), includeBeginMarker+"\nInclude \"/opt/lima home/*/ssh.config\"\n"+includeEndMarker+"\n\n"+userConfig)
+
+	// restores the original content
+	changed, err = UninstallInclude(configPath)
+	assert.NilError(t, err)
+	assert.Check(t, changed)
+	b, err = os.ReadFile(configPath)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), userConfig)
+
+	changed, err = UninstallInclude(configPath)
+	assert.NilError(t, err)
+	assert.Check(t, !changed)
+}
+
+func TestInstallIncludeSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+	// ~/.ssh/config is a symlink into the dotfiles repository
+	dotfiles := filepath.Join(t.TempDir(), "dotfiles")
+	assert.NilError(t, os.MkdirAll(dotfiles, 0o700))
+	target := filepath.Join(dotfiles, "ssh_config")
+	const userConfig = "Host example\n  User foo\n"
+	assert.NilError(t, os.WriteFile(target, []byte(userConfig), 0o644))
+	sshDir := filepath.Join(t.TempDir(), ".ssh")
+	assert.NilError(t, os.MkdirAll(sshDir, 0o700))
+	configPath := filepath.Join(sshDir, "config")
+	assert.NilError(t, os.Symlink(target, configPath))
+
+	changed, err := InstallInclude(configPath, "~/.lima/*/ssh.config")
+	assert.NilError(t, err)
+	assert.Check(t, changed)
+	st, err := os.Lstat(configPath)
+	assert.NilError(t, err)
+	assert.Check(t, st.Mode()&os.ModeSymlink != 0, "the symlink should be preserved")
+	b, err := os.ReadFile(target)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), includeBeginMarker+"\nInclude ~/.lima/*/ssh.config\n"+includeEndMarker+"\n\n"+userConfig)
+	st, err = os.Stat(target)
+	assert.NilError(t, err)
+	assert.Equal(t, st.Mode().Perm(), os.FileMode(0o644))
+}
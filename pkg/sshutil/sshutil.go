@@ -43,6 +43,31 @@ func readPublicKey(f string) (PubKey, error) {
 	return entry, err
 }
 
+// generateKey creates an ed25519 keypair at privateKeyPath, unless it already exists.
+func generateKey(privateKeyPath string) error {
+	_, err := os.Stat(privateKeyPath)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	dir := filepath.Dir(privateKeyPath)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("could not create %q directory: %w", dir, err)
+	}
+	return lockutil.WithDirLock(dir, func() error {
+		// no passphrase, no user@host comment
+		keygenCmd := exec.Command("ssh-keygen", "-t", "ed25519", "-q", "-N", "",
+			"-C", "lima", "-f", privateKeyPath)
+		logrus.Debugf("executing %v", keygenCmd.Args)
+		if out, err := keygenCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to run %v: %q: %w", keygenCmd.Args, string(out), err)
+		}
+		return nil
+	})
+}
+
 // DefaultPubKeys returns the public key from $LIMA_HOME/_config/user.pub.
 // The key will be created if it does not yet exist.
 //
@@ -54,28 +79,28 @@ func DefaultPubKeys(loadDotSSH bool) ([]PubKey, error) {
 	if err != nil {
 		return nil, err
 	}
-	_, err = os.Stat(filepath.Join(configDir, filenames.UserPrivateKey))
-	if err != nil {
-		if !errors.Is(err, os.ErrNotExist) {
-			return nil, err
-		}
-		if err := os.MkdirAll(configDir, 0o700); err != nil {
-			return nil, fmt.Errorf("could not create %q directory: %w", configDir, err)
-		}
-		if err := lockutil.WithDirLock(configDir, func() error {
-			// no passphrase, no user@host comment
-			keygenCmd := exec.Command("ssh-keygen", "-t", "ed25519", "-q", "-N", "",
-				"-C", "lima", "-f", filepath.Join(configDir, filenames.UserPrivateKey))
-			logrus.Debugf("executing %v", keygenCmd.Args)
-			if out, err := keygenCmd.CombinedOutput(); err != nil {
-				return fmt.Errorf("failed to run %v: %q: %w", keygenCmd.Args, string(out), err)
-			}
-			return nil
-		}); err != nil {
-			return nil, err
-		}
+	return pubKeys(filepath.Join(configDir, filenames.UserPrivateKey), loadDotSSH)
+}
+
+// GenerateInstanceKey creates the keypair dedicated to the instance, unless it already exists.
+func GenerateInstanceKey(instDir string) error {
+	return generateKey(filepath.Join(instDir, filenames.SSHPrivateKey))
+}
+
+// InstancePubKeys returns the public key dedicated to the instance, from $LIMA_HOME/<INSTANCE>/ssh_key.pub.
+// The key will be created if it does not yet exist.
+// $LIMA_HOME/_config/user.pub is not included.
+//
+// When loadDotSSH is true, ~/.ssh/*.pub will be appended as in DefaultPubKeys.
+func InstancePubKeys(instDir string, loadDotSSH bool) ([]PubKey, error) {
+	return pubKeys(filepath.Join(instDir, filenames.SSHPrivateKey), loadDotSSH)
+}
+
+func pubKeys(privateKeyPath string, loadDotSSH bool) ([]PubKey, error) {
+	if err := generateKey(privateKeyPath); err != nil {
+		return nil, err
 	}
-	entry, err := readPublicKey(filepath.Join(configDir, filenames.UserPublicKey))
+	entry, err := readPublicKey(privateKeyPath + ".pub")
 	if err != nil {
 		return nil, err
 	}
@@ -90,28 +115,81 @@ func DefaultPubKeys(loadDotSSH bool) ([]PubKey, error) {
 	if err != nil {
 		return nil, err
 	}
-	files, err := filepath.Glob(filepath.Join(homeDir, ".ssh/*.pub"))
+	dotSSHKeys, err := loadDotSSHPubKeys(filepath.Join(homeDir, ".ssh"))
+	if err != nil {
+		return nil, err
+	}
+	return append(res, dotSSHKeys...), nil
+}
+
+// loadDotSSHPubKeys returns the public keys in dir (usually ~/.ssh) that can be written to authorized_keys.
+// Invalid keys and certificates are skipped with a single warning.
+func loadDotSSHPubKeys(dir string) ([]PubKey, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pub"))
 	if err != nil {
 		panic(err) // Only possible error is ErrBadPattern, so this should be unreachable.
 	}
+	var (
+		res     []PubKey
+		skipped []string
+	)
 	for _, f := range files {
 		if !strings.HasSuffix(f, ".pub") {
 			panic(fmt.Errorf("unexpected ssh public key filename %q", f))
 		}
 		entry, err := readPublicKey(f)
-		if err == nil {
-			if !detectValidPublicKey(entry.Content) {
-				logrus.Warnf("public key %q doesn't seem to be in ssh format", entry.Filename)
-			} else {
-				res = append(res, entry)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
 			}
-		} else if !errors.Is(err, os.ErrNotExist) {
 			return nil, err
 		}
+		switch {
+		case !detectValidPublicKey(entry.Content):
+			skipped = append(skipped, fmt.Sprintf("%s (not in ssh format)", filepath.Base(f)))
+		case isCertificateKeyType(pubKeyType(entry.Content)):
+			// A certificate is not a valid entry of authorized_keys, and sshd may reject the entire file
+			skipped = append(skipped, fmt.Sprintf("%s (certificate)", filepath.Base(f)))
+		default:
+			res = append(res, entry)
+		}
+	}
+	if len(skipped) > 0 {
+		logrus.Warnf("Skipped public keys in %q: %s", dir, strings.Join(skipped, ", "))
 	}
 	return res, nil
 }
 
+// pubKeyType returns the key type of the public key, e.g., "ssh-ed25519".
+func pubKeyType(content string) string {
+	typ, _, _ := strings.Cut(content, " ")
+	return typ
+}
+
+// isSecurityKeyType returns true for the key types of FIDO2 security keys, e.g., "sk-ssh-ed25519@openssh.com".
+// The private keys of these types need a user interaction (touching the device) for every authentication.
+func isSecurityKeyType(typ string) bool {
+	return strings.HasPrefix(typ, "sk-")
+}
+
+// isCertificateKeyType returns true for the key types of certificates, e.g., "ssh-ed25519-cert-v01@openssh.com".
+func isCertificateKeyType(typ string) bool {
+	return strings.Contains(typ, "-cert-v0")
+}
+
+// PrivateKeyPath returns the path of the private key used for connecting to the instance.
+// When dedicatedKey is true, the key is $LIMA_HOME/<INSTANCE>/ssh_key, otherwise $LIMA_HOME/_config/user .
+func PrivateKeyPath(instDir string, dedicatedKey bool) (string, error) {
+	if dedicatedKey {
+		return filepath.Join(instDir, filenames.SSHPrivateKey), nil
+	}
+	configDir, err := dirnames.LimaConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, filenames.UserPrivateKey), nil
+}
+
 var sshInfo struct {
 	sync.Once
 	// aesAccelerated is set to true when AES acceleration is available.
@@ -124,24 +202,23 @@ var sshInfo struct {
 // CommonOpts returns ssh option key-value pairs like {"IdentityFile=/path/to/id_foo"}.
 // The result may contain different values with the same key.
 //
-// The result always contains the IdentityFile option.
+// The result always contains the IdentityFile option for each of privateKeyPaths.
 // The result never contains the Port option.
-func CommonOpts(useDotSSH bool) ([]string, error) {
-	configDir, err := dirnames.LimaConfigDir()
-	if err != nil {
-		return nil, err
-	}
-	privateKeyPath := filepath.Join(configDir, filenames.UserPrivateKey)
-	_, err = os.Stat(privateKeyPath)
-	if err != nil {
-		return nil, err
+func CommonOpts(privateKeyPaths []string, useDotSSH bool) ([]string, error) {
+	if len(privateKeyPaths) == 0 {
+		return nil, errors.New("no private key was specified")
 	}
 	var opts []string
-	if runtime.GOOS == "windows" {
-		privateKeyPath = ioutilx.CanonicalWindowsPath(privateKeyPath)
-		opts = []string{fmt.Sprintf(`IdentityFile='%s'`, privateKeyPath)}
-	} else {
-		opts = []string{fmt.Sprintf(`IdentityFile="%s"`, privateKeyPath)}
+	for _, privateKeyPath := range privateKeyPaths {
+		if _, err := os.Stat(privateKeyPath); err != nil {
+			return nil, err
+		}
+		if runtime.GOOS == "windows" {
+			privateKeyPath = ioutilx.CanonicalWindowsPath(privateKeyPath)
+			opts = append(opts, fmt.Sprintf(`IdentityFile='%s'`, privateKeyPath))
+		} else {
+			opts = append(opts, fmt.Sprintf(`IdentityFile="%s"`, privateKeyPath))
+		}
 	}
 
 	// Append all private keys corresponding to ~/.ssh/*.pub to keep old instances working
@@ -151,28 +228,11 @@ func CommonOpts(useDotSSH bool) ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		files, err := filepath.Glob(filepath.Join(homeDir, ".ssh/*.pub"))
+		dotSSHPrivateKeyPaths, err := dotSSHPrivateKeyPaths(filepath.Join(homeDir, ".ssh"))
 		if err != nil {
-			panic(err) // Only possible error is ErrBadPattern, so this should be unreachable.
+			return nil, err
 		}
-		for _, f := range files {
-			if !strings.HasSuffix(f, ".pub") {
-				panic(fmt.Errorf("unexpected ssh public key filename %q", f))
-			}
-			privateKeyPath := strings.TrimSuffix(f, ".pub")
-			_, err = os.Stat(privateKeyPath)
-			if errors.Is(err, fs.ErrNotExist) {
-				// Skip .pub files without a matching private key. This is reasonably common,
-				// due to major projects like Vault recommending the ${name}-cert.pub format
-				// for SSH certificate files.
-				//
-				// e.g. https://www.vaultproject.io/docs/secrets/ssh/signed-ssh-certificates
-				continue
-			}
-			if err != nil {
-				// Fail on permission-related and other path errors
-				return nil, err
-			}
+		for _, privateKeyPath := range dotSSHPrivateKeyPaths {
 			if runtime.GOOS == "windows" {
 				opts = append(opts, fmt.Sprintf(`IdentityFile='%s'`, privateKeyPath))
 			} else {
@@ -222,8 +282,60 @@ func CommonOpts(useDotSSH bool) ([]string, error) {
 	return opts, nil
 }
 
-// SSHOpts adds the following options to CommonOptions: User, ControlMaster, ControlPath, ControlPersist.
-func SSHOpts(instDir string, useDotSSH, forwardAgent, forwardX11, forwardX11Trusted bool) ([]string, error) {
+// dotSSHPrivateKeyPaths returns the private keys corresponding to dir/*.pub (usually ~/.ssh/*.pub)
+// that can be used non-interactively.
+func dotSSHPrivateKeyPaths(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pub"))
+	if err != nil {
+		panic(err) // Only possible error is ErrBadPattern, so this should be unreachable.
+	}
+	var res []string
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".pub") {
+			panic(fmt.Errorf("unexpected ssh public key filename %q", f))
+		}
+		privateKeyPath := strings.TrimSuffix(f, ".pub")
+		_, err = os.Stat(privateKeyPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Skip .pub files without a matching private key. This is reasonably common,
+			// due to major projects like Vault recommending the ${name}-cert.pub format
+			// for SSH certificate files.
+			//
+			// e.g. https://www.vaultproject.io/docs/secrets/ssh/signed-ssh-certificates
+			continue
+		}
+		if err != nil {
+			// Fail on permission-related and other path errors
+			return nil, err
+		}
+		// Skip security keys, as the ssh client of the host agent cannot touch the device,
+		// and skip certificates, which are not identities by themselves.
+		if entry, err := readPublicKey(f); err == nil {
+			if typ := pubKeyType(entry.Content); isSecurityKeyType(typ) || isCertificateKeyType(typ) {
+				logrus.Debugf("Skipping %q (key type %q) for the identity", privateKeyPath, typ)
+				continue
+			}
+		}
+		res = append(res, privateKeyPath)
+	}
+	return res, nil
+}
+
+// ConnectionOpts configures the multiplexing and the keepalive of the SSH connection.
+type ConnectionOpts struct {
+	// ControlPersist is "yes" or the idle time after which the ControlMaster exits.
+	// Empty means "yes".
+	ControlPersist string
+	// ServerAliveInterval is the interval of the keepalive messages in seconds. 0 disables the messages.
+	ServerAliveInterval int
+	// ServerAliveCountMax is the number of the keepalive messages without any response before disconnecting.
+	ServerAliveCountMax int
+}
+
+// SSHOpts adds the following options to CommonOptions: User, ControlMaster, ControlPath, ControlPersist,
+// and ServerAliveInterval and ServerAliveCountMax when the keepalive is enabled in conn.
+// The IdentityFile option is set to the key dedicated to the instance when dedicatedKey is true.
+func SSHOpts(instDir string, dedicatedKey, useDotSSH, forwardAgent, forwardX11, forwardX11Trusted bool, conn ConnectionOpts) ([]string, error) {
 	controlSock := filepath.Join(instDir, filenames.SSHSock)
 	if len(controlSock) >= osutil.UnixPathMax {
 		return nil, fmt.Errorf("socket path %q is too long: >= UNIX_PATH_MAX=%d", controlSock, osutil.UnixPathMax)
@@ -232,21 +344,19 @@ func SSHOpts(instDir string, useDotSSH, forwardAgent, forwardX11, forwardX11Trus
 	if err != nil {
 		return nil, err
 	}
-	opts, err := CommonOpts(useDotSSH)
+	privateKeyPath, err := PrivateKeyPath(instDir, dedicatedKey)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := CommonOpts([]string{privateKeyPath}, useDotSSH)
 	if err != nil {
 		return nil, err
 	}
-	controlPath := fmt.Sprintf(`ControlPath="%s"`, controlSock)
 	if runtime.GOOS == "windows" {
 		controlSock = ioutilx.CanonicalWindowsPath(controlSock)
-		controlPath = fmt.Sprintf(`ControlPath='%s'`, controlSock)
 	}
-	opts = append(opts,
-		fmt.Sprintf("User=%s", u.Username), // guest and host have the same username, but we should specify the username explicitly (#85)
-		"ControlMaster=auto",
-		controlPath,
-		"ControlPersist=yes",
-	)
+	opts = append(opts, fmt.Sprintf("User=%s", u.Username)) // guest and host have the same username, but we should specify the username explicitly (#85)
+	opts = append(opts, connectionOpts(controlSock, conn, runtime.GOOS)...)
 	if forwardAgent {
 		opts = append(opts, "ForwardAgent=yes")
 	}
@@ -259,6 +369,30 @@ func SSHOpts(instDir string, useDotSSH, forwardAgent, forwardX11, forwardX11Trus
 	return opts, nil
 }
 
+// connectionOpts returns the ControlMaster, ControlPath, ControlPersist, and keepalive options.
+func connectionOpts(controlSock string, conn ConnectionOpts, goos string) []string {
+	controlPath := fmt.Sprintf(`ControlPath="%s"`, controlSock)
+	if goos == "windows" {
+		controlPath = fmt.Sprintf(`ControlPath='%s'`, controlSock)
+	}
+	controlPersist := conn.ControlPersist
+	if controlPersist == "" {
+		controlPersist = "yes"
+	}
+	opts := []string{
+		"ControlMaster=auto",
+		controlPath,
+		"ControlPersist=" + controlPersist,
+	}
+	if conn.ServerAliveInterval > 0 {
+		opts = append(opts, fmt.Sprintf("ServerAliveInterval=%d", conn.ServerAliveInterval))
+		if conn.ServerAliveCountMax > 0 {
+			opts = append(opts, fmt.Sprintf("ServerAliveCountMax=%d", conn.ServerAliveCountMax))
+		}
+	}
+	return opts
+}
+
 // SSHArgsFromOpts returns ssh args from opts.
 // The result always contains {"-F", "/dev/null} in addition to {"-o", "KEY=VALUE", ...}.
 func SSHArgsFromOpts(opts []string) []string {
@@ -1,6 +1,7 @@
 package sshutil
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/coreos/go-semver/semver"
@@ -15,6 +16,73 @@ func TestDefaultPubKeys(t *testing.T) {
 	}
 }
 
+func TestPrivateKeyPath(t *testing.T) {
+	instDir := t.TempDir()
+	privateKeyPath, err := PrivateKeyPath(instDir, true)
+	assert.NilError(t, err)
+	assert.Equal(t, privateKeyPath, filepath.Join(instDir, "ssh_key"))
+
+	privateKeyPath, err = PrivateKeyPath(instDir, false)
+	assert.NilError(t, err)
+	assert.Equal(t, filepath.Base(privateKeyPath), "user")
+	assert.Equal(t, filepath.Base(filepath.Dir(privateKeyPath)), "_config")
+}
+
+func TestLoadDotSSHPubKeys(t *testing.T) {
+	keys, err := loadDotSSHPubKeys(filepath.Join("testdata", "dotssh"))
+	assert.NilError(t, err)
+	var names []string
+	for _, key := range keys {
+		names = append(names, filepath.Base(key.Filename))
+	}
+	// invalid.pub and id_ed25519-cert.pub are skipped
+	assert.DeepEqual(t, names, []string{"id_ed25519.pub", "id_ed25519_sk.pub"})
+}
+
+func TestDotSSHPrivateKeyPaths(t *testing.T) {
+	dir := filepath.Join("testdata", "dotssh")
+	paths, err := dotSSHPrivateKeyPaths(dir)
+	assert.NilError(t, err)
+	// id_ed25519_sk is skipped as a security key, and id_ed25519-cert does not exist
+	assert.DeepEqual(t, paths, []string{filepath.Join(dir, "id_ed25519")})
+}
+
+func TestKeyTypes(t *testing.T) {
+	assert.Check(t, isSecurityKeyType("sk-ssh-ed25519@openssh.com"))
+	assert.Check(t, isSecurityKeyType("sk-ecdsa-sha2-nistp256@openssh.com"))
+	assert.Check(t, !isSecurityKeyType("ssh-ed25519"))
+	assert.Check(t, isCertificateKeyType("ssh-ed25519-cert-v01@openssh.com"))
+	assert.Check(t, isCertificateKeyType("sk-ssh-ed25519-cert-v01@openssh.com"))
+	assert.Check(t, !isCertificateKeyType("ssh-rsa"))
+}
+
+func TestConnectionOpts(t *testing.T) {
+	// the defaults match the options used before ssh.controlPersist and ssh.serverAlive* were introduced
+	assert.DeepEqual(t, connectionOpts("/lima/default/ssh.sock", ConnectionOpts{}, "linux"), []string{
+		"ControlMaster=auto",
+		`ControlPath="/lima/default/ssh.sock"`,
+		"ControlPersist=yes",
+	})
+	assert.DeepEqual(t, connectionOpts("/lima/default/ssh.sock", ConnectionOpts{ControlPersist: "yes", ServerAliveCountMax: 3}, "linux"), []string{
+		"ControlMaster=auto",
+		`ControlPath="/lima/default/ssh.sock"`,
+		"ControlPersist=yes",
+	})
+	assert.DeepEqual(t, connectionOpts("/lima/default/ssh.sock", ConnectionOpts{ControlPersist: "10m", ServerAliveInterval: 15, ServerAliveCountMax: 4}, "linux"), []string{
+		"ControlMaster=auto",
+		`ControlPath="/lima/default/ssh.sock"`,
+		"ControlPersist=10m",
+		"ServerAliveInterval=15",
+		"ServerAliveCountMax=4",
+	})
+	assert.DeepEqual(t, connectionOpts(`C:\lima\default\ssh.sock`, ConnectionOpts{ServerAliveInterval: 30}, "windows"), []string{
+		"ControlMaster=auto",
+		`ControlPath='C:\lima\default\ssh.sock'`,
+		"ControlPersist=yes",
+		"ServerAliveInterval=30",
+	})
+}
+
 func TestParseOpenSSHVersion(t *testing.T) {
 	assert.Check(t, ParseOpenSSHVersion([]byte("OpenSSH_8.4p1 Ubuntu")).Equal(
 		semver.Version{Major: 8, Minor: 4, Patch: 1, PreRelease: "", Metadata: ""}))
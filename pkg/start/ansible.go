@@ -8,6 +8,7 @@ import (
 
 	"github.com/goccy/go-yaml"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/progress"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
 	"github.com/sirupsen/logrus"
@@ -18,8 +19,9 @@ func runAnsibleProvision(ctx context.Context, inst *store.Instance) error {
 	if err != nil {
 		return err
 	}
-	for _, f := range y.Provision {
+	for i, f := range y.Provision {
 		if f.Mode == limayaml.ProvisionModeAnsible {
+			progress.Emit(ctx, progress.Event{Phase: progress.RunningProvision, Message: f.Playbook, Script: i + 1})
 			logrus.Infof("Waiting for ansible playbook %q", f.Playbook)
 			if err := runAnsiblePlaybook(ctx, inst, f.Playbook); err != nil {
 				return err
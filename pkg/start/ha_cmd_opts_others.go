@@ -7,3 +7,7 @@ import (
 )
 
 var SysProcAttr = &syscall.SysProcAttr{}
+
+// DetachedSysProcAttr runs the host agent in a new session, so that it survives
+// the signals sent to the process group of limactl, e.g., on closing the terminal.
+var DetachedSysProcAttr = &syscall.SysProcAttr{Setsid: true}
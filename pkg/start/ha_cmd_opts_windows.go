@@ -7,3 +7,6 @@ import (
 var SysProcAttr = &syscall.SysProcAttr{
 	CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
 }
+
+// DetachedSysProcAttr is same as SysProcAttr, as the host agent already runs in a new process group.
+var DetachedSysProcAttr = SysProcAttr
@@ -6,10 +6,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
 	"text/template"
 	"time"
@@ -18,16 +23,19 @@ import (
 	"github.com/lima-vm/lima/pkg/driver"
 	"github.com/lima-vm/lima/pkg/driverutil"
 	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/progress"
 	"github.com/lima-vm/lima/pkg/qemu"
 	"github.com/lima-vm/lima/pkg/qemu/entitlementutil"
-	"github.com/mattn/go-isatty"
 
 	"github.com/lima-vm/lima/pkg/downloader"
 	"github.com/lima-vm/lima/pkg/fileutils"
 	hostagentevents "github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/logrusutil"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/yqutil"
+	"github.com/nxadm/tail"
 	"github.com/sirupsen/logrus"
 )
 
@@ -101,6 +109,7 @@ func Prepare(ctx context.Context, inst *store.Instance) (*Prepared, error) {
 	if _, err := os.Stat(baseDisk); err == nil {
 		created = true
 	}
+	progress.Emit(ctx, progress.Event{Phase: progress.CreatingDisk})
 	if err := limaDriver.CreateDisk(ctx); err != nil {
 		return nil, err
 	}
@@ -122,7 +131,45 @@ func Start(ctx context.Context, inst *store.Instance, launchHostAgentForeground
 	if _, err := os.Stat(haPIDPath); !errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("instance %q seems running (hint: remove %q if the instance is not actually running)", inst.Name, haPIDPath)
 	}
+	if noWait(ctx) && launchHostAgentForeground {
+		return errors.New("not waiting for the instance to be ready is not supported with running the host agent in the foreground")
+	}
+	if startPaused(ctx) && inst.VMType != limayaml.QEMU {
+		return fmt.Errorf("starting an instance paused is not supported for VM driver %q", inst.VMType)
+	}
+	if inst.VMType != limayaml.WSL2 && *inst.Config.SSH.LocalPort > 0 {
+		if err := checkTCPLocalPortFree(*inst.Config.SSH.LocalPort); err != nil {
+			r := inst.Config.SSH.PortRange
+			if len(r) != 2 || *inst.Config.SSH.LocalPort < r[0] || *inst.Config.SSH.LocalPort > r[1] {
+				return fmt.Errorf("field `ssh.localPort` is not available (hint: choose another port with `limactl edit --ssh-port`): %w", err)
+			}
+			if err := reassignSSHLocalPort(inst); err != nil {
+				return fmt.Errorf("field `ssh.localPort` is not available, and %w", err)
+			}
+		}
+	}
 	logrus.Infof("Starting the instance %q with VM driver %q", inst.Name, inst.VMType)
+	// the progress events are appended to the events log file, so it has to be reset for each start
+	if err := os.RemoveAll(filepath.Join(inst.Dir, filenames.HostAgentEventsLog)); err != nil {
+		return err
+	}
+	ctx = progress.WithInstanceDir(ctx, inst.Dir)
+
+	// the host agent must not be killed by the start timeout, so that it can stop the driver
+	haCtx := ctx
+	timeout, hasTimeout := startTimeout(ctx)
+	if hasTimeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	phase := phaseDisk
+	wrapTimeout := func(err error) error {
+		if hasTimeout && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %v while %s: %w%s", timeout, phase, err, bootDiagnostics(inst))
+		}
+		return err
+	}
 
 	haSockPath := filepath.Join(inst.Dir, filenames.HostAgentSock)
 
@@ -135,11 +182,11 @@ func Start(ctx context.Context, inst *store.Instance, launchHostAgentForeground
 		}
 		// The codesign --xml option is only available on macOS Monterey and later
 		if !macOSProductVersion.LessThan(*semver.New("12.0.0")) {
-			qExe, _, err := qemu.Exe(inst.Arch)
+			qExe, _, err := qemu.ExeFromYAML(inst.Config)
 			if err != nil {
 				return fmt.Errorf("failed to find the QEMU binary for the architecture %q: %w", inst.Arch, err)
 			}
-			if accel := qemu.Accel(inst.Arch); accel == "hvf" {
+			if accel, _ := qemu.SelectAccel(inst.Arch, inst.Config.Accel); accel == "hvf" {
 				entitlementutil.AskToSignIfNotSignedProperly(qExe)
 			}
 		}
@@ -147,8 +194,12 @@ func Start(ctx context.Context, inst *store.Instance, launchHostAgentForeground
 
 	prepared, err := Prepare(ctx, inst)
 	if err != nil {
-		return err
+		return wrapTimeout(err)
+	}
+	if err := ctx.Err(); err != nil {
+		return wrapTimeout(err)
 	}
+	phase = phaseLaunch
 
 	self, err := os.Executable()
 	if err != nil {
@@ -187,40 +238,45 @@ func Start(ctx context.Context, inst *store.Instance, launchHostAgentForeground
 	if prepared.NerdctlArchiveCache != "" {
 		args = append(args, "--nerdctl-archive", prepared.NerdctlArchiveCache)
 	}
+	if startPaused(ctx) {
+		args = append(args, "--paused")
+	}
+	cloudInit := cloudInitOverrides(ctx)
+	if cloudInit.UserData != "" {
+		args = append(args, "--cloud-init-user-data", cloudInit.UserData)
+	}
+	if cloudInit.NetworkConfig != "" {
+		args = append(args, "--cloud-init-network-config", cloudInit.NetworkConfig)
+	}
 	args = append(args, inst.Name)
-	haCmd := exec.CommandContext(ctx, self, args...)
+	haCmd := exec.CommandContext(haCtx, self, args...)
 	haCmd.SysProcAttr = SysProcAttr
+	if noWait(ctx) {
+		// limactl exits right after the driver has started, so the host agent must not be bound to it
+		haCmd.SysProcAttr = DetachedSysProcAttr
+	}
 
 	haCmd.Stdout = haStdoutW
 	haCmd.Stderr = haStderrW
 
 	begin := time.Now() // used for logrus propagation
 
+	var sigCh chan os.Signal
 	if launchHostAgentForeground {
 		logrus.Info("Running the host agent in the foreground")
-		if isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd()) {
-			// Write message to standard log files to avoid confusing users
-			message := "This log file is not used because `limactl start` was launched in the terminal with the `--foreground` option."
-			if _, err := haStdoutW.WriteString(message); err != nil {
-				return err
-			}
-			if _, err := haStderrW.WriteString(message); err != nil {
-				return err
-			}
-		} else {
-			if err := osutil.Dup2(int(haStdoutW.Fd()), syscall.Stdout); err != nil {
-				return err
-			}
-			if err := osutil.Dup2(int(haStderrW.Fd()), syscall.Stderr); err != nil {
-				return err
-			}
-		}
-		if err := syscall.Exec(self, haCmd.Args, haCmd.Environ()); err != nil {
-			return err
-		}
-	} else if err := haCmd.Start(); err != nil {
+		// The signals are forwarded to the host agent, so that the driver is stopped gracefully
+		sigCh = make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigCh)
+	}
+	if err := haCmd.Start(); err != nil {
 		return err
 	}
+	if launchHostAgentForeground {
+		forwardDone := make(chan struct{})
+		defer close(forwardDone)
+		go forwardSignals(haCmd, sigCh, forwardDone)
+	}
 
 	if err := waitHostAgentStart(ctx, haPIDPath, haStderrPath); err != nil {
 		return err
@@ -228,7 +284,7 @@ func Start(ctx context.Context, inst *store.Instance, launchHostAgentForeground
 
 	watchErrCh := make(chan error)
 	go func() {
-		watchErrCh <- watchHostAgentEvents(ctx, inst, haStdoutPath, haStderrPath, begin)
+		watchErrCh <- watchHostAgentEvents(ctx, inst, haStdoutPath, haStderrPath, begin, func() { phase = phaseSSH })
 		close(watchErrCh)
 	}()
 	waitErrCh := make(chan error)
@@ -240,6 +296,18 @@ func Start(ctx context.Context, inst *store.Instance, launchHostAgentForeground
 	select {
 	case watchErr := <-watchErrCh:
 		// watchErr can be nil
+		if watchErr != nil && hasTimeout && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err := wrapTimeout(watchErr)
+			stopHostAgent(inst, haCmd, waitErrCh)
+			return err
+		}
+		if launchHostAgentForeground {
+			if watchErr != nil {
+				stopHostAgent(inst, haCmd, waitErrCh)
+				return watchErr
+			}
+			return waitForegroundHostAgent(haStderrPath, waitErrCh)
+		}
 		return watchErr
 		// leave the hostagent process running
 	case waitErr := <-waitErrCh:
@@ -248,6 +316,196 @@ func Start(ctx context.Context, inst *store.Instance, launchHostAgentForeground
 	}
 }
 
+// stopHostAgentTimeout is the duration to wait for the host agent to stop the driver after Start failed.
+const stopHostAgentTimeout = time.Minute
+
+// stopHostAgent stops the host agent and the driver process after Start timed out,
+// or after the foreground startup failed.
+func stopHostAgent(inst *store.Instance, haCmd *exec.Cmd, waitErrCh <-chan error) {
+	logrus.Infof("Sending SIGINT to hostagent process %d", haCmd.Process.Pid)
+	if err := osutil.SysKill(haCmd.Process.Pid, osutil.SigInt); err != nil {
+		logrus.Error(err)
+	}
+	select {
+	case <-waitErrCh:
+		return
+	case <-time.After(stopHostAgentTimeout):
+	}
+	logrus.Warnf("The host agent did not stop in %v, killing the processes", stopHostAgentTimeout)
+	if inst2, err := store.Inspect(inst.Name); err == nil && inst2.DriverPID > 0 {
+		logrus.Infof("Sending SIGKILL to the %s driver process %d", inst2.VMType, inst2.DriverPID)
+		if err := osutil.SysKill(inst2.DriverPID, osutil.SigKill); err != nil {
+			logrus.Error(err)
+		}
+	}
+	if err := haCmd.Process.Kill(); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// forwardSignals forwards SIGINT and SIGTERM to the host agent running in the foreground, until done is closed.
+// The host agent stops the driver gracefully on these signals.
+func forwardSignals(haCmd *exec.Cmd, sigCh <-chan os.Signal, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case sig := <-sigCh:
+			logrus.Infof("Received %s, stopping the instance", osutil.SignalName(sig))
+			if err := osutil.SysKill(haCmd.Process.Pid, osutil.SigInt); err != nil {
+				logrus.Error(err)
+			}
+		}
+	}
+}
+
+// waitForegroundHostAgent propagates the host agent log until the host agent exits,
+// e.g., on the shutdown of the guest. The error is non-nil when the driver stopped with an error.
+func waitForegroundHostAgent(haStderrPath string, waitErrCh <-chan error) error {
+	exited := make(chan struct{})
+	logDone := make(chan struct{})
+	go func() {
+		// the lines older than now have been already propagated by watchHostAgentEvents
+		followHostAgentLog(haStderrPath, time.Now(), exited)
+		close(logDone)
+	}()
+	waitErr := <-waitErrCh
+	close(exited)
+	<-logDone
+	if waitErr != nil {
+		return fmt.Errorf("host agent process has exited: %w", waitErr)
+	}
+	logrus.Info("The host agent has exited")
+	return nil
+}
+
+// followHostAgentLog propagates the host agent log newer than begin, until exited is closed and the end of the log is reached.
+func followHostAgentLog(haStderrPath string, begin time.Time, exited <-chan struct{}) {
+	t, err := tail.TailFile(haStderrPath, tail.Config{
+		Follow:    true,
+		MustExist: true,
+		Logger:    tail.DiscardingLogger,
+	})
+	if err != nil {
+		logrus.WithError(err).Warnf("failed to follow %q", haStderrPath)
+		return
+	}
+	defer t.Cleanup()
+	go func() {
+		<-exited
+		_ = t.StopAtEOF()
+	}()
+	for line := range t.Lines {
+		if line.Err != nil {
+			logrus.Error(line.Err)
+			continue
+		}
+		logrusutil.PropagateJSON(logrus.StandardLogger(), []byte(line.Text), "[hostagent] ", begin)
+	}
+}
+
+// bootDiagnosticsLines is the number of the lines of the serial log shown by bootDiagnostics.
+const bootDiagnosticsLines = 20
+
+// bootDiagnostics returns the last lines of the serial log, and the hint to see the other logs.
+// The result is appended to the error of a failed boot.
+func bootDiagnostics(inst *store.Instance) string {
+	hint := fmt.Sprintf("\n(hint: run `limactl logs %s` to see the logs)", inst.Name)
+	for _, f := range []string{filenames.SerialLog, filenames.SerialVirtioLog} {
+		lines, err := tailLines(filepath.Join(inst.Dir, f), bootDiagnosticsLines)
+		if err != nil || len(lines) == 0 {
+			continue
+		}
+		return fmt.Sprintf("\nThe last %d lines of %q:\n%s%s", len(lines), f, strings.Join(lines, "\n"), hint)
+	}
+	return hint
+}
+
+// tailLines returns the last n lines of the file, reading up to the last 64 KiB only.
+func tailLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	const maxBytes = 64 * 1024
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := st.Size() - maxBytes
+	if offset < 0 {
+		offset = 0
+	}
+	b := make([]byte, st.Size()-offset)
+	if _, err := f.ReadAt(b, offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(string(b), "\r\n"), "\n")
+	if offset > 0 && len(lines) > 1 {
+		// the first line may be partial
+		lines = lines[1:]
+	}
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// reassignSSHLocalPort picks a free port within `ssh.portRange`, and persists it as `ssh.localPort` of the instance.
+// The SSH config file of the instance is regenerated by the host agent.
+func reassignSSHLocalPort(inst *store.Instance) error {
+	r := inst.Config.SSH.PortRange
+	origPort := *inst.Config.SSH.LocalPort
+	port, err := pickSSHLocalPort(r, origPort, func(port int) bool {
+		return checkTCPLocalPortFree(port) == nil
+	})
+	if err != nil {
+		return err
+	}
+	filePath := filepath.Join(inst.Dir, filenames.LimaYAML)
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	b, err = yqutil.EvaluateExpression(fmt.Sprintf(".ssh.localPort = %d", port), b)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, b, 0o644); err != nil {
+		return err
+	}
+	logrus.Warnf("SSH local port %d is already in use, switched to %d within `ssh.portRange` %v", origPort, port, r)
+	inst.Config.SSH.LocalPort = &port
+	inst.SSHLocalPort = port
+	return nil
+}
+
+// pickSSHLocalPort returns the first free port within portRange, starting from the port next to origPort
+// and wrapping around to the start of the range.
+func pickSSHLocalPort(portRange []int, origPort int, isFree func(int) bool) (int, error) {
+	span := portRange[1] - portRange[0] + 1
+	for i := 1; i < span; i++ {
+		port := portRange[0] + (origPort-portRange[0]+i)%span
+		if isFree(port) {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port was found within `ssh.portRange` %v", portRange)
+}
+
+// checkTCPLocalPortFree returns an error if the port is already used on 127.0.0.1.
+func checkTCPLocalPortFree(port int) error {
+	l, err := net.Listen("tcp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("port %d is already in use: %w", port, err)
+	}
+	return l.Close()
+}
+
 func waitHostAgentStart(_ context.Context, haPIDPath, haStderrPath string) error {
 	begin := time.Now()
 	deadlineDuration := 5 * time.Second
@@ -262,16 +520,25 @@ func waitHostAgentStart(_ context.Context, haPIDPath, haStderrPath string) error
 	}
 }
 
-func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPath, haStderrPath string, begin time.Time) error {
+// watchHostAgentEvents waits for the instance to be running.
+// onBooting is called on the first event, which is emitted after the driver has started.
+func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPath, haStderrPath string, begin time.Time, onBooting func()) error {
 	ctx, cancel := context.WithTimeout(ctx, watchHostAgentTimeout(ctx))
 	defer cancel()
 
 	var (
-		printedSSHLocalPort  bool
-		receivedRunningEvent bool
-		err                  error
+		printedSSHLocalPort   bool
+		receivedRunningEvent  bool
+		receivedPausedEvent   bool
+		receivedLaunchedEvent bool
+		err                   error
 	)
+	var receivedEvent bool
 	onEvent := func(ev hostagentevents.Event) bool {
+		if !receivedEvent {
+			receivedEvent = true
+			onBooting()
+		}
 		if !printedSSHLocalPort && ev.Status.SSHLocalPort != 0 {
 			logrus.Infof("SSH Local Port: %d", ev.Status.SSHLocalPort)
 			printedSSHLocalPort = true
@@ -283,11 +550,21 @@ func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPat
 		if ev.Status.Exiting {
 			err = fmt.Errorf("exiting, status=%+v (hint: see %q)", ev.Status, haStderrPath)
 			return true
+		} else if noWait(ctx) {
+			receivedLaunchedEvent = true
+			logrus.Infof("LAUNCHED. Not waiting for the instance to be ready. Run `limactl list %s` to check the status.", inst.Name)
+			err = nil
+			return true
+		} else if ev.Status.Paused {
+			receivedPausedEvent = true
+			logrus.Infof("PAUSED. The vCPUs have not started yet. Run `limactl resume %s` to continue booting.", inst.Name)
+			err = nil
+			return true
 		} else if ev.Status.Running {
 			receivedRunningEvent = true
 			if ev.Status.Degraded {
 				logrus.Warnf("DEGRADED. The VM seems running, but file sharing and port forwarding may not work. (hint: see %q)", haStderrPath)
-				err = fmt.Errorf("degraded, status=%+v", ev.Status)
+				err = fmt.Errorf("degraded, status=%+v%s", ev.Status, bootDiagnostics(inst))
 				return true
 			}
 
@@ -295,6 +572,7 @@ func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPat
 				err = xerr
 				return true
 			}
+			progress.Emit(ctx, progress.Event{Phase: progress.Ready})
 			if *inst.Config.Plain {
 				logrus.Infof("READY. Run `ssh -F %q lima-%s` to open the shell.", inst.SSHConfigFile, inst.Name)
 			} else {
@@ -315,13 +593,76 @@ func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPat
 		return err
 	}
 
-	if !receivedRunningEvent {
+	if !receivedRunningEvent && !receivedPausedEvent && !receivedLaunchedEvent {
 		return errors.New("did not receive an event with the \"running\" status")
 	}
 
 	return nil
 }
 
+type startTimeoutKey struct{}
+
+// Phases of Start, used in the error when the startup timed out.
+const (
+	phaseDisk   = "preparing the disk"
+	phaseLaunch = "launching the VM"
+	phaseSSH    = "waiting for SSH to be ready"
+)
+
+// WithStartTimeout makes Start cancel the whole startup sequence, from the disk preparation
+// to the readiness of SSH, after the timeout. The partially started instance is stopped.
+func WithStartTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, startTimeoutKey{}, timeout)
+}
+
+func startTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(startTimeoutKey{}).(time.Duration)
+	return timeout, ok
+}
+
+type noWaitKey struct{}
+
+// WithNoWait makes Start return as soon as the driver has started, without waiting for the guest to boot.
+// The host agent keeps running in the background, and the readiness can be checked later with `limactl list`.
+func WithNoWait(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noWaitKey{}, true)
+}
+
+func noWait(ctx context.Context) bool {
+	b, _ := ctx.Value(noWaitKey{}).(bool)
+	return b
+}
+
+type startPausedKey struct{}
+
+// WithStartPaused makes Start start the instance with its vCPUs paused, without waiting for the guest to boot.
+func WithStartPaused(ctx context.Context) context.Context {
+	return context.WithValue(ctx, startPausedKey{}, true)
+}
+
+func startPaused(ctx context.Context) bool {
+	paused, _ := ctx.Value(startPausedKey{}).(bool)
+	return paused
+}
+
+// CloudInitOverrides are the absolute paths of the files merged into the generated cloud-init NoCloud data.
+type CloudInitOverrides struct {
+	UserData      string
+	NetworkConfig string
+}
+
+type cloudInitOverridesKey struct{}
+
+// WithCloudInitOverrides makes Start merge the files into the generated cloud-init NoCloud data.
+func WithCloudInitOverrides(ctx context.Context, o CloudInitOverrides) context.Context {
+	return context.WithValue(ctx, cloudInitOverridesKey{}, o)
+}
+
+func cloudInitOverrides(ctx context.Context) CloudInitOverrides {
+	o, _ := ctx.Value(cloudInitOverridesKey{}).(CloudInitOverrides)
+	return o
+}
+
 type watchHostAgentEventsTimeoutKey = struct{}
 
 // WithWatchHostAgentEventsTimeout sets the value of the timeout to use for
@@ -0,0 +1,31 @@
+package start
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPickSSHLocalPort(t *testing.T) {
+	portRange := []int{60020, 60024}
+	used := map[int]bool{60022: true, 60023: true}
+	isFree := func(port int) bool {
+		return !used[port]
+	}
+
+	port, err := pickSSHLocalPort(portRange, 60022, isFree)
+	assert.NilError(t, err)
+	assert.Equal(t, 60024, port)
+
+	// wraps around to the start of the range
+	used[60024] = true
+	port, err = pickSSHLocalPort(portRange, 60022, isFree)
+	assert.NilError(t, err)
+	assert.Equal(t, 60020, port)
+
+	// fully occupied
+	used[60020] = true
+	used[60021] = true
+	_, err = pickSSHLocalPort(portRange, 60022, isFree)
+	assert.ErrorContains(t, err, "no free port was found")
+}
@@ -0,0 +1,295 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-units"
+	hostagentapi "github.com/lima-vm/lima/pkg/hostagent/api"
+	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// Stats is the resource usage of an instance.
+// The fields are nil when the instance is not running, or when they are not available.
+type Stats struct {
+	Name   string       `json:"name"`
+	Status store.Status `json:"status"`
+	// CPUPercent is the CPU usage of the VM process on the host, computed from the CPU time
+	// consumed since the previous sample of the [CPUSampler].
+	CPUPercent *float64 `json:"cpuPercent,omitempty"`
+	// RSS is the resident set size of the VM process on the host, in bytes.
+	RSS *int64 `json:"rss,omitempty"`
+	// Guest is the resource usage reported by the guest agent.
+	Guest *hostagentapi.Stats `json:"guest,omitempty"`
+}
+
+// cpuSampleInterval is the interval between the two samples of the CPU time, when there is no previous sample.
+const cpuSampleInterval = time.Second
+
+// CPUSampler computes the CPU usage of the VM processes from the CPU time consumed between two samples.
+// `ps -o %cpu` is not used, as it is the average over the lifetime of the process on Linux, not the current usage.
+type CPUSampler struct {
+	mu      sync.Mutex
+	samples map[int]cpuSample // by PID
+}
+
+type cpuSample struct {
+	cpuTime time.Duration
+	at      time.Time
+}
+
+func NewCPUSampler() *CPUSampler {
+	return &CPUSampler{
+		samples: make(map[int]cpuSample),
+	}
+}
+
+// add records the sample of the process, and returns the CPU usage since the previous sample, in percent.
+// ok is false when there is no previous sample, or when the PID was reused by another process.
+func (s *CPUSampler) add(pid int, sample cpuSample) (percent float64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.samples[pid]
+	s.samples[pid] = sample
+	if !ok || !sample.at.After(prev.at) || sample.cpuTime < prev.cpuTime {
+		return 0, false
+	}
+	return float64(sample.cpuTime-prev.cpuTime) * 100 / float64(sample.at.Sub(prev.at)), true
+}
+
+func (s *CPUSampler) has(pid int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.samples[pid]
+	return ok
+}
+
+// GetAll returns the resource usage of the instances, in the same order.
+// When the sampler has no previous sample of a running instance, the CPU time is sampled twice,
+// cpuSampleInterval apart.
+// Errors are logged rather than returned, so that a broken instance does not hide the others.
+func GetAll(ctx context.Context, insts []*store.Instance, sampler *CPUSampler) []*Stats {
+	var primed bool
+	for _, inst := range insts {
+		if !running(inst) || inst.DriverPID <= 0 || sampler.has(inst.DriverPID) {
+			continue
+		}
+		if cpuTime, _, err := processStats(ctx, inst.DriverPID); err == nil {
+			sampler.add(inst.DriverPID, cpuSample{cpuTime: cpuTime, at: time.Now()})
+			primed = true
+		}
+	}
+	if primed {
+		select {
+		case <-ctx.Done():
+		case <-time.After(cpuSampleInterval):
+		}
+	}
+	res := make([]*Stats, len(insts))
+	var wg sync.WaitGroup
+	for i, inst := range insts {
+		wg.Add(1)
+		go func(i int, inst *store.Instance) {
+			defer wg.Done()
+			res[i] = get(ctx, inst, sampler)
+		}(i, inst)
+	}
+	wg.Wait()
+	return res
+}
+
+func running(inst *store.Instance) bool {
+	return inst.Status == store.StatusRunning || inst.Status == store.StatusPaused
+}
+
+func get(ctx context.Context, inst *store.Instance, sampler *CPUSampler) *Stats {
+	stats := &Stats{
+		Name:   inst.Name,
+		Status: inst.Status,
+	}
+	if !running(inst) {
+		return stats
+	}
+	if inst.DriverPID > 0 {
+		cpuTime, rss, err := processStats(ctx, inst.DriverPID)
+		if err != nil {
+			logrus.WithError(err).Debugf("failed to get the stats of the process %d of instance %q", inst.DriverPID, inst.Name)
+		} else {
+			stats.RSS = &rss
+			if cpu, ok := sampler.add(inst.DriverPID, cpuSample{cpuTime: cpuTime, at: time.Now()}); ok {
+				stats.CPUPercent = &cpu
+			}
+		}
+	}
+	// the guest agent does not respond while the vCPUs are paused
+	if inst.Status == store.StatusRunning {
+		guest, err := guestStats(ctx, inst)
+		if err != nil {
+			logrus.WithError(err).Debugf("failed to get the guest stats of instance %q", inst.Name)
+		} else {
+			stats.Guest = guest
+		}
+	}
+	return stats
+}
+
+func guestStats(ctx context.Context, inst *store.Instance) (*hostagentapi.Stats, error) {
+	haSock := filepath.Join(inst.Dir, filenames.HostAgentSock)
+	haClient, err := hostagentclient.NewHostAgentClient(haSock)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	return haClient.Stats(ctx)
+}
+
+// processStats returns the CPU time consumed by the process so far, and its RSS.
+func processStats(ctx context.Context, pid int) (cpuTime time.Duration, rss int64, err error) {
+	if runtime.GOOS == "windows" {
+		return 0, 0, fmt.Errorf("unsupported GOOS %q", runtime.GOOS)
+	}
+	out, err := exec.CommandContext(ctx, "ps", "-o", "cputime=,rss=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to run ps: %w", err)
+	}
+	cpuTime, rss, err = parsePS(string(out))
+	if err != nil {
+		return 0, 0, err
+	}
+	if runtime.GOOS == "linux" {
+		// ps of procps reports the CPU time in seconds, which is too coarse for the interval of a few seconds
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			return 0, 0, err
+		}
+		cpuTime, err = parseProcStat(string(stat))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return cpuTime, rss, nil
+}
+
+// parsePS parses the output of `ps -o cputime=,rss=`.
+// The RSS is reported in KiB.
+func parsePS(out string) (cpuTime time.Duration, rss int64, err error) {
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected output of ps: %q", out)
+	}
+	cpuTime, err = parseCPUTime(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	rssKiB, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return cpuTime, rssKiB * 1024, nil
+}
+
+// parseCPUTime parses the "cputime" of ps, i.e., "[[dd-]hh:]mm:ss[.cc]".
+// procps prints "00:01:23" or "1-02:03:04", and the ps of macOS prints "1:23.45".
+func parseCPUTime(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, rest, ok := strings.Cut(s, "-"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid cputime %q: %w", s, err)
+		}
+		d += time.Duration(n) * 24 * time.Hour
+		s = rest
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid cputime %q", s)
+	}
+	sec, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cputime %q: %w", s, err)
+	}
+	d += time.Duration(sec * float64(time.Second))
+	multipliers := []time.Duration{time.Minute, time.Hour}
+	for i, unit := range multipliers[:len(parts)-1] {
+		n, err := strconv.Atoi(parts[len(parts)-2-i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid cputime %q: %w", s, err)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// clockTicks is USER_HZ, the unit of the CPU times in /proc/<pid>/stat, which is 100 on all the Linux architectures.
+const clockTicks = 100
+
+// parseProcStat returns the CPU time (utime + stime) in the content of /proc/<pid>/stat.
+func parseProcStat(stat string) (time.Duration, error) {
+	// the command name in the second field may contain spaces and parentheses
+	i := strings.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("unexpected /proc/<pid>/stat: %q", stat)
+	}
+	// the fields after the command name start from the third field, "state"
+	fields := strings.Fields(stat[i+1:])
+	const utime, stime = 14 - 3, 15 - 3
+	if len(fields) <= stime {
+		return 0, fmt.Errorf("unexpected /proc/<pid>/stat: %q", stat)
+	}
+	var ticks int64
+	for _, f := range []string{fields[utime], fields[stime]} {
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected /proc/<pid>/stat: %q: %w", stat, err)
+		}
+		ticks += n
+	}
+	return time.Duration(ticks) * time.Second / clockTicks, nil
+}
+
+// TableHeader is the header of the columns returned by [Stats.TableRow].
+var TableHeader = []string{"CPU%", "RSS", "LOAD", "MEMPRESSURE", "BALLOON", "ROOTFS"}
+
+// TableRow returns the values for [TableHeader], with "-" for the unavailable values.
+func (s *Stats) TableRow() []string {
+	row := []string{"-", "-", "-", "-", "-", "-"}
+	if s.CPUPercent != nil {
+		row[0] = fmt.Sprintf("%.1f", *s.CPUPercent)
+	}
+	if s.RSS != nil {
+		row[1] = units.BytesSize(float64(*s.RSS))
+	}
+	if s.Guest != nil {
+		if len(s.Guest.LoadAverage) > 0 {
+			loads := make([]string, len(s.Guest.LoadAverage))
+			for i, l := range s.Guest.LoadAverage {
+				loads[i] = fmt.Sprintf("%.2f", l)
+			}
+			row[2] = strings.Join(loads, " ")
+		}
+		if s.Guest.MemoryPressure != nil {
+			row[3] = fmt.Sprintf("%.2f%%", *s.Guest.MemoryPressure)
+		}
+		if s.Guest.MemoryActual > 0 {
+			row[4] = units.BytesSize(float64(s.Guest.MemoryActual))
+		}
+		for _, fs := range s.Guest.Filesystems {
+			if fs.MountPoint == "/" && fs.Total > 0 {
+				row[5] = fmt.Sprintf("%.0f%%", float64(fs.Used)*100/float64(fs.Total))
+			}
+		}
+	}
+	return row
+}
@@ -0,0 +1,96 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	hostagentapi "github.com/lima-vm/lima/pkg/hostagent/api"
+	"github.com/lima-vm/lima/pkg/ptr"
+	"github.com/lima-vm/lima/pkg/store"
+	"gotest.tools/v3/assert"
+)
+
+func TestParsePS(t *testing.T) {
+	cpuTime, rss, err := parsePS(" 00:01:23 204800\n")
+	assert.NilError(t, err)
+	assert.Equal(t, 83*time.Second, cpuTime)
+	assert.Equal(t, int64(200*1024*1024), rss)
+
+	_, _, err = parsePS("")
+	assert.ErrorContains(t, err, "unexpected output")
+}
+
+func TestParseCPUTime(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		// procps
+		"00:01:23":   83 * time.Second,
+		"1-02:03:04": 26*time.Hour + 3*time.Minute + 4*time.Second,
+		// macOS
+		"1:23.45":   83*time.Second + 450*time.Millisecond,
+		"123:00.01": 123*time.Minute + 10*time.Millisecond,
+	} {
+		d, err := parseCPUTime(s)
+		assert.NilError(t, err, s)
+		assert.Equal(t, expected, d, s)
+	}
+	for _, s := range []string{"", "12", "1:2:3:4", "a:00", "x-00:00:00"} {
+		_, err := parseCPUTime(s)
+		assert.ErrorContains(t, err, "invalid cputime", s)
+	}
+}
+
+func TestParseProcStat(t *testing.T) {
+	// the command name may contain spaces and parentheses
+	stat := "1234 (qemu (x) y) S 1 1234 1234 0 -1 4194560 5000 0 0 0 250 130 0 0 20 0 10 0 100 0 0\n"
+	d, err := parseProcStat(stat)
+	assert.NilError(t, err)
+	assert.Equal(t, 3800*time.Millisecond, d)
+
+	_, err = parseProcStat("1234 (qemu) S 1")
+	assert.ErrorContains(t, err, "unexpected")
+}
+
+func TestCPUSampler(t *testing.T) {
+	s := NewCPUSampler()
+	now := time.Now()
+	_, ok := s.add(1, cpuSample{cpuTime: 10 * time.Hour, at: now})
+	assert.Assert(t, !ok)
+	assert.Assert(t, s.has(1))
+
+	// the usage is the CPU time of the interval, not the average over the lifetime
+	cpu, ok := s.add(1, cpuSample{cpuTime: 10*time.Hour + time.Second, at: now.Add(2 * time.Second)})
+	assert.Assert(t, ok)
+	assert.Equal(t, 50.0, cpu)
+	cpu, ok = s.add(1, cpuSample{cpuTime: 10*time.Hour + 5*time.Second, at: now.Add(4 * time.Second)})
+	assert.Assert(t, ok)
+	assert.Equal(t, 200.0, cpu)
+
+	// the PID was reused by another process
+	_, ok = s.add(1, cpuSample{cpuTime: time.Second, at: now.Add(6 * time.Second)})
+	assert.Assert(t, !ok)
+}
+
+func TestTableRow(t *testing.T) {
+	stopped := &Stats{Name: "foo", Status: store.StatusStopped}
+	assert.DeepEqual(t, []string{"-", "-", "-", "-", "-", "-"}, stopped.TableRow())
+
+	running := &Stats{
+		Name:       "foo",
+		Status:     store.StatusRunning,
+		CPUPercent: ptr.Of(3.5),
+		RSS:        ptr.Of(int64(2 << 30)),
+		Guest: &hostagentapi.Stats{
+			LoadAverage:    []float64{0.5, 0.25, 0.75},
+			MemoryPressure: ptr.Of(1.5),
+			Filesystems: []hostagentapi.FilesystemUsage{
+				{MountPoint: "/", Total: 100 << 30, Used: 45 << 30},
+				{MountPoint: "/Users/foo", Total: 500 << 30, Used: 499 << 30},
+			},
+		},
+	}
+	assert.DeepEqual(t, []string{"3.5", "2GiB", "0.50 0.25 0.75", "1.50%", "-", "45%"}, running.TableRow())
+
+	// PSI is not supported by the guest kernel
+	running.Guest.MemoryPressure = nil
+	assert.Equal(t, "-", running.TableRow()[3])
+}
@@ -45,6 +45,15 @@ func LimaConfigDir() (string, error) {
 	return filepath.Join(limaDir, filenames.ConfigDir), nil
 }
 
+// LimaCacheDir returns the path of the cache directory, $LIMA_HOME/_cache.
+func LimaCacheDir() (string, error) {
+	limaDir, err := LimaDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(limaDir, filenames.CacheDir), nil
+}
+
 // LimaNetworksDir returns the path of the networks log directory, $LIMA_HOME/_networks.
 func LimaNetworksDir() (string, error) {
 	limaDir, err := LimaDir()
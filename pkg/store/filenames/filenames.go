@@ -8,7 +8,7 @@ package filenames
 
 const (
 	ConfigDir   = "_config"
-	CacheDir    = "_cache"    // not yet implemented
+	CacheDir    = "_cache"    // cached data such as the QEMU capabilities
 	NetworksDir = "_networks" // network log files are stored here
 	DisksDir    = "_disks"    // disks are stored here
 )
@@ -44,24 +44,33 @@ const (
 	SerialVirtioSock     = "serialv.sock"
 	SSHSock              = "ssh.sock"
 	SSHConfig            = "ssh.config"
+	SSHPrivateKey        = "ssh_key" // dedicated to the instance, see ssh.generateDedicatedKey
+	SSHPublicKey         = SSHPrivateKey + ".pub"
 	VhostSock            = "virtiofsd-%d.sock"
 	VNCDisplayFile       = "vncdisplay"
 	VNCPasswordFile      = "vncpassword"
+	SwtpmSock            = "swtpm.sock"
+	SwtpmStateDir        = "swtpm" // TPM state of swtpm
 	GuestAgentSock       = "ga.sock"
+	QEMUGuestAgentSock   = "qemu-ga.sock" // QEMU guest agent (qemu-ga), not the Lima guest agent
 	VirtioPort           = "io.lima-vm.guest_agent.0"
 	HostAgentPID         = "ha.pid"
 	HostAgentSock        = "ha.sock"
 	HostAgentStdoutLog   = "ha.stdout.log"
 	HostAgentStderrLog   = "ha.stderr.log"
+	HostAgentEventsLog   = "ha.events.log" // progress events, see pkg/progress
 	VzIdentifier         = "vz-identifier"
 	VzEfi                = "vz-efi"           // efi variable store
 	QemuEfiCodeFD        = "qemu-efi-code.fd" // efi code; not always created
 	AnsibleInventoryYAML = "ansible-inventory.yaml"
+	ConsoleLock          = "console.lock"     // locked while `limactl console` is attached
+	ShutdownTimeout      = "shutdown-timeout" // overrides `shutdown.timeout` for the next stop; written by `limactl stop --timeout`
 
 	// SocketDir is the default location for forwarded sockets with a relative paths in HostSocket.
 	SocketDir = "sock"
 
 	Protected = "protected" // empty file; used by `limactl protect`
+	AutoStart = "autostart" // empty file; used by `limactl start-at-login`
 )
 
 // Filenames used under a disk directory
@@ -20,6 +20,7 @@ import (
 	"github.com/docker/go-units"
 	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/sshutil"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
 	"github.com/lima-vm/lima/pkg/store/filenames"
 	"github.com/lima-vm/lima/pkg/textutil"
@@ -35,6 +36,7 @@ const (
 	StatusBroken        Status = "Broken"
 	StatusStopped       Status = "Stopped"
 	StatusRunning       Status = "Running"
+	StatusPaused        Status = "Paused"
 )
 
 type Instance struct {
@@ -58,6 +60,7 @@ type Instance struct {
 	Config          *limayaml.LimaYAML `json:"config,omitempty"`
 	SSHAddress      string             `json:"sshAddress,omitempty"`
 	Protected       bool               `json:"protected"`
+	AutoStart       bool               `json:"autoStart"`
 	LimaVersion     string             `json:"limaVersion"`
 }
 
@@ -105,6 +108,7 @@ func Inspect(instName string) (*Instance, error) {
 		inst.Errors = append(inst.Errors, err)
 	}
 
+	var paused bool
 	if inst.HostAgentPID != 0 {
 		haSock := filepath.Join(instDir, filenames.HostAgentSock)
 		haClient, err := hostagentclient.NewHostAgentClient(haSock)
@@ -114,12 +118,13 @@ func Inspect(instName string) (*Instance, error) {
 		} else {
 			ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
 			defer cancel()
-			info, err := haClient.Info(ctx)
+			info, err := haClient.Info(ctx, false)
 			if err != nil {
 				inst.Status = StatusBroken
 				inst.Errors = append(inst.Errors, fmt.Errorf("failed to get Info from %q: %w", haSock, err))
 			} else {
 				inst.SSHLocalPort = info.SSHLocalPort
+				paused = info.Paused
 			}
 		}
 	}
@@ -148,7 +153,15 @@ func Inspect(instName string) (*Instance, error) {
 		inst.Protected = true
 	}
 
+	autoStart := filepath.Join(instDir, filenames.AutoStart)
+	if _, err := os.Lstat(autoStart); !errors.Is(err, os.ErrNotExist) {
+		inst.AutoStart = true
+	}
+
 	inspectStatus(instDir, inst, y)
+	if inst.Status == StatusRunning && paused {
+		inst.Status = StatusPaused
+	}
 
 	tmpl, err := template.New("format").Parse(y.Message)
 	if err != nil {
@@ -264,11 +277,12 @@ func AddGlobalFields(inst *Instance) (FormatData, error) {
 	// Add HostArch
 	data.HostArch = limayaml.NewArch(runtime.GOARCH)
 	// Add IdentityFile
-	configDir, err := dirnames.LimaConfigDir()
+	dedicatedKey := inst.Config != nil && inst.Config.SSH.GenerateDedicatedKey != nil && *inst.Config.SSH.GenerateDedicatedKey
+	var err error
+	data.IdentityFile, err = sshutil.PrivateKeyPath(inst.Dir, dedicatedKey)
 	if err != nil {
 		return FormatData{}, err
 	}
-	data.IdentityFile = filepath.Join(configDir, filenames.UserPrivateKey)
 	// Add LimaHome
 	data.LimaHome, err = dirnames.LimaDir()
 	if err != nil {
@@ -280,6 +294,10 @@ func AddGlobalFields(inst *Instance) (FormatData, error) {
 type PrintOptions struct {
 	AllFields     bool
 	TerminalWidth int
+	// ExtraColumns are the additional columns of the table format, shown before DIR.
+	ExtraColumns []string
+	// ExtraValues returns the values of ExtraColumns for the instance.
+	ExtraValues func(*Instance) []string
 }
 
 // PrintInstances prints instances in a requested format to a given io.Writer.
@@ -293,9 +311,14 @@ func PrintInstances(w io.Writer, instances []*Instance, format string, options *
 	case "table":
 		types := map[string]int{}
 		archs := map[string]int{}
+		// AUTOSTART is only shown when an instance is registered to `limactl start-at-login`
+		hideAutoStart := true
 		for _, instance := range instances {
 			types[instance.VMType]++
 			archs[instance.Arch]++
+			if instance.AutoStart {
+				hideAutoStart = false
+			}
 		}
 		all := options != nil && options.AllFields
 		width := 0
@@ -306,6 +329,10 @@ func PrintInstances(w io.Writer, instances []*Instance, format string, options *
 		hideType := false
 		hideArch := false
 		hideDir := false
+		var extraColumns []string
+		if options != nil && options.ExtraValues != nil {
+			extraColumns = options.ExtraColumns
+		}
 
 		columns := 1 // NAME
 		columns += 2 // STATUS
@@ -329,6 +356,10 @@ func PrintInstances(w io.Writer, instances []*Instance, format string, options *
 		columns++ // CPUS
 		columns++ // MEMORY
 		columns++ // DISK
+		if !hideAutoStart {
+			columns++ // AUTOSTART
+		}
+		columns += len(extraColumns)
 		// can we still fit the remaining columns (2)
 		if width != 0 && (columns+2)*columnWidth > width && !all {
 			hideDir = true
@@ -347,6 +378,12 @@ func PrintInstances(w io.Writer, instances []*Instance, format string, options *
 			fmt.Fprint(w, "\tARCH")
 		}
 		fmt.Fprint(w, "\tCPUS\tMEMORY\tDISK")
+		if !hideAutoStart {
+			fmt.Fprint(w, "\tAUTOSTART")
+		}
+		for _, c := range extraColumns {
+			fmt.Fprint(w, "\t"+c)
+		}
 		if !hideDir {
 			fmt.Fprint(w, "\tDIR")
 		}
@@ -383,6 +420,12 @@ func PrintInstances(w io.Writer, instances []*Instance, format string, options *
 				units.BytesSize(float64(instance.Memory)),
 				units.BytesSize(float64(instance.Disk)),
 			)
+			if !hideAutoStart {
+				fmt.Fprintf(w, "\t%t", instance.AutoStart)
+			}
+			if len(extraColumns) > 0 {
+				fmt.Fprint(w, "\t"+strings.Join(options.ExtraValues(instance), "\t"))
+			}
 			if !hideDir {
 				fmt.Fprintf(w, "\t%s",
 					dir,
@@ -437,6 +480,21 @@ func (inst *Instance) Unprotect() error {
 	return nil
 }
 
+// SetAutoStart records whether the instance is registered to `limactl start-at-login`.
+// The unit file itself is managed by the autostart package.
+func (inst *Instance) SetAutoStart(enabled bool) error {
+	autoStart := filepath.Join(inst.Dir, filenames.AutoStart)
+	if enabled {
+		if err := os.WriteFile(autoStart, nil, 0o644); err != nil {
+			return err
+		}
+	} else if err := os.RemoveAll(autoStart); err != nil {
+		return err
+	}
+	inst.AutoStart = enabled
+	return nil
+}
+
 // parseLimaVersion parses a Lima version string by removing the leading "v" character and
 // stripping everything from the first "-" forward (which are `git describe` artifacts and
 // not semver pre-release markers). So "v0.19.1-16-gf3dc6ed.m" will be parsed as "0.19.1".
@@ -2,13 +2,22 @@ package store
 
 import (
 	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/lima-vm/lima/pkg/hostagent/api"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store/filenames"
 	"gotest.tools/v3/assert"
 )
 
@@ -62,6 +71,11 @@ var tableTwo = "NAME    STATUS     SSH            VMTYPE    ARCH       CPUS    M
 	"foo     Stopped    127.0.0.1:0    qemu      x86_64     0       0B        0B\n" +
 	"bar     Stopped    127.0.0.1:0    vz        aarch64    0       0B        0B\n"
 
+// AUTOSTART is shown when an instance has autostart enabled
+var tableAutoStart = "NAME    STATUS     SSH            CPUS    MEMORY    DISK    AUTOSTART    DIR\n" +
+	"foo     Stopped    127.0.0.1:0    0       0B        0B      true         dir\n" +
+	"bar     Stopped    127.0.0.1:0    0       0B        0B      false        dir\n"
+
 func TestPrintInstanceTable(t *testing.T) {
 	var buf bytes.Buffer
 	instances := []*Instance{&instance}
@@ -156,6 +170,18 @@ func TestPrintInstanceTableTwo(t *testing.T) {
 	assert.Equal(t, tableTwo, buf.String())
 }
 
+func TestPrintInstanceTableAutoStart(t *testing.T) {
+	var buf bytes.Buffer
+	instance1 := instance
+	instance1.AutoStart = true
+	instance2 := instance
+	instance2.Name = "bar"
+	instances := []*Instance{&instance1, &instance2}
+	err := PrintInstances(&buf, instances, "table", nil)
+	assert.NilError(t, err)
+	assert.Equal(t, tableAutoStart, buf.String())
+}
+
 func TestLimaVersionGreaterThan(t *testing.T) {
 	assert.Equal(t, LimaVersionGreaterThan("", "0.1.0"), false)
 	assert.Equal(t, LimaVersionGreaterThan("0.0.1", "0.1.0"), false)
@@ -164,3 +190,36 @@ func TestLimaVersionGreaterThan(t *testing.T) {
 	assert.Equal(t, LimaVersionGreaterThan("0.2.0", "0.1.0"), true)
 	assert.Equal(t, LimaVersionGreaterThan("abacab", "0.1.0"), true)
 }
+
+func TestInspectPaused(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the host agent socket is not tested on Windows")
+	}
+	t.Setenv("LIMA_HOME", t.TempDir())
+	instDir, err := InstanceDir("foo")
+	assert.NilError(t, err)
+	assert.NilError(t, os.MkdirAll(instDir, 0o700))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.LimaYAML), []byte("vmType: qemu\nimages: [{location: /dummy.img}]\n"), 0o644))
+	pid := []byte(strconv.Itoa(os.Getpid()))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.HostAgentPID), pid, 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.PIDFile(limayaml.QEMU)), pid, 0o644))
+
+	// the paused state is reported by the host agent, without connecting to the QMP socket
+	var paused atomic.Bool
+	l, err := net.Listen("unix", filepath.Join(instDir, filenames.HostAgentSock))
+	assert.NilError(t, err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(api.Info{SSHLocalPort: 60022, Paused: paused.Load()})
+	}), ReadHeaderTimeout: time.Second}
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Close()
+
+	inst, err := Inspect("foo")
+	assert.NilError(t, err)
+	assert.Equal(t, StatusRunning, inst.Status)
+
+	paused.Store(true)
+	inst, err = Inspect("foo")
+	assert.NilError(t, err)
+	assert.Equal(t, StatusPaused, inst.Status)
+}
@@ -1,6 +1,8 @@
 package templatestore
 
 import (
+	"bufio"
+	"bytes"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -8,11 +10,13 @@ import (
 
 	securejoin "github.com/cyphar/filepath-securejoin"
 	"github.com/lima-vm/lima/pkg/usrlocalsharelima"
+	"gopkg.in/yaml.v3"
 )
 
 type Template struct {
-	Name     string `json:"name"`
-	Location string `json:"location"`
+	Name        string `json:"name"`
+	Location    string `json:"location"`
+	Description string `json:"description,omitempty"`
 }
 
 func Read(name string) ([]byte, error) {
@@ -50,6 +54,9 @@ func Templates() ([]Template, error) {
 			Name:     strings.TrimSuffix(strings.TrimPrefix(p, templatesDir+"/"), ".yaml"),
 			Location: p,
 		}
+		if b, err := os.ReadFile(p); err == nil {
+			x.Description = description(b)
+		}
 		res = append(res, x)
 		return nil
 	}
@@ -58,3 +65,31 @@ func Templates() ([]Template, error) {
 	}
 	return res, nil
 }
+
+// description returns the description of the template, from the top-level `description:` field,
+// or from the `# description:` comment in the header comments that precede the YAML content.
+func description(b []byte) string {
+	var y struct {
+		Description string `yaml:"description"`
+	}
+	if err := yaml.Unmarshal(b, &y); err == nil && y.Description != "" {
+		return strings.TrimSpace(y.Description)
+	}
+	const prefix = "description:"
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line == "---" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			// the comments in the YAML content, such as the commented examples, are not the description
+			break
+		}
+		comment := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		if strings.HasPrefix(strings.ToLower(comment), prefix) {
+			return strings.TrimSpace(comment[len(prefix):])
+		}
+	}
+	return ""
+}
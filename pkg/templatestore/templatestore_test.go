@@ -0,0 +1,16 @@
+package templatestore
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDescription(t *testing.T) {
+	assert.Equal(t, description([]byte("description: Docker\nimages: []\n")), "Docker")
+	assert.Equal(t, description([]byte("# A comment\n\n# Description: Podman (rootless)\nimages: []\n")), "Podman (rootless)")
+	assert.Equal(t, description([]byte("---\n# description: k3s\nimages: []\n")), "k3s")
+	// a commented example in the YAML content, as in templates/default.yaml
+	assert.Equal(t, description([]byte("images: []\nprovision:\n#   description: vim to be installed\n")), "")
+	assert.Equal(t, description([]byte("")), "")
+}
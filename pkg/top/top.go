@@ -0,0 +1,287 @@
+// Package top implements `limactl top`.
+package top
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/stats"
+	"github.com/lima-vm/lima/pkg/store"
+	"golang.org/x/term"
+)
+
+// Interval is the interval of refreshing the screen.
+const Interval = 2 * time.Second
+
+// Columns are the columns of the screen.
+var Columns = []string{"NAME", "CPU%", "RSS", "MEMORY", "ROOTFS", "PORTS"}
+
+// Row is the resource usage of a running instance.
+// The pointer fields are nil when the values are not available.
+type Row struct {
+	Name       string
+	CPUPercent *float64
+	// RSS is the resident set size of the VM process on the host.
+	RSS *int64
+	// Memory is the memory size of the guest, as reported by the memory balloon when it is enabled.
+	Memory int64
+	// RootFS is the usage of the root filesystem of the guest, in percent.
+	RootFS *float64
+	// Ports is the number of the TCP ports forwarded from the guest.
+	Ports *int
+}
+
+func newRow(inst *store.Instance, s *stats.Stats) Row {
+	row := Row{
+		Name:       inst.Name,
+		CPUPercent: s.CPUPercent,
+		RSS:        s.RSS,
+		Memory:     inst.Memory,
+	}
+	if s.Guest != nil {
+		if s.Guest.MemoryActual > 0 {
+			row.Memory = s.Guest.MemoryActual
+		}
+		for _, fs := range s.Guest.Filesystems {
+			if fs.MountPoint == "/" && fs.Total > 0 {
+				rootFS := float64(fs.Used) * 100 / float64(fs.Total)
+				row.RootFS = &rootFS
+			}
+		}
+		row.Ports = &s.Guest.ForwardedPorts
+	}
+	return row
+}
+
+func (r *Row) values() []string {
+	values := []string{r.Name, "-", "-", units.BytesSize(float64(r.Memory)), "-", "-"}
+	if r.CPUPercent != nil {
+		values[1] = fmt.Sprintf("%.1f", *r.CPUPercent)
+	}
+	if r.RSS != nil {
+		values[2] = units.BytesSize(float64(*r.RSS))
+	}
+	if r.RootFS != nil {
+		values[4] = fmt.Sprintf("%.0f%%", *r.RootFS)
+	}
+	if r.Ports != nil {
+		values[5] = fmt.Sprintf("%d", *r.Ports)
+	}
+	return values
+}
+
+// key returns the sort key of the column. ok is false when the value is not available.
+func (r *Row) key(column int) (key float64, ok bool) {
+	switch column {
+	case 1:
+		if r.CPUPercent != nil {
+			return *r.CPUPercent, true
+		}
+	case 2:
+		if r.RSS != nil {
+			return float64(*r.RSS), true
+		}
+	case 3:
+		return float64(r.Memory), true
+	case 4:
+		if r.RootFS != nil {
+			return *r.RootFS, true
+		}
+	case 5:
+		if r.Ports != nil {
+			return float64(*r.Ports), true
+		}
+	}
+	return 0, false
+}
+
+// Sort sorts the rows by the column.
+// NAME is sorted in ascending order, and the other columns are sorted in descending order, unless reverse is set.
+// The unavailable values are always sorted last.
+func Sort(rows []Row, column int, reverse bool) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		if column == 0 {
+			return (rows[i].Name < rows[j].Name) != reverse
+		}
+		ki, oki := rows[i].key(column)
+		kj, okj := rows[j].key(column)
+		if oki != okj {
+			return oki
+		}
+		if ki == kj {
+			return rows[i].Name < rows[j].Name
+		}
+		return (ki > kj) != reverse
+	})
+}
+
+// Collect returns the rows of the running instances.
+// The CPU usage is computed from the CPU time consumed since the previous call with the same sampler.
+func Collect(ctx context.Context, sampler *stats.CPUSampler) ([]Row, error) {
+	names, err := store.Instances()
+	if err != nil {
+		return nil, err
+	}
+	var insts []*store.Instance
+	for _, name := range names {
+		inst, err := store.Inspect(name)
+		if err != nil || inst.Status != store.StatusRunning {
+			continue
+		}
+		insts = append(insts, inst)
+	}
+	rows := make([]Row, len(insts))
+	for i, s := range stats.GetAll(ctx, insts, sampler) {
+		rows[i] = newRow(insts[i], s)
+	}
+	return rows, nil
+}
+
+// Print prints the rows as a table.
+// The header of the sort column is highlighted when highlight is set.
+func Print(w io.Writer, rows []Row, column int, highlight bool) error {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 4, 8, 4, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(Columns, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row.values(), "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	out := b.String()
+	if highlight {
+		// highlighted after the alignment, as tabwriter would count the escape sequences as visible
+		header, body, _ := strings.Cut(out, "\n")
+		header = strings.Replace(header, Columns[column], "\033[7m"+Columns[column]+"\033[0m", 1)
+		out = header + "\n" + body
+	}
+	_, err := io.WriteString(w, out)
+	return err
+}
+
+// Run shows the screen, refreshing every Interval, until "q" is pressed.
+// When stdout is not a terminal, Run prints the rows once and returns.
+func Run(ctx context.Context, stdin, stdout *os.File) error {
+	column := 1 // CPU%
+	sampler := stats.NewCPUSampler()
+	if !term.IsTerminal(int(stdout.Fd())) || !term.IsTerminal(int(stdin.Fd())) {
+		rows, err := Collect(ctx, sampler)
+		if err != nil {
+			return err
+		}
+		Sort(rows, column, false)
+		return Print(stdout, rows, column, false)
+	}
+
+	fd := int(stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = term.Restore(fd, oldState) }()
+	// switch to the alternate screen, and hide the cursor
+	fmt.Fprint(stdout, "\033[?1049h\033[?25l")
+	defer fmt.Fprint(stdout, "\033[?25h\033[?1049l")
+
+	keyCh := make(chan byte)
+	go readKeys(stdin, keyCh)
+
+	type result struct {
+		rows []Row
+		err  error
+	}
+	resultCh := make(chan result, 1)
+	collect := func(delay time.Duration) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		rows, err := Collect(ctx, sampler)
+		resultCh <- result{rows, err}
+	}
+	go collect(0)
+
+	var (
+		rows    []Row
+		reverse bool
+		status  = "Loading..."
+	)
+	for {
+		Sort(rows, column, reverse)
+		var b bytes.Buffer
+		b.WriteString("\033[H\033[2J")
+		if err := Print(&b, rows, column, true); err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "\n%s\n", status)
+		// the terminal is in the raw mode
+		_, _ = stdout.WriteString(strings.ReplaceAll(b.String(), "\n", "\r\n"))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case r := <-resultCh:
+			rows = r.rows
+			status = "Sort: < > or 1-6 to select the column, r to reverse, q to quit"
+			if r.err != nil {
+				status = "Error: " + r.err.Error()
+			}
+			go collect(Interval)
+		case k, ok := <-keyCh:
+			if !ok {
+				return nil
+			}
+			switch k {
+			case 'q', 'Q', 0x03 /* Ctrl-C */, 0x04 /* Ctrl-D */ :
+				return nil
+			case '<', 'h':
+				column = (column + len(Columns) - 1) % len(Columns)
+			case '>', 'l':
+				column = (column + 1) % len(Columns)
+			case 'r':
+				reverse = !reverse
+			default:
+				if k >= '1' && int(k-'1') < len(Columns) {
+					column = int(k - '1')
+				}
+			}
+		}
+	}
+}
+
+// readKeys sends the pressed keys to keyCh.
+// The left and right arrow keys are translated to '<' and '>'.
+func readKeys(r io.Reader, keyCh chan<- byte) {
+	defer close(keyCh)
+	buf := make([]byte, 16)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		b := buf[:n]
+		for len(b) > 0 {
+			switch {
+			case bytes.HasPrefix(b, []byte("\033[D")):
+				keyCh <- '<'
+				b = b[3:]
+			case bytes.HasPrefix(b, []byte("\033[C")):
+				keyCh <- '>'
+				b = b[3:]
+			default:
+				keyCh <- b[0]
+				b = b[1:]
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package top
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/ptr"
+	"gotest.tools/v3/assert"
+)
+
+func names(rows []Row) []string {
+	var res []string
+	for _, r := range rows {
+		res = append(res, r.Name)
+	}
+	return res
+}
+
+func TestSort(t *testing.T) {
+	rows := []Row{
+		{Name: "b", CPUPercent: ptr.Of(10.0), Memory: 4 << 30},
+		{Name: "c", Memory: 2 << 30},
+		{Name: "a", CPUPercent: ptr.Of(50.0), Memory: 8 << 30},
+	}
+	Sort(rows, 0, false)
+	assert.DeepEqual(t, []string{"a", "b", "c"}, names(rows))
+	Sort(rows, 1, false)
+	assert.DeepEqual(t, []string{"a", "b", "c"}, names(rows))
+	// the unavailable values are sorted last even when reversed
+	Sort(rows, 1, true)
+	assert.DeepEqual(t, []string{"b", "a", "c"}, names(rows))
+	Sort(rows, 3, true)
+	assert.DeepEqual(t, []string{"c", "b", "a"}, names(rows))
+}
+
+func TestPrint(t *testing.T) {
+	rows := []Row{{Name: "default", CPUPercent: ptr.Of(1.5), Memory: 4 << 30, Ports: ptr.Of(2)}}
+	var b bytes.Buffer
+	assert.NilError(t, Print(&b, rows, 1, false))
+	assert.Equal(t, `NAME       CPU%    RSS    MEMORY    ROOTFS    PORTS
+default    1.5     -      4GiB      -         2
+`, b.String())
+
+	b.Reset()
+	assert.NilError(t, Print(&b, rows, 1, true))
+	assert.Assert(t, strings.HasPrefix(b.String(), "NAME       \033[7mCPU%\033[0m    RSS    MEMORY    ROOTFS    PORTS\n"))
+}
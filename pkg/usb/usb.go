@@ -0,0 +1,42 @@
+package usb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/driverutil"
+	"github.com/lima-vm/lima/pkg/store"
+)
+
+// Attach attaches `usbDevices[index]` to the running instance.
+func Attach(ctx context.Context, inst *store.Instance, index int) error {
+	limaDriver, err := newDriver(inst)
+	if err != nil {
+		return err
+	}
+	return limaDriver.AttachUSBDevice(ctx, index)
+}
+
+// Detach detaches `usbDevices[index]` from the running instance.
+func Detach(ctx context.Context, inst *store.Instance, index int) error {
+	limaDriver, err := newDriver(inst)
+	if err != nil {
+		return err
+	}
+	return limaDriver.DetachUSBDevice(ctx, index)
+}
+
+func newDriver(inst *store.Instance) (driver.Driver, error) {
+	if inst.Status != store.StatusRunning {
+		return nil, fmt.Errorf("expected status %q, got %q", store.StatusRunning, inst.Status)
+	}
+	y, err := inst.LoadYAML()
+	if err != nil {
+		return nil, err
+	}
+	return driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
+		Instance: inst,
+		Yaml:     y,
+	}), nil
+}
@@ -42,6 +42,9 @@ func EnsureDisk(ctx context.Context, driver *driver.BaseDriver) error {
 	if diskSize == 0 {
 		return nil
 	}
+	if err := fileutils.EnsureDecompressedBaseDisk(ctx, baseDisk, diskSize); err != nil {
+		return err
+	}
 	isBaseDiskISO, err := iso9660util.IsISO9660(baseDisk)
 	if err != nil {
 		return err
@@ -418,7 +418,8 @@ func attachDisks(driver *driver.BaseDriver, vmConfig *vz.VirtualMachineConfigura
 	diffDiskPath := filepath.Join(driver.Instance.Dir, filenames.DiffDisk)
 	ciDataPath := filepath.Join(driver.Instance.Dir, filenames.CIDataISO)
 	isBaseDiskCDROM, err := iso9660util.IsISO9660(baseDiskPath)
-	if err != nil {
+	// The base disk is missing for an instance imported by `limactl import`
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 	var configurations []vz.StorageDeviceConfiguration
@@ -526,7 +527,7 @@ func attachDisplay(driver *driver.BaseDriver, vmConfig *vz.VirtualMachineConfigu
 func attachFolderMounts(driver *driver.BaseDriver, vmConfig *vz.VirtualMachineConfiguration) error {
 	var mounts []vz.DirectorySharingDeviceConfiguration
 	if *driver.Yaml.MountType == limayaml.VIRTIOFS {
-		for i, mount := range driver.Yaml.Mounts {
+		for _, mount := range driver.Yaml.Mounts {
 			expandedPath, err := localpathutil.Expand(mount.Location)
 			if err != nil {
 				return err
@@ -547,7 +548,7 @@ func attachFolderMounts(driver *driver.BaseDriver, vmConfig *vz.VirtualMachineCo
 				return err
 			}
 
-			tag := fmt.Sprintf("mount%d", i)
+			tag := mount.Tag
 			config, err := vz.NewVirtioFileSystemDeviceConfiguration(tag)
 			if err != nil {
 				return err
@@ -591,14 +592,16 @@ func attachAudio(driver *driver.BaseDriver, config *vz.VirtualMachineConfigurati
 	return nil
 }
 
-func attachOtherDevices(_ *driver.BaseDriver, vmConfig *vz.VirtualMachineConfiguration) error {
-	entropyConfig, err := vz.NewVirtioEntropyDeviceConfiguration()
-	if err != nil {
-		return err
+func attachOtherDevices(driver *driver.BaseDriver, vmConfig *vz.VirtualMachineConfiguration) error {
+	if *driver.Yaml.RNG.Enabled {
+		entropyConfig, err := vz.NewVirtioEntropyDeviceConfiguration()
+		if err != nil {
+			return err
+		}
+		vmConfig.SetEntropyDevicesVirtualMachineConfiguration([]*vz.VirtioEntropyDeviceConfiguration{
+			entropyConfig,
+		})
 	}
-	vmConfig.SetEntropyDevicesVirtualMachineConfiguration([]*vz.VirtioEntropyDeviceConfiguration{
-		entropyConfig,
-	})
 
 	configuration, err := vz.NewVirtioTraditionalMemoryBalloonDeviceConfiguration()
 	if err != nil {
@@ -23,19 +23,25 @@ var knownYamlProperties = []string{
 	"AdditionalDisks",
 	"Arch",
 	"Audio",
+	"AutoSnapshot",
+	"Boot",
 	"CACertificates",
 	"Containerd",
 	"CopyToHost",
 	"CPUs",
 	"CPUType",
 	"Disk",
+	"DiskFormat",
+	"DiskOptions",
 	"DNS",
 	"Env",
 	"Firmware",
+	"GuestAgent",
 	"GuestInstallPrefix",
 	"HostResolver",
 	"Images",
 	"Memory",
+	"MemoryBalloon",
 	"Message",
 	"Mounts",
 	"MountType",
@@ -43,13 +49,19 @@ var knownYamlProperties = []string{
 	"Networks",
 	"OS",
 	"Plain",
+	"PortForwardOptions",
 	"PortForwards",
 	"Probes",
 	"PropagateProxyEnv",
 	"Provision",
+	"QEMU",
+	"RNG",
 	"Rosetta",
+	"Shell",
+	"Shutdown",
 	"SSH",
 	"TimeZone",
+	"TPM",
 	"UpgradePackages",
 	"Video",
 	"VMType",
@@ -69,18 +81,32 @@ func New(driver *driver.BaseDriver) *LimaVzDriver {
 	}
 }
 
+// ValidateMountType returns an error if `mountType` is not supported by the VZ driver.
+func ValidateMountType(y *limayaml.LimaYAML) error {
+	if *y.MountType == limayaml.NINEP {
+		return fmt.Errorf("field `mountType` must be %q or %q for VZ driver , got %q", limayaml.REVSSHFS, limayaml.VIRTIOFS, *y.MountType)
+	}
+	return nil
+}
+
 func (l *LimaVzDriver) Validate() error {
 	// Calling NewEFIBootLoader to do required version check for latest APIs
 	_, err := vz.NewEFIBootLoader()
 	if errors.Is(err, vz.ErrUnsupportedOSVersion) {
 		return fmt.Errorf("VZ driver requires macOS 13 or higher to run")
 	}
-	if *l.Yaml.MountType == limayaml.NINEP {
-		return fmt.Errorf("field `mountType` must be %q or %q for VZ driver , got %q", limayaml.REVSSHFS, limayaml.VIRTIOFS, *l.Yaml.MountType)
+	if err := ValidateMountType(l.Yaml); err != nil {
+		return err
+	}
+	if len(l.Yaml.USBDevices) > 0 {
+		return fmt.Errorf("`usbDevices` configuration is not supported for VZ driver")
 	}
 	if *l.Yaml.Firmware.LegacyBIOS {
 		return fmt.Errorf("`firmware.legacyBIOS` configuration is not supported for VZ driver")
 	}
+	if l.Yaml.DiskOptions.Ephemeral != nil && *l.Yaml.DiskOptions.Ephemeral {
+		return fmt.Errorf("`diskOptions.ephemeral` configuration is not supported for VZ driver")
+	}
 	for _, f := range l.Yaml.Firmware.Images {
 		switch f.VMType {
 		case "", limayaml.VZ:
@@ -97,6 +123,36 @@ func (l *LimaVzDriver) Validate() error {
 		return fmt.Errorf("unsupported arch: %q", *l.Yaml.Arch)
 	}
 
+	if l.Yaml.MemoryBalloon.Enabled != nil && *l.Yaml.MemoryBalloon.Enabled {
+		logrus.Warnf("vmType %s: ignoring memoryBalloon.enabled", *l.Yaml.VMType)
+	}
+
+	if l.Yaml.TPM.Enabled != nil && *l.Yaml.TPM.Enabled {
+		logrus.Warnf("vmType %s: ignoring tpm.enabled", *l.Yaml.VMType)
+	}
+
+	if l.Yaml.Video.VRAM != nil && *l.Yaml.Video.VRAM != "" {
+		logrus.Warnf("vmType %s: ignoring video.vram", *l.Yaml.VMType)
+	}
+
+	if o := l.Yaml.DiskOptions; (o.CacheMode != nil && *o.CacheMode != "") || (o.AIO != nil && *o.AIO != "") || (o.Discard != nil && *o.Discard) {
+		logrus.Warnf("vmType %s: ignoring diskOptions", *l.Yaml.VMType)
+	}
+	if t := l.Yaml.DiskOptions.Throttle; t.IOPS != nil && (*t.IOPS != 0 || *t.ReadIOPS != 0 || *t.WriteIOPS != 0 ||
+		*t.BPS != "0" || *t.ReadBPS != "0" || *t.WriteBPS != "0") {
+		logrus.Warnf("vmType %s: ignoring diskOptions.throttle", *l.Yaml.VMType)
+	}
+
+	if l.Yaml.QEMU.Binary != nil && *l.Yaml.QEMU.Binary != "" {
+		logrus.Warnf("vmType %s: ignoring qemu.binary", *l.Yaml.VMType)
+	}
+	if l.Yaml.QEMU.Machine != nil && *l.Yaml.QEMU.Machine != "" {
+		logrus.Warnf("vmType %s: ignoring qemu.machine", *l.Yaml.VMType)
+	}
+	if l.Yaml.QEMU.GuestAgent != nil && *l.Yaml.QEMU.GuestAgent {
+		logrus.Warnf("vmType %s: ignoring qemu.guestAgent", *l.Yaml.VMType)
+	}
+
 	for k, v := range l.Yaml.CPUType {
 		if v != "" {
 			logrus.Warnf("vmType %s: ignoring cpuType[%q]: %q", *l.Yaml.VMType, k, v)
@@ -115,6 +171,7 @@ func (l *LimaVzDriver) Validate() error {
 			"Writable",
 			"SSHFS",
 			"NineP",
+			"Tag",
 		); len(unknown) > 0 {
 			logrus.Warnf("vmType %s: ignoring mounts[%d]: %+v", *l.Yaml.VMType, i, unknown)
 		}
@@ -141,6 +198,9 @@ func (l *LimaVzDriver) Validate() error {
 	default:
 		logrus.Warnf("field `video.display` must be \"vz\", \"default\", or \"none\" for VZ driver , got %q", videoDisplay)
 	}
+	if l.Yaml.Video.Accel != nil && *l.Yaml.Video.Accel != "" {
+		logrus.Warnf("vmType %s: ignoring video.accel", *l.Yaml.VMType)
+	}
 	return nil
 }
 
@@ -184,33 +244,52 @@ func (l *LimaVzDriver) RunGUI() error {
 }
 
 func (l *LimaVzDriver) Stop(_ context.Context) error {
+	timeout := l.ShutdownTimeout()
+	if timeout == 0 {
+		logrus.Info("The shutdown timeout is 0, forcibly stopping VZ")
+		return l.forceStop()
+	}
 	logrus.Info("Shutting down VZ")
-	canStop := l.machine.CanRequestStop()
-
-	if canStop {
-		_, err := l.machine.RequestStop()
-		if err != nil {
-			return err
-		}
+	if !l.machine.CanRequestStop() {
+		return errors.New("vz: CanRequestStop is not supported")
+	}
+	if _, err := l.machine.RequestStop(); err != nil {
+		return err
+	}
 
-		timeout := time.After(5 * time.Second)
-		ticker := time.NewTicker(500 * time.Millisecond)
-		for {
-			select {
-			case <-timeout:
-				return errors.New("vz timeout while waiting for stop status")
-			case <-ticker.C:
-				l.machine.mu.Lock()
-				stopped := l.machine.stopped
-				l.machine.mu.Unlock()
-				if stopped {
-					return nil
-				}
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-deadline:
+			logrus.Warnf("vz did not stop in %v, forcibly stopping", timeout)
+			return l.forceStop()
+		case <-ticker.C:
+			l.machine.mu.Lock()
+			stopped := l.machine.stopped
+			l.machine.mu.Unlock()
+			if stopped {
+				return nil
 			}
 		}
 	}
+}
+
+// forceStop stops the VM without giving the guest a chance to shut down.
+func (l *LimaVzDriver) forceStop() error {
+	if !l.machine.CanStop() {
+		return errors.New("vz: CanStop is not supported")
+	}
+	return l.machine.Stop()
+}
+
+func (l *LimaVzDriver) SetMemoryTarget(_ context.Context, _ int64) error {
+	return errors.New("vmType vz: memory ballooning is not supported")
+}
 
-	return errors.New("vz: CanRequestStop is not supported")
+func (l *LimaVzDriver) SupportsVSock() bool {
+	return true
 }
 
 func (l *LimaVzDriver) GuestAgentConn(_ context.Context) (net.Conn, error) {
@@ -220,5 +299,5 @@ func (l *LimaVzDriver) GuestAgentConn(_ context.Context) (net.Conn, error) {
 			return connect, nil
 		}
 	}
-	return nil, fmt.Errorf("unable to connect to guest agent via vsock port 2222")
+	return nil, fmt.Errorf("unable to connect to guest agent via vsock port %d", l.VSockPort)
 }
@@ -7,6 +7,7 @@ import (
 	"errors"
 
 	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/limayaml"
 )
 
 var ErrUnsupported = errors.New("vm driver 'vz' needs macOS 13 or later (Hint: try recompiling Lima if you are seeing this error on macOS 13)")
@@ -27,6 +28,10 @@ func (l *LimaVzDriver) Validate() error {
 	return ErrUnsupported
 }
 
+func ValidateMountType(_ *limayaml.LimaYAML) error {
+	return ErrUnsupported
+}
+
 func (l *LimaVzDriver) CreateDisk(_ context.Context) error {
 	return ErrUnsupported
 }
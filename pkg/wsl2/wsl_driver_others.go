@@ -7,6 +7,7 @@ import (
 	"errors"
 
 	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/limayaml"
 )
 
 var ErrUnsupported = errors.New("vm driver 'wsl2' requires Windows 10 build 19041 or later (Hint: try recompiling Lima if you are seeing this error on Windows 10+)")
@@ -27,6 +28,10 @@ func (l *LimaWslDriver) Validate() error {
 	return ErrUnsupported
 }
 
+func ValidateMountType(_ *limayaml.LimaYAML) error {
+	return ErrUnsupported
+}
+
 func (l *LimaWslDriver) CreateDisk(_ context.Context) error {
 	return ErrUnsupported
 }
@@ -18,6 +18,7 @@ import (
 
 var knownYamlProperties = []string{
 	"Arch",
+	"Boot",
 	"Containerd",
 	"CopyToHost",
 	"CPUType",
@@ -50,9 +51,17 @@ func New(driver *driver.BaseDriver) *LimaWslDriver {
 	}
 }
 
+// ValidateMountType returns an error if `mountType` is not supported by the WSL2 driver.
+func ValidateMountType(y *limayaml.LimaYAML) error {
+	if *y.MountType != limayaml.WSLMount {
+		return fmt.Errorf("field `mountType` must be %q for WSL2 driver, got %q", limayaml.WSLMount, *y.MountType)
+	}
+	return nil
+}
+
 func (l *LimaWslDriver) Validate() error {
-	if *l.Yaml.MountType != limayaml.WSLMount {
-		return fmt.Errorf("field `mountType` must be %q for WSL2 driver, got %q", limayaml.WSLMount, *l.Yaml.MountType)
+	if err := ValidateMountType(l.Yaml); err != nil {
+		return err
 	}
 	// TODO: revise this list for WSL2
 	if unknown := reflectutil.UnknownNonEmptyFields(l.Yaml, knownYamlProperties...); len(unknown) > 0 {
@@ -172,6 +181,10 @@ func (l *LimaWslDriver) Unregister(ctx context.Context) error {
 	return nil
 }
 
+func (l *LimaWslDriver) SupportsVSock() bool {
+	return true
+}
+
 // GuestAgentConn returns the guest agent connection, or nil (if forwarded by ssh).
 // As of 08-01-2024, github.com/mdlayher/vsock does not natively support vsock on
 // Windows, so use the winio library to create the connection.